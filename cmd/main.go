@@ -2,10 +2,15 @@ package main
 
 import (
 	"fmt"
+	"go-multi-tenancy/internals/core/ports"
 	"go-multi-tenancy/internals/core/services"
+	"go-multi-tenancy/internals/federation"
 	"go-multi-tenancy/internals/handlers"
+	"go-multi-tenancy/internals/mailer"
 	"go-multi-tenancy/internals/repositories"
 	"go-multi-tenancy/internals/server"
+	"go-multi-tenancy/internals/utils"
+	"log"
 	"strings"
 	"time"
 
@@ -16,17 +21,94 @@ import (
 
 func main() {
 	initConfig()
+	initKeys()
 	db := initDatabase()
 
+	passwordHasher := initPasswordHasher()
+
 	companyRepository := repositories.NewCompanyRepository(db)
-	companyService := services.NewCompanyService(companyRepository)
-	companyHandler := handlers.NewCompanyHandler(companyService)
+
+	policyRepository := repositories.NewPolicyRepository(db)
+	policyService := services.NewPolicyService(policyRepository)
+	policyHandler := handlers.NewPolicyHandler(policyService)
+
+	loginAttemptRepository := repositories.NewLoginAttemptRepository(db)
+	loginThrottle := services.NewLoginThrottle(loginAttemptRepository, services.LoginThrottleConfig{
+		MaxAttempts:   viper.GetInt("login.max_attempts"),
+		IPMaxAttempts: viper.GetInt("login.ip_max_attempts"),
+		FreeAttempts:  viper.GetInt("login.free_attempts"),
+		BackoffBase:   viper.GetDuration("login.backoff_base"),
+		BackoffMax:    viper.GetDuration("login.backoff_max"),
+		Lockout:       viper.GetDuration("login.lockout"),
+		Window:        viper.GetDuration("login.window"),
+	})
+
+	actionTokenRepository := repositories.NewActionTokenRepository(db)
+
+	mfaRepository := repositories.NewMFARepository(db)
+	mfaService := services.NewMFAService(mfaRepository, policyRepository, companyRepository, actionTokenRepository, loginThrottle, viper.GetString("mfa.issuer"), viper.GetInt("mfa.max_failures"))
+
+	passwordPolicy := services.NewPasswordPolicy(policyRepository, companyRepository, passwordHasher, initBreachList())
+
+	networkRepository := repositories.NewNetworkRepository(db)
+	networkService := services.NewNetworkPolicyService(networkRepository, viper.GetDuration("network.cache_ttl"), viper.GetBool("network.super_admin_bypass"))
+	networkHandler := handlers.NewNetworkPolicyHandler(networkService)
 
 	manageRepository := repositories.NewManageRepository(db)
-	manageService := services.NewManageService(manageRepository)
+	tenantStatusService := services.NewTenantStatusService(manageRepository, viper.GetDuration("tenant.cache_ttl"))
+	tenantHandler := handlers.NewTenantHandler(tenantStatusService)
+
+	companyService := services.NewCompanyService(companyRepository, policyRepository, passwordHasher, mfaService, loginThrottle, passwordPolicy, networkService, tenantStatusService)
+
+	roleRepository := repositories.NewRoleRepository(db)
+	roleService := services.NewRoleService(roleRepository, companyRepository)
+	roleHandler := handlers.NewRoleHandler(roleService)
+
+	tokenRepository := repositories.NewTokenRepository(db)
+	tokenService := services.NewTokenService(tokenRepository, companyRepository, roleService, tenantStatusService, viper.GetDuration("jwt.access_ttl"), viper.GetDuration("jwt.refresh_ttl"))
+
+	mailSender := initMailer()
+	accountService := services.NewAccountService(companyRepository, actionTokenRepository, tokenService, passwordHasher, passwordPolicy, tenantStatusService, mailSender, viper.GetString("app.base_url"), viper.GetDuration("account.reset_ttl"), viper.GetDuration("account.verification_ttl"))
+	accountHandler := handlers.NewAccountHandler(accountService)
+
+	bootstrapService := services.NewBootstrapService(manageRepository, passwordHasher, passwordPolicy, initBootstrapToken(companyRepository))
+	bootstrapHandler := handlers.NewBootstrapHandler(bootstrapService)
+
+	companyHandler := handlers.NewCompanyHandler(companyService, tokenService, accountService)
+	mfaHandler := handlers.NewMFAHandler(mfaService, tokenService)
+
+	manageService := services.NewManageService(manageRepository, viper.GetDuration("archive.retention"))
+	manageService.WatchArchives(viper.GetDuration("archive.purge_interval"))
 	manageHandler := handlers.NewManageHandler(manageService)
 
-	httpServer := server.NewServer(companyHandler, manageHandler)
+	apiKeyRepository := repositories.NewAPIKeyRepository(db)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepository)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+
+	oidcRepository := repositories.NewOIDCRepository(db)
+	oidcService := services.NewOIDCService(oidcRepository, companyRepository, tokenService, viper.GetString("oidc.issuer"), viper.GetDuration("oidc.id_token_ttl"))
+	oidcHandler := handlers.NewOIDCHandler(oidcService, viper.GetString("oidc.login_url"))
+
+	federationRepository := repositories.NewFederationRepository(db)
+	federationService := services.NewFederationService(federationRepository, companyRepository, mfaService, tenantStatusService, federation.NewOIDCClient(viper.GetDuration("sso.http_timeout")))
+	federationHandler := handlers.NewFederationHandler(federationService, tokenService)
+
+	scimService := services.NewSCIMService(companyRepository, roleRepository, tokenService, passwordHasher, passwordPolicy, viper.GetString("scim.base_url"))
+	scimHandler := handlers.NewSCIMHandler(scimService)
+
+	auditRepository := repositories.NewAuditRepository(db)
+	impersonationService := services.NewImpersonationService(companyRepository, auditRepository, tokenService, viper.GetDuration("impersonation.ttl"))
+	impersonationHandler := handlers.NewImpersonationHandler(impersonationService)
+
+	sessionHandler := handlers.NewSessionHandler(tokenService)
+
+	invitationRepository := repositories.NewInvitationRepository(db)
+	invitationService := services.NewInvitationService(invitationRepository, companyRepository, passwordHasher, passwordPolicy, tenantStatusService, mailSender, viper.GetString("app.base_url"), viper.GetDuration("invitation.ttl"))
+	invitationHandler := handlers.NewInvitationHandler(invitationService)
+
+	wellKnownHandler := handlers.NewWellKnownHandler(viper.GetString("oidc.issuer"))
+
+	httpServer := server.NewServer(companyHandler, manageHandler, mfaHandler, accountHandler, policyHandler, roleHandler, apiKeyHandler, oidcHandler, federationHandler, scimHandler, impersonationHandler, sessionHandler, networkHandler, invitationHandler, bootstrapHandler, tenantHandler, wellKnownHandler, tokenService, apiKeyService, networkService, tenantStatusService)
 
 	httpServer.Initialize()
 }
@@ -51,6 +133,82 @@ func initDatabase() *sqlx.DB {
 	return db
 }
 
+func initMailer() ports.Mailer {
+	if viper.GetString("mail.driver") == "smtp" {
+		return mailer.NewSMTPMailer(
+			viper.GetString("mail.smtp.host"),
+			viper.GetInt("mail.smtp.port"),
+			viper.GetString("mail.smtp.username"),
+			viper.GetString("mail.smtp.password"),
+			viper.GetString("mail.from"),
+		)
+	}
+
+	return mailer.NewLogMailer(viper.GetString("mail.log_path"))
+}
+
+func initPasswordHasher() *utils.PasswordHasher {
+	hasher, err := utils.NewPasswordHasher(
+		viper.GetString("password.algorithm"),
+		utils.Argon2Params{
+			Memory:      viper.GetUint32("password.argon2.memory"),
+			Iterations:  viper.GetUint32("password.argon2.iterations"),
+			Parallelism: uint8(viper.GetUint("password.argon2.parallelism")),
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+		viper.GetInt("password.bcrypt_cost"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return hasher
+}
+
+func initBreachList() *utils.BreachList {
+	list, err := utils.LoadBreachList(viper.GetString("password.breach_list"))
+	if err != nil {
+		panic(err)
+	}
+
+	return list
+}
+
+// initBootstrapToken returns the token that may create the first super
+// admin, or "" once one exists. Without a configured token a random one is
+// generated and printed, valid until this process exits.
+func initBootstrapToken(companyRepository ports.CompanyRepository) string {
+	exists, err := companyRepository.HasSuperAdmin()
+	if err != nil {
+		panic(err)
+	}
+
+	if exists {
+		return ""
+	}
+
+	token := viper.GetString("bootstrap.token")
+	if token == "" {
+		token, err = utils.GenerateRandomToken(32)
+		if err != nil {
+			panic(err)
+		}
+		log.Println("no super admin yet, create one with POST /api/v1/company/bootstrap and token:", token)
+	}
+
+	return token
+}
+
+func initKeys() {
+	err := utils.InitKeys()
+	if err != nil {
+		panic(err)
+	}
+
+	utils.WatchKeys(viper.GetDuration("jwt.reload_interval"))
+}
+
 func initConfig() {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -58,6 +216,43 @@ func initConfig() {
 	viper.AutomaticEnv()
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 
+	viper.SetDefault("jwt.access_ttl", 15*time.Minute)
+	viper.SetDefault("jwt.refresh_ttl", 7*24*time.Hour)
+	viper.SetDefault("app.base_url", "http://localhost:8080")
+	viper.SetDefault("account.reset_ttl", time.Hour)
+	viper.SetDefault("account.verification_ttl", 48*time.Hour)
+	viper.SetDefault("invitation.ttl", 7*24*time.Hour)
+	viper.SetDefault("bootstrap.token", "")
+	viper.SetDefault("mail.driver", "log")
+	viper.SetDefault("login.max_attempts", 10)
+	viper.SetDefault("login.ip_max_attempts", 100)
+	viper.SetDefault("login.free_attempts", 3)
+	viper.SetDefault("login.backoff_base", time.Second)
+	viper.SetDefault("login.backoff_max", time.Minute)
+	viper.SetDefault("login.lockout", 15*time.Minute)
+	viper.SetDefault("login.window", time.Hour)
+	viper.SetDefault("mfa.issuer", "OneSystem")
+	viper.SetDefault("mfa.max_failures", 5)
+	viper.SetDefault("oidc.issuer", "http://localhost:8080")
+	viper.SetDefault("oidc.login_url", "http://localhost:8080/login")
+	viper.SetDefault("oidc.id_token_ttl", time.Hour)
+	viper.SetDefault("sso.http_timeout", 10*time.Second)
+	viper.SetDefault("scim.base_url", "http://localhost:8080")
+	viper.SetDefault("impersonation.ttl", 30*time.Minute)
+	viper.SetDefault("network.cache_ttl", 30*time.Second)
+	viper.SetDefault("network.super_admin_bypass", true)
+	viper.SetDefault("tenant.cache_ttl", 30*time.Second)
+	viper.SetDefault("archive.retention", 30*24*time.Hour)
+	viper.SetDefault("archive.purge_interval", time.Hour)
+	viper.SetDefault("password.algorithm", utils.PasswordArgon2id)
+	viper.SetDefault("password.argon2.memory", 64*1024)
+	viper.SetDefault("password.argon2.iterations", 3)
+	viper.SetDefault("password.argon2.parallelism", 2)
+	viper.SetDefault("password.bcrypt_cost", 12)
+	viper.SetDefault("password.breach_list", "")
+	viper.SetDefault("jwt.overlap", 15*time.Minute)
+	viper.SetDefault("jwt.reload_interval", time.Hour)
+
 	err := viper.ReadInConfig()
 	if err != nil {
 		panic(err)
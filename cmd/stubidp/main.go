@@ -0,0 +1,42 @@
+// Command stubidp is a minimal OpenID Connect identity provider for trying
+// out and testing federated login locally. It approves every authorization
+// request without asking anything and signs ID tokens with a throwaway key.
+//
+// The identity it reports comes from the flags, and can be overridden per
+// request with the sub, username, email, branch and role query parameters
+// of the authorization request.
+package main
+
+import (
+	"flag"
+	"go-multi-tenancy/internals/federation/stubidp"
+	"log"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL, must match how clients reach the stub")
+	clientID := flag.String("client-id", "stub-client", "accepted client id")
+	clientSecret := flag.String("client-secret", "stub-secret", "accepted client secret, empty for a public client")
+	sub := flag.String("sub", "stub-user", "default subject")
+	username := flag.String("username", "stub.user", "default preferred_username")
+	email := flag.String("email", "stub.user@example.com", "default email")
+	branch := flag.String("branch", "", "default branch claim")
+	role := flag.String("role", "", "default role claim")
+	flag.Parse()
+
+	provider, err := stubidp.New(*issuer, *clientID, *clientSecret, map[string]string{
+		"sub":      *sub,
+		"username": *username,
+		"email":    *email,
+		"branch":   *branch,
+		"role":     *role,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("stub identity provider %s listening on %s", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, provider))
+}
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+)
+
+type ActionToken struct {
+	ID        uuid.UUID  `json:"id"`
+	Purpose   string     `json:"purpose"`
+	UserID    uuid.UUID  `json:"user_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreateAt  time.Time  `json:"create_at"`
+}
+
+type ForgotPasswordInput struct {
+	Company  string `json:"company"`
+	Branch   string `json:"branch"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailInput struct {
+	Token string `json:"token"`
+}
+
+var (
+	ErrInvalidActionToken = errors.New("invalid or expired token")
+	ErrEmailMissing       = errors.New("no email address on this account")
+)
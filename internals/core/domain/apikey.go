@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKeyPrefix starts every API key so leaked keys are easy to recognise.
+const APIKeyPrefix = "mt"
+
+// APIKey lets an integration call the API without a user. Keys with an empty
+// branch act for the whole company.
+type APIKey struct {
+	ID          uuid.UUID  `json:"id"`
+	Company     string     `json:"company"`
+	Branch      string     `json:"branch"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	KeyHash     string     `json:"-"`
+	Permissions []string   `json:"permissions"`
+	CreatedBy   uuid.UUID  `json:"created_by"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreateAt    time.Time  `json:"create_at"`
+}
+
+type APIKeyInput struct {
+	Name        string   `json:"name"`
+	Branch      string   `json:"branch"`
+	Permissions []string `json:"permissions"`
+	ExpiresIn   int      `json:"expires_in"` // seconds, 0 never expires
+}
+
+// APIKeyCreated carries the plain key, which is only ever shown once.
+type APIKeyCreated struct {
+	*APIKey
+	Key string `json:"key"`
+}
+
+var ErrInvalidAPIKey = errors.New("invalid API key")
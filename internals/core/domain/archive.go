@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Archive is a deleted company or branch whose partition was detached and
+// parked in the company_archive schema until PurgeAfter.
+type Archive struct {
+	ID            uuid.UUID `json:"id"`
+	Company       string    `json:"company"`
+	Branch        string    `json:"branch,omitempty"`
+	TableName     string    `json:"-"` // the partition's name in the company schema
+	ArchivedTable string    `json:"-"` // its name in the company_archive schema
+	TenantID      uuid.UUID `json:"-"` // the partition list value, to attach it with again
+	BranchTables  []string  `json:"-"` // a company's branch partitions, archived as ArchivedTable_<index>
+	ArchivedAt    time.Time `json:"archived_at"`
+	PurgeAfter    time.Time `json:"purge_after"`
+}
+
+var (
+	ErrArchiveNotFound      = errors.New("archive not found")
+	ErrArchiveConflict      = errors.New("a company or branch with this name exists again, rename it before restoring")
+	ErrArchiveParentMissing = errors.New("the branch's company does not exist, restore the company first")
+	ErrArchiveLegacy        = errors.New("this archive predates tenant ids as partition keys and can only be purged")
+)
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+type LoginAttempt struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	LockedFor     int        `json:"-"` // seconds left until locked_until, computed by the database
+}
+
+type UnlockInput struct {
+	Company  string `json:"company"`
+	Branch   string `json:"branch"`
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+}
+
+// LockoutError is returned while an account or address has to wait before
+// the next login attempt.
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return "too many failed login attempts, try again later"
+}
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
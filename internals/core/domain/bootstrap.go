@@ -0,0 +1,22 @@
+package domain
+
+import "errors"
+
+// BootstrapInput creates the platform's first super admin. The company and
+// branch are created when they do not exist yet.
+type BootstrapInput struct {
+	Token     string `json:"token"`
+	Company   string `json:"company"`
+	Branch    string `json:"branch"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Password  string `json:"password"`
+	Email     string `json:"email"`
+}
+
+var (
+	ErrInvalidBootstrapToken = errors.New("invalid bootstrap token")
+	ErrAlreadyBootstrapped   = errors.New("a super admin already exists, bootstrapping is closed")
+	ErrAdminRole             = errors.New("role must be admin or head_admin and rank below your own")
+)
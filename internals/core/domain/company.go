@@ -18,6 +18,9 @@ type Data struct {
 	UpdateAt  *time.Time `json:"update_at"`
 	DeleteAt  *time.Time `json:"delete_at"`
 	Role      string     `json:"role"`
+	Email     string     `json:"email"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
 }
 
 func NewData(company string, branch string, id uuid.UUID, first_name string, last_name string, username string, password string, create_at time.Time, update_at time.Time, delete_at time.Time, role string) *Data {
@@ -43,6 +46,7 @@ type RegisterInput struct {
 	Branch    string `json:"branch"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
 }
 
 type LoginInput struct {
@@ -50,6 +54,7 @@ type LoginInput struct {
 	Password string `json:"password"`
 	Company  string `json:"company"`
 	Branch   string `json:"branch"`
+	IP       string `json:"-"`
 }
 
 type DataReply struct {
@@ -59,6 +64,7 @@ type DataReply struct {
 	Branch    string    `json:"branch"`
 	FirstName string    `json:"first_name"`
 	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -83,6 +89,8 @@ type DataDelete struct {
 	ID      uuid.UUID `json:"id"`
 }
 
+// Admin creates an admin or head_admin. Company and branch default to the
+// caller's.
 type Admin struct {
 	Company   string `json:"company"`
 	Branch    string `json:"branch"`
@@ -90,6 +98,8 @@ type Admin struct {
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Password  string `json:"password"`
+	Email     string `json:"email"`
+	Role      string `json:"role"` // admin or head_admin, admin when empty
 }
 
 type Me struct {
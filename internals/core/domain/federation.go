@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FederatedPassword is stored as the password of users provisioned from an
+// identity provider. It is not a valid hash, so no password ever matches it.
+const FederatedPassword = "!federated"
+
+// IdentityProvider is the upstream OpenID Connect issuer a company signs its
+// users in with.
+type IdentityProvider struct {
+	Company       string            `json:"company"`
+	Issuer        string            `json:"issuer"`
+	ClientID      string            `json:"client_id"`
+	ClientSecret  string            `json:"client_secret,omitempty"`
+	RedirectURI   string            `json:"redirect_uri"`
+	Scopes        string            `json:"scopes"`
+	BranchClaim   string            `json:"branch_claim"`
+	DefaultBranch string            `json:"default_branch"`
+	RoleClaim     string            `json:"role_claim"`
+	RoleMapping   map[string]string `json:"role_mapping"` // claim value to local role
+	DefaultRole   string            `json:"default_role"`
+	Enabled       bool              `json:"enabled"`
+	UpdateAt      *time.Time        `json:"update_at"`
+}
+
+// SSOState ties a callback to the login it started.
+type SSOState struct {
+	StateHash    string
+	Company      string
+	Nonce        string
+	CodeVerifier string
+}
+
+type SSOStartReply struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+type SSOCallbackInput struct {
+	Company string `json:"-"`
+	Code    string `json:"code"`
+	State   string `json:"state"`
+}
+
+// FederatedIdentity links a subject at an identity provider to a local user.
+type FederatedIdentity struct {
+	Company  string    `json:"company"`
+	Issuer   string    `json:"issuer"`
+	Subject  string    `json:"subject"`
+	UserID   uuid.UUID `json:"user_id"`
+	Branch   string    `json:"branch"`
+	CreateAt time.Time `json:"create_at"`
+}
+
+var (
+	ErrSSONotConfigured = errors.New("single sign-on is not configured for this company")
+	ErrSSOInvalidState  = errors.New("invalid or expired sign-on state")
+	ErrSSOFailed        = errors.New("sign-on with the identity provider failed")
+	ErrSSOAccountExists = errors.New("a local account with this username already exists")
+)
@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AuditImpersonationStart = "impersonation.start"
+	AuditImpersonationStop  = "impersonation.stop"
+)
+
+// Actor is the real identity behind an impersonation token, carried in its
+// act claim.
+type Actor struct {
+	UserID    uuid.UUID `json:"user_id"`
+	SessionID uuid.UUID `json:"session_id"`
+	Username  string    `json:"username"`
+	Company   string    `json:"company"`
+	Branch    string    `json:"branch"`
+	Role      string    `json:"role"`
+}
+
+type ImpersonationInput struct {
+	Company string    `json:"company"`
+	UserID  uuid.UUID `json:"user_id"`
+	Reason  string    `json:"reason"`
+	IP      string    `json:"-"`
+}
+
+type ImpersonationReply struct {
+	AccessToken string     `json:"access_token"`
+	TokenType   string     `json:"token_type"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	Target      *DataReply `json:"target"`
+}
+
+type ImpersonationStopInput struct {
+	SessionID uuid.UUID
+	UserID    uuid.UUID
+	Company   string
+	Branch    string
+	Actor     *Actor
+	IP        string
+}
+
+// AuditEvent is one row of the audit trail.
+type AuditEvent struct {
+	ID            uuid.UUID  `json:"id"`
+	Action        string     `json:"action"`
+	ActorID       uuid.UUID  `json:"actor_id"`
+	ActorUsername string     `json:"actor_username"`
+	ActorCompany  string     `json:"actor_company"`
+	TargetID      *uuid.UUID `json:"target_id"`
+	TargetCompany string     `json:"target_company"`
+	TargetBranch  string     `json:"target_branch"`
+	SessionID     *uuid.UUID `json:"session_id"`
+	Reason        string     `json:"reason"`
+	IP            string     `json:"ip"`
+	CreateAt      time.Time  `json:"create_at"`
+}
+
+type AuditQuery struct {
+	Action  string `query:"action"`
+	Company string `query:"company"`
+	ActorID string `query:"actor_id"`
+	Limit   int    `query:"limit"`
+}
+
+var (
+	ErrUserNotFound           = errors.New("user not found")
+	ErrImpersonationTarget    = errors.New("company and user_id are required")
+	ErrImpersonationReason    = errors.New("a reason is required to impersonate a user")
+	ErrImpersonationForbidden = errors.New("this user cannot be impersonated")
+	ErrImpersonationNested    = errors.New("cannot impersonate while impersonating")
+	ErrNotImpersonating       = errors.New("the session is not an impersonation")
+)
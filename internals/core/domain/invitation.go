@@ -0,0 +1,57 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const PurposeInvitation = "invitation"
+
+type Invitation struct {
+	ID         uuid.UUID  `json:"id"`
+	Company    string     `json:"company"`
+	Branch     string     `json:"branch"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	InvitedBy  uuid.UUID  `json:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	UserID     *uuid.UUID `json:"user_id"`
+	CreateAt   time.Time  `json:"create_at"`
+}
+
+// InvitationInput asks for an invitation. Company defaults to the caller's
+// and only super admins can name another one.
+type InvitationInput struct {
+	Company   string `json:"company"`
+	Branch    string `json:"branch"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	ExpiresIn int    `json:"expires_in"` // seconds, 0 for the configured default
+}
+
+// InvitationCreated carries the signed link, also mailed to the invitee,
+// for admins who hand it over another way.
+type InvitationCreated struct {
+	*Invitation
+	Link string `json:"link"`
+}
+
+type AcceptInvitationInput struct {
+	Token     string `json:"token"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+var (
+	ErrInvalidInvitation  = errors.New("invalid, expired or already used invitation")
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvitationRole     = errors.New("role must be a company role no higher than your own")
+	ErrUsernameTaken      = errors.New("username is already taken")
+	ErrRegistrationClosed = errors.New("open registration is disabled for this company, ask an admin for an invitation")
+)
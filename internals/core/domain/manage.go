@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -40,7 +41,6 @@ type CompanyAndBranch struct {
 	OldCompany string `json:"company"`
 	OldBranch  string `json:"branch"`
 	NewCompany string `json:"new_company"`
-	NewBranch  string `json:"new_branch"`
 	BranchName string `json:"branch_name"`
 }
 
@@ -61,12 +61,16 @@ type GetBranch struct {
 }
 
 type CompanyRequest struct {
-	Company string `json:"company"`
+	Company     string          `json:"company"`
+	DisplayName string          `json:"display_name,omitempty"`
+	Settings    json.RawMessage `json:"settings,omitempty"`
 }
 
 type BranchRequest struct {
-	Company string `json:"company"`
-	Branch  string `json:"branch"`
+	Company     string          `json:"company"`
+	Branch      string          `json:"branch"`
+	DisplayName string          `json:"display_name,omitempty"`
+	Settings    json.RawMessage `json:"settings,omitempty"`
 }
 
 type Response struct {
@@ -75,7 +79,12 @@ type Response struct {
 }
 
 type ResponseCompany struct {
-	Company string `json:"company"`
+	Company     string          `json:"company"`
+	DisplayName string          `json:"display_name"`
+	Status      string          `json:"status"`
+	Settings    json.RawMessage `json:"settings"`
+	CreateAt    time.Time       `json:"create_at"`
+	UpdateAt    *time.Time      `json:"update_at"`
 }
 
 type ResponseBranch struct {
@@ -84,7 +93,12 @@ type ResponseBranch struct {
 }
 
 type BranchObject struct {
-	Name string `json:"name"`
+	Name        string          `json:"name"`
+	DisplayName string          `json:"display_name"`
+	Status      string          `json:"status"`
+	Settings    json.RawMessage `json:"settings"`
+	CreateAt    time.Time       `json:"create_at"`
+	UpdateAt    *time.Time      `json:"update_at"`
 }
 
 type CompanyUpdate struct {
@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MFAPurposeLogin  = "mfa"
+	MFAPurposeEnroll = "mfa_enroll"
+)
+
+type MFA struct {
+	UserID       uuid.UUID  `json:"user_id"`
+	Company      string     `json:"company"`
+	Branch       string     `json:"branch"`
+	Secret       string     `json:"-"`
+	EnabledAt    *time.Time `json:"enabled_at"`
+	LastUsedStep int64      `json:"-"`
+	CreateAt     time.Time  `json:"create_at"`
+}
+
+type MFAIdentity struct {
+	UserID   uuid.UUID `json:"-"`
+	Company  string    `json:"-"`
+	Branch   string    `json:"-"`
+	Username string    `json:"-"`
+	Role     string    `json:"-"`
+}
+
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type MFACodeInput struct {
+	Code string `json:"code"`
+	IP   string `json:"-"`
+}
+
+type MFATokenInput struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+type MFAVerifyInput struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	IP           string `json:"-"`
+}
+
+type MFAVerifyReply struct {
+	Data          *DataReply `json:"data"`
+	Role          string     `json:"-"`
+	RecoveryCodes []string   `json:"recovery_codes,omitempty"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// SecurityPolicy holds a company's security settings. Companies that never
+// saved one get DefaultSecurityPolicy.
+type SecurityPolicy struct {
+	Company               string `json:"company"`
+	MFARequired           bool   `json:"mfa_required"`
+	PasswordMinLength     int    `json:"password_min_length"`
+	PasswordRequireUpper  bool   `json:"password_require_upper"`
+	PasswordRequireLower  bool   `json:"password_require_lower"`
+	PasswordRequireDigit  bool   `json:"password_require_digit"`
+	PasswordRequireSymbol bool   `json:"password_require_symbol"`
+	PasswordCheckBreached bool   `json:"password_check_breached"`
+	PasswordMaxAgeDays    int    `json:"password_max_age_days"` // 0 means passwords do not expire
+	PasswordHistory       int    `json:"password_history"`      // previous passwords that cannot be reused
+	OpenRegistration      bool   `json:"open_registration"`     // anyone may register, otherwise users join by invitation
+}
+
+// DefaultSecurityPolicy matches the column defaults of company.security_policies.
+func DefaultSecurityPolicy(company string) *SecurityPolicy {
+	return &SecurityPolicy{
+		Company:               company,
+		PasswordMinLength:     8,
+		PasswordCheckBreached: true,
+		OpenRegistration:      true,
+	}
+}
+
+type LoginResult struct {
+	Data                  *DataReply `json:"data"`
+	Role                  string     `json:"-"`
+	MFAToken              string     `json:"mfa_token,omitempty"`
+	MFAEnrollmentRequired bool       `json:"mfa_enrollment_required,omitempty"`
+}
+
+var (
+	ErrMFAInvalidCode      = errors.New("invalid MFA code")
+	ErrMFAInvalidToken     = errors.New("invalid or expired MFA token")
+	ErrMFAChallengeLocked  = errors.New("too many invalid MFA codes, log in again")
+	ErrMFAAlreadyEnabled   = errors.New("MFA is already enabled")
+	ErrMFANotEnabled       = errors.New("MFA is not enabled")
+	ErrMFANotEnrolled      = errors.New("MFA enrolment has not been started")
+	ErrMFARequiredByPolicy = errors.New("MFA is required for this account by company policy")
+)
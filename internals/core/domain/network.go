@@ -0,0 +1,34 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// NetworkPolicy restricts where and when users of a company, or of one of
+// its branches when Branch is set, can authenticate. A user has to satisfy
+// both the company-wide policy and the policy of their branch.
+type NetworkPolicy struct {
+	Company      string     `json:"company"`
+	Branch       string     `json:"branch"`
+	AllowedCIDRs []string   `json:"allowed_cidrs"` // empty allows every address
+	WindowStart  string     `json:"window_start"`  // "HH:MM", empty for no time window
+	WindowEnd    string     `json:"window_end"`    // "HH:MM", before WindowStart for windows over midnight
+	Timezone     string     `json:"timezone"`      // IANA name, branches default to the company's
+	UpdateAt     *time.Time `json:"update_at,omitempty"`
+}
+
+// NetworkCheck describes an authentication to test against the policies.
+type NetworkCheck struct {
+	Company string
+	Branch  string
+	Role    string
+	IP      string
+}
+
+var (
+	ErrNetworkNotAllowed     = errors.New("access from this network is not allowed")
+	ErrOutsideLoginHours     = errors.New("access is not allowed at this time")
+	ErrInvalidNetworkPolicy  = errors.New("invalid network policy")
+	ErrNetworkPolicyNotFound = errors.New("network policy not found")
+)
@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	PasswordMaxLength     = 128
+	PasswordHistoryMax    = 24
+	PasswordMaxAgeDaysMax = 3650
+)
+
+// PasswordPolicyError lists every rule of the company's password policy a
+// new password breaks, so the user can fix them all at once.
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet the policy: " + strings.Join(e.Violations, "; ")
+}
+
+var (
+	ErrPasswordExpired = errors.New("password has expired, reset it to log in")
+	ErrInvalidPolicy   = errors.New("invalid security policy")
+)
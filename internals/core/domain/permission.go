@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PermUsersRead      = "users:read"      // read the users of the own branch
+	PermUsersWrite     = "users:write"     // manage the user accounts of the own branch
+	PermBranchesManage = "branches:manage" // extend users:* to every branch of the own company
+	PermRolesManage    = "roles:manage"    // define company roles and assign them
+	PermAPIKeysManage  = "api_keys:manage" // create and revoke API keys within the own scope
+	PermTenantsManage  = "tenants:manage"  // manage every company, platform operators only
+)
+
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Assignable  bool   `json:"assignable"` // whether company roles may include it
+}
+
+// Permissions is the catalogue of every permission the API checks.
+var Permissions = []Permission{
+	{Name: PermUsersRead, Description: "Read the users of the own branch", Assignable: true},
+	{Name: PermUsersWrite, Description: "Manage the user accounts of the own branch", Assignable: true},
+	{Name: PermBranchesManage, Description: "Reach every branch of the own company", Assignable: true},
+	{Name: PermRolesManage, Description: "Define company roles and assign them to users", Assignable: true},
+	{Name: PermAPIKeysManage, Description: "Create and revoke API keys within the own scope", Assignable: true},
+	{Name: PermTenantsManage, Description: "Manage every company on the platform", Assignable: false},
+}
+
+// AssignablePermission reports whether perm is in the catalogue and may be
+// bundled into a company role.
+func AssignablePermission(perm string) bool {
+	for _, p := range Permissions {
+		if p.Name == perm {
+			return p.Assignable
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether perms contains perm.
+func HasPermission(perms []string, perm string) bool {
+	for _, p := range perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// CustomRole is a named bundle of permissions defined by a company.
+type CustomRole struct {
+	ID          uuid.UUID  `json:"id"`
+	Company     string     `json:"company"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Permissions []string   `json:"permissions"`
+	CreateAt    time.Time  `json:"create_at"`
+	UpdateAt    *time.Time `json:"update_at"`
+}
+
+type RoleInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type RoleAssignment struct {
+	UserID  uuid.UUID `json:"user_id"`
+	RoleID  uuid.UUID `json:"role_id"`
+	Company string    `json:"company"`
+	Branch  string    `json:"branch"`
+}
+
+// Principal is the authenticated caller as described by the access token.
+// Actor is set when a super admin is impersonating the user.
+type Principal struct {
+	UserID      uuid.UUID
+	Company     string
+	Branch      string
+	Role        string
+	Permissions []string
+	Actor       *Actor
+}
+
+var (
+	ErrRoleNotFound        = errors.New("role not found")
+	ErrUnknownPermission   = errors.New("unknown or unassignable permission")
+	ErrPermissionEscalated = errors.New("cannot grant a permission you do not hold")
+	ErrOutOfTenantScope    = errors.New("user is outside your tenant scope")
+)
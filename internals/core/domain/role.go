@@ -0,0 +1,82 @@
+package domain
+
+const (
+	RoleUser       = "user"
+	RoleAdmin      = "admin"       // manages one branch
+	RoleHeadAdmin  = "head_admin"  // manages every branch of one company
+	RoleSuperAdmin = "super_admin" // manages every company
+
+	// RoleAPIKey marks requests made with an API key. It ranks nowhere, so
+	// keys only get the permissions they were created with.
+	RoleAPIKey = "api_key"
+)
+
+// roleRank orders the built-in roles. A role inherits everything the roles
+// ranked below it are allowed to do.
+var roleRank = map[string]int{
+	RoleUser:       1,
+	RoleAdmin:      2,
+	RoleHeadAdmin:  3,
+	RoleSuperAdmin: 4,
+}
+
+// rolePermissions are the permissions each built-in role carries. Company
+// roles assigned to a user add to these.
+var rolePermissions = map[string][]string{
+	RoleUser:       {},
+	RoleAdmin:      {PermUsersRead, PermUsersWrite, PermAPIKeysManage},
+	RoleHeadAdmin:  {PermUsersRead, PermUsersWrite, PermAPIKeysManage, PermBranchesManage, PermRolesManage},
+	RoleSuperAdmin: {PermUsersRead, PermUsersWrite, PermAPIKeysManage, PermBranchesManage, PermRolesManage, PermTenantsManage},
+}
+
+// RolePermissions returns a copy of the permissions of a built-in role.
+func RolePermissions(role string) []string {
+	return append([]string(nil), rolePermissions[role]...)
+}
+
+// ValidRole reports whether role is one of the built-in roles.
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role is required or ranks above it. Unknown
+// roles satisfy nothing.
+func RoleAtLeast(role, required string) bool {
+	rank, ok := roleRank[role]
+	if !ok {
+		return false
+	}
+
+	requiredRank, ok := roleRank[required]
+	if !ok {
+		return false
+	}
+
+	return rank >= requiredRank
+}
+
+// RoleAbove reports whether role ranks strictly above other.
+func RoleAbove(role, other string) bool {
+	return RoleAtLeast(role, other) && !RoleAtLeast(other, role)
+}
+
+// InTenantScope reports whether a caller holding perms in company and branch
+// may act on the target company and branch. tenants:manage reaches every
+// tenant, branches:manage the whole own company and anyone else only their
+// own branch. An empty target branch means the whole company.
+func InTenantScope(perms []string, company, branch, targetCompany, targetBranch string) bool {
+	if HasPermission(perms, PermTenantsManage) {
+		return true
+	}
+
+	if targetCompany != company {
+		return false
+	}
+
+	if HasPermission(perms, PermBranchesManage) {
+		return true
+	}
+
+	return targetBranch != "" && targetBranch == branch
+}
@@ -0,0 +1,102 @@
+package domain
+
+import "testing"
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		role, required string
+		want           bool
+	}{
+		{role: RoleUser, required: RoleUser, want: true},
+		{role: RoleUser, required: RoleAdmin, want: false},
+		{role: RoleAdmin, required: RoleUser, want: true},
+		{role: RoleHeadAdmin, required: RoleAdmin, want: true},
+		{role: RoleSuperAdmin, required: RoleHeadAdmin, want: true},
+		{role: RoleHeadAdmin, required: RoleSuperAdmin, want: false},
+		{role: "owner", required: RoleUser, want: false},
+		{role: RoleSuperAdmin, required: "owner", want: false},
+		{role: RoleAPIKey, required: RoleUser, want: false},
+		{role: "", required: "", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := RoleAtLeast(tt.role, tt.required); got != tt.want {
+			t.Errorf("RoleAtLeast(%q, %q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestRoleAbove(t *testing.T) {
+	if !RoleAbove(RoleHeadAdmin, RoleAdmin) {
+		t.Error("head_admin is not above admin")
+	}
+	if RoleAbove(RoleAdmin, RoleAdmin) {
+		t.Error("admin is above itself")
+	}
+	if RoleAbove(RoleAdmin, RoleHeadAdmin) {
+		t.Error("admin is above head_admin")
+	}
+	if RoleAbove(RoleSuperAdmin, "owner") {
+		t.Error("a built-in role is above an unknown one")
+	}
+}
+
+func TestValidRole(t *testing.T) {
+	for _, role := range []string{RoleUser, RoleAdmin, RoleHeadAdmin, RoleSuperAdmin} {
+		if !ValidRole(role) {
+			t.Errorf("ValidRole(%q) = false", role)
+		}
+	}
+	for _, role := range []string{"", "owner", "Admin", RoleAPIKey} {
+		if ValidRole(role) {
+			t.Errorf("ValidRole(%q) = true", role)
+		}
+	}
+}
+
+func TestInTenantScope(t *testing.T) {
+	tests := []struct {
+		name          string
+		role          string
+		targetCompany string
+		targetBranch  string
+		want          bool
+	}{
+		{name: "user in own branch", role: RoleUser, targetCompany: "acme", targetBranch: "hq", want: true},
+		{name: "user in sibling branch", role: RoleUser, targetCompany: "acme", targetBranch: "east", want: false},
+		{name: "branch admin in own branch", role: RoleAdmin, targetCompany: "acme", targetBranch: "hq", want: true},
+		{name: "branch admin in sibling branch", role: RoleAdmin, targetCompany: "acme", targetBranch: "east", want: false},
+		{name: "branch admin on whole company", role: RoleAdmin, targetCompany: "acme", targetBranch: "", want: false},
+		{name: "branch admin in same branch name of other company", role: RoleAdmin, targetCompany: "globex", targetBranch: "hq", want: false},
+		{name: "company admin in sibling branch", role: RoleHeadAdmin, targetCompany: "acme", targetBranch: "east", want: true},
+		{name: "company admin on whole company", role: RoleHeadAdmin, targetCompany: "acme", targetBranch: "", want: true},
+		{name: "company admin in other company", role: RoleHeadAdmin, targetCompany: "globex", targetBranch: "hq", want: false},
+		{name: "company admin on other whole company", role: RoleHeadAdmin, targetCompany: "globex", targetBranch: "", want: false},
+		{name: "super admin in other company", role: RoleSuperAdmin, targetCompany: "globex", targetBranch: "hq", want: true},
+		{name: "super admin on other whole company", role: RoleSuperAdmin, targetCompany: "globex", targetBranch: "", want: true},
+		{name: "unknown role in own branch", role: "owner", targetCompany: "acme", targetBranch: "hq", want: true},
+		{name: "unknown role in sibling branch", role: "owner", targetCompany: "acme", targetBranch: "east", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := InTenantScope(RolePermissions(tt.role), "acme", "hq", tt.targetCompany, tt.targetBranch)
+			if got != tt.want {
+				t.Errorf("InTenantScope(%s, acme/hq -> %s/%s) = %v, want %v", tt.role, tt.targetCompany, tt.targetBranch, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInTenantScopeByPermission(t *testing.T) {
+	// Company roles can grant the scope permissions without the built-in role
+	if !InTenantScope([]string{PermBranchesManage}, "acme", "hq", "acme", "east") {
+		t.Error("branches:manage does not reach a sibling branch")
+	}
+	if InTenantScope([]string{PermBranchesManage}, "acme", "hq", "globex", "hq") {
+		t.Error("branches:manage reaches another company")
+	}
+	if !InTenantScope([]string{PermTenantsManage}, "acme", "hq", "globex", "") {
+		t.Error("tenants:manage does not reach another company")
+	}
+}
@@ -0,0 +1,130 @@
+package domain
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SCIMSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMSchemaUserTenant   = "urn:ietf:params:scim:schemas:extension:onesystem:2.0:User"
+	SCIMSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMSchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+type SCIMName struct {
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+}
+
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type SCIMMeta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      time.Time  `json:"created"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location,omitempty"`
+}
+
+// SCIMUserTenant places a user in a branch of the company. API keys bound to
+// a branch can leave it out.
+type SCIMUserTenant struct {
+	Branch string `json:"branch,omitempty"`
+	Role   string `json:"role,omitempty"`
+}
+
+type SCIMUser struct {
+	Schemas    []string        `json:"schemas"`
+	ID         string          `json:"id,omitempty"`
+	ExternalID string          `json:"externalId,omitempty"`
+	UserName   string          `json:"userName"`
+	Name       *SCIMName       `json:"name,omitempty"`
+	Emails     []SCIMEmail     `json:"emails,omitempty"`
+	Active     *bool           `json:"active,omitempty"`
+	Password   string          `json:"password,omitempty"`
+	Tenant     *SCIMUserTenant `json:"urn:ietf:params:scim:schemas:extension:onesystem:2.0:User,omitempty"`
+	Meta       *SCIMMeta       `json:"meta,omitempty"`
+}
+
+type SCIMMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type SCIMGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []SCIMMember `json:"members,omitempty"`
+	Meta        *SCIMMeta    `json:"meta,omitempty"`
+}
+
+type SCIMListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type SCIMListInput struct {
+	Filter     string `query:"filter"`
+	StartIndex int    `query:"startIndex"`
+	Count      int    `query:"count"`
+}
+
+type SCIMPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type SCIMPatch struct {
+	Schemas    []string      `json:"schemas"`
+	Operations []SCIMPatchOp `json:"Operations"`
+}
+
+// UserQuery selects users of one company. Empty fields do not filter.
+type UserQuery struct {
+	Company  string
+	Branch   string
+	ID       *uuid.UUID
+	Username string
+	Email    string
+	Active   *bool
+	Offset   int
+	Limit    int
+}
+
+// SCIMError is an error reported in the SCIM error format, RFC 7644 section 3.12.
+type SCIMError struct {
+	Status   int    `json:"-"`
+	ScimType string `json:"scimType,omitempty"`
+	Detail   string `json:"detail"`
+}
+
+func (e *SCIMError) Error() string {
+	return e.Detail
+}
+
+func (e *SCIMError) MarshalJSON() ([]byte, error) {
+	type body SCIMError
+	return json.Marshal(struct {
+		Schemas []string `json:"schemas"`
+		Status  string   `json:"status"`
+		*body
+	}{
+		Schemas: []string{SCIMSchemaError},
+		Status:  strconv.Itoa(e.Status),
+		body:    (*body)(e),
+	})
+}
@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	TenantActive    = "active"
+	TenantReadOnly  = "read_only" // users can log in and read, nothing can be changed
+	TenantSuspended = "suspended" // nobody can log in or use the API
+)
+
+// tenantStatusRank orders the states from least to most restrictive.
+var tenantStatusRank = map[string]int{
+	TenantActive:    0,
+	TenantReadOnly:  1,
+	TenantSuspended: 2,
+}
+
+// ValidTenantStatus reports whether status is one of the tenant states.
+func ValidTenantStatus(status string) bool {
+	_, ok := tenantStatusRank[status]
+	return ok
+}
+
+// StricterTenantStatus returns the more restrictive of two states. A branch
+// is held to its company's state when that is stricter than its own.
+func StricterTenantStatus(a, b string) string {
+	if tenantStatusRank[b] > tenantStatusRank[a] {
+		return b
+	}
+	return a
+}
+
+// tenantNamePattern keeps company and branch slugs URL-safe. Human names,
+// spaces and Thai included, belong in the display name.
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// reservedTenantNames are the tables of the company schema. Partitions
+// created before the accounts migration are still named after their slug, so
+// a slug must never collide with one of these.
+var reservedTenantNames = map[string]bool{
+	"onesystem": true, "accounts": true, "tenants": true, "archives": true, "invitations": true,
+	"action_tokens": true, "api_keys": true, "audit_log": true, "federated_identities": true,
+	"identity_providers": true, "login_attempts": true, "mfa": true, "mfa_recovery_codes": true,
+	"network_policies": true, "oauth_clients": true, "oauth_codes": true, "password_history": true,
+	"refresh_tokens": true, "roles": true, "security_policies": true, "sessions": true,
+	"sso_states": true, "user_roles": true,
+}
+
+// ValidTenantName reports whether name may be used as a company or branch
+// slug. Slugs show up in path parameters and tokens, partitions are named
+// and keyed after the tenant id. Legacy partitions still carry slugs, so the
+// pg_ prefix of system tables and the a_ prefix of archived partitions stay
+// off limits.
+func ValidTenantName(name string) error {
+	if !tenantNamePattern.MatchString(name) || strings.HasPrefix(name, "pg_") || strings.HasPrefix(name, "a_") {
+		return ErrInvalidTenantName
+	}
+	if reservedTenantNames[name] {
+		return ErrReservedTenantName
+	}
+	return nil
+}
+
+// Tenant is the registry entry of a company or one of its branches. Company
+// and Branch are its slugs, Branch is empty on the company's own entry. The
+// ID never changes and is what the partition holding the tenant's users is
+// listed under, Partition is that table's generated name.
+type Tenant struct {
+	ID          uuid.UUID       `json:"id"`
+	Company     string          `json:"company"`
+	Branch      string          `json:"branch,omitempty"`
+	DisplayName string          `json:"display_name"`
+	Status      string          `json:"status"`
+	Settings    json.RawMessage `json:"settings"` // free-form, e.g. contact and plan
+	CreateAt    time.Time       `json:"create_at"`
+	UpdateAt    *time.Time      `json:"update_at"`
+	Partition   string          `json:"-"`
+}
+
+// TenantUpdate changes a tenant's metadata. Fields left out keep their value.
+type TenantUpdate struct {
+	Company     string          `json:"-"`
+	Branch      string          `json:"-"`
+	DisplayName *string         `json:"display_name"`
+	Settings    json.RawMessage `json:"settings"`
+}
+
+// TenantStatusInput changes the state of a company, or of one of its
+// branches when Branch is set.
+type TenantStatusInput struct {
+	Company string `json:"-"`
+	Branch  string `json:"-"`
+	Status  string `json:"status"`
+}
+
+var (
+	ErrTenantNotFound      = errors.New("tenant not found")
+	ErrInvalidTenantName   = errors.New("slugs must use at most 63 lowercase letters, digits, hyphens or underscores and not start with pg_ or a_")
+	ErrReservedTenantName  = errors.New("this name is reserved")
+	ErrInvalidSettings     = errors.New("settings must be a JSON object")
+	ErrInvalidTenantStatus = errors.New("status must be active, read_only or suspended")
+	ErrTenantSuspended     = errors.New("this company or branch is suspended")
+	ErrTenantReadOnly      = errors.New("this company or branch is read-only")
+)
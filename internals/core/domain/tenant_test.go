@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidTenantName(t *testing.T) {
+	tests := []struct {
+		name string
+		want error
+	}{
+		{name: "acme"},
+		{name: "acme-east"},
+		{name: "acme_east_2"},
+		{name: "7eleven"},
+		{name: strings.Repeat("a", 63)},
+		{name: "", want: ErrInvalidTenantName},
+		{name: strings.Repeat("a", 64), want: ErrInvalidTenantName},
+		{name: "Acme", want: ErrInvalidTenantName},
+		{name: "-acme", want: ErrInvalidTenantName},
+		{name: "acme east", want: ErrInvalidTenantName},
+		{name: `acme"; DROP TABLE company.accounts; --`, want: ErrInvalidTenantName},
+		{name: "pg_class", want: ErrInvalidTenantName},
+		{name: "a_0f9c", want: ErrInvalidTenantName},
+		{name: "onesystem", want: ErrReservedTenantName},
+		{name: "accounts", want: ErrReservedTenantName},
+		{name: "tenants", want: ErrReservedTenantName},
+		{name: "archives", want: ErrReservedTenantName},
+		{name: "api_keys", want: ErrReservedTenantName},
+	}
+
+	for _, tt := range tests {
+		if err := ValidTenantName(tt.name); !errors.Is(err, tt.want) {
+			t.Errorf("ValidTenantName(%q) = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
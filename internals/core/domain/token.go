@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Company    string     `json:"company"`
+	Branch     string     `json:"branch"`
+	Username   string     `json:"username"`
+	ActorID    *uuid.UUID `json:"actor_id,omitempty"`
+	ClientID   string     `json:"client_id,omitempty"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreateAt   time.Time  `json:"create_at"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	Current    bool       `json:"current"`
+}
+
+// Device describes where a session was started from.
+type Device struct {
+	UserAgent string
+	IP        string
+	ClientID  string // the OAuth client holding the session, if any
+}
+
+type RefreshToken struct {
+	ID        uuid.UUID  `json:"id"`
+	SessionID uuid.UUID  `json:"session_id"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreateAt  time.Time  `json:"create_at"`
+}
+
+type TokenPair struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	TokenType    string    `json:"token_type"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token"`
+	Device       Device `json:"-"`
+}
+
+type LogoutInput struct {
+	SessionID uuid.UUID `json:"-"`
+	UserID    uuid.UUID `json:"-"`
+	All       bool      `json:"all"`
+}
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token already used, session revoked")
+	ErrSessionRevoked      = errors.New("session has been revoked")
+	ErrSessionNotFound     = errors.New("session not found")
+)
@@ -0,0 +1,29 @@
+package ports
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AccountService interface {
+	RequestPasswordReset(data *domain.ForgotPasswordInput) error
+	ResetPassword(data *domain.ResetPasswordInput) error
+	RequestEmailVerification(data *domain.Me) error
+	SendEmailVerification(user *domain.DataReply) error
+	VerifyEmail(data *domain.VerifyEmailInput) error
+}
+
+type ActionTokenRepository interface {
+	CreateActionToken(data *domain.ActionToken) (*domain.ActionToken, error)
+	CheckActionToken(data *domain.ActionToken) (bool, error)
+	UseActionToken(data *domain.ActionToken) (bool, error)
+	FailActionToken(data *domain.ActionToken, maxFailures int) (bool, error)
+}
+
+type AccountHandler interface {
+	ForgotPassword(c *fiber.Ctx) error
+	ResetPassword(c *fiber.Ctx) error
+	RequestEmailVerification(c *fiber.Ctx) error
+	VerifyEmail(c *fiber.Ctx) error
+}
@@ -0,0 +1,30 @@
+package ports
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type APIKeyService interface {
+	ListAPIKeys(principal *domain.Principal) ([]domain.APIKey, error)
+	CreateAPIKey(principal *domain.Principal, data *domain.APIKeyInput) (*domain.APIKeyCreated, error)
+	RevokeAPIKey(principal *domain.Principal, id uuid.UUID) error
+	Authenticate(key string) (*domain.APIKey, error)
+}
+
+type APIKeyRepository interface {
+	GetAPIKeys(data *domain.APIKey) ([]domain.APIKey, error)
+	GetAPIKey(data *domain.APIKey) (*domain.APIKey, error)
+	GetActiveAPIKey(data *domain.APIKey) (*domain.APIKey, error)
+	CreateAPIKey(data *domain.APIKey, expiresIn int) (*domain.APIKey, error)
+	RevokeAPIKey(data *domain.APIKey) (bool, error)
+	TouchAPIKey(data *domain.APIKey) error
+}
+
+type APIKeyHandler interface {
+	ListAPIKeys(c *fiber.Ctx) error
+	CreateAPIKey(c *fiber.Ctx) error
+	RevokeAPIKey(c *fiber.Ctx) error
+}
@@ -0,0 +1,17 @@
+package ports
+
+import "go-multi-tenancy/internals/core/domain"
+
+type LoginAttemptRepository interface {
+	GetAttempt(data *domain.LoginAttempt) (*domain.LoginAttempt, error)
+	RecordFailure(data *domain.LoginAttempt, windowSeconds int) (*domain.LoginAttempt, error)
+	Lock(data *domain.LoginAttempt, seconds int) error
+	ResetAttempts(data *domain.LoginAttempt) error
+}
+
+type LoginThrottle interface {
+	Check(login *domain.LoginInput) error
+	Fail(login *domain.LoginInput) error
+	Succeed(login *domain.LoginInput) error
+	Unlock(data *domain.UnlockInput) error
+}
@@ -0,0 +1,15 @@
+package ports
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type BootstrapService interface {
+	Bootstrap(data *domain.BootstrapInput) (*domain.DataReply, error)
+}
+
+type BootstrapHandler interface {
+	Bootstrap(c *fiber.Ctx) error
+}
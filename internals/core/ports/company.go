@@ -8,7 +8,7 @@ import (
 
 type CompanyService interface {
 	Register(register *domain.RegisterInput) (*domain.DataReply, error)
-	Login(login *domain.LoginInput) (*domain.DataReply, string, error)
+	Login(login *domain.LoginInput) (*domain.LoginResult, error)
 	GetData(data *domain.DataInput) (*domain.DataReply, error)
 	GetCompanyData(data *domain.DataInput) ([]domain.DataReply, error)
 	GetBranchData(data *domain.DataInput) ([]domain.DataReply, error)
@@ -16,26 +16,39 @@ type CompanyService interface {
 	GetAllData() ([]domain.DataReply, error)
 	DeleteData(data *domain.DataDelete) error
 	GetMe(data *domain.Me) (*domain.DataReply, error)
+	Unlock(data *domain.UnlockInput) error
 
-	Admin(data *domain.Admin) (*domain.DataReply, error)
+	Admin(principal *domain.Principal, data *domain.Admin) (*domain.DataReply, error)
 }
 
 type CompanyRepository interface {
 	Register(data *domain.Data) (*domain.Data, error)
+	HasSuperAdmin() (bool, error)
 	Login(data *domain.Data) (*domain.Data, error)
+	GetByEmail(data *domain.Data) (*domain.Data, error)
 	GetData(data *domain.Data) (*domain.Data, error)
 	UpdateData(data *domain.Data) (*domain.Data, error)
+	UpdatePassword(data *domain.Data) error
+	ChangePassword(data *domain.Data) error
+	PasswordExpired(data *domain.Data, maxAgeDays int) (bool, error)
+	VerifyEmail(data *domain.Data) error
 	GetAllData() ([]domain.Data, error)
 	GetCompanyData(data *domain.Data) ([]domain.Data, error)
 	GetBranchData(data *domain.Data) ([]domain.Data, error)
 	DeleteData(data *domain.Data) error
 	GetMe(data *domain.Data) (*domain.Data, error)
 	GetOne(data *domain.Data) (*domain.Data, error)
+	GetByID(data *domain.Data) (*domain.Data, error)
+	FindUsers(data *domain.UserQuery) ([]domain.Data, int, error)
+	UpdateProfile(data *domain.Data) error
+	SetActive(data *domain.Data, active bool) error
 }
 
 type CompanyHandler interface {
 	Register(c *fiber.Ctx) error
 	Login(c *fiber.Ctx) error
+	Refresh(c *fiber.Ctx) error
+	Logout(c *fiber.Ctx) error
 	GetData(c *fiber.Ctx) error
 	UpdateData(c *fiber.Ctx) error
 	GetAllData(c *fiber.Ctx) error
@@ -43,6 +56,7 @@ type CompanyHandler interface {
 	GetMe(c *fiber.Ctx) error
 	GetCompanyData(c *fiber.Ctx) error
 	GetBranchData(c *fiber.Ctx) error
+	Unlock(c *fiber.Ctx) error
 
 	Admin(c *fiber.Ctx) error
 }
@@ -0,0 +1,41 @@
+package ports
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type FederationService interface {
+	GetProvider(data *domain.CompanyRequest) (*domain.IdentityProvider, error)
+	SaveProvider(data *domain.IdentityProvider) (*domain.IdentityProvider, error)
+	DeleteProvider(data *domain.CompanyRequest) error
+	Start(data *domain.CompanyRequest) (*domain.SSOStartReply, error)
+	Callback(data *domain.SSOCallbackInput) (*domain.LoginResult, error)
+}
+
+type FederationRepository interface {
+	GetProvider(data *domain.IdentityProvider) (*domain.IdentityProvider, error)
+	SaveProvider(data *domain.IdentityProvider) (*domain.IdentityProvider, error)
+	DeleteProvider(data *domain.IdentityProvider) error
+	CreateState(data *domain.SSOState, ttlSeconds int) error
+	UseState(data *domain.SSOState) (*domain.SSOState, error)
+	GetIdentity(data *domain.FederatedIdentity) (*domain.FederatedIdentity, error)
+	CreateIdentity(data *domain.FederatedIdentity) error
+}
+
+// IdentityProviderClient talks to an upstream OpenID Connect issuer.
+type IdentityProviderClient interface {
+	AuthorizationURL(provider *domain.IdentityProvider, state, nonce, codeChallenge string) (string, error)
+	// Exchange redeems an authorization code and returns the claims of the
+	// verified ID token.
+	Exchange(provider *domain.IdentityProvider, code, codeVerifier string) (map[string]interface{}, error)
+}
+
+type FederationHandler interface {
+	GetProvider(c *fiber.Ctx) error
+	SaveProvider(c *fiber.Ctx) error
+	DeleteProvider(c *fiber.Ctx) error
+	Start(c *fiber.Ctx) error
+	Callback(c *fiber.Ctx) error
+}
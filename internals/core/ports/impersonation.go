@@ -0,0 +1,24 @@
+package ports
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ImpersonationService interface {
+	Start(actor *domain.Actor, data *domain.ImpersonationInput) (*domain.ImpersonationReply, error)
+	Stop(data *domain.ImpersonationStopInput) error
+	AuditLog(data *domain.AuditQuery) ([]domain.AuditEvent, error)
+}
+
+type AuditRepository interface {
+	CreateAuditEvent(data *domain.AuditEvent) error
+	GetAuditEvents(data *domain.AuditQuery) ([]domain.AuditEvent, error)
+}
+
+type ImpersonationHandler interface {
+	Start(c *fiber.Ctx) error
+	Stop(c *fiber.Ctx) error
+	AuditLog(c *fiber.Ctx) error
+}
@@ -0,0 +1,32 @@
+package ports
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type InvitationService interface {
+	ListInvitations(principal *domain.Principal) ([]domain.Invitation, error)
+	CreateInvitation(principal *domain.Principal, data *domain.InvitationInput) (*domain.InvitationCreated, error)
+	RevokeInvitation(principal *domain.Principal, id uuid.UUID) error
+	AcceptInvitation(data *domain.AcceptInvitationInput) (*domain.DataReply, error)
+}
+
+type InvitationRepository interface {
+	CreateInvitation(data *domain.Invitation, expiresIn int) (*domain.Invitation, error)
+	GetInvitations(data *domain.Invitation) ([]domain.Invitation, error)
+	GetInvitation(data *domain.Invitation) (*domain.Invitation, error)
+	GetPendingInvitation(data *domain.Invitation) (*domain.Invitation, error)
+	AcceptInvitation(data *domain.Invitation) (bool, error)
+	SetInvitationUser(data *domain.Invitation) error
+	RevokeInvitation(data *domain.Invitation) (bool, error)
+}
+
+type InvitationHandler interface {
+	ListInvitations(c *fiber.Ctx) error
+	CreateInvitation(c *fiber.Ctx) error
+	RevokeInvitation(c *fiber.Ctx) error
+	AcceptInvitation(c *fiber.Ctx) error
+}
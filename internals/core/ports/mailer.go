@@ -0,0 +1,7 @@
+package ports
+
+import "go-multi-tenancy/internals/core/domain"
+
+type Mailer interface {
+	Send(mail *domain.Mail) error
+}
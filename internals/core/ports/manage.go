@@ -4,19 +4,29 @@ import (
 	"go-multi-tenancy/internals/core/domain"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
 type ManageRepository interface {
-	GetCompany() ([]domain.Manage, error)
-	GetBranch(data *domain.GetBranch) ([]domain.GetBranch, error)
-	CreateCompany(data *domain.Manage) (*domain.Manage, error)
-	CreateBranch(data *domain.Manage) (*domain.Manage, error)
+	GetCompany() ([]domain.Tenant, error)
+	GetBranch(data *domain.Tenant) ([]domain.Tenant, error)
+	GetTenant(data *domain.Tenant) (*domain.Tenant, error)
+	GetCompanyTenants(data *domain.Tenant) ([]domain.Tenant, error)
+	UpdateTenant(data *domain.Tenant) (bool, error)
+	SetTenantStatus(data *domain.Tenant) (bool, error)
+	CreateCompany(data *domain.Tenant) (*domain.Tenant, error)
+	CreateBranch(data *domain.Tenant) (*domain.Tenant, error)
+	RegisterFirstSuperAdmin(data *domain.Data) (bool, error)
 	UpdateCompanyToBranch(data *domain.CompanyAndBranch) error
 	UpdateBranchToCompany(data *domain.CompanyAndBranch) error
 	UpdateCompanyName(data *domain.RenameCompany) error
 	UpdateBranchName(data *domain.RenameBranch) error
-	DeleteCompany(data *domain.Manage) error
-	DeleteBranch(data *domain.Manage) error
+	ArchiveCompany(data *domain.Tenant, retention int) (*domain.Archive, error)
+	ArchiveBranch(data *domain.Tenant, retention int) (*domain.Archive, error)
+	GetArchives() ([]domain.Archive, error)
+	GetExpiredArchives() ([]domain.Archive, error)
+	RestoreArchive(data *domain.Archive) error
+	PurgeArchive(data *domain.Archive) error
 }
 
 type ManageService interface {
@@ -28,8 +38,12 @@ type ManageService interface {
 	UpdateBranchToCompany(data *domain.CompanyAndBranch) (*domain.Response, error)
 	UpdateCompanyName(data *domain.RenameCompany) (*domain.Response, error)
 	UpdateBranchName(data *domain.RenameBranch) (*domain.Response, error)
-	DeleteCompany(data *domain.CompanyRequest) error
-	DeleteBranch(data *domain.BranchRequest) error
+	DeleteCompany(data *domain.CompanyRequest) (*domain.Archive, error)
+	DeleteBranch(data *domain.BranchRequest) (*domain.Archive, error)
+	UpdateTenant(data *domain.TenantUpdate) (*domain.Tenant, error)
+	GetArchives() ([]domain.Archive, error)
+	RestoreArchive(id uuid.UUID) error
+	PurgeArchives() (int, error)
 }
 
 type ManageHandler interface {
@@ -43,4 +57,8 @@ type ManageHandler interface {
 	CreateBranch(c *fiber.Ctx) error
 	DeleteCompany(c *fiber.Ctx) error
 	DeleteBranch(c *fiber.Ctx) error
+	UpdateCompanyMetadata(c *fiber.Ctx) error
+	UpdateBranchMetadata(c *fiber.Ctx) error
+	GetArchives(c *fiber.Ctx) error
+	RestoreArchive(c *fiber.Ctx) error
 }
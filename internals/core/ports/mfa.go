@@ -0,0 +1,36 @@
+package ports
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type MFAService interface {
+	Challenge(user *domain.DataReply, role string) (*domain.LoginResult, error)
+	Verify(data *domain.MFAVerifyInput) (*domain.MFAVerifyReply, error)
+	EnrollWithToken(data *domain.MFATokenInput) (*domain.MFAEnrollment, error)
+	Enroll(identity *domain.MFAIdentity) (*domain.MFAEnrollment, error)
+	Confirm(identity *domain.MFAIdentity, data *domain.MFACodeInput) (*domain.RecoveryCodes, error)
+	Disable(identity *domain.MFAIdentity, data *domain.MFACodeInput) error
+	RegenerateRecoveryCodes(identity *domain.MFAIdentity, data *domain.MFACodeInput) (*domain.RecoveryCodes, error)
+}
+
+type MFARepository interface {
+	GetMFA(data *domain.MFA) (*domain.MFA, error)
+	SaveMFA(data *domain.MFA) (*domain.MFA, error)
+	EnableMFA(data *domain.MFA) error
+	DeleteMFA(data *domain.MFA) error
+	UseStep(data *domain.MFA) (bool, error)
+	ReplaceRecoveryCodes(data *domain.MFA, codeHashes []string) error
+	UseRecoveryCode(data *domain.MFA, codeHash string) (bool, error)
+}
+
+type MFAHandler interface {
+	Verify(c *fiber.Ctx) error
+	EnrollWithToken(c *fiber.Ctx) error
+	Enroll(c *fiber.Ctx) error
+	Confirm(c *fiber.Ctx) error
+	Disable(c *fiber.Ctx) error
+	RegenerateRecoveryCodes(c *fiber.Ctx) error
+}
@@ -0,0 +1,30 @@
+package ports
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type NetworkPolicyService interface {
+	// Check returns ErrNetworkNotAllowed or ErrOutsideLoginHours when the
+	// policies of the company and branch refuse the authentication.
+	Check(data *domain.NetworkCheck) error
+	GetPolicies(data *domain.CompanyRequest) ([]domain.NetworkPolicy, error)
+	SavePolicy(data *domain.NetworkPolicy) (*domain.NetworkPolicy, error)
+	DeletePolicy(data *domain.NetworkPolicy) error
+}
+
+type NetworkRepository interface {
+	GetNetworkPolicies(data *domain.NetworkPolicy) ([]domain.NetworkPolicy, error)
+	SaveNetworkPolicy(data *domain.NetworkPolicy) (*domain.NetworkPolicy, error)
+	DeleteNetworkPolicy(data *domain.NetworkPolicy) (bool, error)
+}
+
+type NetworkPolicyHandler interface {
+	GetPolicies(c *fiber.Ctx) error
+	SaveCompanyPolicy(c *fiber.Ctx) error
+	SaveBranchPolicy(c *fiber.Ctx) error
+	DeleteCompanyPolicy(c *fiber.Ctx) error
+	DeleteBranchPolicy(c *fiber.Ctx) error
+}
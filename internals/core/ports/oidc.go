@@ -0,0 +1,36 @@
+package ports
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type OIDCService interface {
+	CheckAuthorize(data *domain.AuthorizeRequest) (*domain.OAuthClient, error)
+	Authorize(principal *domain.Principal, data *domain.AuthorizeRequest) (*domain.AuthorizeReply, error)
+	Token(data *domain.OAuthTokenRequest) (*domain.OAuthTokenReply, error)
+	UserInfo(principal *domain.Principal) (*domain.UserInfo, error)
+	ListClients() ([]domain.OAuthClient, error)
+	CreateClient(data *domain.OAuthClientInput) (*domain.OAuthClientCreated, error)
+	DeleteClient(data *domain.OAuthClient) error
+}
+
+type OIDCRepository interface {
+	GetClients() ([]domain.OAuthClient, error)
+	GetClient(data *domain.OAuthClient) (*domain.OAuthClient, error)
+	CreateClient(data *domain.OAuthClient) (*domain.OAuthClient, error)
+	DeleteClient(data *domain.OAuthClient) (bool, error)
+	CreateCode(data *domain.AuthorizationCode, ttlSeconds int) error
+	UseCode(data *domain.AuthorizationCode) (*domain.AuthorizationCode, error)
+}
+
+type OIDCHandler interface {
+	Authorize(c *fiber.Ctx) error
+	ApproveAuthorize(c *fiber.Ctx) error
+	Token(c *fiber.Ctx) error
+	UserInfo(c *fiber.Ctx) error
+	ListClients(c *fiber.Ctx) error
+	CreateClient(c *fiber.Ctx) error
+	DeleteClient(c *fiber.Ctx) error
+}
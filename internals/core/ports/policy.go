@@ -0,0 +1,37 @@
+package ports
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PolicyService interface {
+	GetPolicy(data *domain.CompanyRequest) (*domain.SecurityPolicy, error)
+	UpdatePolicy(data *domain.SecurityPolicy) (*domain.SecurityPolicy, error)
+}
+
+type PolicyRepository interface {
+	GetPolicy(data *domain.SecurityPolicy) (*domain.SecurityPolicy, error)
+	SavePolicy(data *domain.SecurityPolicy) (*domain.SecurityPolicy, error)
+	GetPasswordHistory(data *domain.Data, limit int) ([]string, error)
+	AddPasswordHistory(data *domain.Data) error
+}
+
+// PasswordPolicy checks new passwords against the company's policy and keeps
+// the password history.
+type PasswordPolicy interface {
+	Check(user *domain.Data, password string) error
+	Record(user *domain.Data) error
+	Expired(user *domain.Data) (bool, error)
+}
+
+// BreachList tells whether a password is known from public breaches.
+type BreachList interface {
+	Contains(password string) bool
+}
+
+type PolicyHandler interface {
+	GetPolicy(c *fiber.Ctx) error
+	UpdatePolicy(c *fiber.Ctx) error
+}
@@ -0,0 +1,43 @@
+package ports
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type RoleService interface {
+	ListRoles(principal *domain.Principal) ([]domain.CustomRole, error)
+	CreateRole(principal *domain.Principal, data *domain.RoleInput) (*domain.CustomRole, error)
+	UpdateRole(principal *domain.Principal, id uuid.UUID, data *domain.RoleInput) (*domain.CustomRole, error)
+	DeleteRole(principal *domain.Principal, id uuid.UUID) error
+	AssignRole(principal *domain.Principal, data *domain.RoleAssignment) error
+	UnassignRole(principal *domain.Principal, data *domain.RoleAssignment) error
+	UserRoles(principal *domain.Principal, data *domain.RoleAssignment) ([]domain.CustomRole, error)
+	Permissions(userID uuid.UUID, role string) ([]string, error)
+}
+
+type RoleRepository interface {
+	GetRoles(data *domain.CustomRole) ([]domain.CustomRole, error)
+	GetRole(data *domain.CustomRole) (*domain.CustomRole, error)
+	CreateRole(data *domain.CustomRole) (*domain.CustomRole, error)
+	UpdateRole(data *domain.CustomRole) (*domain.CustomRole, error)
+	DeleteRole(data *domain.CustomRole) (bool, error)
+	AssignRole(data *domain.RoleAssignment) error
+	UnassignRole(data *domain.RoleAssignment) error
+	GetUserRoles(data *domain.RoleAssignment) ([]domain.CustomRole, error)
+	GetRoleMembers(data *domain.CustomRole) ([]domain.RoleAssignment, error)
+	GetUserPermissions(data *domain.RoleAssignment) ([]string, error)
+}
+
+type RoleHandler interface {
+	ListPermissions(c *fiber.Ctx) error
+	ListRoles(c *fiber.Ctx) error
+	CreateRole(c *fiber.Ctx) error
+	UpdateRole(c *fiber.Ctx) error
+	DeleteRole(c *fiber.Ctx) error
+	AssignRole(c *fiber.Ctx) error
+	UnassignRole(c *fiber.Ctx) error
+	UserRoles(c *fiber.Ctx) error
+}
@@ -0,0 +1,36 @@
+package ports
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type SCIMService interface {
+	ListUsers(principal *domain.Principal, data *domain.SCIMListInput) (*domain.SCIMListResponse, error)
+	GetUser(principal *domain.Principal, id string) (*domain.SCIMUser, error)
+	CreateUser(principal *domain.Principal, data *domain.SCIMUser) (*domain.SCIMUser, error)
+	ReplaceUser(principal *domain.Principal, id string, data *domain.SCIMUser) (*domain.SCIMUser, error)
+	PatchUser(principal *domain.Principal, id string, data *domain.SCIMPatch) (*domain.SCIMUser, error)
+	DeleteUser(principal *domain.Principal, id string) error
+	ListGroups(principal *domain.Principal, data *domain.SCIMListInput) (*domain.SCIMListResponse, error)
+	GetGroup(principal *domain.Principal, id string) (*domain.SCIMGroup, error)
+	CreateGroup(principal *domain.Principal, data *domain.SCIMGroup) (*domain.SCIMGroup, error)
+	PatchGroup(principal *domain.Principal, id string, data *domain.SCIMPatch) (*domain.SCIMGroup, error)
+	DeleteGroup(principal *domain.Principal, id string) error
+}
+
+type SCIMHandler interface {
+	ServiceProviderConfig(c *fiber.Ctx) error
+	ListUsers(c *fiber.Ctx) error
+	GetUser(c *fiber.Ctx) error
+	CreateUser(c *fiber.Ctx) error
+	ReplaceUser(c *fiber.Ctx) error
+	PatchUser(c *fiber.Ctx) error
+	DeleteUser(c *fiber.Ctx) error
+	ListGroups(c *fiber.Ctx) error
+	GetGroup(c *fiber.Ctx) error
+	CreateGroup(c *fiber.Ctx) error
+	PatchGroup(c *fiber.Ctx) error
+	DeleteGroup(c *fiber.Ctx) error
+}
@@ -0,0 +1,19 @@
+package ports
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type TenantStatusService interface {
+	// Check returns ErrTenantSuspended when the company or branch is
+	// suspended, and ErrTenantReadOnly when write is set and it is read-only.
+	Check(company, branch string, write bool) error
+	SetStatus(data *domain.TenantStatusInput) (*domain.Tenant, error)
+}
+
+type TenantHandler interface {
+	SetCompanyStatus(c *fiber.Ctx) error
+	SetBranchStatus(c *fiber.Ctx) error
+}
@@ -0,0 +1,39 @@
+package ports
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type TokenService interface {
+	Issue(user *domain.DataReply, role string, device *domain.Device) (*domain.TokenPair, error)
+	Impersonate(target *domain.Data, actor *domain.Actor, ttl time.Duration) (*domain.Session, *domain.TokenPair, error)
+	Refresh(data *domain.RefreshInput) (*domain.TokenPair, error)
+	Logout(data *domain.LogoutInput) error
+	RevokeUserSessions(userID uuid.UUID) error
+	ValidateSession(sessionID uuid.UUID) error
+	ListSessions(principal *domain.Principal, userID uuid.UUID) ([]domain.Session, error)
+	RevokeSession(principal *domain.Principal, userID uuid.UUID, sessionID uuid.UUID) error
+}
+
+type TokenRepository interface {
+	CreateSession(data *domain.Session) (*domain.Session, error)
+	GetSession(data *domain.Session) (*domain.Session, error)
+	GetUserSessions(data *domain.Session, idleSeconds int) ([]domain.Session, error)
+	TouchSession(data *domain.Session) error
+	RevokeSession(data *domain.Session) error
+	RevokeUserSessions(data *domain.Session) error
+	CreateRefreshToken(data *domain.RefreshToken) (*domain.RefreshToken, error)
+	GetRefreshToken(data *domain.RefreshToken) (*domain.RefreshToken, error)
+	UseRefreshToken(data *domain.RefreshToken) (bool, error)
+}
+
+type SessionHandler interface {
+	ListMySessions(c *fiber.Ctx) error
+	RevokeMySession(c *fiber.Ctx) error
+	ListUserSessions(c *fiber.Ctx) error
+	RevokeUserSession(c *fiber.Ctx) error
+}
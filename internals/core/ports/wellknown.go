@@ -0,0 +1,8 @@
+package ports
+
+import "github.com/gofiber/fiber/v2"
+
+type WellKnownHandler interface {
+	JWKS(c *fiber.Ctx) error
+	OpenIDConfiguration(c *fiber.Ctx) error
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"go-multi-tenancy/internals/utils"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type accountService struct {
+	companyRepository     ports.CompanyRepository
+	actionTokenRepository ports.ActionTokenRepository
+	tokenService          ports.TokenService
+	passwordHasher        ports.PasswordHasher
+	passwordPolicy        ports.PasswordPolicy
+	tenantStatus          ports.TenantStatusService
+	mailer                ports.Mailer
+	baseURL               string
+	resetTTL              time.Duration
+	verificationTTL       time.Duration
+}
+
+func NewAccountService(companyRepository ports.CompanyRepository, actionTokenRepository ports.ActionTokenRepository, tokenService ports.TokenService, passwordHasher ports.PasswordHasher, passwordPolicy ports.PasswordPolicy, tenantStatus ports.TenantStatusService, mailer ports.Mailer, baseURL string, resetTTL time.Duration, verificationTTL time.Duration) *accountService {
+	return &accountService{
+		companyRepository:     companyRepository,
+		actionTokenRepository: actionTokenRepository,
+		tokenService:          tokenService,
+		passwordHasher:        passwordHasher,
+		passwordPolicy:        passwordPolicy,
+		tenantStatus:          tenantStatus,
+		mailer:                mailer,
+		baseURL:               baseURL,
+		resetTTL:              resetTTL,
+		verificationTTL:       verificationTTL,
+	}
+}
+
+// RequestPasswordReset mails a reset link to the account's address. It
+// succeeds for unknown accounts too, so the endpoint cannot be used to find
+// out which usernames exist.
+func (s *accountService) RequestPasswordReset(data *domain.ForgotPasswordInput) error {
+	if data.Company == "" || data.Branch == "" || (data.Username == "" && data.Email == "") {
+		return errors.New("company, branch and username or email are required")
+	}
+
+	var user *domain.Data
+	var err error
+	if data.Username != "" {
+		user, err = s.companyRepository.Login(&domain.Data{Company: data.Company, Branch: data.Branch, Username: data.Username})
+	} else {
+		user, err = s.companyRepository.GetByEmail(&domain.Data{Company: data.Company, Branch: data.Branch, Email: data.Email})
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	if user.Email == "" {
+		return nil
+	}
+
+	token, err := s.issue(domain.PurposePasswordReset, user, s.resetTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(&domain.Mail{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nUse the link below to choose a new password. It expires in %s and works once.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.FirstName, s.resetTTL, s.link("/reset-password", token)),
+	})
+}
+
+// ResetPassword sets a new password from a reset token and signs the user
+// out everywhere, since whoever held the old password may still be logged in.
+func (s *accountService) ResetPassword(data *domain.ResetPasswordInput) error {
+	if data.Password == "" {
+		return errors.New("password cannot be empty")
+	}
+
+	claims, err := utils.ParseActionToken(data.Token, domain.PurposePasswordReset)
+	if err != nil {
+		return domain.ErrInvalidActionToken
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return domain.ErrInvalidActionToken
+	}
+
+	if err := s.tenantStatus.Check(claims.Company, claims.Branch, true); err != nil {
+		return err
+	}
+
+	user, err := s.companyRepository.GetOne(&domain.Data{
+		Company: claims.Company,
+		Branch:  claims.Branch,
+		ID:      userID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrInvalidActionToken
+		}
+		return err
+	}
+
+	// Checked before the token is burnt, so a rejected password can be retried with the same link
+	if err := s.passwordPolicy.Check(user, data.Password); err != nil {
+		return err
+	}
+
+	if _, err := s.consume(domain.PurposePasswordReset, data.Token); err != nil {
+		return err
+	}
+
+	user.Password, err = s.passwordHasher.Hash(data.Password)
+	if err != nil {
+		return err
+	}
+
+	if err := s.companyRepository.ChangePassword(user); err != nil {
+		return err
+	}
+
+	if err := s.passwordPolicy.Record(user); err != nil {
+		return err
+	}
+
+	return s.tokenService.RevokeUserSessions(user.ID)
+}
+
+func (s *accountService) RequestEmailVerification(data *domain.Me) error {
+	user, err := s.companyRepository.GetMe(&domain.Data{
+		Company: data.Company,
+		Branch:  data.Branch,
+		ID:      data.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	return s.sendVerification(user)
+}
+
+func (s *accountService) SendEmailVerification(user *domain.DataReply) error {
+	return s.sendVerification(&domain.Data{
+		Company:   user.Company,
+		Branch:    user.Branch,
+		ID:        user.ID,
+		FirstName: user.FirstName,
+		Email:     user.Email,
+	})
+}
+
+// VerifyEmail marks the address the token was sent to as verified. A token
+// for an address the user has since changed does not verify the new one.
+func (s *accountService) VerifyEmail(data *domain.VerifyEmailInput) error {
+	claims, err := s.consume(domain.PurposeEmailVerification, data.Token)
+	if err != nil {
+		return err
+	}
+
+	return s.companyRepository.VerifyEmail(&domain.Data{
+		Company: claims.Company,
+		Branch:  claims.Branch,
+		ID:      uuid.MustParse(claims.UserID),
+		Email:   claims.Email,
+	})
+}
+
+func (s *accountService) sendVerification(user *domain.Data) error {
+	if user.Email == "" {
+		return domain.ErrEmailMissing
+	}
+
+	token, err := s.issue(domain.PurposeEmailVerification, user, s.verificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(&domain.Mail{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nConfirm that this address belongs to you by opening the link below. It expires in %s.\n\n%s\n",
+			user.FirstName, s.verificationTTL, s.link("/verify-email", token)),
+	})
+}
+
+// issue records a single-use token and returns it signed. The signature
+// makes it tamper proof, the stored row makes it usable once.
+func (s *accountService) issue(purpose string, user *domain.Data, ttl time.Duration) (string, error) {
+	if _, err := mail.ParseAddress(user.Email); err != nil {
+		return "", errors.New("invalid email address")
+	}
+
+	record, err := s.actionTokenRepository.CreateActionToken(&domain.ActionToken{
+		Purpose:   purpose,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims := &utils.ActionClaims{
+		Purpose: purpose,
+		UserID:  user.ID.String(),
+		Company: user.Company,
+		Branch:  user.Branch,
+		Email:   user.Email,
+	}
+	claims.Id = record.ID.String()
+
+	return utils.GenerateActionToken(claims, ttl)
+}
+
+// consume verifies a token and burns it.
+func (s *accountService) consume(purpose string, token string) (*utils.ActionClaims, error) {
+	claims, err := utils.ParseActionToken(token, purpose)
+	if err != nil {
+		return nil, domain.ErrInvalidActionToken
+	}
+
+	id, err := uuid.Parse(claims.Id)
+	if err != nil {
+		return nil, domain.ErrInvalidActionToken
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return nil, domain.ErrInvalidActionToken
+	}
+
+	ok, err := s.actionTokenRepository.UseActionToken(&domain.ActionToken{
+		ID:      id,
+		Purpose: purpose,
+		UserID:  userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, domain.ErrInvalidActionToken
+	}
+
+	return claims, nil
+}
+
+func (s *accountService) link(path string, token string) string {
+	return s.baseURL + path + "?token=" + url.QueryEscape(token)
+}
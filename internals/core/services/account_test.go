@@ -0,0 +1,264 @@
+package services
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// outbox collects mails instead of sending them.
+type outbox struct {
+	mails []domain.Mail
+}
+
+func (o *outbox) Send(mail *domain.Mail) error {
+	o.mails = append(o.mails, *mail)
+	return nil
+}
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// token returns the token of the link in the last mail.
+func (o *outbox) token(t *testing.T) string {
+	t.Helper()
+
+	if len(o.mails) == 0 {
+		t.Fatal("no mail was sent")
+	}
+	link, err := url.Parse(linkPattern.FindString(o.mails[len(o.mails)-1].Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return link.Query().Get("token")
+}
+
+// revokingTokenService records whose sessions were revoked.
+type revokingTokenService struct {
+	ports.TokenService
+	revoked []uuid.UUID
+}
+
+func (s *revokingTokenService) RevokeUserSessions(userID uuid.UUID) error {
+	s.revoked = append(s.revoked, userID)
+	return nil
+}
+
+// weakPasswords refuses the password "weak" and accepts every other one.
+type weakPasswords struct {
+	allowAll
+}
+
+func (weakPasswords) Check(user *domain.Data, password string) error {
+	if password == "weak" {
+		return &domain.PasswordPolicyError{Violations: []string{"too short"}}
+	}
+	return nil
+}
+
+type accountFixture struct {
+	service  *accountService
+	users    *fakeCompanyRepository
+	tokens   *fakeActionTokenRepository
+	sessions *revokingTokenService
+	mail     *outbox
+	status   *fakeTenantStatus
+	user     *domain.Data
+}
+
+func newAccountFixture(t *testing.T) *accountFixture {
+	t.Helper()
+
+	user := newUser("acme", "hq", "alice", "user")
+	user.Email = "alice@acme.test"
+	user.Password = "old-hash"
+
+	f := &accountFixture{
+		users:    newFakeCompanyRepository(user),
+		tokens:   newFakeActionTokenRepository(),
+		sessions: &revokingTokenService{},
+		mail:     &outbox{},
+		status:   &fakeTenantStatus{errs: map[string]error{}},
+		user:     user,
+	}
+	f.service = NewAccountService(f.users, f.tokens, f.sessions, newTestHasher(t), weakPasswords{}, f.status, f.mail, "https://id.acme.test", time.Hour, time.Hour)
+	return f
+}
+
+func (f *accountFixture) requestReset(t *testing.T) string {
+	t.Helper()
+
+	if err := f.service.RequestPasswordReset(&domain.ForgotPasswordInput{Company: "acme", Branch: "hq", Username: "alice"}); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	return f.mail.token(t)
+}
+
+func TestResetPassword(t *testing.T) {
+	f := newAccountFixture(t)
+	token := f.requestReset(t)
+
+	if to := f.mail.mails[0].To; to != "alice@acme.test" {
+		t.Errorf("reset mailed to %q", to)
+	}
+
+	if err := f.service.ResetPassword(&domain.ResetPasswordInput{Token: token, Password: "n3w-passw0rd"}); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+
+	if ok, _ := newTestHasher(t).Verify("n3w-passw0rd", f.users.users[f.user.ID].Password); !ok {
+		t.Error("new password was not stored hashed")
+	}
+	if len(f.sessions.revoked) != 1 || f.sessions.revoked[0] != f.user.ID {
+		t.Errorf("revoked sessions of %v, want the user's", f.sessions.revoked)
+	}
+
+	// The link works once
+	err := f.service.ResetPassword(&domain.ResetPasswordInput{Token: token, Password: "an0ther-passw0rd"})
+	if !errors.Is(err, domain.ErrInvalidActionToken) {
+		t.Errorf("second use: err = %v, want ErrInvalidActionToken", err)
+	}
+}
+
+func TestResetPasswordKeepsTokenForRejectedPassword(t *testing.T) {
+	f := newAccountFixture(t)
+	token := f.requestReset(t)
+
+	err := f.service.ResetPassword(&domain.ResetPasswordInput{Token: token, Password: "weak"})
+	var policyErr *domain.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("err = %v, want the policy error", err)
+	}
+
+	if err := f.service.ResetPassword(&domain.ResetPasswordInput{Token: token, Password: "n3w-passw0rd"}); err != nil {
+		t.Errorf("retry with the same link: %v", err)
+	}
+}
+
+func TestResetPasswordFollowsTenantStatus(t *testing.T) {
+	f := newAccountFixture(t)
+	token := f.requestReset(t)
+	f.status.errs["acme"] = domain.ErrTenantSuspended
+
+	err := f.service.ResetPassword(&domain.ResetPasswordInput{Token: token, Password: "n3w-passw0rd"})
+	if !errors.Is(err, domain.ErrTenantSuspended) {
+		t.Fatalf("err = %v, want ErrTenantSuspended", err)
+	}
+	if f.users.users[f.user.ID].Password != "old-hash" {
+		t.Error("password changed in a suspended tenant")
+	}
+
+	// Refused before the token is burnt, so the link works once the tenant is back
+	delete(f.status.errs, "acme")
+	if err := f.service.ResetPassword(&domain.ResetPasswordInput{Token: token, Password: "n3w-passw0rd"}); err != nil {
+		t.Errorf("after reactivation: %v", err)
+	}
+}
+
+func TestResetPasswordRefusesTokens(t *testing.T) {
+	tests := map[string]func(t *testing.T, f *accountFixture) string{
+		"garbage": func(*testing.T, *accountFixture) string {
+			return "not-a-token"
+		},
+		"expired": func(t *testing.T, f *accountFixture) string {
+			token := f.requestReset(t)
+			for _, record := range f.tokens.tokens {
+				record.ExpiresAt = time.Now().Add(-time.Second)
+			}
+			return token
+		},
+		"email verification token": func(t *testing.T, f *accountFixture) string {
+			if err := f.service.RequestEmailVerification(&domain.Me{Company: "acme", Branch: "hq", ID: f.user.ID}); err != nil {
+				t.Fatal(err)
+			}
+			return f.mail.token(t)
+		},
+		"user deleted": func(t *testing.T, f *accountFixture) string {
+			token := f.requestReset(t)
+			f.users.delete(f.user.ID)
+			return token
+		},
+	}
+
+	for name, prepare := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := newAccountFixture(t)
+			token := prepare(t, f)
+
+			err := f.service.ResetPassword(&domain.ResetPasswordInput{Token: token, Password: "n3w-passw0rd"})
+			if !errors.Is(err, domain.ErrInvalidActionToken) {
+				t.Errorf("err = %v, want ErrInvalidActionToken", err)
+			}
+			if len(f.sessions.revoked) != 0 {
+				t.Error("sessions were revoked for a refused token")
+			}
+		})
+	}
+}
+
+func TestRequestPasswordResetForUnknownAccount(t *testing.T) {
+	f := newAccountFixture(t)
+
+	inputs := []*domain.ForgotPasswordInput{
+		{Company: "acme", Branch: "hq", Username: "bob"},
+		{Company: "acme", Branch: "hq", Email: "bob@acme.test"},
+		{Company: "acme", Branch: "east", Username: "alice"},
+	}
+	for _, input := range inputs {
+		if err := f.service.RequestPasswordReset(input); err != nil {
+			t.Errorf("%+v: err = %v, want the same answer as for a known account", input, err)
+		}
+	}
+
+	if len(f.mail.mails) != 0 || len(f.tokens.tokens) != 0 {
+		t.Errorf("%d mails and %d tokens for unknown accounts", len(f.mail.mails), len(f.tokens.tokens))
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	f := newAccountFixture(t)
+
+	if err := f.service.RequestEmailVerification(&domain.Me{Company: "acme", Branch: "hq", ID: f.user.ID}); err != nil {
+		t.Fatalf("RequestEmailVerification: %v", err)
+	}
+	token := f.mail.token(t)
+
+	// A reset token does not verify the address
+	if err := f.service.VerifyEmail(&domain.VerifyEmailInput{Token: f.requestReset(t)}); !errors.Is(err, domain.ErrInvalidActionToken) {
+		t.Errorf("reset token: err = %v, want ErrInvalidActionToken", err)
+	}
+
+	if err := f.service.VerifyEmail(&domain.VerifyEmailInput{Token: token}); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if f.users.users[f.user.ID].EmailVerifiedAt == nil {
+		t.Error("address was not marked verified")
+	}
+
+	if err := f.service.VerifyEmail(&domain.VerifyEmailInput{Token: token}); !errors.Is(err, domain.ErrInvalidActionToken) {
+		t.Errorf("second use: err = %v, want ErrInvalidActionToken", err)
+	}
+}
+
+func TestVerifyEmailAfterAddressChange(t *testing.T) {
+	f := newAccountFixture(t)
+
+	if err := f.service.RequestEmailVerification(&domain.Me{Company: "acme", Branch: "hq", ID: f.user.ID}); err != nil {
+		t.Fatal(err)
+	}
+	token := f.mail.token(t)
+
+	f.users.users[f.user.ID].Email = "mallory@evil.test"
+
+	if err := f.service.VerifyEmail(&domain.VerifyEmailInput{Token: token}); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if f.users.users[f.user.ID].EmailVerifiedAt != nil {
+		t.Error("the new address was verified with a token sent to the old one")
+	}
+}
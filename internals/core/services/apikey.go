@@ -0,0 +1,158 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"go-multi-tenancy/internals/utils"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type apiKeyService struct {
+	apiKeyRepository ports.APIKeyRepository
+}
+
+func NewAPIKeyService(apiKeyRepository ports.APIKeyRepository) *apiKeyService {
+	return &apiKeyService{
+		apiKeyRepository: apiKeyRepository,
+	}
+}
+
+// ListAPIKeys returns the keys the caller can manage: the whole company's
+// with branches:manage, otherwise those of the caller's branch.
+func (s *apiKeyService) ListAPIKeys(principal *domain.Principal) ([]domain.APIKey, error) {
+	keys, err := s.apiKeyRepository.GetAPIKeys(&domain.APIKey{Company: principal.Company})
+	if err != nil {
+		return nil, err
+	}
+
+	visible := []domain.APIKey{}
+	for _, key := range keys {
+		if domain.InTenantScope(principal.Permissions, principal.Company, principal.Branch, key.Company, key.Branch) {
+			visible = append(visible, key)
+		}
+	}
+
+	return visible, nil
+}
+
+// CreateAPIKey issues a key for the caller's company, or one of its branches.
+// The key can only carry permissions the caller holds.
+func (s *apiKeyService) CreateAPIKey(principal *domain.Principal, data *domain.APIKeyInput) (*domain.APIKeyCreated, error) {
+	name := strings.TrimSpace(data.Name)
+	if name == "" {
+		return nil, errors.New("API key name cannot be empty")
+	}
+
+	if data.ExpiresIn < 0 {
+		return nil, errors.New("expires_in cannot be negative")
+	}
+
+	if !domain.InTenantScope(principal.Permissions, principal.Company, principal.Branch, principal.Company, data.Branch) {
+		return nil, domain.ErrOutOfTenantScope
+	}
+
+	perms := []string{}
+	for _, perm := range data.Permissions {
+		if !domain.AssignablePermission(perm) {
+			return nil, domain.ErrUnknownPermission
+		}
+		if !domain.HasPermission(principal.Permissions, perm) {
+			return nil, domain.ErrPermissionEscalated
+		}
+		if !domain.HasPermission(perms, perm) {
+			perms = append(perms, perm)
+		}
+	}
+
+	// A company-wide key reaches every branch, which the caller is known to
+	// be allowed from the scope check above
+	if data.Branch == "" && !domain.HasPermission(perms, domain.PermBranchesManage) {
+		perms = append(perms, domain.PermBranchesManage)
+	}
+
+	prefix := make([]byte, 6)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	key := domain.APIKeyPrefix + "_" + hex.EncodeToString(prefix) + "_" + secret
+
+	record, err := s.apiKeyRepository.CreateAPIKey(&domain.APIKey{
+		Company:     principal.Company,
+		Branch:      data.Branch,
+		Name:        name,
+		Prefix:      hex.EncodeToString(prefix),
+		KeyHash:     utils.HashToken(key),
+		Permissions: perms,
+		CreatedBy:   principal.UserID,
+	}, data.ExpiresIn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.APIKeyCreated{APIKey: record, Key: key}, nil
+}
+
+func (s *apiKeyService) RevokeAPIKey(principal *domain.Principal, id uuid.UUID) error {
+	key, err := s.apiKeyRepository.GetAPIKey(&domain.APIKey{ID: id, Company: principal.Company})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrInvalidAPIKey
+		}
+		return err
+	}
+
+	if !domain.InTenantScope(principal.Permissions, principal.Company, principal.Branch, key.Company, key.Branch) {
+		return domain.ErrOutOfTenantScope
+	}
+
+	ok, err := s.apiKeyRepository.RevokeAPIKey(key)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return domain.ErrInvalidAPIKey
+	}
+
+	return nil
+}
+
+// Authenticate resolves a presented key of the form mt_<prefix>_<secret> to
+// its active record.
+func (s *apiKeyService) Authenticate(key string) (*domain.APIKey, error) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != domain.APIKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	record, err := s.apiKeyRepository.GetActiveAPIKey(&domain.APIKey{Prefix: parts[1]})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(key)), []byte(record.KeyHash)) != 1 {
+		return nil, domain.ErrInvalidAPIKey
+	}
+
+	if err := s.apiKeyRepository.TouchAPIKey(record); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeAPIKeyRepository keeps API keys in memory with the same rules as the
+// database: revoked and expired keys are not active.
+type fakeAPIKeyRepository struct {
+	mu   sync.Mutex
+	keys map[uuid.UUID]*domain.APIKey
+}
+
+func newFakeAPIKeyRepository(keys ...*domain.APIKey) *fakeAPIKeyRepository {
+	r := &fakeAPIKeyRepository{keys: map[uuid.UUID]*domain.APIKey{}}
+	for _, key := range keys {
+		r.keys[key.ID] = key
+	}
+	return r
+}
+
+func (r *fakeAPIKeyRepository) GetAPIKeys(data *domain.APIKey) ([]domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := []domain.APIKey{}
+	for _, key := range r.keys {
+		if key.Company == data.Company {
+			keys = append(keys, *key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *fakeAPIKeyRepository) GetAPIKey(data *domain.APIKey) (*domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[data.ID]
+	if !ok || key.Company != data.Company {
+		return nil, sql.ErrNoRows
+	}
+	found := *key
+	return &found, nil
+}
+
+func (r *fakeAPIKeyRepository) GetActiveAPIKey(data *domain.APIKey) (*domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range r.keys {
+		if key.Prefix == data.Prefix && key.RevokedAt == nil && (key.ExpiresAt == nil || time.Now().Before(*key.ExpiresAt)) {
+			found := *key
+			return &found, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeAPIKeyRepository) CreateAPIKey(data *domain.APIKey, expiresIn int) (*domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data.ID = uuid.New()
+	if expiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(expiresIn) * time.Second)
+		data.ExpiresAt = &expiresAt
+	}
+	key := *data
+	r.keys[data.ID] = &key
+	return data, nil
+}
+
+func (r *fakeAPIKeyRepository) RevokeAPIKey(data *domain.APIKey) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[data.ID]
+	if !ok || key.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	key.RevokedAt = &now
+	return true, nil
+}
+
+func (r *fakeAPIKeyRepository) TouchAPIKey(data *domain.APIKey) error {
+	return nil
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	repository := newFakeAPIKeyRepository()
+	s := NewAPIKeyService(repository)
+
+	created, err := s.CreateAPIKey(branchAdmin, &domain.APIKeyInput{Name: "ci", Branch: "hq", Permissions: []string{domain.PermUsersRead}})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	parts := strings.SplitN(created.Key, "_", 3)
+	if len(parts) != 3 || parts[0] != domain.APIKeyPrefix || parts[1] != created.APIKey.Prefix {
+		t.Fatalf("key %q does not have the form %s_<prefix>_<secret>", created.Key, domain.APIKeyPrefix)
+	}
+	prefix, secret := parts[1], parts[2]
+
+	record, err := s.Authenticate(created.Key)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if record.Company != "acme" || record.Branch != "hq" || !reflect.DeepEqual(record.Permissions, []string{domain.PermUsersRead}) {
+		t.Errorf("record = %+v", record)
+	}
+
+	malformed := map[string]string{
+		"empty":          "",
+		"scheme only":    domain.APIKeyPrefix,
+		"no secret":      domain.APIKeyPrefix + "_" + prefix,
+		"empty secret":   domain.APIKeyPrefix + "_" + prefix + "_",
+		"empty prefix":   domain.APIKeyPrefix + "__" + secret,
+		"other scheme":   "sk_" + prefix + "_" + secret,
+		"wrong secret":   domain.APIKeyPrefix + "_" + prefix + "_" + strings.Repeat("A", len(secret)),
+		"unknown prefix": domain.APIKeyPrefix + "_000000000000_" + secret,
+	}
+	for name, key := range malformed {
+		t.Run(name, func(t *testing.T) {
+			if _, err := s.Authenticate(key); !errors.Is(err, domain.ErrInvalidAPIKey) {
+				t.Errorf("err = %v, want ErrInvalidAPIKey", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRefusesInactiveKeys(t *testing.T) {
+	tests := map[string]func(s *apiKeyService, repository *fakeAPIKeyRepository, key *domain.APIKeyCreated){
+		"revoked": func(s *apiKeyService, repository *fakeAPIKeyRepository, key *domain.APIKeyCreated) {
+			if err := s.RevokeAPIKey(branchAdmin, key.APIKey.ID); err != nil {
+				t.Fatalf("RevokeAPIKey: %v", err)
+			}
+		},
+		"expired": func(s *apiKeyService, repository *fakeAPIKeyRepository, key *domain.APIKeyCreated) {
+			expired := time.Now().Add(-time.Second)
+			repository.keys[key.APIKey.ID].ExpiresAt = &expired
+		},
+	}
+
+	for name, deactivate := range tests {
+		t.Run(name, func(t *testing.T) {
+			repository := newFakeAPIKeyRepository()
+			s := NewAPIKeyService(repository)
+
+			key, err := s.CreateAPIKey(branchAdmin, &domain.APIKeyInput{Name: "ci", Branch: "hq", ExpiresIn: 3600})
+			if err != nil {
+				t.Fatalf("CreateAPIKey: %v", err)
+			}
+			if _, err := s.Authenticate(key.Key); err != nil {
+				t.Fatalf("fresh key: %v", err)
+			}
+
+			deactivate(s, repository, key)
+			if _, err := s.Authenticate(key.Key); !errors.Is(err, domain.ErrInvalidAPIKey) {
+				t.Errorf("err = %v, want ErrInvalidAPIKey", err)
+			}
+		})
+	}
+}
+
+func TestCreateAPIKeyPermissions(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *domain.Principal
+		branch    string
+		perms     []string
+		want      []string
+		err       error
+	}{
+		{name: "subset of the caller's", principal: branchAdmin, branch: "hq", perms: []string{domain.PermUsersRead, domain.PermUsersRead}, want: []string{domain.PermUsersRead}},
+		{name: "none", principal: branchAdmin, branch: "hq", want: []string{}},
+		{name: "one the caller lacks", principal: branchAdmin, branch: "hq", perms: []string{domain.PermUsersRead, domain.PermRolesManage}, err: domain.ErrPermissionEscalated},
+		{name: "company-wide key reaches every branch", principal: companyAdmin, perms: []string{domain.PermUsersRead}, want: []string{domain.PermUsersRead, domain.PermBranchesManage}},
+		{name: "unassignable", principal: superAdmin, branch: "hq", perms: []string{domain.PermTenantsManage}, err: domain.ErrUnknownPermission},
+		{name: "unknown", principal: companyAdmin, branch: "hq", perms: []string{"billing:manage"}, err: domain.ErrUnknownPermission},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := newFakeAPIKeyRepository()
+			s := NewAPIKeyService(repository)
+
+			created, err := s.CreateAPIKey(tt.principal, &domain.APIKeyInput{Name: "ci", Branch: tt.branch, Permissions: tt.perms})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				if len(repository.keys) != 0 {
+					t.Error("refused key was stored")
+				}
+				return
+			}
+			if !reflect.DeepEqual(created.APIKey.Permissions, tt.want) {
+				t.Errorf("permissions = %v, want %v", created.APIKey.Permissions, tt.want)
+			}
+			if created.APIKey.KeyHash == created.Key || strings.Contains(created.APIKey.KeyHash, created.Key) {
+				t.Error("the key is stored in clear")
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"go-multi-tenancy/internals/utils"
+	"strings"
+	"sync"
+)
+
+type bootstrapService struct {
+	manageRepository ports.ManageRepository
+	passwordHasher   ports.PasswordHasher
+	passwordPolicy   ports.PasswordPolicy
+
+	mu        sync.Mutex
+	tokenHash string // cleared once the token has been used
+}
+
+// NewBootstrapService accepts token once to create the first super admin,
+// and the company and branch they belong to on a fresh install. An empty
+// token disables bootstrapping.
+func NewBootstrapService(manageRepository ports.ManageRepository, passwordHasher ports.PasswordHasher, passwordPolicy ports.PasswordPolicy, token string) *bootstrapService {
+	s := &bootstrapService{
+		manageRepository: manageRepository,
+		passwordHasher:   passwordHasher,
+		passwordPolicy:   passwordPolicy,
+	}
+	if token != "" {
+		s.tokenHash = utils.HashToken(token)
+	}
+	return s
+}
+
+func (s *bootstrapService) Bootstrap(data *domain.BootstrapInput) (*domain.DataReply, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tokenHash == "" || subtle.ConstantTimeCompare([]byte(utils.HashToken(data.Token)), []byte(s.tokenHash)) != 1 {
+		return nil, domain.ErrInvalidBootstrapToken
+	}
+
+	if data.Username == "" || data.Password == "" || data.Company == "" || data.Branch == "" {
+		return nil, errors.New("username or password cannot be empty")
+	}
+
+	company, branch := strings.ToLower(data.Company), strings.ToLower(data.Branch)
+	if err := validTenantNames(company, branch); err != nil {
+		return nil, err
+	}
+
+	user := &domain.Data{
+		Company:   company,
+		Branch:    branch,
+		Username:  data.Username,
+		FirstName: data.FirstName,
+		LastName:  data.LastName,
+		Email:     data.Email,
+	}
+	if err := s.passwordPolicy.Check(user, data.Password); err != nil {
+		return nil, err
+	}
+
+	var err error
+	user.Password, err = s.passwordHasher.Hash(data.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.manageRepository.RegisterFirstSuperAdmin(user)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		s.tokenHash = ""
+		return nil, domain.ErrAlreadyBootstrapped
+	}
+	s.tokenHash = ""
+
+	if err := s.passwordPolicy.Record(user); err != nil {
+		return nil, err
+	}
+
+	return &domain.DataReply{
+		ID:        user.ID,
+		Company:   user.Company,
+		Branch:    user.Branch,
+		Username:  user.Username,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		CreatedAt: user.CreateAt,
+	}, nil
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"testing"
+)
+
+func bootstrapInput(token string) *domain.BootstrapInput {
+	return &domain.BootstrapInput{
+		Token:    token,
+		Company:  "Acme",
+		Branch:   "HQ",
+		Username: "root",
+		Password: "correct horse battery staple",
+	}
+}
+
+func TestBootstrapCreatesTenantOnce(t *testing.T) {
+	repo := newFakeManageRepository()
+	s := NewBootstrapService(repo, newTestHasher(t), allowAll{}, "s3cr3t")
+
+	reply, err := s.Bootstrap(bootstrapInput("s3cr3t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Company != "acme" || reply.Branch != "hq" {
+		t.Errorf("bootstrapped into %s/%s, want acme/hq", reply.Company, reply.Branch)
+	}
+	if _, ok := repo.tenants["acme/hq"]; !ok {
+		t.Error("company and branch were not created")
+	}
+	if repo.superAdmin == nil || repo.superAdmin.Password == "correct horse battery staple" {
+		t.Error("super admin missing or stored with a plain password")
+	}
+
+	// The token is spent even though the caller still holds it
+	if _, err := s.Bootstrap(bootstrapInput("s3cr3t")); !errors.Is(err, domain.ErrInvalidBootstrapToken) {
+		t.Errorf("second bootstrap = %v, want %v", err, domain.ErrInvalidBootstrapToken)
+	}
+}
+
+func TestBootstrapRefusesBadInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input func(*domain.BootstrapInput)
+		token string
+		want  error
+	}{
+		{name: "wrong token", input: func(in *domain.BootstrapInput) { in.Token = "guess" }, token: "s3cr3t", want: domain.ErrInvalidBootstrapToken},
+		{name: "disabled", input: func(in *domain.BootstrapInput) { in.Token = "" }, want: domain.ErrInvalidBootstrapToken},
+		{name: "invalid company", input: func(in *domain.BootstrapInput) { in.Company = "acme corp" }, token: "s3cr3t", want: domain.ErrInvalidTenantName},
+		{name: "reserved branch", input: func(in *domain.BootstrapInput) { in.Branch = "accounts" }, token: "s3cr3t", want: domain.ErrReservedTenantName},
+	}
+
+	for _, tt := range tests {
+		repo := newFakeManageRepository()
+		s := NewBootstrapService(repo, newTestHasher(t), allowAll{}, tt.token)
+
+		in := bootstrapInput("s3cr3t")
+		tt.input(in)
+		if _, err := s.Bootstrap(in); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Bootstrap = %v, want %v", tt.name, err, tt.want)
+		}
+		if len(repo.tenants) != 0 || repo.superAdmin != nil {
+			t.Errorf("%s: created %v before refusing", tt.name, repo.tenants)
+		}
+	}
+}
+
+func TestBootstrapClosedOnceSuperAdminExists(t *testing.T) {
+	repo := newFakeManageRepository("acme/", "acme/hq")
+	repo.superAdmin = newUser("acme", "hq", "root", domain.RoleSuperAdmin)
+	s := NewBootstrapService(repo, newTestHasher(t), allowAll{}, "s3cr3t")
+
+	in := bootstrapInput("s3cr3t")
+	in.Company, in.Branch = "globex", "hq"
+	if _, err := s.Bootstrap(in); !errors.Is(err, domain.ErrAlreadyBootstrapped) {
+		t.Fatalf("Bootstrap = %v, want %v", err, domain.ErrAlreadyBootstrapped)
+	}
+	if _, ok := repo.tenants["globex/hq"]; ok {
+		t.Error("created a tenant after bootstrapping was closed")
+	}
+
+	if _, err := s.Bootstrap(in); !errors.Is(err, domain.ErrInvalidBootstrapToken) {
+		t.Errorf("retry = %v, want %v", err, domain.ErrInvalidBootstrapToken)
+	}
+}
@@ -1,20 +1,41 @@
 package services
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"database/sql"
 	"errors"
 	"go-multi-tenancy/internals/core/domain"
 	"go-multi-tenancy/internals/core/ports"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
 )
 
 type companyService struct {
 	companyRepository ports.CompanyRepository
+	policyRepository  ports.PolicyRepository
+	passwordHasher    ports.PasswordHasher
+	mfaService        ports.MFAService
+	loginThrottle     ports.LoginThrottle
+	passwordPolicy    ports.PasswordPolicy
+	networkPolicy     ports.NetworkPolicyService
+	tenantStatus      ports.TenantStatusService
+
+	dummyHashOnce sync.Once
+	dummyHash     string
 }
 
-func NewCompanyService(companyRepository ports.CompanyRepository) *companyService {
+func NewCompanyService(companyRepository ports.CompanyRepository, policyRepository ports.PolicyRepository, passwordHasher ports.PasswordHasher, mfaService ports.MFAService, loginThrottle ports.LoginThrottle, passwordPolicy ports.PasswordPolicy, networkPolicy ports.NetworkPolicyService, tenantStatus ports.TenantStatusService) *companyService {
 	return &companyService{
 		companyRepository: companyRepository,
+		policyRepository:  policyRepository,
+		passwordHasher:    passwordHasher,
+		mfaService:        mfaService,
+		loginThrottle:     loginThrottle,
+		passwordPolicy:    passwordPolicy,
+		networkPolicy:     networkPolicy,
+		tenantStatus:      tenantStatus,
 	}
 }
 
@@ -23,7 +44,30 @@ func (s *companyService) Register(register *domain.RegisterInput) (*domain.DataR
 		return nil, errors.New("username or password cannot be empty")
 	}
 
-	hashedPassword := hashPassword(register.Password)
+	// Companies that onboard by invitation only do not take strangers
+	policy, err := loadPolicy(s.policyRepository, strings.ToLower(register.Company))
+	if err != nil {
+		return nil, err
+	}
+	if !policy.OpenRegistration {
+		return nil, domain.ErrRegistrationClosed
+	}
+
+	// Registration is public, so the TenantStatus middleware never sees it
+	if err := s.tenantStatus.Check(strings.ToLower(register.Company), strings.ToLower(register.Branch), true); err != nil {
+		return nil, err
+	}
+
+	err = s.passwordPolicy.Check(&domain.Data{Company: register.Company, Branch: register.Branch}, register.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.passwordHasher.Hash(register.Password)
+	if err != nil {
+		return nil, err
+	}
+
 	registerData := &domain.Data{
 		Company:   register.Company,
 		Branch:    register.Branch,
@@ -31,7 +75,8 @@ func (s *companyService) Register(register *domain.RegisterInput) (*domain.DataR
 		Password:  hashedPassword,
 		FirstName: register.FirstName,
 		LastName:  register.LastName,
-		Role:      "user",
+		Email:     register.Email,
+		Role:      domain.RoleUser,
 	}
 
 	res, err := s.companyRepository.Register(registerData)
@@ -39,6 +84,10 @@ func (s *companyService) Register(register *domain.RegisterInput) (*domain.DataR
 		return nil, err
 	}
 
+	if err := s.passwordPolicy.Record(res); err != nil {
+		return nil, err
+	}
+
 	return &domain.DataReply{
 		ID:        res.ID,
 		Company:   res.Company,
@@ -46,41 +95,86 @@ func (s *companyService) Register(register *domain.RegisterInput) (*domain.DataR
 		Username:  res.Username,
 		FirstName: res.FirstName,
 		LastName:  res.LastName,
+		Email:     res.Email,
 		CreatedAt: res.CreateAt,
 	}, nil
 }
 
-func (s *companyService) Login(login *domain.LoginInput) (*domain.DataReply, string, error) {
+func (s *companyService) Login(login *domain.LoginInput) (*domain.LoginResult, error) {
 	if login.Username == "" || login.Password == "" || login.Company == "" || login.Branch == "" {
-		return nil, "", errors.New("username or password cannot be empty")
+		return nil, errors.New("username or password cannot be empty")
+	}
+
+	if err := s.loginThrottle.Check(login); err != nil {
+		return nil, err
 	}
 
-	hashedPassword := hashPassword(login.Password)
 	loginData := &domain.Data{
 		Username: login.Username,
-		Password: hashedPassword,
 		Company:  login.Company,
 		Branch:   login.Branch,
 	}
 
 	res, err := s.companyRepository.Login(loginData)
 	if err != nil {
-		return nil, "", err
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		// Spend the same time as a wrong password so unknown usernames cannot be told apart
+		s.passwordHasher.Verify(login.Password, s.unknownUserHash())
+		return nil, s.failLogin(login)
 	}
 
-	if !checkPassword(login.Password, res.Password) {
-		return nil, "", errors.New("invalid username or password")
+	ok, err := s.passwordHasher.Verify(login.Password, res.Password)
+	if err != nil {
+		return nil, err
 	}
 
-	return &domain.DataReply{
+	if !ok {
+		return nil, s.failLogin(login)
+	}
+
+	if err := s.loginThrottle.Succeed(login); err != nil {
+		return nil, err
+	}
+
+	// The company may only allow its staff in from its own networks or at set hours
+	err = s.networkPolicy.Check(&domain.NetworkCheck{
+		Company: res.Company,
+		Branch:  res.Branch,
+		Role:    res.Role,
+		IP:      login.IP,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The password was right, but it is too old to be used any more
+	expired, err := s.passwordPolicy.Expired(res)
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, domain.ErrPasswordExpired
+	}
+
+	// Upgrade legacy or outdated hashes while the plain password is at hand
+	if s.passwordHasher.NeedsRehash(res.Password) {
+		s.rehashPassword(res, login.Password)
+	}
+
+	// Hold the login back behind a second factor when MFA applies
+	return s.mfaService.Challenge(&domain.DataReply{
 		ID:        res.ID,
 		Company:   res.Company,
 		Branch:    res.Branch,
 		Username:  res.Username,
 		FirstName: res.FirstName,
 		LastName:  res.LastName,
+		Email:     res.Email,
 		CreatedAt: res.CreateAt,
-	}, res.Role, nil
+	}, res.Role)
 }
 
 func (s *companyService) GetData(data *domain.DataInput) (*domain.DataReply, error) {
@@ -101,19 +195,45 @@ func (s *companyService) GetData(data *domain.DataInput) (*domain.DataReply, err
 		Username:  res.Username,
 		FirstName: res.FirstName,
 		LastName:  res.LastName,
+		Email:     res.Email,
 		CreatedAt: res.CreateAt,
 	}, nil
 }
 
+// UpdateData changes the fields that are set. A new password has to pass
+// the company's password policy.
 func (s *companyService) UpdateData(data *domain.DataUpdate) (*domain.DataReply, error) {
 	req := &domain.Data{
-		ID:        data.ID,
-		Company:   data.Company,
-		Branch:    data.Branch,
-		Username:  data.Username,
-		FirstName: *data.FirstName,
-		LastName:  *data.LastName,
-		Password:  *data.Password,
+		ID:       data.ID,
+		Company:  data.Company,
+		Branch:   data.Branch,
+		Username: data.Username,
+	}
+	if data.FirstName != nil {
+		req.FirstName = *data.FirstName
+	}
+	if data.LastName != nil {
+		req.LastName = *data.LastName
+	}
+
+	if data.Password != nil {
+		if *data.Password == "" {
+			return nil, errors.New("password cannot be empty")
+		}
+
+		user, err := s.companyRepository.GetOne(&domain.Data{Company: data.Company, Branch: data.Branch, ID: data.ID})
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.passwordPolicy.Check(user, *data.Password); err != nil {
+			return nil, err
+		}
+
+		req.Password, err = s.passwordHasher.Hash(*data.Password)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	res, err := s.companyRepository.UpdateData(req)
@@ -121,6 +241,12 @@ func (s *companyService) UpdateData(data *domain.DataUpdate) (*domain.DataReply,
 		return nil, err
 	}
 
+	if data.Password != nil {
+		if err := s.passwordPolicy.Record(res); err != nil {
+			return nil, err
+		}
+	}
+
 	return &domain.DataReply{
 		ID:        res.ID,
 		Company:   res.Company,
@@ -128,18 +254,52 @@ func (s *companyService) UpdateData(data *domain.DataUpdate) (*domain.DataReply,
 		Username:  res.Username,
 		FirstName: res.FirstName,
 		LastName:  res.LastName,
+		Email:     res.Email,
 		CreatedAt: res.CreateAt,
 	}, nil
 }
 
-func hashPassword(password string) string {
-	hash := sha256.New()
-	hash.Write([]byte(password))
-	return hex.EncodeToString(hash.Sum(nil))
+func (s *companyService) Unlock(data *domain.UnlockInput) error {
+	return s.loginThrottle.Unlock(data)
+}
+
+// failLogin records the failed attempt and returns the error shown for every
+// kind of credential mismatch.
+func (s *companyService) failLogin(login *domain.LoginInput) error {
+	if err := s.loginThrottle.Fail(login); err != nil {
+		return err
+	}
+
+	return domain.ErrInvalidCredentials
 }
 
-func checkPassword(password, hash string) bool {
-	return hashPassword(password) == hash
+// unknownUserHash is a hash of a random password, verified against when the
+// username does not exist.
+func (s *companyService) unknownUserHash() string {
+	s.dummyHashOnce.Do(func() {
+		s.dummyHash, _ = s.passwordHasher.Hash(uuid.NewString())
+	})
+	return s.dummyHash
+}
+
+// rehashPassword stores password under the current hashing scheme. A failure
+// only means the upgrade is retried on the next login, so it does not fail the login.
+func (s *companyService) rehashPassword(data *domain.Data, password string) {
+	hashedPassword, err := s.passwordHasher.Hash(password)
+	if err != nil {
+		log.Println("rehash password:", err)
+		return
+	}
+
+	err = s.companyRepository.UpdatePassword(&domain.Data{
+		Company:  data.Company,
+		Branch:   data.Branch,
+		ID:       data.ID,
+		Password: hashedPassword,
+	})
+	if err != nil {
+		log.Println("rehash password:", err)
+	}
 }
 
 func (s *companyService) DeleteData(data *domain.DataDelete) error {
@@ -172,6 +332,7 @@ func (s *companyService) GetAllData() ([]domain.DataReply, error) {
 			Username:  info.Username,
 			FirstName: info.FirstName,
 			LastName:  info.LastName,
+			Email:     info.Email,
 			CreatedAt: info.CreateAt,
 		})
 	}
@@ -198,16 +359,47 @@ func (s *companyService) GetMe(data *domain.Me) (*domain.DataReply, error) {
 		Username:  res.Username,
 		FirstName: res.FirstName,
 		LastName:  res.LastName,
+		Email:     res.Email,
 		CreatedAt: res.CreateAt,
 	}, nil
 }
 
-func (s *companyService) Admin(data *domain.Admin) (*domain.DataReply, error) {
-	if data.Username == "" || data.Password == "" || data.Company == "" || data.Branch == "" {
+// Admin creates an admin or head_admin on behalf of a caller ranked above
+// that role: head admins create the admins of their company, super admins
+// the head admins of any company.
+func (s *companyService) Admin(principal *domain.Principal, data *domain.Admin) (*domain.DataReply, error) {
+	if data.Company == "" {
+		data.Company = principal.Company
+	}
+	if data.Branch == "" {
+		data.Branch = principal.Branch
+	}
+	if data.Role == "" {
+		data.Role = domain.RoleAdmin
+	}
+
+	if data.Username == "" || data.Password == "" {
 		return nil, errors.New("username or password cannot be empty")
 	}
 
-	hashedPassword := hashPassword(data.Password)
+	if (data.Role != domain.RoleAdmin && data.Role != domain.RoleHeadAdmin) || !domain.RoleAbove(principal.Role, data.Role) {
+		return nil, domain.ErrAdminRole
+	}
+
+	if !domain.InTenantScope(principal.Permissions, principal.Company, principal.Branch, data.Company, data.Branch) {
+		return nil, domain.ErrOutOfTenantScope
+	}
+
+	err := s.passwordPolicy.Check(&domain.Data{Company: data.Company, Branch: data.Branch}, data.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.passwordHasher.Hash(data.Password)
+	if err != nil {
+		return nil, err
+	}
+
 	registerData := &domain.Data{
 		Company:   data.Company,
 		Branch:    data.Branch,
@@ -215,7 +407,8 @@ func (s *companyService) Admin(data *domain.Admin) (*domain.DataReply, error) {
 		Password:  hashedPassword,
 		FirstName: data.FirstName,
 		LastName:  data.LastName,
-		Role:      "admin",
+		Email:     data.Email,
+		Role:      data.Role,
 	}
 
 	res, err := s.companyRepository.Register(registerData)
@@ -223,6 +416,10 @@ func (s *companyService) Admin(data *domain.Admin) (*domain.DataReply, error) {
 		return nil, err
 	}
 
+	if err := s.passwordPolicy.Record(res); err != nil {
+		return nil, err
+	}
+
 	return &domain.DataReply{
 		ID:        res.ID,
 		Company:   res.Company,
@@ -230,6 +427,7 @@ func (s *companyService) Admin(data *domain.Admin) (*domain.DataReply, error) {
 		Username:  res.Username,
 		FirstName: res.FirstName,
 		LastName:  res.LastName,
+		Email:     res.Email,
 		CreatedAt: res.CreateAt,
 	}, nil
 
@@ -255,6 +453,7 @@ func (s *companyService) GetCompanyData(data *domain.DataInput) ([]domain.DataRe
 			Username:  info.Username,
 			FirstName: info.FirstName,
 			LastName:  info.LastName,
+			Email:     info.Email,
 			CreatedAt: info.CreateAt,
 		})
 	}
@@ -282,6 +481,7 @@ func (s *companyService) GetBranchData(data *domain.DataInput) ([]domain.DataRep
 			Username:  info.Username,
 			FirstName: info.FirstName,
 			LastName:  info.LastName,
+			Email:     info.Email,
 			CreatedAt: info.CreateAt,
 		})
 	}
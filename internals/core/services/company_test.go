@@ -0,0 +1,260 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"go-multi-tenancy/internals/utils"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// allowAll is a password policy that accepts every password.
+type allowAll struct{}
+
+func (allowAll) Check(*domain.Data, string) error { return nil }
+func (allowAll) Record(*domain.Data) error        { return nil }
+func (allowAll) Expired(*domain.Data) (bool, error) {
+	return false, nil
+}
+
+// allowNetwork lets every login in regardless of address and time.
+type allowNetwork struct{}
+
+func (allowNetwork) Check(*domain.NetworkCheck) error { return nil }
+func (allowNetwork) GetPolicies(*domain.CompanyRequest) ([]domain.NetworkPolicy, error) {
+	return nil, nil
+}
+func (allowNetwork) SavePolicy(data *domain.NetworkPolicy) (*domain.NetworkPolicy, error) {
+	return data, nil
+}
+func (allowNetwork) DeletePolicy(*domain.NetworkPolicy) error { return nil }
+
+// countingThrottle records the outcome of each login and locks out once
+// lockAfter failures were seen, when lockAfter is set.
+type countingThrottle struct {
+	failures  int
+	successes int
+	lockAfter int
+	failed    []domain.LoginInput
+}
+
+func (t *countingThrottle) Check(*domain.LoginInput) error {
+	if t.lockAfter > 0 && t.failures >= t.lockAfter {
+		return &domain.LockoutError{RetryAfter: time.Minute}
+	}
+	return nil
+}
+
+func (t *countingThrottle) Fail(login *domain.LoginInput) error {
+	t.failures++
+	t.failed = append(t.failed, *login)
+	return nil
+}
+
+func (t *countingThrottle) Succeed(*domain.LoginInput) error { t.successes++; return nil }
+func (t *countingThrottle) Unlock(*domain.UnlockInput) error { return nil }
+
+// passThroughMFA completes every login without a second factor.
+type passThroughMFA struct {
+	ports.MFAService
+}
+
+func (passThroughMFA) Challenge(user *domain.DataReply, role string) (*domain.LoginResult, error) {
+	return &domain.LoginResult{Data: user, Role: role}, nil
+}
+
+func newTestHasher(t *testing.T) *utils.PasswordHasher {
+	t.Helper()
+
+	h, err := utils.NewPasswordHasher(utils.PasswordArgon2id, utils.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}, bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func newTestCompanyService(t *testing.T, users *fakeCompanyRepository, throttle *countingThrottle) *companyService {
+	return NewCompanyService(users, newFakePolicyRepository(), newTestHasher(t), passThroughMFA{}, throttle, allowAll{}, allowNetwork{}, &fakeTenantStatus{})
+}
+
+func TestLoginRehashesLegacyPassword(t *testing.T) {
+	sum := sha256.Sum256([]byte("hunter22"))
+	user := newUser("acme", "hq", "alice", "user")
+	user.Password = hex.EncodeToString(sum[:])
+	users := newFakeCompanyRepository(user)
+	throttle := &countingThrottle{}
+	s := newTestCompanyService(t, users, throttle)
+
+	login := &domain.LoginInput{Company: "acme", Branch: "hq", Username: "alice", Password: "hunter22"}
+	result, err := s.Login(login)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if result.Data.ID != user.ID {
+		t.Errorf("logged in as %s, want %s", result.Data.ID, user.ID)
+	}
+
+	stored := users.users[user.ID].Password
+	if stored == hex.EncodeToString(sum[:]) {
+		t.Fatal("legacy hash was not upgraded")
+	}
+	if newTestHasher(t).NeedsRehash(stored) {
+		t.Errorf("upgraded hash %q still needs a rehash", stored)
+	}
+
+	// The upgraded hash keeps working
+	if _, err := s.Login(login); err != nil {
+		t.Fatalf("Login after rehash: %v", err)
+	}
+	if throttle.successes != 2 || throttle.failures != 0 {
+		t.Errorf("throttle saw %d successes, %d failures", throttle.successes, throttle.failures)
+	}
+}
+
+func TestLoginKeepsCurrentHash(t *testing.T) {
+	hash, err := newTestHasher(t).Hash("hunter22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := newUser("acme", "hq", "alice", "user")
+	user.Password = hash
+	users := newFakeCompanyRepository(user)
+	s := newTestCompanyService(t, users, &countingThrottle{})
+
+	if _, err := s.Login(&domain.LoginInput{Company: "acme", Branch: "hq", Username: "alice", Password: "hunter22"}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if users.users[user.ID].Password != hash {
+		t.Error("a current hash was rewritten")
+	}
+}
+
+func TestLoginFailures(t *testing.T) {
+	sum := sha256.Sum256([]byte("hunter22"))
+	user := newUser("acme", "hq", "alice", "user")
+	user.Password = hex.EncodeToString(sum[:])
+
+	tests := map[string]*domain.LoginInput{
+		"wrong password": {Company: "acme", Branch: "hq", Username: "alice", Password: "hunter23"},
+		"unknown user":   {Company: "acme", Branch: "hq", Username: "bob", Password: "hunter22"},
+		"other branch":   {Company: "acme", Branch: "east", Username: "alice", Password: "hunter22"},
+		"legacy digest":  {Company: "acme", Branch: "hq", Username: "alice", Password: user.Password},
+	}
+
+	for name, login := range tests {
+		t.Run(name, func(t *testing.T) {
+			users := newFakeCompanyRepository(user)
+			throttle := &countingThrottle{}
+			s := newTestCompanyService(t, users, throttle)
+
+			if _, err := s.Login(login); !errors.Is(err, domain.ErrInvalidCredentials) {
+				t.Errorf("err = %v, want ErrInvalidCredentials", err)
+			}
+			if throttle.failures != 1 {
+				t.Errorf("throttle saw %d failures, want 1", throttle.failures)
+			}
+			if users.users[user.ID].Password != user.Password {
+				t.Error("hash was rewritten after a failed login")
+			}
+		})
+	}
+}
+
+func TestUpdateDataHashesPassword(t *testing.T) {
+	user := newUser("acme", "hq", "alice", "user")
+	users := newFakeCompanyRepository(user)
+	s := newTestCompanyService(t, users, &countingThrottle{})
+
+	firstName, lastName, password := "Alice", "Liddell", "n3w-passw0rd"
+	if _, err := s.UpdateData(&domain.DataUpdate{ID: user.ID, Company: "acme", Branch: "hq", FirstName: &firstName, LastName: &lastName, Password: &password}); err != nil {
+		t.Fatalf("UpdateData: %v", err)
+	}
+
+	stored := users.users[user.ID].Password
+	if stored == password {
+		t.Fatal("password stored in plaintext")
+	}
+	if ok, err := newTestHasher(t).Verify(password, stored); !ok || err != nil {
+		t.Errorf("stored hash does not verify: %v, %v", ok, err)
+	}
+}
+
+func TestRegisterFollowsTenantStatus(t *testing.T) {
+	for _, want := range []error{domain.ErrTenantReadOnly, domain.ErrTenantSuspended} {
+		users := newFakeCompanyRepository()
+		status := &fakeTenantStatus{errs: map[string]error{"acme": want}}
+		s := NewCompanyService(users, newFakePolicyRepository(), newTestHasher(t), passThroughMFA{}, &countingThrottle{}, allowAll{}, allowNetwork{}, status)
+
+		input := &domain.RegisterInput{Company: "ACME", Branch: "hq", Username: "mallory", Password: "n3w-passw0rd"}
+		if _, err := s.Register(input); !errors.Is(err, want) {
+			t.Errorf("Register = %v, want %v", err, want)
+		}
+		if len(users.users) != 0 {
+			t.Errorf("registered into a tenant that is %v", want)
+		}
+
+		delete(status.errs, "acme")
+		if _, err := s.Register(input); err != nil {
+			t.Errorf("Register into an active tenant: %v", err)
+		}
+	}
+}
+
+func TestRegisterClosedRegistration(t *testing.T) {
+	policy := domain.DefaultSecurityPolicy("acme")
+	policy.OpenRegistration = false
+	users := newFakeCompanyRepository()
+	s := NewCompanyService(users, newFakePolicyRepository(policy), newTestHasher(t), passThroughMFA{}, &countingThrottle{}, allowAll{}, allowNetwork{}, &fakeTenantStatus{})
+
+	// Invitation-only companies refuse strangers, whatever the case of the slug
+	_, err := s.Register(&domain.RegisterInput{Company: "ACME", Branch: "hq", Username: "mallory", Password: "n3w-passw0rd"})
+	if !errors.Is(err, domain.ErrRegistrationClosed) {
+		t.Errorf("err = %v, want %v", err, domain.ErrRegistrationClosed)
+	}
+	if len(users.users) != 0 {
+		t.Error("registered into an invitation-only company")
+	}
+
+	// Companies without a stored policy take the default, which is open
+	if _, err := s.Register(&domain.RegisterInput{Company: "globex", Branch: "hq", Username: "mallory", Password: "n3w-passw0rd"}); err != nil {
+		t.Errorf("Register into an open company: %v", err)
+	}
+}
+
+func TestAdminRoles(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *domain.Principal
+		input     domain.Admin
+		want      error
+	}{
+		{name: "company admin creates admin", principal: companyAdmin, input: domain.Admin{Branch: "east"}},
+		{name: "branch admin creates admin", principal: branchAdmin, input: domain.Admin{Role: domain.RoleAdmin}, want: domain.ErrAdminRole},
+		{name: "company admin creates company admin", principal: companyAdmin, input: domain.Admin{Role: domain.RoleHeadAdmin}, want: domain.ErrAdminRole},
+		{name: "company admin into other company", principal: companyAdmin, input: domain.Admin{Company: "globex", Branch: "hq"}, want: domain.ErrOutOfTenantScope},
+		{name: "super admin creates company admin elsewhere", principal: superAdmin, input: domain.Admin{Company: "globex", Branch: "hq", Role: domain.RoleHeadAdmin}},
+		{name: "super admin creates super admin", principal: superAdmin, input: domain.Admin{Role: domain.RoleSuperAdmin}, want: domain.ErrAdminRole},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := newFakeCompanyRepository()
+			s := newTestCompanyService(t, users, &countingThrottle{})
+
+			input := tt.input
+			input.Username, input.Password = "new.admin", "n3w-passw0rd"
+			_, err := s.Admin(tt.principal, &input)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if created := len(users.users) == 1; created != (tt.want == nil) {
+				t.Errorf("admin created = %v", created)
+			}
+		})
+	}
+}
@@ -0,0 +1,436 @@
+package services
+
+import (
+	"database/sql"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"go-multi-tenancy/internals/utils"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMain(m *testing.M) {
+	// Without configured keys InitKeys signs with a temporary Ed25519 key
+	if err := utils.InitKeys(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// fakeCompanyRepository keeps users in memory. Methods the tests do not
+// need fall through to the nil interface and panic if called.
+type fakeCompanyRepository struct {
+	ports.CompanyRepository
+
+	mu    sync.Mutex
+	users map[uuid.UUID]*domain.Data
+}
+
+func newFakeCompanyRepository(users ...*domain.Data) *fakeCompanyRepository {
+	r := &fakeCompanyRepository{users: map[uuid.UUID]*domain.Data{}}
+	for _, user := range users {
+		r.users[user.ID] = user
+	}
+	return r
+}
+
+func (r *fakeCompanyRepository) find(match func(*domain.Data) bool) (*domain.Data, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if match(user) {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeCompanyRepository) GetMe(data *domain.Data) (*domain.Data, error) {
+	return r.find(func(u *domain.Data) bool {
+		return u.Company == data.Company && u.Branch == data.Branch && u.ID == data.ID && u.DeleteAt == nil
+	})
+}
+
+func (r *fakeCompanyRepository) GetOne(data *domain.Data) (*domain.Data, error) {
+	return r.find(func(u *domain.Data) bool {
+		return u.Company == data.Company && u.Branch == data.Branch && u.ID == data.ID
+	})
+}
+
+func (r *fakeCompanyRepository) GetByID(data *domain.Data) (*domain.Data, error) {
+	return r.find(func(u *domain.Data) bool {
+		return u.Company == data.Company && u.ID == data.ID
+	})
+}
+
+func (r *fakeCompanyRepository) Login(data *domain.Data) (*domain.Data, error) {
+	return r.find(func(u *domain.Data) bool {
+		return u.Company == data.Company && u.Branch == data.Branch && u.Username == data.Username && u.DeleteAt == nil
+	})
+}
+
+func (r *fakeCompanyRepository) FindUsers(data *domain.UserQuery) ([]domain.Data, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := []domain.Data{}
+	for _, u := range r.users {
+		if u.Company != data.Company {
+			continue
+		}
+		if data.Branch != "" && u.Branch != data.Branch {
+			continue
+		}
+		if data.ID != nil && u.ID != *data.ID {
+			continue
+		}
+		if data.Username != "" && u.Username != data.Username {
+			continue
+		}
+		users = append(users, *u)
+	}
+	return users, len(users), nil
+}
+
+func (r *fakeCompanyRepository) UpdatePassword(data *domain.Data) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user, ok := r.users[data.ID]; ok {
+		user.Password = data.Password
+	}
+	return nil
+}
+
+func (r *fakeCompanyRepository) GetByEmail(data *domain.Data) (*domain.Data, error) {
+	return r.find(func(u *domain.Data) bool {
+		return u.Company == data.Company && u.Branch == data.Branch && strings.EqualFold(u.Email, data.Email) && u.DeleteAt == nil
+	})
+}
+
+func (r *fakeCompanyRepository) ChangePassword(data *domain.Data) error {
+	return r.UpdatePassword(data)
+}
+
+func (r *fakeCompanyRepository) VerifyEmail(data *domain.Data) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user, ok := r.users[data.ID]; ok && strings.EqualFold(user.Email, data.Email) {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	return nil
+}
+
+func (r *fakeCompanyRepository) UpdateData(data *domain.Data) (*domain.Data, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[data.ID]
+	if !ok || user.Company != data.Company || user.Branch != data.Branch {
+		return nil, sql.ErrNoRows
+	}
+	if data.FirstName != "" {
+		user.FirstName = data.FirstName
+	}
+	if data.LastName != "" {
+		user.LastName = data.LastName
+	}
+	if data.Password != "" {
+		user.Password = data.Password
+	}
+	updated := *user
+	return &updated, nil
+}
+
+func (r *fakeCompanyRepository) Register(data *domain.Data) (*domain.Data, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data.ID = uuid.New()
+	data.CreateAt = time.Now()
+	user := *data
+	r.users[data.ID] = &user
+	return data, nil
+}
+
+func (r *fakeCompanyRepository) UpdateProfile(data *domain.Data) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user, ok := r.users[data.ID]; ok {
+		user.Username, user.FirstName, user.LastName, user.Email = data.Username, data.FirstName, data.LastName, data.Email
+	}
+	return nil
+}
+
+func (r *fakeCompanyRepository) SetActive(data *domain.Data, active bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user, ok := r.users[data.ID]; ok {
+		user.DeleteAt = nil
+		if !active {
+			now := time.Now()
+			user.DeleteAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeCompanyRepository) delete(id uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.users, id)
+}
+
+// fakeActionTokenRepository keeps action tokens in memory with the same
+// rules as the database: a token works once and only before it expires.
+type fakeActionTokenRepository struct {
+	mu       sync.Mutex
+	tokens   map[uuid.UUID]*domain.ActionToken
+	failures map[uuid.UUID]int
+}
+
+func newFakeActionTokenRepository() *fakeActionTokenRepository {
+	return &fakeActionTokenRepository{
+		tokens:   map[uuid.UUID]*domain.ActionToken{},
+		failures: map[uuid.UUID]int{},
+	}
+}
+
+func (r *fakeActionTokenRepository) CreateActionToken(data *domain.ActionToken) (*domain.ActionToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data.ID = uuid.New()
+	data.CreateAt = time.Now()
+	token := *data
+	r.tokens[data.ID] = &token
+	return data, nil
+}
+
+func (r *fakeActionTokenRepository) usable(data *domain.ActionToken) (*domain.ActionToken, bool) {
+	token, ok := r.tokens[data.ID]
+	if !ok || token.Purpose != data.Purpose || token.UserID != data.UserID {
+		return nil, false
+	}
+	return token, token.UsedAt == nil && time.Now().Before(token.ExpiresAt)
+}
+
+func (r *fakeActionTokenRepository) CheckActionToken(data *domain.ActionToken) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.usable(data)
+	return ok, nil
+}
+
+func (r *fakeActionTokenRepository) UseActionToken(data *domain.ActionToken) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.usable(data)
+	if !ok {
+		return false, nil
+	}
+	now := time.Now()
+	token.UsedAt = &now
+	return true, nil
+}
+
+func (r *fakeActionTokenRepository) FailActionToken(data *domain.ActionToken, maxFailures int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.usable(data)
+	if !ok {
+		return false, nil
+	}
+	r.failures[data.ID]++
+	if r.failures[data.ID] >= maxFailures {
+		now := time.Now()
+		token.UsedAt = &now
+		return false, nil
+	}
+	return true, nil
+}
+
+// fakePolicyRepository keeps security policies and password histories in
+// memory. Companies without a stored policy get the defaults.
+type fakePolicyRepository struct {
+	mu       sync.Mutex
+	policies map[string]*domain.SecurityPolicy
+	history  map[uuid.UUID][]string
+}
+
+func newFakePolicyRepository(policies ...*domain.SecurityPolicy) *fakePolicyRepository {
+	r := &fakePolicyRepository{policies: map[string]*domain.SecurityPolicy{}, history: map[uuid.UUID][]string{}}
+	for _, policy := range policies {
+		r.policies[policy.Company] = policy
+	}
+	return r
+}
+
+func (r *fakePolicyRepository) GetPolicy(data *domain.SecurityPolicy) (*domain.SecurityPolicy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	policy, ok := r.policies[data.Company]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	found := *policy
+	return &found, nil
+}
+
+func (r *fakePolicyRepository) SavePolicy(data *domain.SecurityPolicy) (*domain.SecurityPolicy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	policy := *data
+	r.policies[data.Company] = &policy
+	return data, nil
+}
+
+// GetPasswordHistory returns the newest hashes first.
+func (r *fakePolicyRepository) GetPasswordHistory(data *domain.Data, limit int) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hashes := []string{}
+	history := r.history[data.ID]
+	for i := len(history) - 1; i >= 0 && len(hashes) < limit; i-- {
+		hashes = append(hashes, history[i])
+	}
+	return hashes, nil
+}
+
+func (r *fakePolicyRepository) AddPasswordHistory(data *domain.Data) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.history[data.ID] = append(r.history[data.ID], data.Password)
+	return nil
+}
+
+// newUser returns an active user of the given tenant.
+func newUser(company, branch, username, role string) *domain.Data {
+	return &domain.Data{
+		ID:       uuid.New(),
+		Company:  company,
+		Branch:   branch,
+		Username: username,
+		Role:     role,
+	}
+}
+
+// fakeRoleService grants the built-in permissions of a role only.
+type fakeRoleService struct {
+	ports.RoleService
+}
+
+func (fakeRoleService) Permissions(userID uuid.UUID, role string) ([]string, error) {
+	return domain.RolePermissions(role), nil
+}
+
+func newPrincipal(company, branch, role string) *domain.Principal {
+	return &domain.Principal{
+		UserID:      uuid.New(),
+		Company:     company,
+		Branch:      branch,
+		Role:        role,
+		Permissions: domain.RolePermissions(role),
+	}
+}
+
+// Callers of every scope, all of them at acme/hq unless they belong elsewhere
+var (
+	branchAdmin  = newPrincipal("acme", "hq", domain.RoleAdmin)
+	companyAdmin = newPrincipal("acme", "hq", domain.RoleHeadAdmin)
+	superAdmin   = newPrincipal("acme", "hq", domain.RoleSuperAdmin)
+	globexAdmin  = newPrincipal("globex", "hq", domain.RoleHeadAdmin)
+)
+
+// fakeTenantStatus reports the error stored for a company, nil otherwise.
+type fakeTenantStatus struct {
+	errs map[string]error
+}
+
+func (f *fakeTenantStatus) Check(company, branch string, write bool) error {
+	return f.errs[company]
+}
+
+func (f *fakeTenantStatus) SetStatus(data *domain.TenantStatusInput) (*domain.Tenant, error) {
+	return nil, nil
+}
+
+// fakeManageRepository keeps the tenant registry in memory, keyed by
+// "company/branch" with "company/" for the company itself.
+type fakeManageRepository struct {
+	ports.ManageRepository
+	tenants    map[string]string // tenant to status
+	loads      int               // calls to GetCompanyTenants
+	superAdmin *domain.Data
+}
+
+func newFakeManageRepository(tenants ...string) *fakeManageRepository {
+	r := &fakeManageRepository{tenants: map[string]string{}}
+	for _, tenant := range tenants {
+		r.tenants[tenant] = domain.TenantActive
+	}
+	return r
+}
+
+func (r *fakeManageRepository) GetCompanyTenants(data *domain.Tenant) ([]domain.Tenant, error) {
+	r.loads++
+
+	var tenants []domain.Tenant
+	for key, status := range r.tenants {
+		if branch, ok := strings.CutPrefix(key, data.Company+"/"); ok {
+			tenants = append(tenants, domain.Tenant{Company: data.Company, Branch: branch, Status: status})
+		}
+	}
+	return tenants, nil
+}
+
+func (r *fakeManageRepository) SetTenantStatus(data *domain.Tenant) (bool, error) {
+	key := data.Company + "/" + data.Branch
+	if _, ok := r.tenants[key]; !ok {
+		return false, nil
+	}
+	r.tenants[key] = data.Status
+	return true, nil
+}
+
+func (r *fakeManageRepository) GetTenant(data *domain.Tenant) (*domain.Tenant, error) {
+	status, ok := r.tenants[data.Company+"/"+data.Branch]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &domain.Tenant{Company: data.Company, Branch: data.Branch, Status: status}, nil
+}
+
+func (r *fakeManageRepository) RegisterFirstSuperAdmin(data *domain.Data) (bool, error) {
+	if r.superAdmin != nil {
+		return false, nil
+	}
+	for _, key := range []string{data.Company + "/", data.Company + "/" + data.Branch} {
+		if _, ok := r.tenants[key]; !ok {
+			r.tenants[key] = domain.TenantActive
+		}
+	}
+	data.ID = uuid.New()
+	data.Role = domain.RoleSuperAdmin
+	r.superAdmin = data
+	return true, nil
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"go-multi-tenancy/internals/utils"
+	"log"
+	"net/url"
+	"strings"
+)
+
+const ssoStateTTL = 10 * 60 // seconds
+
+type federationService struct {
+	federationRepository ports.FederationRepository
+	companyRepository    ports.CompanyRepository
+	mfaService           ports.MFAService
+	tenantStatus         ports.TenantStatusService
+	idpClient            ports.IdentityProviderClient
+}
+
+func NewFederationService(federationRepository ports.FederationRepository, companyRepository ports.CompanyRepository, mfaService ports.MFAService, tenantStatus ports.TenantStatusService, idpClient ports.IdentityProviderClient) *federationService {
+	return &federationService{
+		federationRepository: federationRepository,
+		companyRepository:    companyRepository,
+		mfaService:           mfaService,
+		tenantStatus:         tenantStatus,
+		idpClient:            idpClient,
+	}
+}
+
+// GetProvider returns the company's provider without the client secret.
+func (s *federationService) GetProvider(data *domain.CompanyRequest) (*domain.IdentityProvider, error) {
+	provider, err := s.federationRepository.GetProvider(&domain.IdentityProvider{Company: strings.ToLower(data.Company)})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrSSONotConfigured
+		}
+		return nil, err
+	}
+
+	provider.ClientSecret = ""
+	return provider, nil
+}
+
+func (s *federationService) SaveProvider(data *domain.IdentityProvider) (*domain.IdentityProvider, error) {
+	if data.Company == "" || data.Issuer == "" || data.ClientID == "" || data.RedirectURI == "" {
+		return nil, errors.New("company, issuer, client_id and redirect_uri are required")
+	}
+
+	for _, raw := range []string{data.Issuer, data.RedirectURI} {
+		if parsed, err := url.Parse(raw); err != nil || !parsed.IsAbs() {
+			return nil, errors.New("issuer and redirect_uri must be absolute URLs")
+		}
+	}
+
+	if data.DefaultRole == "" {
+		data.DefaultRole = domain.RoleUser
+	}
+
+	if data.BranchClaim == "" && data.DefaultBranch == "" {
+		return nil, errors.New("branch_claim or default_branch is required")
+	}
+
+	// Identity providers must not be able to mint platform operators
+	for _, role := range append([]string{data.DefaultRole}, mappedRoles(data.RoleMapping)...) {
+		if !domain.ValidRole(role) || domain.RoleAtLeast(role, domain.RoleSuperAdmin) {
+			return nil, errors.New("role mappings may only use user, admin and head_admin")
+		}
+	}
+
+	if data.Scopes == "" {
+		data.Scopes = "openid profile email"
+	}
+
+	if data.RoleMapping == nil {
+		data.RoleMapping = map[string]string{}
+	}
+
+	data.Company = strings.ToLower(data.Company)
+
+	// The secret is never returned, so updates that leave it out keep the old one
+	if data.ClientSecret == "" {
+		existing, err := s.federationRepository.GetProvider(&domain.IdentityProvider{Company: data.Company})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if existing != nil {
+			data.ClientSecret = existing.ClientSecret
+		}
+	}
+
+	res, err := s.federationRepository.SaveProvider(data)
+	if err != nil {
+		return nil, err
+	}
+
+	res.ClientSecret = ""
+	return res, nil
+}
+
+func (s *federationService) DeleteProvider(data *domain.CompanyRequest) error {
+	return s.federationRepository.DeleteProvider(&domain.IdentityProvider{Company: strings.ToLower(data.Company)})
+}
+
+// Start begins a federated login and returns where to send the browser.
+func (s *federationService) Start(data *domain.CompanyRequest) (*domain.SSOStartReply, error) {
+	provider, err := s.provider(data.Company)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.federationRepository.CreateState(&domain.SSOState{
+		StateHash:    utils.HashToken(state),
+		Company:      provider.Company,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+	}, ssoStateTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	authURL, err := s.idpClient.AuthorizationURL(provider, state, nonce, base64.RawURLEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.SSOStartReply{AuthorizationURL: authURL}, nil
+}
+
+// Callback finishes a federated login. Users seen for the first time are
+// provisioned into the branch and role the provider's claims map to.
+func (s *federationService) Callback(data *domain.SSOCallbackInput) (*domain.LoginResult, error) {
+	state, err := s.federationRepository.UseState(&domain.SSOState{StateHash: utils.HashToken(data.State)})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrSSOInvalidState
+		}
+		return nil, err
+	}
+
+	if state.Company != strings.ToLower(data.Company) {
+		return nil, domain.ErrSSOInvalidState
+	}
+
+	provider, err := s.provider(state.Company)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := s.idpClient.Exchange(provider, data.Code, state.CodeVerifier)
+	if err != nil {
+		log.Printf("sso: %s: %v", provider.Company, err)
+		return nil, domain.ErrSSOFailed
+	}
+
+	if claimString(claims, "nonce") != state.Nonce {
+		return nil, domain.ErrSSOFailed
+	}
+
+	subject := claimString(claims, "sub")
+	if subject == "" {
+		return nil, domain.ErrSSOFailed
+	}
+
+	user, err := s.federatedUser(provider, subject, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.mfaService.Challenge(&domain.DataReply{
+		ID:        user.ID,
+		Company:   user.Company,
+		Branch:    user.Branch,
+		Username:  user.Username,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		CreatedAt: user.CreateAt,
+	}, user.Role)
+}
+
+func (s *federationService) provider(company string) (*domain.IdentityProvider, error) {
+	provider, err := s.federationRepository.GetProvider(&domain.IdentityProvider{Company: strings.ToLower(company)})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrSSONotConfigured
+		}
+		return nil, err
+	}
+
+	if !provider.Enabled {
+		return nil, domain.ErrSSONotConfigured
+	}
+
+	return provider, nil
+}
+
+// federatedUser returns the local user linked to the subject, creating it on
+// the first login.
+func (s *federationService) federatedUser(provider *domain.IdentityProvider, subject string, claims map[string]interface{}) (*domain.Data, error) {
+	identity, err := s.federationRepository.GetIdentity(&domain.FederatedIdentity{
+		Company: provider.Company,
+		Issuer:  provider.Issuer,
+		Subject: subject,
+	})
+	if err == nil {
+		return s.companyRepository.GetMe(&domain.Data{
+			Company: identity.Company,
+			Branch:  identity.Branch,
+			ID:      identity.UserID,
+		})
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	branch := provider.DefaultBranch
+	if provider.BranchClaim != "" && claimString(claims, provider.BranchClaim) != "" {
+		branch = strings.ToLower(claimString(claims, provider.BranchClaim))
+	}
+	if branch == "" {
+		return nil, errors.New("identity provider did not send a branch")
+	}
+
+	username := claimString(claims, "preferred_username")
+	if username == "" {
+		username = claimString(claims, "email")
+	}
+	if username == "" {
+		username = subject
+	}
+
+	// Provisioning writes to the tenant, a read-only one only lets linked users in
+	if err := s.tenantStatus.Check(provider.Company, branch, true); err != nil {
+		return nil, err
+	}
+
+	// Never attach a federated login to an existing local account
+	_, err = s.companyRepository.Login(&domain.Data{Company: provider.Company, Branch: branch, Username: username})
+	if err == nil {
+		return nil, domain.ErrSSOAccountExists
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	user, err := s.companyRepository.Register(&domain.Data{
+		Company:   provider.Company,
+		Branch:    branch,
+		Username:  username,
+		Password:  domain.FederatedPassword,
+		FirstName: claimString(claims, "given_name"),
+		LastName:  claimString(claims, "family_name"),
+		Email:     claimString(claims, "email"),
+		Role:      mapRole(provider, claims),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.federationRepository.CreateIdentity(&domain.FederatedIdentity{
+		Company: provider.Company,
+		Issuer:  provider.Issuer,
+		Subject: subject,
+		UserID:  user.ID,
+		Branch:  user.Branch,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if verified, _ := claims["email_verified"].(bool); verified && user.Email != "" {
+		if err := s.companyRepository.VerifyEmail(user); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.companyRepository.GetMe(&domain.Data{
+		Company: user.Company,
+		Branch:  user.Branch,
+		ID:      user.ID,
+	})
+}
+
+// mapRole picks the highest ranked role any value of the role claim maps to.
+func mapRole(provider *domain.IdentityProvider, claims map[string]interface{}) string {
+	role := provider.DefaultRole
+	if provider.RoleClaim == "" {
+		return role
+	}
+
+	values := []string{}
+	switch claim := claims[provider.RoleClaim].(type) {
+	case string:
+		values = append(values, claim)
+	case []interface{}:
+		for _, v := range claim {
+			if str, ok := v.(string); ok {
+				values = append(values, str)
+			}
+		}
+	}
+
+	for _, value := range values {
+		mapped, ok := provider.RoleMapping[value]
+		if ok && !domain.RoleAtLeast(role, mapped) {
+			role = mapped
+		}
+	}
+
+	return role
+}
+
+func mappedRoles(mapping map[string]string) []string {
+	roles := []string{}
+	for _, role := range mapping {
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
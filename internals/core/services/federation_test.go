@@ -0,0 +1,395 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"go-multi-tenancy/internals/federation"
+	"go-multi-tenancy/internals/federation/stubidp"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFederationRepository keeps one provider, the pending states and the
+// linked identities in memory.
+type fakeFederationRepository struct {
+	mu         sync.Mutex
+	provider   *domain.IdentityProvider
+	states     map[string]*domain.SSOState
+	identities []domain.FederatedIdentity
+}
+
+func (r *fakeFederationRepository) GetProvider(data *domain.IdentityProvider) (*domain.IdentityProvider, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.provider == nil || r.provider.Company != data.Company {
+		return nil, sql.ErrNoRows
+	}
+	found := *r.provider
+	return &found, nil
+}
+
+func (r *fakeFederationRepository) SaveProvider(data *domain.IdentityProvider) (*domain.IdentityProvider, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	provider := *data
+	r.provider = &provider
+	return data, nil
+}
+
+func (r *fakeFederationRepository) DeleteProvider(data *domain.IdentityProvider) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.provider = nil
+	return nil
+}
+
+func (r *fakeFederationRepository) CreateState(data *domain.SSOState, ttlSeconds int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state := *data
+	r.states[data.StateHash] = &state
+	return nil
+}
+
+func (r *fakeFederationRepository) UseState(data *domain.SSOState) (*domain.SSOState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, ok := r.states[data.StateHash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	delete(r.states, data.StateHash)
+	return state, nil
+}
+
+func (r *fakeFederationRepository) GetIdentity(data *domain.FederatedIdentity) (*domain.FederatedIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, identity := range r.identities {
+		if identity.Company == data.Company && identity.Issuer == data.Issuer && identity.Subject == data.Subject {
+			found := identity
+			return &found, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeFederationRepository) CreateIdentity(data *domain.FederatedIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.identities = append(r.identities, *data)
+	return nil
+}
+
+// noMFA lets every login through without a second factor.
+type noMFA struct{ ports.MFAService }
+
+func (noMFA) Challenge(user *domain.DataReply, role string) (*domain.LoginResult, error) {
+	return &domain.LoginResult{Data: user, Role: role}, nil
+}
+
+type federationFixture struct {
+	service    *federationService
+	federation *fakeFederationRepository
+	users      *fakeCompanyRepository
+	status     *fakeTenantStatus
+	idp        *httptest.Server
+}
+
+// newFederationFixture configures acme to log in through a stub identity
+// provider that reports stub.user, mapping its "admins" role claim to admin.
+func newFederationFixture(t *testing.T, users ...*domain.Data) *federationFixture {
+	t.Helper()
+
+	idp := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(idp.Close)
+
+	provider, err := stubidp.New(idp.URL, "acme-client", "acme-secret", map[string]string{
+		"sub":      "stub-user",
+		"username": "stub.user",
+		"email":    "stub.user@acme.test",
+		"branch":   "hq",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.Config.Handler = provider
+
+	f := &federationFixture{
+		federation: &fakeFederationRepository{states: map[string]*domain.SSOState{}},
+		users:      newFakeCompanyRepository(users...),
+		status:     &fakeTenantStatus{errs: map[string]error{}},
+		idp:        idp,
+	}
+	f.service = NewFederationService(f.federation, f.users, noMFA{}, f.status, federation.NewOIDCClient(5*time.Second))
+
+	_, err = f.service.SaveProvider(&domain.IdentityProvider{
+		Company:      "acme",
+		Issuer:       idp.URL,
+		ClientID:     "acme-client",
+		ClientSecret: "acme-secret",
+		RedirectURI:  "https://id.acme.test/sso/acme/callback",
+		BranchClaim:  "branch",
+		RoleClaim:    "role",
+		RoleMapping:  map[string]string{"admins": domain.RoleAdmin},
+		Enabled:      true,
+	})
+	if err != nil {
+		t.Fatalf("SaveProvider: %v", err)
+	}
+	return f
+}
+
+// login runs a federated login through the stub, which reports the claims in
+// overrides instead of its defaults.
+func (f *federationFixture) login(t *testing.T, overrides url.Values) (*domain.LoginResult, error) {
+	t.Helper()
+
+	start, err := f.service.Start(&domain.CompanyRequest{Company: "acme"})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	authorize, err := url.Parse(start.AuthorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authorize.Query()
+	for name, values := range overrides {
+		query[name] = values
+	}
+	authorize.RawQuery = query.Encode()
+
+	// The stub approves right away and redirects back with the code
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(authorize.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	callback, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || callback.Query().Get("code") == "" {
+		t.Fatalf("stub answered %s without a code", res.Status)
+	}
+
+	return f.service.Callback(&domain.SSOCallbackInput{
+		Company: "acme",
+		Code:    callback.Query().Get("code"),
+		State:   callback.Query().Get("state"),
+	})
+}
+
+// acmeProvider is a valid provider for acme that maps the "admins" group
+// to admin.
+func acmeProvider() *domain.IdentityProvider {
+	return &domain.IdentityProvider{
+		Company:      "acme",
+		Issuer:       "https://idp.acme.test",
+		ClientID:     "acme-client",
+		ClientSecret: "acme-secret",
+		RedirectURI:  "https://id.acme.test/sso/acme/callback",
+		BranchClaim:  "branch",
+		RoleClaim:    "role",
+		RoleMapping:  map[string]string{"admins": domain.RoleAdmin},
+		Enabled:      true,
+	}
+}
+
+func TestSaveProvider(t *testing.T) {
+	repo := &fakeFederationRepository{}
+	s := NewFederationService(repo, nil, nil, nil, nil)
+
+	saved, err := s.SaveProvider(acmeProvider())
+	if err != nil {
+		t.Fatalf("SaveProvider: %v", err)
+	}
+	if saved.ClientSecret != "" {
+		t.Error("the client secret was returned")
+	}
+	if saved.DefaultRole != domain.RoleUser || saved.Scopes != "openid profile email" {
+		t.Errorf("defaults = %q, %q", saved.DefaultRole, saved.Scopes)
+	}
+
+	// Updates without a secret keep the stored one
+	update := acmeProvider()
+	update.ClientSecret = ""
+	if _, err := s.SaveProvider(update); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if repo.provider.ClientSecret != "acme-secret" {
+		t.Errorf("stored secret = %q, want it kept", repo.provider.ClientSecret)
+	}
+}
+
+func TestSaveProviderRefusesSuperAdmin(t *testing.T) {
+	tests := map[string]func(*domain.IdentityProvider){
+		"mapped":    func(p *domain.IdentityProvider) { p.RoleMapping = map[string]string{"ops": domain.RoleSuperAdmin} },
+		"default":   func(p *domain.IdentityProvider) { p.DefaultRole = domain.RoleSuperAdmin },
+		"unknown":   func(p *domain.IdentityProvider) { p.RoleMapping = map[string]string{"ops": "root"} },
+		"no branch": func(p *domain.IdentityProvider) { p.BranchClaim = "" },
+		"relative":  func(p *domain.IdentityProvider) { p.Issuer = "idp.acme.test" },
+	}
+
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := &fakeFederationRepository{}
+			s := NewFederationService(repo, nil, nil, nil, nil)
+
+			provider := acmeProvider()
+			modify(provider)
+			if _, err := s.SaveProvider(provider); err == nil {
+				t.Fatal("provider was saved")
+			}
+			if repo.provider != nil {
+				t.Error("refused provider was stored")
+			}
+		})
+	}
+}
+
+func TestMapRole(t *testing.T) {
+	provider := acmeProvider()
+	provider.DefaultRole = domain.RoleUser
+	provider.RoleMapping["leads"] = domain.RoleHeadAdmin
+
+	tests := []struct {
+		name  string
+		claim interface{}
+		want  string
+	}{
+		{name: "mapped group", claim: "admins", want: domain.RoleAdmin},
+		{name: "unmapped group", claim: "staff", want: domain.RoleUser},
+		{name: "local role name as group", claim: domain.RoleSuperAdmin, want: domain.RoleUser},
+		{name: "highest of several", claim: []interface{}{"admins", "leads", "staff"}, want: domain.RoleHeadAdmin},
+		{name: "no claim", want: domain.RoleUser},
+	}
+
+	for _, tt := range tests {
+		claims := map[string]interface{}{}
+		if tt.claim != nil {
+			claims["role"] = tt.claim
+		}
+		if got := mapRole(provider, claims); got != tt.want {
+			t.Errorf("%s: role = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// Mapping is off without a role claim configured
+	provider.RoleClaim = ""
+	if got := mapRole(provider, map[string]interface{}{"role": "admins"}); got != domain.RoleUser {
+		t.Errorf("without role claim: role = %s, want %s", got, domain.RoleUser)
+	}
+}
+
+func TestFederatedLoginProvisionsUser(t *testing.T) {
+	f := newFederationFixture(t)
+
+	result, err := f.login(t, url.Values{"role": {"admins"}})
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if result.Data.Company != "acme" || result.Data.Branch != "hq" || result.Data.Username != "stub.user" || result.Role != domain.RoleAdmin {
+		t.Errorf("logged in as %+v with role %s", result.Data, result.Role)
+	}
+
+	user := f.users.users[result.Data.ID]
+	if user.Password != domain.FederatedPassword {
+		t.Error("provisioned user can log in with a password")
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Error("the provider's verified email was not taken over")
+	}
+
+	// The next login finds the same user through the linked identity
+	again, err := f.login(t, nil)
+	if err != nil {
+		t.Fatalf("second Callback: %v", err)
+	}
+	if again.Data.ID != result.Data.ID || len(f.users.users) != 1 {
+		t.Errorf("second login gave user %s, want %s", again.Data.ID, result.Data.ID)
+	}
+}
+
+func TestFederatedLoginRoleMapping(t *testing.T) {
+	tests := []struct {
+		name  string
+		group string
+		want  string
+	}{
+		{name: "mapped group", group: "admins", want: domain.RoleAdmin},
+		{name: "unmapped group", group: "staff", want: domain.RoleUser},
+		{name: "local role name as group", group: domain.RoleSuperAdmin, want: domain.RoleUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFederationFixture(t)
+
+			result, err := f.login(t, url.Values{"role": {tt.group}})
+			if err != nil {
+				t.Fatalf("Callback: %v", err)
+			}
+			if result.Role != tt.want {
+				t.Errorf("role = %s, want %s", result.Role, tt.want)
+			}
+		})
+	}
+}
+
+func TestFederatedLoginDoesNotLinkLocalAccount(t *testing.T) {
+	local := newUser("acme", "hq", "stub.user", domain.RoleHeadAdmin)
+	f := newFederationFixture(t, local)
+
+	if _, err := f.login(t, nil); !errors.Is(err, domain.ErrSSOAccountExists) {
+		t.Fatalf("err = %v, want ErrSSOAccountExists", err)
+	}
+	if len(f.federation.identities) != 0 || len(f.users.users) != 1 {
+		t.Error("the login was attached to or created next to the local account")
+	}
+
+	// The same username in another branch is a different account
+	result, err := f.login(t, url.Values{"branch": {"east"}})
+	if err != nil {
+		t.Fatalf("other branch: %v", err)
+	}
+	if result.Data.ID == local.ID || result.Data.Branch != "east" {
+		t.Errorf("logged in as %+v", result.Data)
+	}
+}
+
+func TestFederatedProvisioningFollowsTenantStatus(t *testing.T) {
+	f := newFederationFixture(t)
+
+	linked, err := f.login(t, nil)
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+
+	// Linked users still log in to a read-only tenant, new ones are not created
+	f.status.errs["acme"] = domain.ErrTenantReadOnly
+	if again, err := f.login(t, nil); err != nil || again.Data.ID != linked.Data.ID {
+		t.Errorf("linked user in a read-only tenant: %v", err)
+	}
+
+	_, err = f.login(t, url.Values{"sub": {"other-user"}, "username": {"other.user"}})
+	if !errors.Is(err, domain.ErrTenantReadOnly) {
+		t.Errorf("err = %v, want ErrTenantReadOnly", err)
+	}
+	if len(f.users.users) != 1 || len(f.federation.identities) != 1 {
+		t.Error("provisioned a user into a read-only tenant")
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const auditDefaultLimit = 100
+
+type impersonationService struct {
+	companyRepository ports.CompanyRepository
+	auditRepository   ports.AuditRepository
+	tokenService      ports.TokenService
+	ttl               time.Duration
+}
+
+func NewImpersonationService(companyRepository ports.CompanyRepository, auditRepository ports.AuditRepository, tokenService ports.TokenService, ttl time.Duration) *impersonationService {
+	return &impersonationService{
+		companyRepository: companyRepository,
+		auditRepository:   auditRepository,
+		tokenService:      tokenService,
+		ttl:               ttl,
+	}
+}
+
+// Start issues a short-lived access token for the target user on behalf of
+// a super admin. Every start is written to the audit log with its reason.
+func (s *impersonationService) Start(actor *domain.Actor, data *domain.ImpersonationInput) (*domain.ImpersonationReply, error) {
+	data.Reason = strings.TrimSpace(data.Reason)
+	if data.Reason == "" {
+		return nil, domain.ErrImpersonationReason
+	}
+
+	if data.Company == "" || data.UserID == uuid.Nil {
+		return nil, domain.ErrImpersonationTarget
+	}
+
+	target, err := s.companyRepository.GetByID(&domain.Data{Company: data.Company, ID: data.UserID})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if target.DeleteAt != nil {
+		return nil, domain.ErrUserNotFound
+	}
+
+	// Super admins cannot borrow each other's identity, nor their own
+	if target.ID == actor.UserID || domain.RoleAtLeast(target.Role, domain.RoleSuperAdmin) {
+		return nil, domain.ErrImpersonationForbidden
+	}
+
+	session, token, err := s.tokenService.Impersonate(target, actor, s.ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.auditRepository.CreateAuditEvent(&domain.AuditEvent{
+		Action:        domain.AuditImpersonationStart,
+		ActorID:       actor.UserID,
+		ActorUsername: actor.Username,
+		ActorCompany:  actor.Company,
+		TargetID:      &target.ID,
+		TargetCompany: target.Company,
+		TargetBranch:  target.Branch,
+		SessionID:     &session.ID,
+		Reason:        data.Reason,
+		IP:            data.IP,
+	})
+	if err != nil {
+		// An impersonation that is not on record must not be usable
+		if revokeErr := s.tokenService.Logout(&domain.LogoutInput{SessionID: session.ID}); revokeErr != nil {
+			return nil, revokeErr
+		}
+		return nil, err
+	}
+
+	return &domain.ImpersonationReply{
+		AccessToken: token.AccessToken,
+		TokenType:   token.TokenType,
+		ExpiresAt:   token.ExpiresAt,
+		Target: &domain.DataReply{
+			ID:        target.ID,
+			Company:   target.Company,
+			Branch:    target.Branch,
+			Username:  target.Username,
+			FirstName: target.FirstName,
+			LastName:  target.LastName,
+			Email:     target.Email,
+			CreatedAt: target.CreateAt,
+		},
+	}, nil
+}
+
+// Stop ends the impersonation the caller's token belongs to.
+func (s *impersonationService) Stop(data *domain.ImpersonationStopInput) error {
+	if data.Actor == nil {
+		return domain.ErrNotImpersonating
+	}
+
+	if err := s.tokenService.Logout(&domain.LogoutInput{SessionID: data.SessionID}); err != nil {
+		return err
+	}
+
+	return s.auditRepository.CreateAuditEvent(&domain.AuditEvent{
+		Action:        domain.AuditImpersonationStop,
+		ActorID:       data.Actor.UserID,
+		ActorUsername: data.Actor.Username,
+		ActorCompany:  data.Actor.Company,
+		TargetID:      &data.UserID,
+		TargetCompany: data.Company,
+		TargetBranch:  data.Branch,
+		SessionID:     &data.SessionID,
+		IP:            data.IP,
+	})
+}
+
+func (s *impersonationService) AuditLog(data *domain.AuditQuery) ([]domain.AuditEvent, error) {
+	if data.Limit <= 0 || data.Limit > 1000 {
+		data.Limit = auditDefaultLimit
+	}
+
+	return s.auditRepository.GetAuditEvents(data)
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/utils"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// auditLog records audit events, failing every write when err is set.
+type auditLog struct {
+	events []domain.AuditEvent
+	err    error
+}
+
+func (a *auditLog) CreateAuditEvent(data *domain.AuditEvent) error {
+	if a.err != nil {
+		return a.err
+	}
+	a.events = append(a.events, *data)
+	return nil
+}
+
+func (a *auditLog) GetAuditEvents(*domain.AuditQuery) ([]domain.AuditEvent, error) {
+	return a.events, nil
+}
+
+var rootActor = &domain.Actor{UserID: uuid.New(), SessionID: uuid.New(), Username: "root", Company: "platform", Branch: "hq", Role: domain.RoleSuperAdmin}
+
+func TestImpersonationStart(t *testing.T) {
+	alice := newUser("acme", "hq", "alice", domain.RoleAdmin)
+	users := newFakeCompanyRepository(alice)
+	tokens, sessions, _ := newTestTokenService(users)
+	audit := &auditLog{}
+	s := NewImpersonationService(users, audit, tokens, 15*time.Minute)
+
+	reply, err := s.Start(rootActor, &domain.ImpersonationInput{Company: "acme", UserID: alice.ID, Reason: " ticket 42 ", IP: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := utils.ParseJWT(reply.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != alice.ID.String() || claims.Actor == nil || claims.Actor.Subject != rootActor.UserID.String() {
+		t.Errorf("token for %s acting as %+v, want alice acting as root", claims.UserID, claims.Actor)
+	}
+	if time.Until(reply.ExpiresAt) > 15*time.Minute {
+		t.Errorf("token expires at %s, beyond the impersonation ttl", reply.ExpiresAt)
+	}
+
+	if len(audit.events) != 1 {
+		t.Fatalf("audit events = %d, want 1", len(audit.events))
+	}
+	event := audit.events[0]
+	if event.Action != domain.AuditImpersonationStart || event.Reason != "ticket 42" || *event.TargetID != alice.ID || event.ActorID != rootActor.UserID {
+		t.Errorf("audit event %+v", event)
+	}
+	if session := sessions.sessions[*event.SessionID]; session == nil || session.ActorID == nil || *session.ActorID != rootActor.UserID {
+		t.Errorf("session %+v is not marked with the actor", session)
+	}
+}
+
+func TestImpersonationStartRefusals(t *testing.T) {
+	other := newUser("acme", "hq", "other-root", domain.RoleSuperAdmin)
+	self := newUser("platform", "hq", "root", domain.RoleSuperAdmin)
+	self.ID = rootActor.UserID
+	gone := newUser("acme", "hq", "gone", domain.RoleUser)
+	deleted := time.Now()
+	gone.DeleteAt = &deleted
+	users := newFakeCompanyRepository(other, self, gone)
+	tokens, sessions, _ := newTestTokenService(users)
+	audit := &auditLog{}
+	s := NewImpersonationService(users, audit, tokens, time.Minute)
+
+	tests := []struct {
+		name  string
+		input *domain.ImpersonationInput
+		want  error
+	}{
+		{name: "no reason", input: &domain.ImpersonationInput{Company: "acme", UserID: gone.ID, Reason: "  "}, want: domain.ErrImpersonationReason},
+		{name: "no target", input: &domain.ImpersonationInput{Company: "acme", Reason: "support"}, want: domain.ErrImpersonationTarget},
+		{name: "unknown user", input: &domain.ImpersonationInput{Company: "acme", UserID: uuid.New(), Reason: "support"}, want: domain.ErrUserNotFound},
+		{name: "deleted user", input: &domain.ImpersonationInput{Company: "acme", UserID: gone.ID, Reason: "support"}, want: domain.ErrUserNotFound},
+		{name: "another super admin", input: &domain.ImpersonationInput{Company: "acme", UserID: other.ID, Reason: "support"}, want: domain.ErrImpersonationForbidden},
+		{name: "self", input: &domain.ImpersonationInput{Company: "platform", UserID: self.ID, Reason: "support"}, want: domain.ErrImpersonationForbidden},
+	}
+	for _, tt := range tests {
+		if _, err := s.Start(rootActor, tt.input); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if len(sessions.sessions) != 0 || len(audit.events) != 0 {
+		t.Errorf("refusals left %d sessions and %d audit events", len(sessions.sessions), len(audit.events))
+	}
+}
+
+func TestImpersonationWithoutAuditIsRevoked(t *testing.T) {
+	alice := newUser("acme", "hq", "alice", domain.RoleUser)
+	users := newFakeCompanyRepository(alice)
+	tokens, sessions, _ := newTestTokenService(users)
+	s := NewImpersonationService(users, &auditLog{err: errors.New("audit log unavailable")}, tokens, time.Minute)
+
+	if _, err := s.Start(rootActor, &domain.ImpersonationInput{Company: "acme", UserID: alice.ID, Reason: "support"}); err == nil {
+		t.Fatal("impersonation started without an audit record")
+	}
+	for _, session := range sessions.sessions {
+		if session.RevokedAt == nil {
+			t.Error("session of the unrecorded impersonation is still valid")
+		}
+	}
+}
+
+func TestImpersonationStop(t *testing.T) {
+	alice := newUser("acme", "hq", "alice", domain.RoleUser)
+	users := newFakeCompanyRepository(alice)
+	tokens, sessions, _ := newTestTokenService(users)
+	audit := &auditLog{}
+	s := NewImpersonationService(users, audit, tokens, time.Minute)
+
+	if err := s.Stop(&domain.ImpersonationStopInput{UserID: alice.ID}); !errors.Is(err, domain.ErrNotImpersonating) {
+		t.Errorf("stop without actor: err = %v, want %v", err, domain.ErrNotImpersonating)
+	}
+
+	if _, err := s.Start(rootActor, &domain.ImpersonationInput{Company: "acme", UserID: alice.ID, Reason: "support"}); err != nil {
+		t.Fatal(err)
+	}
+	sessionID := *audit.events[0].SessionID
+	if err := s.Stop(&domain.ImpersonationStopInput{SessionID: sessionID, UserID: alice.ID, Company: "acme", Branch: "hq", Actor: rootActor}); err != nil {
+		t.Fatal(err)
+	}
+	if sessions.sessions[sessionID].RevokedAt == nil {
+		t.Error("impersonation session still valid after stop")
+	}
+	if len(audit.events) != 2 || audit.events[1].Action != domain.AuditImpersonationStop {
+		t.Errorf("audit events = %+v, want start and stop", audit.events)
+	}
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"go-multi-tenancy/internals/utils"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const invitationMaxTTL = 30 * 24 * time.Hour
+
+type invitationService struct {
+	invitationRepository ports.InvitationRepository
+	companyRepository    ports.CompanyRepository
+	passwordHasher       ports.PasswordHasher
+	passwordPolicy       ports.PasswordPolicy
+	tenantStatus         ports.TenantStatusService
+	mailer               ports.Mailer
+	baseURL              string
+	ttl                  time.Duration
+}
+
+func NewInvitationService(invitationRepository ports.InvitationRepository, companyRepository ports.CompanyRepository, passwordHasher ports.PasswordHasher, passwordPolicy ports.PasswordPolicy, tenantStatus ports.TenantStatusService, mailer ports.Mailer, baseURL string, ttl time.Duration) *invitationService {
+	return &invitationService{
+		invitationRepository: invitationRepository,
+		companyRepository:    companyRepository,
+		passwordHasher:       passwordHasher,
+		passwordPolicy:       passwordPolicy,
+		tenantStatus:         tenantStatus,
+		mailer:               mailer,
+		baseURL:              baseURL,
+		ttl:                  ttl,
+	}
+}
+
+// ListInvitations returns the invitations of the caller's company, or of
+// their own branch unless they manage every branch.
+func (s *invitationService) ListInvitations(principal *domain.Principal) ([]domain.Invitation, error) {
+	branch := principal.Branch
+	if domain.HasPermission(principal.Permissions, domain.PermBranchesManage) {
+		branch = ""
+	}
+
+	return s.invitationRepository.GetInvitations(&domain.Invitation{Company: principal.Company, Branch: branch})
+}
+
+// CreateInvitation records an invitation and mails the signed link to the
+// invitee. Admins can only invite into their own scope and at most at their
+// own role.
+func (s *invitationService) CreateInvitation(principal *domain.Principal, data *domain.InvitationInput) (*domain.InvitationCreated, error) {
+	if data.Company == "" {
+		data.Company = principal.Company
+	}
+	if data.Branch == "" {
+		data.Branch = principal.Branch
+	}
+	if data.Role == "" {
+		data.Role = domain.RoleUser
+	}
+
+	if _, err := mail.ParseAddress(data.Email); err != nil {
+		return nil, errors.New("invalid email address")
+	}
+
+	if !domain.InTenantScope(principal.Permissions, principal.Company, principal.Branch, data.Company, data.Branch) {
+		return nil, domain.ErrOutOfTenantScope
+	}
+
+	// Super admins run the platform, they are not invited into a company
+	if !domain.ValidRole(data.Role) || data.Role == domain.RoleSuperAdmin || !domain.RoleAtLeast(principal.Role, data.Role) {
+		return nil, domain.ErrInvitationRole
+	}
+
+	ttl := s.ttl
+	if data.ExpiresIn > 0 {
+		ttl = time.Duration(data.ExpiresIn) * time.Second
+	}
+	if ttl > invitationMaxTTL {
+		ttl = invitationMaxTTL
+	}
+
+	invitation, err := s.invitationRepository.CreateInvitation(&domain.Invitation{
+		Company:   data.Company,
+		Branch:    data.Branch,
+		Email:     data.Email,
+		Role:      data.Role,
+		InvitedBy: principal.UserID,
+	}, int(ttl.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &utils.ActionClaims{
+		Purpose: domain.PurposeInvitation,
+		Company: invitation.Company,
+		Branch:  invitation.Branch,
+		Email:   invitation.Email,
+	}
+	claims.Id = invitation.ID.String()
+
+	token, err := utils.GenerateActionToken(claims, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	link := s.baseURL + "/accept-invitation?token=" + url.QueryEscape(token)
+
+	err = s.mailer.Send(&domain.Mail{
+		To:      invitation.Email,
+		Subject: "You have been invited to " + invitation.Company,
+		Body: fmt.Sprintf("Hello,\n\nYou have been invited to join %s (%s). Open the link below to choose a username and password. It expires in %s and works once.\n\n%s\n",
+			invitation.Company, invitation.Branch, ttl, link),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.InvitationCreated{Invitation: invitation, Link: link}, nil
+}
+
+func (s *invitationService) RevokeInvitation(principal *domain.Principal, id uuid.UUID) error {
+	invitation, err := s.invitationRepository.GetInvitation(&domain.Invitation{ID: id})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrInvitationNotFound
+		}
+		return err
+	}
+
+	// Invitations of other tenants are reported missing rather than forbidden
+	if !domain.InTenantScope(principal.Permissions, principal.Company, principal.Branch, invitation.Company, invitation.Branch) {
+		return domain.ErrInvitationNotFound
+	}
+
+	ok, err := s.invitationRepository.RevokeInvitation(invitation)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return domain.ErrInvitationNotFound
+	}
+
+	return nil
+}
+
+// AcceptInvitation creates the invited user. The invitation is burnt before
+// the user is created, so two requests racing with one link cannot both
+// succeed.
+func (s *invitationService) AcceptInvitation(data *domain.AcceptInvitationInput) (*domain.DataReply, error) {
+	data.Username = strings.TrimSpace(data.Username)
+	if data.Username == "" || data.Password == "" {
+		return nil, errors.New("username or password cannot be empty")
+	}
+
+	claims, err := utils.ParseActionToken(data.Token, domain.PurposeInvitation)
+	if err != nil {
+		return nil, domain.ErrInvalidInvitation
+	}
+
+	id, err := uuid.Parse(claims.Id)
+	if err != nil {
+		return nil, domain.ErrInvalidInvitation
+	}
+
+	invitation, err := s.invitationRepository.GetPendingInvitation(&domain.Invitation{ID: id})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrInvalidInvitation
+		}
+		return nil, err
+	}
+
+	if err := s.tenantStatus.Check(invitation.Company, invitation.Branch, true); err != nil {
+		return nil, err
+	}
+
+	users, _, err := s.companyRepository.FindUsers(&domain.UserQuery{Company: invitation.Company, Branch: invitation.Branch, Username: data.Username, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) > 0 {
+		return nil, domain.ErrUsernameTaken
+	}
+
+	// Checked before the invitation is burnt, so a rejected password can be retried with the same link
+	user := &domain.Data{
+		Company:   invitation.Company,
+		Branch:    invitation.Branch,
+		Username:  data.Username,
+		FirstName: data.FirstName,
+		LastName:  data.LastName,
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+	}
+	if err := s.passwordPolicy.Check(user, data.Password); err != nil {
+		return nil, err
+	}
+
+	user.Password, err = s.passwordHasher.Hash(data.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.invitationRepository.AcceptInvitation(invitation)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, domain.ErrInvalidInvitation
+	}
+
+	res, err := s.companyRepository.Register(user)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation.UserID = &res.ID
+	if err := s.invitationRepository.SetInvitationUser(invitation); err != nil {
+		return nil, err
+	}
+
+	if err := s.passwordPolicy.Record(res); err != nil {
+		return nil, err
+	}
+
+	// The link reached the invitee through this address, so it is verified
+	if err := s.companyRepository.VerifyEmail(res); err != nil {
+		return nil, err
+	}
+
+	return &domain.DataReply{
+		ID:        res.ID,
+		Company:   res.Company,
+		Branch:    res.Branch,
+		Username:  res.Username,
+		FirstName: res.FirstName,
+		LastName:  res.LastName,
+		Email:     res.Email,
+		CreatedAt: res.CreateAt,
+	}, nil
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// fakeInvitationRepository keeps invitations in memory and records the
+// filter of every listing.
+type fakeInvitationRepository struct {
+	mu          sync.Mutex
+	invitations map[uuid.UUID]*domain.Invitation
+	listed      []domain.Invitation
+}
+
+func newFakeInvitationRepository(invitations ...*domain.Invitation) *fakeInvitationRepository {
+	r := &fakeInvitationRepository{invitations: map[uuid.UUID]*domain.Invitation{}}
+	for _, invitation := range invitations {
+		r.invitations[invitation.ID] = invitation
+	}
+	return r
+}
+
+func (r *fakeInvitationRepository) CreateInvitation(data *domain.Invitation, expiresIn int) (*domain.Invitation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data.ID = uuid.New()
+	data.ExpiresAt = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	invitation := *data
+	r.invitations[data.ID] = &invitation
+	return data, nil
+}
+
+// GetInvitations records the filter it was called with.
+func (r *fakeInvitationRepository) GetInvitations(data *domain.Invitation) ([]domain.Invitation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.listed = append(r.listed, *data)
+	return []domain.Invitation{}, nil
+}
+
+func (r *fakeInvitationRepository) GetInvitation(data *domain.Invitation) (*domain.Invitation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invitation, ok := r.invitations[data.ID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	found := *invitation
+	return &found, nil
+}
+
+func (r *fakeInvitationRepository) GetPendingInvitation(data *domain.Invitation) (*domain.Invitation, error) {
+	invitation, err := r.GetInvitation(data)
+	if err != nil {
+		return nil, err
+	}
+	if invitation.AcceptedAt != nil || invitation.RevokedAt != nil || time.Now().After(invitation.ExpiresAt) {
+		return nil, sql.ErrNoRows
+	}
+	return invitation, nil
+}
+
+func (r *fakeInvitationRepository) AcceptInvitation(data *domain.Invitation) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invitation, ok := r.invitations[data.ID]
+	if !ok || invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	invitation.AcceptedAt = &now
+	return true, nil
+}
+
+func (r *fakeInvitationRepository) SetInvitationUser(data *domain.Invitation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.invitations[data.ID].UserID = data.UserID
+	return nil
+}
+
+func (r *fakeInvitationRepository) RevokeInvitation(data *domain.Invitation) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invitation, ok := r.invitations[data.ID]
+	if !ok || invitation.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	invitation.RevokedAt = &now
+	return true, nil
+}
+
+func TestCreateInvitationRoles(t *testing.T) {
+	tests := []struct {
+		principal *domain.Principal
+		role      string
+		want      error
+	}{
+		{principal: branchAdmin, role: ""},
+		{principal: branchAdmin, role: domain.RoleAdmin},
+		{principal: branchAdmin, role: domain.RoleHeadAdmin, want: domain.ErrInvitationRole},
+		{principal: companyAdmin, role: domain.RoleHeadAdmin},
+		{principal: superAdmin, role: domain.RoleSuperAdmin, want: domain.ErrInvitationRole},
+		{principal: superAdmin, role: domain.RoleAPIKey, want: domain.ErrInvitationRole},
+		{principal: superAdmin, role: "owner", want: domain.ErrInvitationRole},
+	}
+
+	for _, tt := range tests {
+		mail := &outbox{}
+		s := NewInvitationService(newFakeInvitationRepository(), nil, nil, allowAll{}, &fakeTenantStatus{}, mail, "https://id.acme.test", time.Hour)
+
+		created, err := s.CreateInvitation(tt.principal, &domain.InvitationInput{Email: "new@acme.test", Role: tt.role})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s inviting a %q: err = %v, want %v", tt.principal.Role, tt.role, err, tt.want)
+			continue
+		}
+		if tt.want != nil {
+			if len(mail.mails) != 0 {
+				t.Errorf("%s inviting a %q: refused invitation was mailed", tt.principal.Role, tt.role)
+			}
+			continue
+		}
+		if tt.role == "" && created.Role != domain.RoleUser {
+			t.Errorf("default role = %s, want %s", created.Role, domain.RoleUser)
+		}
+		if len(mail.mails) != 1 || mail.mails[0].To != "new@acme.test" || !strings.Contains(mail.mails[0].Body, created.Link) {
+			t.Errorf("mails = %+v, want the link sent to the invitee", mail.mails)
+		}
+	}
+
+	s := NewInvitationService(newFakeInvitationRepository(), nil, nil, allowAll{}, &fakeTenantStatus{}, &outbox{}, "https://id.acme.test", time.Hour)
+	if _, err := s.CreateInvitation(companyAdmin, &domain.InvitationInput{Email: "not an address"}); err == nil {
+		t.Error("invitation to an invalid address created")
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	mail := &outbox{}
+	invitations := newFakeInvitationRepository()
+	taken := newUser("acme", "east", "alice", domain.RoleUser)
+	users := newFakeCompanyRepository(taken)
+	s := NewInvitationService(invitations, users, newTestHasher(t), weakPasswords{}, &fakeTenantStatus{}, mail, "https://id.acme.test", time.Hour)
+
+	if _, err := s.CreateInvitation(companyAdmin, &domain.InvitationInput{Branch: "east", Email: "Bob@acme.test", Role: domain.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	token := mail.token(t)
+
+	// Refusals leave the link usable
+	if _, err := s.AcceptInvitation(&domain.AcceptInvitationInput{Token: token, Username: "alice", Password: "b0b-passw0rd"}); !errors.Is(err, domain.ErrUsernameTaken) {
+		t.Errorf("taken username: err = %v, want %v", err, domain.ErrUsernameTaken)
+	}
+	if _, err := s.AcceptInvitation(&domain.AcceptInvitationInput{Token: token, Username: "bob", Password: "weak"}); violations(err) == nil {
+		t.Errorf("weak password: err = %v, want a policy error", err)
+	}
+	if len(users.users) != 1 {
+		t.Fatalf("users = %d after refusals, want 1", len(users.users))
+	}
+
+	reply, err := s.AcceptInvitation(&domain.AcceptInvitationInput{Token: token, Username: " bob ", Password: "b0b-passw0rd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := users.users[reply.ID]
+	if bob.Branch != "east" || bob.Username != "bob" || bob.Role != domain.RoleAdmin || bob.Password == "b0b-passw0rd" {
+		t.Errorf("created %+v", bob)
+	}
+	if bob.EmailVerifiedAt == nil {
+		t.Error("invited address is not verified")
+	}
+	for _, invitation := range invitations.invitations {
+		if invitation.UserID == nil || *invitation.UserID != bob.ID {
+			t.Errorf("invitation user = %v, want %s", invitation.UserID, bob.ID)
+		}
+	}
+
+	if _, err := s.AcceptInvitation(&domain.AcceptInvitationInput{Token: token, Username: "carol", Password: "c4rol-passw0rd"}); !errors.Is(err, domain.ErrInvalidInvitation) {
+		t.Errorf("second accept: err = %v, want %v", err, domain.ErrInvalidInvitation)
+	}
+	if _, err := s.AcceptInvitation(&domain.AcceptInvitationInput{Token: "forged", Username: "carol", Password: "c4rol-passw0rd"}); !errors.Is(err, domain.ErrInvalidInvitation) {
+		t.Errorf("forged token: err = %v, want %v", err, domain.ErrInvalidInvitation)
+	}
+}
+
+func TestAcceptRevokedInvitation(t *testing.T) {
+	mail := &outbox{}
+	users := newFakeCompanyRepository()
+	s := NewInvitationService(newFakeInvitationRepository(), users, newTestHasher(t), allowAll{}, &fakeTenantStatus{}, mail, "https://id.acme.test", time.Hour)
+
+	created, err := s.CreateInvitation(companyAdmin, &domain.InvitationInput{Email: "new@acme.test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RevokeInvitation(companyAdmin, created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.AcceptInvitation(&domain.AcceptInvitationInput{Token: mail.token(t), Username: "newbie", Password: "n3w-passw0rd"}); !errors.Is(err, domain.ErrInvalidInvitation) {
+		t.Errorf("err = %v, want %v", err, domain.ErrInvalidInvitation)
+	}
+	if len(users.users) != 0 {
+		t.Error("user created from a revoked invitation")
+	}
+}
+
+func TestAcceptInvitationFollowsTenantStatus(t *testing.T) {
+	mail := &outbox{}
+	users := newFakeCompanyRepository()
+	status := &fakeTenantStatus{errs: map[string]error{}}
+	s := NewInvitationService(newFakeInvitationRepository(), users, newTestHasher(t), allowAll{}, status, mail, "https://id.acme.test", time.Hour)
+
+	if _, err := s.CreateInvitation(companyAdmin, &domain.InvitationInput{Email: "new@acme.test"}); err != nil {
+		t.Fatal(err)
+	}
+	input := &domain.AcceptInvitationInput{Token: mail.token(t), Username: "newbie", Password: "n3w-passw0rd"}
+
+	for _, want := range []error{domain.ErrTenantReadOnly, domain.ErrTenantSuspended} {
+		status.errs["acme"] = want
+		if _, err := s.AcceptInvitation(input); !errors.Is(err, want) {
+			t.Errorf("err = %v, want %v", err, want)
+		}
+		if len(users.users) != 0 {
+			t.Fatalf("user created in a tenant that is %v", want)
+		}
+	}
+
+	// Refused before the invitation is burnt, so the link works once the tenant is back
+	delete(status.errs, "acme")
+	reply, err := s.AcceptInvitation(input)
+	if err != nil {
+		t.Fatalf("after reactivation: %v", err)
+	}
+	if reply.Company != "acme" || reply.Branch != "hq" || reply.Username != "newbie" {
+		t.Errorf("accepted as %+v", reply)
+	}
+}
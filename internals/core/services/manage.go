@@ -1,36 +1,48 @@
 package services
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"go-multi-tenancy/internals/core/domain"
 	"go-multi-tenancy/internals/core/ports"
+	"log"
 	"strings"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type manageService struct {
 	manageRepository ports.ManageRepository
+	retention        time.Duration
 }
 
-func NewManageService(manageRepository ports.ManageRepository) *manageService {
+// NewManageService manages companies and branches. Deleted ones are kept in
+// the archive for retention before PurgeArchives drops them.
+func NewManageService(manageRepository ports.ManageRepository, retention time.Duration) *manageService {
 	return &manageService{
 		manageRepository: manageRepository,
+		retention:        retention,
 	}
 }
 
 func (m *manageService) GetCompany() ([]domain.ResponseCompany, error) {
 	company, err := m.manageRepository.GetCompany()
 	if err != nil {
-		return nil, errors.New("Company not found")
+		return nil, err
 	}
 
 	companyData := []domain.ResponseCompany{}
 	for _, res := range company {
-		if len(res.Company) == 0 {
-			return nil, errors.New("Company not found")
-		}
-
 		companyData = append(companyData, domain.ResponseCompany{
-			Company: extractLastPart(res.Company),
+			Company:     res.Company,
+			DisplayName: res.DisplayName,
+			Status:      res.Status,
+			Settings:    res.Settings,
+			CreateAt:    res.CreateAt,
+			UpdateAt:    res.UpdateAt,
 		})
 	}
 
@@ -42,34 +54,51 @@ func (m *manageService) GetBranch(data *domain.CompanyRequest) ([]domain.Respons
 		return nil, errors.New("Company name is required")
 	}
 
-	req := &domain.GetBranch{
-		Company: strings.ToLower(data.Company),
+	name := strings.ToLower(data.Company)
+	if err := validTenantNames(name); err != nil {
+		return nil, err
 	}
 
-	branch, err := m.manageRepository.GetBranch(req)
+	company, err := m.getTenant(name, "")
 	if err != nil {
 		return nil, err
 	}
 
-	branchData := []domain.ResponseBranch{}
-	for _, res := range branch {
-		if len(res.Company) == 0 && len(res.Branch) == 0 {
-			return nil, errors.New("Branch not found")
-		}
+	branch, err := m.manageRepository.GetBranch(company)
+	if err != nil {
+		return nil, err
+	}
 
-		branchData = append(branchData, domain.ResponseBranch{
-			Company: extractLastPart(res.Company),
-			Branch:  extractLastPartFromSlice(res.Branch),
+	branchData := []domain.BranchObject{}
+	for _, res := range branch {
+		branchData = append(branchData, domain.BranchObject{
+			Name:        res.Branch,
+			DisplayName: res.DisplayName,
+			Status:      res.Status,
+			Settings:    res.Settings,
+			CreateAt:    res.CreateAt,
+			UpdateAt:    res.UpdateAt,
 		})
 	}
 
-	return branchData, nil
-
+	return []domain.ResponseBranch{{
+		Company: company.Company,
+		Branch:  branchData,
+	}}, nil
 }
 
 func (m *manageService) CreateCompany(data *domain.CompanyRequest) (*domain.Response, error) {
-	req := &domain.Manage{
-		Company: strings.ToLower(data.Company),
+	if err := validTenantNames(strings.ToLower(data.Company)); err != nil {
+		return nil, err
+	}
+	if !validSettings(data.Settings) {
+		return nil, domain.ErrInvalidSettings
+	}
+
+	req := &domain.Tenant{
+		Company:     strings.ToLower(data.Company),
+		DisplayName: data.DisplayName,
+		Settings:    data.Settings,
 	}
 
 	company, err := m.manageRepository.CreateCompany(req)
@@ -86,9 +115,18 @@ func (m *manageService) CreateCompany(data *domain.CompanyRequest) (*domain.Resp
 }
 
 func (m *manageService) CreateBranch(data *domain.BranchRequest) (*domain.Response, error) {
-	req := &domain.Manage{
-		Company: strings.ToLower(data.Company),
-		Branch:  strings.ToLower(data.Branch),
+	if err := validTenantNames(strings.ToLower(data.Company), strings.ToLower(data.Branch)); err != nil {
+		return nil, err
+	}
+	if !validSettings(data.Settings) {
+		return nil, domain.ErrInvalidSettings
+	}
+
+	req := &domain.Tenant{
+		Company:     strings.ToLower(data.Company),
+		Branch:      strings.ToLower(data.Branch),
+		DisplayName: data.DisplayName,
+		Settings:    data.Settings,
 	}
 
 	branch, err := m.manageRepository.CreateBranch(req)
@@ -104,57 +142,164 @@ func (m *manageService) CreateBranch(data *domain.BranchRequest) (*domain.Respon
 	return &branchData, nil
 }
 
-func (m *manageService) DeleteCompany(data *domain.CompanyRequest) error {
-	req := &domain.Manage{
+// DeleteCompany archives the company with all of its branches. Nothing is
+// dropped until the retention ends, so the delete can be undone until then.
+func (m *manageService) DeleteCompany(data *domain.CompanyRequest) (*domain.Archive, error) {
+	req := &domain.Tenant{
 		Company: strings.ToLower(data.Company),
 	}
-
-	err := m.manageRepository.DeleteCompany(req)
-	if err != nil {
-		return err
+	if err := validTenantNames(req.Company); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return m.manageRepository.ArchiveCompany(req, int(m.retention.Seconds()))
 }
 
-func (m *manageService) DeleteBranch(data *domain.BranchRequest) error {
-	req := &domain.Manage{
+func (m *manageService) DeleteBranch(data *domain.BranchRequest) (*domain.Archive, error) {
+	req := &domain.Tenant{
 		Company: strings.ToLower(data.Company),
 		Branch:  strings.ToLower(data.Branch),
 	}
+	if err := validTenantNames(req.Company, req.Branch); err != nil {
+		return nil, err
+	}
+
+	return m.manageRepository.ArchiveBranch(req, int(m.retention.Seconds()))
+}
 
-	err := m.manageRepository.DeleteBranch(req)
+func (m *manageService) GetArchives() ([]domain.Archive, error) {
+	return m.manageRepository.GetArchives()
+}
+
+func (m *manageService) RestoreArchive(id uuid.UUID) error {
+	return m.manageRepository.RestoreArchive(&domain.Archive{ID: id})
+}
+
+// PurgeArchives drops the archives whose retention has ended and reports
+// how many went. One failing archive does not hold back the others.
+func (m *manageService) PurgeArchives() (int, error) {
+	archives, err := m.manageRepository.GetExpiredArchives()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	purged := 0
+	var errs []error
+	for i := range archives {
+		if err := m.manageRepository.PurgeArchive(&archives[i]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		purged++
+	}
+
+	return purged, errors.Join(errs...)
+}
+
+// WatchArchives purges expired archives every interval for as long as the
+// process runs.
+func (m *manageService) WatchArchives(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			purged, err := m.PurgeArchives()
+			if err != nil {
+				log.Println("archive: purging expired archives:", err)
+			}
+			if purged > 0 {
+				log.Println("archive: purged", purged, "expired archives")
+			}
+		}
+	}()
 }
 
-func extractLastPart(s string) string {
-	parts := strings.Split(s, ".")
-	if len(parts) > 1 {
-		return parts[1]
+// UpdateTenant changes the display name and settings of a company, or of
+// one of its branches when data.Branch is set.
+func (m *manageService) UpdateTenant(data *domain.TenantUpdate) (*domain.Tenant, error) {
+	company, branch := strings.ToLower(data.Company), strings.ToLower(data.Branch)
+	names := []string{company}
+	if branch != "" {
+		names = append(names, branch)
+	}
+	if err := validTenantNames(names...); err != nil {
+		return nil, err
+	}
+
+	tenant, err := m.getTenant(company, branch)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.DisplayName != nil {
+		tenant.DisplayName = *data.DisplayName
 	}
-	return ""
+	if len(data.Settings) > 0 {
+		if !validSettings(data.Settings) {
+			return nil, domain.ErrInvalidSettings
+		}
+		tenant.Settings = data.Settings
+	}
+
+	ok, err := m.manageRepository.UpdateTenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, domain.ErrTenantNotFound
+	}
+
+	return m.getTenant(tenant.Company, tenant.Branch)
 }
 
-func extractLastPartFromSlice(slice []*string) []domain.BranchObject {
-	var result []domain.BranchObject
-	for _, str := range slice {
-		if str != nil {
-			extracted := extractLastPart(*str)
-			result = append(result, domain.BranchObject{Name: extracted})
+func (m *manageService) getTenant(company, branch string) (*domain.Tenant, error) {
+	tenant, err := m.manageRepository.GetTenant(&domain.Tenant{Company: company, Branch: branch})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrTenantNotFound
 		}
+		return nil, err
 	}
-	return result
+
+	return tenant, nil
+}
+
+// validTenantNames checks every slug before it reaches the repository.
+func validTenantNames(names ...string) error {
+	for _, name := range names {
+		if err := domain.ValidTenantName(name); err != nil {
+			return fmt.Errorf("%q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validSettings accepts a JSON object, or nothing at all.
+func validSettings(settings json.RawMessage) bool {
+	if len(settings) == 0 {
+		return true
+	}
+
+	var object map[string]interface{}
+	return json.Unmarshal(settings, &object) == nil && object != nil
 }
 
 func (m *manageService) UpdateCompanyToBranch(data *domain.CompanyAndBranch) (*domain.Response, error) {
-	if data.NewBranch == "" || data.NewCompany == "" || data.OldBranch == "" || data.OldCompany == "" || data.BranchName == "" {
+	if data.NewCompany == "" || data.OldBranch == "" || data.OldCompany == "" || data.BranchName == "" {
 		return nil, errors.New("All fields are required")
 	}
 
+	data.OldCompany, data.OldBranch = strings.ToLower(data.OldCompany), strings.ToLower(data.OldBranch)
+	data.NewCompany, data.BranchName = strings.ToLower(data.NewCompany), strings.ToLower(data.BranchName)
+	if err := validTenantNames(data.OldCompany, data.OldBranch, data.NewCompany, data.BranchName); err != nil {
+		return nil, err
+	}
+
 	err := m.manageRepository.UpdateCompanyToBranch(data)
 	if err != nil {
 		return nil, err
@@ -166,10 +311,16 @@ func (m *manageService) UpdateCompanyToBranch(data *domain.CompanyAndBranch) (*d
 }
 
 func (m *manageService) UpdateBranchToCompany(data *domain.CompanyAndBranch) (*domain.Response, error) {
-	if data.NewBranch == "" || data.NewCompany == "" || data.OldBranch == "" || data.OldCompany == "" || data.BranchName == "" {
+	if data.NewCompany == "" || data.OldBranch == "" || data.OldCompany == "" || data.BranchName == "" {
 		return nil, errors.New("All fields are required")
 	}
 
+	data.OldCompany, data.OldBranch = strings.ToLower(data.OldCompany), strings.ToLower(data.OldBranch)
+	data.NewCompany, data.BranchName = strings.ToLower(data.NewCompany), strings.ToLower(data.BranchName)
+	if err := validTenantNames(data.OldCompany, data.OldBranch, data.NewCompany, data.BranchName); err != nil {
+		return nil, err
+	}
+
 	err := m.manageRepository.UpdateBranchToCompany(data)
 	if err != nil {
 		return nil, err
@@ -185,6 +336,11 @@ func (m *manageService) UpdateCompanyName(data *domain.RenameCompany) (*domain.R
 		return nil, errors.New("All fields are required")
 	}
 
+	data.OldCompany, data.NewCompany = strings.ToLower(data.OldCompany), strings.ToLower(data.NewCompany)
+	if err := validTenantNames(data.OldCompany, data.NewCompany); err != nil {
+		return nil, err
+	}
+
 	err := m.manageRepository.UpdateCompanyName(data)
 	if err != nil {
 		return nil, err
@@ -201,6 +357,12 @@ func (m *manageService) UpdateBranchName(data *domain.RenameBranch) (*domain.Res
 		return nil, errors.New("All fields are required")
 	}
 
+	data.Company = strings.ToLower(data.Company)
+	data.OldBranch, data.NewBranch = strings.ToLower(data.OldBranch), strings.ToLower(data.NewBranch)
+	if err := validTenantNames(data.Company, data.OldBranch, data.NewBranch); err != nil {
+		return nil, err
+	}
+
 	err := m.manageRepository.UpdateBranchName(data)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// tenantRegistry keeps tenant metadata keyed by "company/branch".
+type tenantRegistry struct {
+	ports.ManageRepository
+	tenants map[string]*domain.Tenant
+}
+
+func (r *tenantRegistry) GetTenant(data *domain.Tenant) (*domain.Tenant, error) {
+	tenant, ok := r.tenants[data.Company+"/"+data.Branch]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	found := *tenant
+	return &found, nil
+}
+
+func (r *tenantRegistry) UpdateTenant(data *domain.Tenant) (bool, error) {
+	key := data.Company + "/" + data.Branch
+	if _, ok := r.tenants[key]; !ok {
+		return false, nil
+	}
+	tenant := *data
+	r.tenants[key] = &tenant
+	return true, nil
+}
+
+func TestValidSettings(t *testing.T) {
+	tests := map[string]bool{
+		``:                     true,
+		`{}`:                   true,
+		`{"plan": "business"}`: true,
+		`null`:                 false,
+		`[]`:                   false,
+		`"business"`:           false,
+		`{"plan":`:             false,
+	}
+	for settings, want := range tests {
+		if got := validSettings(json.RawMessage(settings)); got != want {
+			t.Errorf("validSettings(%s) = %v, want %v", settings, got, want)
+		}
+	}
+}
+
+func TestUpdateTenant(t *testing.T) {
+	repo := &tenantRegistry{tenants: map[string]*domain.Tenant{
+		"acme/":   {Company: "acme", DisplayName: "Acme", Status: domain.TenantActive, Settings: json.RawMessage(`{"plan": "free"}`)},
+		"acme/hq": {Company: "acme", Branch: "hq", DisplayName: "HQ", Status: domain.TenantActive},
+	}}
+	s := NewManageService(repo, 0)
+
+	name := "Acme Corporation"
+	tenant, err := s.UpdateTenant(&domain.TenantUpdate{Company: "ACME", DisplayName: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant.DisplayName != name || string(tenant.Settings) != `{"plan": "free"}` {
+		t.Errorf("updated to %s %s, want the new name and the old settings", tenant.DisplayName, tenant.Settings)
+	}
+
+	// Display names are free text, slugs are not
+	name = "สำนักงานใหญ่"
+	tenant, err = s.UpdateTenant(&domain.TenantUpdate{Company: "acme", Branch: "hq", DisplayName: &name, Settings: json.RawMessage(`{"plan": "business"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant.DisplayName != name || string(tenant.Settings) != `{"plan": "business"}` {
+		t.Errorf("updated branch to %s %s", tenant.DisplayName, tenant.Settings)
+	}
+
+	if _, err := s.UpdateTenant(&domain.TenantUpdate{Company: "acme", Settings: json.RawMessage(`[1]`)}); !errors.Is(err, domain.ErrInvalidSettings) {
+		t.Errorf("array settings: err = %v, want %v", err, domain.ErrInvalidSettings)
+	}
+	if _, err := s.UpdateTenant(&domain.TenantUpdate{Company: "acme", Branch: "east", DisplayName: &name}); !errors.Is(err, domain.ErrTenantNotFound) {
+		t.Errorf("missing branch: err = %v, want %v", err, domain.ErrTenantNotFound)
+	}
+	if repo.tenants["acme/"].DisplayName != "Acme Corporation" {
+		t.Errorf("refused update changed the company to %s", repo.tenants["acme/"].DisplayName)
+	}
+}
+
+// archiveShelf keeps archives in memory and fails to purge the ones in broken.
+type archiveShelf struct {
+	ports.ManageRepository
+	archives  []domain.Archive
+	retention int
+	broken    map[string]bool
+}
+
+func (s *archiveShelf) ArchiveCompany(data *domain.Tenant, retention int) (*domain.Archive, error) {
+	s.retention = retention
+	archive := domain.Archive{ID: uuid.New(), Company: data.Company, ArchivedAt: time.Now()}
+	archive.PurgeAfter = archive.ArchivedAt.Add(time.Duration(retention) * time.Second)
+	s.archives = append(s.archives, archive)
+	return &archive, nil
+}
+
+func (s *archiveShelf) GetExpiredArchives() ([]domain.Archive, error) {
+	var expired []domain.Archive
+	for _, archive := range s.archives {
+		if !archive.PurgeAfter.After(time.Now()) {
+			expired = append(expired, archive)
+		}
+	}
+	return expired, nil
+}
+
+func (s *archiveShelf) PurgeArchive(data *domain.Archive) error {
+	if s.broken[data.Company] {
+		return errors.New("drop table failed")
+	}
+	for i := range s.archives {
+		if s.archives[i].ID == data.ID {
+			s.archives = append(s.archives[:i], s.archives[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrArchiveNotFound
+}
+
+func TestDeleteCompanyArchives(t *testing.T) {
+	repo := &archiveShelf{}
+	s := NewManageService(repo, 72*time.Hour)
+
+	archive, err := s.DeleteCompany(&domain.CompanyRequest{Company: "ACME"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive.Company != "acme" || repo.retention != 72*60*60 {
+		t.Errorf("archived %s for %d seconds, want acme for 259200", archive.Company, repo.retention)
+	}
+	if purged, err := s.PurgeArchives(); err != nil || purged != 0 {
+		t.Errorf("purged %d (%v) before the retention ended", purged, err)
+	}
+}
+
+func TestPurgeArchives(t *testing.T) {
+	repo := &archiveShelf{broken: map[string]bool{"globex": true}}
+	s := NewManageService(repo, 0)
+	for _, company := range []string{"acme", "globex", "initech"} {
+		if _, err := s.DeleteCompany(&domain.CompanyRequest{Company: company}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	purged, err := s.PurgeArchives()
+	if err == nil {
+		t.Error("a failed purge was not reported")
+	}
+	if purged != 2 || len(repo.archives) != 1 || repo.archives[0].Company != "globex" {
+		t.Errorf("purged %d, left %v, want only globex left", purged, repo.archives)
+	}
+}
+
+func TestManageRefusesInvalidNames(t *testing.T) {
+	// The repository is never set, so reaching it panics
+	s := NewManageService(&tenantRegistry{}, 0)
+	name := `acme"; DROP TABLE company.accounts; --`
+
+	if _, err := s.CreateCompany(&domain.CompanyRequest{Company: name}); !errors.Is(err, domain.ErrInvalidTenantName) {
+		t.Errorf("create company: err = %v, want %v", err, domain.ErrInvalidTenantName)
+	}
+	if _, err := s.CreateBranch(&domain.BranchRequest{Company: "acme", Branch: "east side"}); !errors.Is(err, domain.ErrInvalidTenantName) {
+		t.Errorf("create branch: err = %v, want %v", err, domain.ErrInvalidTenantName)
+	}
+	if _, err := s.DeleteBranch(&domain.BranchRequest{Company: "acme", Branch: "-east"}); !errors.Is(err, domain.ErrInvalidTenantName) {
+		t.Errorf("delete branch: err = %v, want %v", err, domain.ErrInvalidTenantName)
+	}
+	if _, err := s.CreateBranch(&domain.BranchRequest{Company: "acme", Branch: "accounts"}); !errors.Is(err, domain.ErrReservedTenantName) {
+		t.Errorf("reserved branch: err = %v, want %v", err, domain.ErrReservedTenantName)
+	}
+	if _, err := s.CreateCompany(&domain.CompanyRequest{Company: "pg_class"}); !errors.Is(err, domain.ErrInvalidTenantName) {
+		t.Errorf("pg_ company: err = %v, want %v", err, domain.ErrInvalidTenantName)
+	}
+	if _, err := s.UpdateTenant(&domain.TenantUpdate{Company: "acme", Branch: name}); !errors.Is(err, domain.ErrInvalidTenantName) {
+		t.Errorf("update branch: err = %v, want %v", err, domain.ErrInvalidTenantName)
+	}
+}
@@ -0,0 +1,491 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"go-multi-tenancy/internals/utils"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	mfaTokenTTL       = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+type mfaService struct {
+	mfaRepository         ports.MFARepository
+	policyRepository      ports.PolicyRepository
+	companyRepository     ports.CompanyRepository
+	actionTokenRepository ports.ActionTokenRepository
+	loginThrottle         ports.LoginThrottle
+	issuer                string
+	maxFailures           int // wrong codes a login challenge takes before it is burnt
+}
+
+func NewMFAService(mfaRepository ports.MFARepository, policyRepository ports.PolicyRepository, companyRepository ports.CompanyRepository, actionTokenRepository ports.ActionTokenRepository, loginThrottle ports.LoginThrottle, issuer string, maxFailures int) *mfaService {
+	return &mfaService{
+		mfaRepository:         mfaRepository,
+		policyRepository:      policyRepository,
+		companyRepository:     companyRepository,
+		actionTokenRepository: actionTokenRepository,
+		loginThrottle:         loginThrottle,
+		issuer:                issuer,
+		maxFailures:           maxFailures,
+	}
+}
+
+// Challenge decides whether a user who passed the password check still owes
+// a second factor. It returns an MFA token when the user has MFA enabled, or
+// an enrolment token when company policy requires MFA the user has not set up.
+func (s *mfaService) Challenge(user *domain.DataReply, role string) (*domain.LoginResult, error) {
+	result := &domain.LoginResult{
+		Data: user,
+		Role: role,
+	}
+
+	mfa, err := s.mfaRepository.GetMFA(&domain.MFA{UserID: user.ID})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	purpose := ""
+	if mfa != nil && mfa.EnabledAt != nil {
+		purpose = domain.MFAPurposeLogin
+	} else {
+		required, err := s.requiredFor(user.Company, role)
+		if err != nil {
+			return nil, err
+		}
+		if required {
+			purpose = domain.MFAPurposeEnroll
+			result.MFAEnrollmentRequired = true
+		}
+	}
+
+	if purpose == "" {
+		return result, nil
+	}
+
+	// The token id is recorded so the challenge completes one login only
+	record, err := s.actionTokenRepository.CreateActionToken(&domain.ActionToken{
+		Purpose:   purpose,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(mfaTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &utils.ActionClaims{
+		Purpose: purpose,
+		UserID:  user.ID.String(),
+		Company: user.Company,
+		Branch:  user.Branch,
+	}
+	claims.Id = record.ID.String()
+
+	token, err := utils.GenerateActionToken(claims, mfaTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	result.MFAToken = token
+	return result, nil
+}
+
+// Verify completes a login started with an MFA token. For enrolment tokens a
+// valid code also activates MFA and the reply carries the recovery codes.
+// Wrong codes count against the login throttle of the account and address,
+// and the token is burnt after too many of them or once the login succeeds.
+func (s *mfaService) Verify(data *domain.MFAVerifyInput) (*domain.MFAVerifyReply, error) {
+	user, challenge, err := s.tokenUser(data.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &domain.MFAVerifyReply{
+		Data: &domain.DataReply{
+			ID:        user.ID,
+			Company:   user.Company,
+			Branch:    user.Branch,
+			Username:  user.Username,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Email:     user.Email,
+			CreatedAt: user.CreateAt,
+		},
+		Role: user.Role,
+	}
+
+	identity := &domain.MFAIdentity{
+		UserID:   user.ID,
+		Company:  user.Company,
+		Branch:   user.Branch,
+		Username: user.Username,
+		Role:     user.Role,
+	}
+
+	login := throttleLogin(identity, data.IP)
+	err = s.throttled(login, func() error {
+		var err error
+		reply.RecoveryCodes, err = s.verifyChallenge(challenge.Purpose, identity, data)
+		return err
+	})
+	if errors.Is(err, domain.ErrMFAInvalidCode) {
+		return nil, s.failChallenge(challenge)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Burnt only now, so a mistyped code can be retried with the same token
+	ok, err := s.actionTokenRepository.UseActionToken(challenge)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, domain.ErrMFAInvalidToken
+	}
+
+	if err := s.loginThrottle.Succeed(login); err != nil {
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+// verifyChallenge checks the code or recovery code given for a challenge.
+// For enrolment challenges it activates MFA and returns the recovery codes.
+func (s *mfaService) verifyChallenge(purpose string, identity *domain.MFAIdentity, data *domain.MFAVerifyInput) ([]string, error) {
+	if purpose == domain.MFAPurposeEnroll {
+		codes, err := s.confirm(identity, data.Code)
+		if err != nil {
+			return nil, err
+		}
+		return codes.Codes, nil
+	}
+
+	mfa, err := s.enabledMFA(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.RecoveryCode != "" {
+		ok, err := s.mfaRepository.UseRecoveryCode(mfa, hashRecoveryCode(data.RecoveryCode))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, domain.ErrMFAInvalidCode
+		}
+		return nil, nil
+	}
+
+	return nil, s.checkCode(mfa, data.Code)
+}
+
+// failChallenge counts a wrong code against the challenge and reports
+// ErrMFAChallengeLocked once the challenge has been burnt.
+func (s *mfaService) failChallenge(challenge *domain.ActionToken) error {
+	usable, err := s.actionTokenRepository.FailActionToken(challenge, s.maxFailures)
+	if err != nil {
+		return err
+	}
+
+	if !usable {
+		return domain.ErrMFAChallengeLocked
+	}
+
+	return domain.ErrMFAInvalidCode
+}
+
+// EnrollWithToken starts enrolment for a user whose login was held back
+// because policy requires MFA.
+func (s *mfaService) EnrollWithToken(data *domain.MFATokenInput) (*domain.MFAEnrollment, error) {
+	user, challenge, err := s.tokenUser(data.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if challenge.Purpose != domain.MFAPurposeEnroll {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+
+	return s.Enroll(&domain.MFAIdentity{
+		UserID:   user.ID,
+		Company:  user.Company,
+		Branch:   user.Branch,
+		Username: user.Username,
+		Role:     user.Role,
+	})
+}
+
+// Enroll creates a new pending secret. MFA is only switched on by Confirm,
+// so a user who abandons enrolment is not locked out.
+func (s *mfaService) Enroll(identity *domain.MFAIdentity) (*domain.MFAEnrollment, error) {
+	existing, err := s.mfaRepository.GetMFA(&domain.MFA{UserID: identity.UserID})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if existing != nil && existing.EnabledAt != nil {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.mfaRepository.SaveMFA(&domain.MFA{
+		UserID:  identity.UserID,
+		Company: identity.Company,
+		Branch:  identity.Branch,
+		Secret:  secret,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(s.issuer, identity.Username+"@"+identity.Company, secret),
+	}, nil
+}
+
+// Confirm activates a pending enrolment once the user proves the
+// authenticator produces valid codes, and returns fresh recovery codes.
+func (s *mfaService) Confirm(identity *domain.MFAIdentity, data *domain.MFACodeInput) (*domain.RecoveryCodes, error) {
+	var codes *domain.RecoveryCodes
+	err := s.throttled(throttleLogin(identity, data.IP), func() error {
+		var err error
+		codes, err = s.confirm(identity, data.Code)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *mfaService) confirm(identity *domain.MFAIdentity, code string) (*domain.RecoveryCodes, error) {
+	mfa, err := s.mfaRepository.GetMFA(&domain.MFA{UserID: identity.UserID})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrMFANotEnrolled
+		}
+		return nil, err
+	}
+
+	if mfa.EnabledAt != nil {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+
+	if err := s.checkCode(mfa, code); err != nil {
+		return nil, err
+	}
+
+	if err := s.mfaRepository.EnableMFA(mfa); err != nil {
+		return nil, err
+	}
+
+	return s.replaceRecoveryCodes(mfa)
+}
+
+func (s *mfaService) Disable(identity *domain.MFAIdentity, data *domain.MFACodeInput) error {
+	required, err := s.requiredFor(identity.Company, identity.Role)
+	if err != nil {
+		return err
+	}
+
+	if required {
+		return domain.ErrMFARequiredByPolicy
+	}
+
+	mfa, err := s.enabledMFA(identity)
+	if err != nil {
+		return err
+	}
+
+	err = s.throttled(throttleLogin(identity, data.IP), func() error {
+		return s.checkCode(mfa, data.Code)
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mfaRepository.DeleteMFA(mfa)
+}
+
+func (s *mfaService) RegenerateRecoveryCodes(identity *domain.MFAIdentity, data *domain.MFACodeInput) (*domain.RecoveryCodes, error) {
+	mfa, err := s.enabledMFA(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.throttled(throttleLogin(identity, data.IP), func() error {
+		return s.checkCode(mfa, data.Code)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.replaceRecoveryCodes(mfa)
+}
+
+// tokenUser loads the user an MFA or enrolment token was issued to and
+// returns the challenge the token stands for.
+func (s *mfaService) tokenUser(token string) (*domain.Data, *domain.ActionToken, error) {
+	purpose := domain.MFAPurposeLogin
+	claims, err := utils.ParseActionToken(token, domain.MFAPurposeLogin)
+	if err != nil {
+		purpose = domain.MFAPurposeEnroll
+		claims, err = utils.ParseActionToken(token, domain.MFAPurposeEnroll)
+		if err != nil {
+			return nil, nil, domain.ErrMFAInvalidToken
+		}
+	}
+
+	id, err := uuid.Parse(claims.Id)
+	if err != nil {
+		return nil, nil, domain.ErrMFAInvalidToken
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return nil, nil, domain.ErrMFAInvalidToken
+	}
+
+	// A used, burnt or expired challenge is refused before any code is
+	// checked, since checking one burns its time step and enrolment
+	// switches MFA on
+	challenge := &domain.ActionToken{ID: id, Purpose: purpose, UserID: userID}
+	usable, err := s.actionTokenRepository.CheckActionToken(challenge)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !usable {
+		return nil, nil, domain.ErrMFAInvalidToken
+	}
+
+	user, err := s.companyRepository.GetMe(&domain.Data{
+		Company: claims.Company,
+		Branch:  claims.Branch,
+		ID:      userID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, domain.ErrMFAInvalidToken
+		}
+		return nil, nil, err
+	}
+
+	return user, challenge, nil
+}
+
+func (s *mfaService) enabledMFA(identity *domain.MFAIdentity) (*domain.MFA, error) {
+	mfa, err := s.mfaRepository.GetMFA(&domain.MFA{UserID: identity.UserID})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrMFANotEnabled
+		}
+		return nil, err
+	}
+
+	if mfa.EnabledAt == nil {
+		return nil, domain.ErrMFANotEnabled
+	}
+
+	return mfa, nil
+}
+
+// checkCode validates a TOTP code and burns its time step.
+func (s *mfaService) checkCode(mfa *domain.MFA, code string) error {
+	step, ok := utils.ValidateTOTP(mfa.Secret, code, time.Now())
+	if !ok {
+		return domain.ErrMFAInvalidCode
+	}
+
+	mfa.LastUsedStep = step
+	fresh, err := s.mfaRepository.UseStep(mfa)
+	if err != nil {
+		return err
+	}
+
+	if !fresh {
+		return domain.ErrMFAInvalidCode
+	}
+
+	return nil
+}
+
+// throttled runs a code check behind the login throttle of the account and
+// address, so guessing codes is limited like guessing passwords.
+func (s *mfaService) throttled(login *domain.LoginInput, check func() error) error {
+	if err := s.loginThrottle.Check(login); err != nil {
+		return err
+	}
+
+	err := check()
+	if errors.Is(err, domain.ErrMFAInvalidCode) {
+		if err := s.loginThrottle.Fail(login); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (s *mfaService) replaceRecoveryCodes(mfa *domain.MFA) (*domain.RecoveryCodes, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := utils.GenerateRandomToken(6)
+		if err != nil {
+			return nil, err
+		}
+		code = strings.ToLower(code[:4] + "-" + code[4:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	if err := s.mfaRepository.ReplaceRecoveryCodes(mfa, hashes); err != nil {
+		return nil, err
+	}
+
+	return &domain.RecoveryCodes{Codes: codes}, nil
+}
+
+// requiredFor reports whether company policy forces MFA on the role. The
+// policy covers the company's own admins, not the platform's super admins.
+func (s *mfaService) requiredFor(company, role string) (bool, error) {
+	if !domain.RoleAtLeast(role, domain.RoleAdmin) || domain.RoleAtLeast(role, domain.RoleSuperAdmin) {
+		return false, nil
+	}
+
+	policy, err := loadPolicy(s.policyRepository, company)
+	if err != nil {
+		return false, err
+	}
+
+	return policy.MFARequired, nil
+}
+
+func throttleLogin(identity *domain.MFAIdentity, ip string) *domain.LoginInput {
+	return &domain.LoginInput{
+		Company:  identity.Company,
+		Branch:   identity.Branch,
+		Username: identity.Username,
+		IP:       ip,
+	}
+}
+
+func hashRecoveryCode(code string) string {
+	return utils.HashToken(strings.ToLower(strings.TrimSpace(code)))
+}
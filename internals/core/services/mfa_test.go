@@ -0,0 +1,476 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/utils"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type fakeMFARepository struct {
+	mu            sync.Mutex
+	mfa           map[uuid.UUID]*domain.MFA
+	recoveryCodes map[uuid.UUID]map[string]bool
+}
+
+func newFakeMFARepository() *fakeMFARepository {
+	return &fakeMFARepository{
+		mfa:           map[uuid.UUID]*domain.MFA{},
+		recoveryCodes: map[uuid.UUID]map[string]bool{},
+	}
+}
+
+func (r *fakeMFARepository) GetMFA(data *domain.MFA) (*domain.MFA, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	mfa, ok := r.mfa[data.UserID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	found := *mfa
+	return &found, nil
+}
+
+func (r *fakeMFARepository) SaveMFA(data *domain.MFA) (*domain.MFA, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	mfa := *data
+	r.mfa[data.UserID] = &mfa
+	return data, nil
+}
+
+func (r *fakeMFARepository) EnableMFA(data *domain.MFA) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.mfa[data.UserID].EnabledAt = &now
+	return nil
+}
+
+func (r *fakeMFARepository) DeleteMFA(data *domain.MFA) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.mfa, data.UserID)
+	return nil
+}
+
+func (r *fakeMFARepository) UseStep(data *domain.MFA) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	mfa := r.mfa[data.UserID]
+	if data.LastUsedStep <= mfa.LastUsedStep {
+		return false, nil
+	}
+	mfa.LastUsedStep = data.LastUsedStep
+	return true, nil
+}
+
+func (r *fakeMFARepository) ReplaceRecoveryCodes(data *domain.MFA, codeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	codes := map[string]bool{}
+	for _, hash := range codeHashes {
+		codes[hash] = false
+	}
+	r.recoveryCodes[data.UserID] = codes
+	return nil
+}
+
+func (r *fakeMFARepository) UseRecoveryCode(data *domain.MFA, codeHash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	used, ok := r.recoveryCodes[data.UserID][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	r.recoveryCodes[data.UserID][codeHash] = true
+	return true, nil
+}
+
+// totpNow computes the current RFC 6238 code the way an authenticator app does.
+func totpNow(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(time.Now().Unix()/30+offset))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	index := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[index:index+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// wrongCode returns a six digit code that is not valid right now.
+func wrongCode(t *testing.T, secret string) string {
+	t.Helper()
+
+	valid := map[string]bool{}
+	for offset := int64(-1); offset <= 1; offset++ {
+		valid[totpNow(t, secret, offset)] = true
+	}
+	for i := 0; ; i++ {
+		code := fmt.Sprintf("%06d", i)
+		if !valid[code] {
+			return code
+		}
+	}
+}
+
+type mfaFixture struct {
+	service  *mfaService
+	mfa      *fakeMFARepository
+	tokens   *fakeActionTokenRepository
+	throttle *countingThrottle
+	user     *domain.Data
+	secret   string
+}
+
+// newMFAFixture returns a service for a user who has MFA enabled.
+func newMFAFixture(t *testing.T, maxFailures int) *mfaFixture {
+	t.Helper()
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &mfaFixture{
+		mfa:      newFakeMFARepository(),
+		tokens:   newFakeActionTokenRepository(),
+		throttle: &countingThrottle{},
+		user:     newUser("acme", "hq", "alice", domain.RoleUser),
+		secret:   secret,
+	}
+	f.service = NewMFAService(f.mfa, nil, newFakeCompanyRepository(f.user), f.tokens, f.throttle, "OneSystem", maxFailures)
+
+	now := time.Now()
+	f.mfa.mfa[f.user.ID] = &domain.MFA{UserID: f.user.ID, Company: "acme", Branch: "hq", Secret: secret, EnabledAt: &now}
+	return f
+}
+
+func (f *mfaFixture) challenge(t *testing.T) string {
+	t.Helper()
+
+	result, err := f.service.Challenge(&domain.DataReply{ID: f.user.ID, Company: f.user.Company, Branch: f.user.Branch, Username: f.user.Username}, f.user.Role)
+	if err != nil {
+		t.Fatalf("Challenge: %v", err)
+	}
+	if result.MFAToken == "" {
+		t.Fatal("no MFA token for a user with MFA enabled")
+	}
+	return result.MFAToken
+}
+
+func (f *mfaFixture) verify(token, code string) (*domain.MFAVerifyReply, error) {
+	return f.service.Verify(&domain.MFAVerifyInput{MFAToken: token, Code: code, IP: "203.0.113.7"})
+}
+
+func TestMFAVerify(t *testing.T) {
+	f := newMFAFixture(t, 5)
+
+	reply, err := f.verify(f.challenge(t), totpNow(t, f.secret, 0))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if reply.Data.ID != f.user.ID || reply.Role != f.user.Role {
+		t.Errorf("reply = %+v, want the challenged user", reply)
+	}
+	if f.throttle.successes != 1 || f.throttle.failures != 0 {
+		t.Errorf("throttle saw %d successes, %d failures", f.throttle.successes, f.throttle.failures)
+	}
+}
+
+func TestMFATokenIsSingleUse(t *testing.T) {
+	f := newMFAFixture(t, 5)
+	codes, err := f.service.replaceRecoveryCodes(f.mfa.mfa[f.user.ID])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := f.challenge(t)
+	if _, err := f.verify(token, totpNow(t, f.secret, 0)); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// A second, equally valid factor must not turn the same token into another session
+	_, err = f.service.Verify(&domain.MFAVerifyInput{MFAToken: token, RecoveryCode: codes.Codes[0]})
+	if !errors.Is(err, domain.ErrMFAInvalidToken) {
+		t.Fatalf("replayed token: err = %v, want ErrMFAInvalidToken", err)
+	}
+
+	// A fresh challenge still works
+	if _, err := f.service.Verify(&domain.MFAVerifyInput{MFAToken: f.challenge(t), RecoveryCode: codes.Codes[1]}); err != nil {
+		t.Errorf("new challenge: %v", err)
+	}
+}
+
+func TestMFAChallengeLocksAfterFailures(t *testing.T) {
+	f := newMFAFixture(t, 3)
+	token := f.challenge(t)
+	wrong := wrongCode(t, f.secret)
+
+	for i := 1; i <= 3; i++ {
+		_, err := f.verify(token, wrong)
+		want := domain.ErrMFAInvalidCode
+		if i == 3 {
+			want = domain.ErrMFAChallengeLocked
+		}
+		if !errors.Is(err, want) {
+			t.Fatalf("attempt %d: err = %v, want %v", i, err, want)
+		}
+	}
+
+	// The right code comes too late, the user has to log in again
+	if _, err := f.verify(token, totpNow(t, f.secret, 0)); !errors.Is(err, domain.ErrMFAInvalidToken) {
+		t.Errorf("locked challenge: err = %v, want ErrMFAInvalidToken", err)
+	}
+}
+
+func TestMFAFailuresCountAgainstLoginThrottle(t *testing.T) {
+	f := newMFAFixture(t, 100)
+	f.throttle.lockAfter = 2
+	wrong := wrongCode(t, f.secret)
+
+	for i := 0; i < 2; i++ {
+		if _, err := f.verify(f.challenge(t), wrong); !errors.Is(err, domain.ErrMFAInvalidCode) {
+			t.Fatalf("err = %v, want ErrMFAInvalidCode", err)
+		}
+	}
+
+	for _, login := range f.throttle.failed {
+		if login.Company != "acme" || login.Branch != "hq" || login.Username != "alice" || login.IP != "203.0.113.7" {
+			t.Errorf("failure recorded for %+v, want the account and client address", login)
+		}
+	}
+
+	// Fresh challenges do not reset the count, and the code is not even checked
+	var lockout *domain.LockoutError
+	if _, err := f.verify(f.challenge(t), totpNow(t, f.secret, 0)); !errors.As(err, &lockout) {
+		t.Errorf("err = %v, want a LockoutError", err)
+	}
+}
+
+func TestMFAVerifyRefusesTokens(t *testing.T) {
+	f := newMFAFixture(t, 5)
+
+	// Signed correctly, but issued without a recorded challenge
+	withoutID, err := utils.GenerateActionToken(&utils.ActionClaims{
+		Purpose: domain.MFAPurposeLogin,
+		UserID:  f.user.ID.String(),
+		Company: f.user.Company,
+		Branch:  f.user.Branch,
+	}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrongPurpose, err := utils.GenerateActionToken(&utils.ActionClaims{
+		Purpose: domain.PurposePasswordReset,
+		UserID:  f.user.ID.String(),
+		Company: f.user.Company,
+		Branch:  f.user.Branch,
+	}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"empty":         "",
+		"garbage":       "not-a-token",
+		"without id":    withoutID,
+		"wrong purpose": wrongPurpose,
+	}
+
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := f.verify(token, totpNow(t, f.secret, 0)); !errors.Is(err, domain.ErrMFAInvalidToken) {
+				t.Errorf("err = %v, want ErrMFAInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestMFACodeCannotBeReplayed(t *testing.T) {
+	f := newMFAFixture(t, 5)
+	code := totpNow(t, f.secret, 0)
+
+	if _, err := f.verify(f.challenge(t), code); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if _, err := f.verify(f.challenge(t), code); !errors.Is(err, domain.ErrMFAInvalidCode) {
+		t.Errorf("replayed code: err = %v, want ErrMFAInvalidCode", err)
+	}
+}
+
+func TestMFARecoveryCodeWorksOnce(t *testing.T) {
+	f := newMFAFixture(t, 5)
+	codes, err := f.service.replaceRecoveryCodes(f.mfa.mfa[f.user.ID])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := &domain.MFAVerifyInput{MFAToken: f.challenge(t), RecoveryCode: " " + strings.ToUpper(codes.Codes[0]) + " "}
+	if _, err := f.service.Verify(input); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	input.MFAToken = f.challenge(t)
+	if _, err := f.service.Verify(input); !errors.Is(err, domain.ErrMFAInvalidCode) {
+		t.Errorf("used recovery code: err = %v, want ErrMFAInvalidCode", err)
+	}
+}
+
+func TestMFAEnrollmentRequiredByPolicy(t *testing.T) {
+	admin := newUser("acme", "hq", "bob", "admin")
+	mfa := newFakeMFARepository()
+	s := NewMFAService(mfa, newFakePolicyRepository(&domain.SecurityPolicy{Company: "acme", MFARequired: true}), newFakeCompanyRepository(admin), newFakeActionTokenRepository(), &countingThrottle{}, "OneSystem", 5)
+
+	result, err := s.Challenge(&domain.DataReply{ID: admin.ID, Company: "acme", Branch: "hq", Username: "bob"}, admin.Role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.MFAEnrollmentRequired || result.MFAToken == "" {
+		t.Fatalf("Challenge = %+v, want an enrolment token", result)
+	}
+
+	enrollment, err := s.EnrollWithToken(&domain.MFATokenInput{MFAToken: result.MFAToken})
+	if err != nil {
+		t.Fatalf("EnrollWithToken: %v", err)
+	}
+	if mfa.mfa[admin.ID].EnabledAt != nil {
+		t.Fatal("MFA switched on before the first code")
+	}
+
+	reply, err := s.Verify(&domain.MFAVerifyInput{MFAToken: result.MFAToken, Code: totpNow(t, enrollment.Secret, 0)})
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if mfa.mfa[admin.ID].EnabledAt == nil || len(reply.RecoveryCodes) != recoveryCodeCount {
+		t.Errorf("enabled = %v with %d recovery codes", mfa.mfa[admin.ID].EnabledAt != nil, len(reply.RecoveryCodes))
+	}
+
+	// Users below admin are not held to the policy
+	user := newUser("acme", "hq", "carol", "user")
+	result, err = s.Challenge(&domain.DataReply{ID: user.ID, Company: "acme", Branch: "hq", Username: "carol"}, user.Role)
+	if err != nil || result.MFAToken != "" {
+		t.Errorf("Challenge for a user = %+v, %v, want no second factor", result, err)
+	}
+
+	if err := s.Disable(&domain.MFAIdentity{UserID: admin.ID, Company: "acme", Branch: "hq", Role: admin.Role}, &domain.MFACodeInput{Code: totpNow(t, enrollment.Secret, 1)}); !errors.Is(err, domain.ErrMFARequiredByPolicy) {
+		t.Errorf("Disable = %v, want ErrMFARequiredByPolicy", err)
+	}
+}
+
+func TestMFADisable(t *testing.T) {
+	f := newMFAFixture(t, 5)
+	identity := &domain.MFAIdentity{UserID: f.user.ID, Company: "acme", Branch: "hq", Username: "alice", Role: "user"}
+
+	if err := f.service.Disable(identity, &domain.MFACodeInput{Code: wrongCode(t, f.secret)}); !errors.Is(err, domain.ErrMFAInvalidCode) {
+		t.Fatalf("err = %v, want ErrMFAInvalidCode", err)
+	}
+
+	if err := f.service.Disable(identity, &domain.MFACodeInput{Code: totpNow(t, f.secret, 0)}); err != nil {
+		t.Fatalf("Disable: %v", err)
+	}
+	if _, ok := f.mfa.mfa[f.user.ID]; ok {
+		t.Error("MFA is still enabled")
+	}
+}
+
+func TestMFADisableIsThrottled(t *testing.T) {
+	f := newMFAFixture(t, 5)
+	identity := &domain.MFAIdentity{UserID: f.user.ID, Company: "acme", Branch: "hq", Username: "alice", Role: domain.RoleUser}
+
+	err := f.service.Disable(identity, &domain.MFACodeInput{Code: wrongCode(t, f.secret), IP: "203.0.113.7"})
+	if !errors.Is(err, domain.ErrMFAInvalidCode) {
+		t.Fatalf("err = %v, want ErrMFAInvalidCode", err)
+	}
+	if f.throttle.failures != 1 {
+		t.Errorf("throttle saw %d failures, want 1", f.throttle.failures)
+	}
+
+	if err := f.service.Disable(identity, &domain.MFACodeInput{Code: totpNow(t, f.secret, 0)}); err != nil {
+		t.Fatalf("Disable: %v", err)
+	}
+	if _, ok := f.mfa.mfa[f.user.ID]; ok {
+		t.Error("MFA is still enabled")
+	}
+}
+
+func TestMFALockedChallengeDoesNotCheckCode(t *testing.T) {
+	f := newMFAFixture(t, 1)
+	token := f.challenge(t)
+
+	if _, err := f.verify(token, wrongCode(t, f.secret)); !errors.Is(err, domain.ErrMFAChallengeLocked) {
+		t.Fatalf("err = %v, want ErrMFAChallengeLocked", err)
+	}
+
+	// The burnt challenge is refused before the code, so the current time
+	// step stays usable for the next login
+	code := totpNow(t, f.secret, 0)
+	if _, err := f.verify(token, code); !errors.Is(err, domain.ErrMFAInvalidToken) {
+		t.Fatalf("locked challenge: err = %v, want ErrMFAInvalidToken", err)
+	}
+	if f.mfa.mfa[f.user.ID].LastUsedStep != 0 {
+		t.Error("the code of a locked challenge burnt its time step")
+	}
+	if _, err := f.verify(f.challenge(t), code); err != nil {
+		t.Errorf("new challenge: %v", err)
+	}
+}
+
+func TestMFAUsedEnrollmentTokenDoesNotEnable(t *testing.T) {
+	f := newMFAFixture(t, 5)
+	f.mfa.mfa[f.user.ID].EnabledAt = nil
+
+	record, err := f.tokens.CreateActionToken(&domain.ActionToken{Purpose: domain.MFAPurposeEnroll, UserID: f.user.ID, ExpiresAt: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := f.tokens.UseActionToken(record); !ok {
+		t.Fatal("could not use the enrolment token")
+	}
+
+	claims := &utils.ActionClaims{
+		Purpose: domain.MFAPurposeEnroll,
+		UserID:  f.user.ID.String(),
+		Company: f.user.Company,
+		Branch:  f.user.Branch,
+	}
+	claims.Id = record.ID.String()
+	token, err := utils.GenerateActionToken(claims, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.verify(token, totpNow(t, f.secret, 0)); !errors.Is(err, domain.ErrMFAInvalidToken) {
+		t.Fatalf("used enrolment token: err = %v, want ErrMFAInvalidToken", err)
+	}
+	if f.mfa.mfa[f.user.ID].EnabledAt != nil {
+		t.Error("a used enrolment token switched MFA on")
+	}
+}
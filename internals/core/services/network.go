@@ -0,0 +1,267 @@
+package services
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+type networkPolicyService struct {
+	networkRepository ports.NetworkRepository
+	cacheTTL          time.Duration
+	superAdminBypass  bool
+
+	mu    sync.Mutex
+	cache map[string]*networkCacheEntry
+}
+
+// networkCacheEntry holds the parsed policies of one company, keyed by branch.
+type networkCacheEntry struct {
+	rules    map[string]*networkRule
+	loadedAt time.Time
+}
+
+type networkRule struct {
+	nets     []*net.IPNet
+	window   bool
+	start    int // minutes after midnight
+	end      int
+	location *time.Location
+}
+
+// NewNetworkPolicyService checks authentications against the network
+// policies. JWTAuth calls Check on every request, so policies are cached for
+// cacheTTL; changes made through this service apply at once on this instance.
+func NewNetworkPolicyService(networkRepository ports.NetworkRepository, cacheTTL time.Duration, superAdminBypass bool) *networkPolicyService {
+	return &networkPolicyService{
+		networkRepository: networkRepository,
+		cacheTTL:          cacheTTL,
+		superAdminBypass:  superAdminBypass,
+		cache:             map[string]*networkCacheEntry{},
+	}
+}
+
+func (s *networkPolicyService) Check(data *domain.NetworkCheck) error {
+	if s.superAdminBypass && domain.RoleAtLeast(data.Role, domain.RoleSuperAdmin) {
+		return nil
+	}
+
+	rules, err := s.rules(data.Company)
+	if err != nil {
+		return err
+	}
+
+	companyRule := rules[""]
+	branchRule := rules[data.Branch]
+	if data.Branch == "" {
+		branchRule = nil
+	}
+
+	ip := net.ParseIP(data.IP)
+	for _, rule := range []*networkRule{companyRule, branchRule} {
+		if rule == nil {
+			continue
+		}
+
+		if len(rule.nets) > 0 && !containsIP(rule.nets, ip) {
+			return domain.ErrNetworkNotAllowed
+		}
+
+		if rule.window {
+			location := time.UTC
+			switch {
+			case rule.location != nil:
+				location = rule.location
+			case companyRule != nil && companyRule.location != nil:
+				location = companyRule.location
+			}
+
+			if !inWindow(time.Now().In(location), rule.start, rule.end) {
+				return domain.ErrOutsideLoginHours
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *networkPolicyService) GetPolicies(data *domain.CompanyRequest) ([]domain.NetworkPolicy, error) {
+	return s.networkRepository.GetNetworkPolicies(&domain.NetworkPolicy{Company: strings.ToLower(data.Company)})
+}
+
+// SavePolicy validates and stores a policy. Single addresses are accepted
+// and stored as /32 or /128 networks.
+func (s *networkPolicyService) SavePolicy(data *domain.NetworkPolicy) (*domain.NetworkPolicy, error) {
+	if data.Company == "" {
+		return nil, domain.ErrInvalidNetworkPolicy
+	}
+	data.Company = strings.ToLower(data.Company)
+	data.Branch = strings.ToLower(data.Branch)
+
+	cidrs := []string{}
+	for _, cidr := range data.AllowedCIDRs {
+		ipNet, err := parseNetwork(cidr)
+		if err != nil {
+			return nil, domain.ErrInvalidNetworkPolicy
+		}
+		cidrs = append(cidrs, ipNet.String())
+	}
+	data.AllowedCIDRs = cidrs
+
+	if (data.WindowStart == "") != (data.WindowEnd == "") {
+		return nil, domain.ErrInvalidNetworkPolicy
+	}
+	if data.WindowStart != "" {
+		if _, ok := parseClock(data.WindowStart); !ok {
+			return nil, domain.ErrInvalidNetworkPolicy
+		}
+		if _, ok := parseClock(data.WindowEnd); !ok {
+			return nil, domain.ErrInvalidNetworkPolicy
+		}
+	}
+
+	if data.Timezone != "" {
+		if _, err := time.LoadLocation(data.Timezone); err != nil {
+			return nil, domain.ErrInvalidNetworkPolicy
+		}
+	}
+
+	res, err := s.networkRepository.SaveNetworkPolicy(data)
+	if err != nil {
+		return nil, err
+	}
+
+	s.forget(data.Company)
+	return res, nil
+}
+
+func (s *networkPolicyService) DeletePolicy(data *domain.NetworkPolicy) error {
+	data.Company = strings.ToLower(data.Company)
+	data.Branch = strings.ToLower(data.Branch)
+
+	ok, err := s.networkRepository.DeleteNetworkPolicy(data)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return domain.ErrNetworkPolicyNotFound
+	}
+
+	s.forget(data.Company)
+	return nil
+}
+
+// rules returns the parsed policies of the company from the cache, loading
+// them when missing or stale.
+func (s *networkPolicyService) rules(company string) (map[string]*networkRule, error) {
+	s.mu.Lock()
+	entry, ok := s.cache[company]
+	s.mu.Unlock()
+
+	if ok && time.Since(entry.loadedAt) < s.cacheTTL {
+		return entry.rules, nil
+	}
+
+	policies, err := s.networkRepository.GetNetworkPolicies(&domain.NetworkPolicy{Company: company})
+	if err != nil {
+		return nil, err
+	}
+
+	rules := map[string]*networkRule{}
+	for _, policy := range policies {
+		rules[policy.Branch] = compileNetworkPolicy(&policy)
+	}
+
+	s.mu.Lock()
+	s.cache[company] = &networkCacheEntry{rules: rules, loadedAt: time.Now()}
+	s.mu.Unlock()
+
+	return rules, nil
+}
+
+func (s *networkPolicyService) forget(company string) {
+	s.mu.Lock()
+	delete(s.cache, company)
+	s.mu.Unlock()
+}
+
+// compileNetworkPolicy parses a stored policy. Entries that no longer parse
+// are skipped rather than locking the company out.
+func compileNetworkPolicy(policy *domain.NetworkPolicy) *networkRule {
+	rule := &networkRule{}
+
+	for _, cidr := range policy.AllowedCIDRs {
+		if ipNet, err := parseNetwork(cidr); err == nil {
+			rule.nets = append(rule.nets, ipNet)
+		}
+	}
+
+	start, startOK := parseClock(policy.WindowStart)
+	end, endOK := parseClock(policy.WindowEnd)
+	if startOK && endOK {
+		rule.window = true
+		rule.start = start
+		rule.end = end
+	}
+
+	if policy.Timezone != "" {
+		if location, err := time.LoadLocation(policy.Timezone); err == nil {
+			rule.location = location
+		}
+	}
+
+	return rule
+}
+
+func parseNetwork(cidr string) (*net.IPNet, error) {
+	cidr = strings.TrimSpace(cidr)
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return nil, domain.ErrInvalidNetworkPolicy
+		}
+		if ip.To4() != nil {
+			cidr += "/32"
+		} else {
+			cidr += "/128"
+		}
+	}
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	return ipNet, err
+}
+
+// parseClock reads "HH:MM" as minutes after midnight.
+func parseClock(value string) (int, bool) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// inWindow reports whether t falls in [start, end), wrapping past midnight
+// when end is before start.
+func inWindow(t time.Time, start, end int) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeNetworkRepository keeps network policies keyed by "company/branch".
+type fakeNetworkRepository struct {
+	policies map[string]domain.NetworkPolicy
+	loads    int
+}
+
+func newFakeNetworkRepository(policies ...domain.NetworkPolicy) *fakeNetworkRepository {
+	r := &fakeNetworkRepository{policies: map[string]domain.NetworkPolicy{}}
+	for _, policy := range policies {
+		r.policies[policy.Company+"/"+policy.Branch] = policy
+	}
+	return r
+}
+
+func (r *fakeNetworkRepository) GetNetworkPolicies(data *domain.NetworkPolicy) ([]domain.NetworkPolicy, error) {
+	r.loads++
+	policies := []domain.NetworkPolicy{}
+	for _, policy := range r.policies {
+		if policy.Company == data.Company {
+			policies = append(policies, policy)
+		}
+	}
+	return policies, nil
+}
+
+func (r *fakeNetworkRepository) SaveNetworkPolicy(data *domain.NetworkPolicy) (*domain.NetworkPolicy, error) {
+	r.policies[data.Company+"/"+data.Branch] = *data
+	return data, nil
+}
+
+func (r *fakeNetworkRepository) DeleteNetworkPolicy(data *domain.NetworkPolicy) (bool, error) {
+	key := data.Company + "/" + data.Branch
+	_, ok := r.policies[key]
+	delete(r.policies, key)
+	return ok, nil
+}
+
+// closedWindow returns a login window that ends a minute before now.
+func closedWindow() (string, string) {
+	now := time.Now().UTC()
+	return now.Add(time.Hour).Format("15:04"), now.Add(-time.Minute).Format("15:04")
+}
+
+func TestNetworkPolicyCheck(t *testing.T) {
+	start, end := closedWindow()
+	repo := newFakeNetworkRepository(
+		domain.NetworkPolicy{Company: "acme", AllowedCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"}},
+		domain.NetworkPolicy{Company: "acme", Branch: "east", AllowedCIDRs: []string{"10.1.0.0/16"}},
+		domain.NetworkPolicy{Company: "acme", Branch: "night", WindowStart: start, WindowEnd: end},
+	)
+	s := NewNetworkPolicyService(repo, time.Hour, true)
+
+	tests := []struct {
+		branch, role, ip string
+		want             error
+	}{
+		{branch: "hq", role: domain.RoleUser, ip: "10.2.3.4"},
+		{branch: "hq", role: domain.RoleUser, ip: "2001:db8::1"},
+		{branch: "hq", role: domain.RoleUser, ip: "192.0.2.1", want: domain.ErrNetworkNotAllowed},
+		{branch: "hq", role: domain.RoleUser, ip: "not an address", want: domain.ErrNetworkNotAllowed},
+		// Branch users have to pass both policies
+		{branch: "east", role: domain.RoleUser, ip: "10.1.2.3"},
+		{branch: "east", role: domain.RoleUser, ip: "10.2.3.4", want: domain.ErrNetworkNotAllowed},
+		{branch: "night", role: domain.RoleAdmin, ip: "10.2.3.4", want: domain.ErrOutsideLoginHours},
+		{branch: "east", role: domain.RoleSuperAdmin, ip: "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		check := &domain.NetworkCheck{Company: "acme", Branch: tt.branch, Role: tt.role, IP: tt.ip}
+		if err := s.Check(check); !errors.Is(err, tt.want) {
+			t.Errorf("Check(%s, %s, %s) = %v, want %v", tt.branch, tt.role, tt.ip, err, tt.want)
+		}
+	}
+
+	// Without the bypass super admins follow the policies too
+	s = NewNetworkPolicyService(repo, time.Hour, false)
+	if err := s.Check(&domain.NetworkCheck{Company: "acme", Branch: "hq", Role: domain.RoleSuperAdmin, IP: "192.0.2.1"}); !errors.Is(err, domain.ErrNetworkNotAllowed) {
+		t.Errorf("super admin without bypass = %v, want %v", err, domain.ErrNetworkNotAllowed)
+	}
+
+	// Companies without policies are open
+	if err := s.Check(&domain.NetworkCheck{Company: "globex", Branch: "hq", Role: domain.RoleUser, IP: "192.0.2.1"}); err != nil {
+		t.Errorf("company without policies = %v", err)
+	}
+}
+
+func TestNetworkPolicyCache(t *testing.T) {
+	repo := newFakeNetworkRepository()
+	s := NewNetworkPolicyService(repo, time.Hour, false)
+	check := &domain.NetworkCheck{Company: "acme", Branch: "hq", Role: domain.RoleUser, IP: "192.0.2.1"}
+
+	for i := 0; i < 3; i++ {
+		if err := s.Check(check); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if repo.loads != 1 {
+		t.Fatalf("loaded %d times for three checks, want 1", repo.loads)
+	}
+
+	// Saved through the service, so it applies to the next check
+	if _, err := s.SavePolicy(&domain.NetworkPolicy{Company: "ACME", AllowedCIDRs: []string{"10.0.0.1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Check(check); !errors.Is(err, domain.ErrNetworkNotAllowed) {
+		t.Errorf("Check after SavePolicy = %v, want %v", err, domain.ErrNetworkNotAllowed)
+	}
+
+	if err := s.DeletePolicy(&domain.NetworkPolicy{Company: "acme"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Check(check); err != nil {
+		t.Errorf("Check after DeletePolicy = %v", err)
+	}
+	if err := s.DeletePolicy(&domain.NetworkPolicy{Company: "acme"}); !errors.Is(err, domain.ErrNetworkPolicyNotFound) {
+		t.Errorf("second DeletePolicy = %v, want %v", err, domain.ErrNetworkPolicyNotFound)
+	}
+}
+
+func TestSaveNetworkPolicy(t *testing.T) {
+	s := NewNetworkPolicyService(newFakeNetworkRepository(), time.Hour, false)
+
+	saved, err := s.SavePolicy(&domain.NetworkPolicy{Company: "acme", Branch: "HQ", AllowedCIDRs: []string{" 10.0.0.1 ", "2001:db8::1", "10.1.2.3/16"}, WindowStart: "22:00", WindowEnd: "06:00", Timezone: "Europe/Berlin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10.0.0.1/32", "2001:db8::1/128", "10.1.0.0/16"}; !reflect.DeepEqual(saved.AllowedCIDRs, want) || saved.Branch != "hq" {
+		t.Errorf("saved %s %v, want hq %v", saved.Branch, saved.AllowedCIDRs, want)
+	}
+
+	invalid := []*domain.NetworkPolicy{
+		{AllowedCIDRs: []string{"10.0.0.0/8"}},
+		{Company: "acme", AllowedCIDRs: []string{"10.0.0.0/33"}},
+		{Company: "acme", AllowedCIDRs: []string{"intranet"}},
+		{Company: "acme", WindowStart: "09:00"},
+		{Company: "acme", WindowStart: "9am", WindowEnd: "17:00"},
+		{Company: "acme", Timezone: "Mars/Olympus_Mons"},
+	}
+	for _, policy := range invalid {
+		if _, err := s.SavePolicy(policy); !errors.Is(err, domain.ErrInvalidNetworkPolicy) {
+			t.Errorf("SavePolicy(%+v) = %v, want %v", policy, err, domain.ErrInvalidNetworkPolicy)
+		}
+	}
+}
+
+func TestInWindow(t *testing.T) {
+	at := func(clock string) time.Time {
+		t, _ := time.Parse("15:04", clock)
+		return t
+	}
+	nineToFive, overnight := [2]int{9 * 60, 17 * 60}, [2]int{22 * 60, 6 * 60}
+
+	tests := []struct {
+		clock  string
+		window [2]int
+		want   bool
+	}{
+		{clock: "09:00", window: nineToFive, want: true},
+		{clock: "16:59", window: nineToFive, want: true},
+		{clock: "17:00", window: nineToFive},
+		{clock: "23:30", window: overnight, want: true},
+		{clock: "05:59", window: overnight, want: true},
+		{clock: "12:00", window: overnight},
+	}
+	for _, tt := range tests {
+		if got := inWindow(at(tt.clock), tt.window[0], tt.window[1]); got != tt.want {
+			t.Errorf("inWindow(%s, %v) = %v, want %v", tt.clock, tt.window, got, tt.want)
+		}
+	}
+}
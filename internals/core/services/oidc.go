@@ -0,0 +1,335 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"go-multi-tenancy/internals/utils"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const authorizationCodeTTL = 60 // seconds
+
+type oidcService struct {
+	oidcRepository    ports.OIDCRepository
+	companyRepository ports.CompanyRepository
+	tokenService      ports.TokenService
+	issuer            string
+	idTokenTTL        time.Duration
+}
+
+func NewOIDCService(oidcRepository ports.OIDCRepository, companyRepository ports.CompanyRepository, tokenService ports.TokenService, issuer string, idTokenTTL time.Duration) *oidcService {
+	return &oidcService{
+		oidcRepository:    oidcRepository,
+		companyRepository: companyRepository,
+		tokenService:      tokenService,
+		issuer:            issuer,
+		idTokenTTL:        idTokenTTL,
+	}
+}
+
+// CheckAuthorize validates an authorization request before the user is sent
+// to log in. PKCE with S256 is required from every client.
+func (s *oidcService) CheckAuthorize(data *domain.AuthorizeRequest) (*domain.OAuthClient, error) {
+	client, err := s.oidcRepository.GetClient(&domain.OAuthClient{ClientID: data.ClientID})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &domain.OAuthError{Code: "invalid_client", Description: "unknown client"}
+		}
+		return nil, err
+	}
+
+	if !containsString(client.RedirectURIs, data.RedirectURI) {
+		return nil, &domain.OAuthError{Code: "invalid_request", Description: "redirect_uri is not registered for this client"}
+	}
+
+	if data.ResponseType != "code" {
+		return nil, &domain.OAuthError{Code: "unsupported_response_type"}
+	}
+
+	if !containsString(strings.Fields(data.Scope), domain.OAuthScopeOpenID) {
+		return nil, &domain.OAuthError{Code: "invalid_scope", Description: "the openid scope is required"}
+	}
+
+	if data.CodeChallenge == "" || data.CodeChallengeMethod != domain.PKCEMethodS256 {
+		return nil, &domain.OAuthError{Code: "invalid_request", Description: "PKCE with code_challenge_method S256 is required"}
+	}
+
+	return client, nil
+}
+
+// Authorize issues an authorization code to a logged in user and returns the
+// client redirect that carries it.
+func (s *oidcService) Authorize(principal *domain.Principal, data *domain.AuthorizeRequest) (*domain.AuthorizeReply, error) {
+	if _, err := s.CheckAuthorize(data); err != nil {
+		return nil, err
+	}
+
+	code, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.oidcRepository.CreateCode(&domain.AuthorizationCode{
+		CodeHash:      utils.HashToken(code),
+		ClientID:      data.ClientID,
+		UserID:        principal.UserID,
+		Company:       principal.Company,
+		Branch:        principal.Branch,
+		RedirectURI:   data.RedirectURI,
+		Scope:         data.Scope,
+		Nonce:         data.Nonce,
+		CodeChallenge: data.CodeChallenge,
+	}, authorizationCodeTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	redirect, err := url.Parse(data.RedirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	query := redirect.Query()
+	query.Set("code", code)
+	if data.State != "" {
+		query.Set("state", data.State)
+	}
+	redirect.RawQuery = query.Encode()
+
+	return &domain.AuthorizeReply{RedirectURI: redirect.String()}, nil
+}
+
+// Token implements the token endpoint for the authorization_code and
+// refresh_token grants.
+func (s *oidcService) Token(data *domain.OAuthTokenRequest) (*domain.OAuthTokenReply, error) {
+	client, err := s.authenticateClient(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch data.GrantType {
+	case domain.OAuthGrantAuthorizationCode:
+		return s.exchangeCode(client, data)
+	case domain.OAuthGrantRefreshToken:
+		pair, err := s.tokenService.Refresh(&domain.RefreshInput{
+			RefreshToken: data.RefreshToken,
+			Device:       *clientDevice(client, data),
+		})
+		if err != nil {
+			if errors.Is(err, domain.ErrInvalidRefreshToken) || errors.Is(err, domain.ErrRefreshTokenReused) || errors.Is(err, domain.ErrSessionRevoked) || errors.Is(err, domain.ErrTenantSuspended) {
+				return nil, &domain.OAuthError{Code: "invalid_grant", Description: err.Error()}
+			}
+			return nil, err
+		}
+		return tokenReply(pair, "", ""), nil
+	}
+
+	return nil, &domain.OAuthError{Code: "unsupported_grant_type"}
+}
+
+func (s *oidcService) UserInfo(principal *domain.Principal) (*domain.UserInfo, error) {
+	user, err := s.companyRepository.GetMe(&domain.Data{
+		Company: principal.Company,
+		Branch:  principal.Branch,
+		ID:      principal.UserID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.UserInfo{
+		Subject:           user.ID.String(),
+		PreferredUsername: user.Username,
+		GivenName:         user.FirstName,
+		FamilyName:        user.LastName,
+		Email:             user.Email,
+		EmailVerified:     user.EmailVerifiedAt != nil,
+		Company:           user.Company,
+		Branch:            user.Branch,
+		Role:              user.Role,
+	}, nil
+}
+
+func (s *oidcService) ListClients() ([]domain.OAuthClient, error) {
+	return s.oidcRepository.GetClients()
+}
+
+// CreateClient registers an application. Confidential clients get a secret
+// that is returned once and stored hashed.
+func (s *oidcService) CreateClient(data *domain.OAuthClientInput) (*domain.OAuthClientCreated, error) {
+	if strings.TrimSpace(data.Name) == "" {
+		return nil, errors.New("client name cannot be empty")
+	}
+
+	if len(data.RedirectURIs) == 0 {
+		return nil, errors.New("at least one redirect_uri is required")
+	}
+
+	for _, uri := range data.RedirectURIs {
+		parsed, err := url.Parse(uri)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			return nil, errors.New("redirect_uris must be absolute URLs without a fragment")
+		}
+	}
+
+	clientID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &domain.OAuthClient{
+		ClientID:     clientID,
+		Name:         strings.TrimSpace(data.Name),
+		RedirectURIs: data.RedirectURIs,
+		Public:       data.Public,
+	}
+
+	secret := ""
+	if !data.Public {
+		secret, err = utils.GenerateRandomToken(32)
+		if err != nil {
+			return nil, err
+		}
+		client.SecretHash = utils.HashToken(secret)
+	}
+
+	res, err := s.oidcRepository.CreateClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.OAuthClientCreated{OAuthClient: res, ClientSecret: secret}, nil
+}
+
+func (s *oidcService) DeleteClient(data *domain.OAuthClient) error {
+	ok, err := s.oidcRepository.DeleteClient(data)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return &domain.OAuthError{Code: "invalid_client", Description: "unknown client"}
+	}
+
+	return nil
+}
+
+func (s *oidcService) authenticateClient(data *domain.OAuthTokenRequest) (*domain.OAuthClient, error) {
+	client, err := s.oidcRepository.GetClient(&domain.OAuthClient{ClientID: data.ClientID})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &domain.OAuthError{Code: "invalid_client"}
+		}
+		return nil, err
+	}
+
+	if !client.Public && subtle.ConstantTimeCompare([]byte(utils.HashToken(data.ClientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, &domain.OAuthError{Code: "invalid_client"}
+	}
+
+	return client, nil
+}
+
+func (s *oidcService) exchangeCode(client *domain.OAuthClient, data *domain.OAuthTokenRequest) (*domain.OAuthTokenReply, error) {
+	invalidGrant := &domain.OAuthError{Code: "invalid_grant"}
+
+	code, err := s.oidcRepository.UseCode(&domain.AuthorizationCode{CodeHash: utils.HashToken(data.Code)})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, invalidGrant
+		}
+		return nil, err
+	}
+
+	if code.ClientID != client.ClientID || code.RedirectURI != data.RedirectURI {
+		return nil, invalidGrant
+	}
+
+	// RFC 7636: BASE64URL(SHA256(code_verifier)) must equal the challenge
+	sum := sha256.Sum256([]byte(data.CodeVerifier))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(code.CodeChallenge)) != 1 {
+		return nil, invalidGrant
+	}
+
+	user, err := s.companyRepository.GetMe(&domain.Data{
+		Company: code.Company,
+		Branch:  code.Branch,
+		ID:      code.UserID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, invalidGrant
+		}
+		return nil, err
+	}
+
+	pair, err := s.tokenService.Issue(&domain.DataReply{
+		ID:       user.ID,
+		Company:  user.Company,
+		Branch:   user.Branch,
+		Username: user.Username,
+	}, user.Role, clientDevice(client, data))
+	if err != nil {
+		if errors.Is(err, domain.ErrTenantSuspended) {
+			return nil, &domain.OAuthError{Code: "invalid_grant", Description: err.Error()}
+		}
+		return nil, err
+	}
+
+	claims := &utils.Claims{
+		ID:      user.Username,
+		UserID:  user.ID.String(),
+		Company: user.Company,
+		Branch:  user.Branch,
+		Role:    user.Role,
+		Nonce:   code.Nonce,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:   s.issuer,
+			Subject:  user.ID.String(),
+			Audience: client.ClientID,
+		},
+	}
+
+	idToken, err := utils.GenerateJWT(claims, s.idTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokenReply(pair, idToken, code.Scope), nil
+}
+
+func tokenReply(pair *domain.TokenPair, idToken string, scope string) *domain.OAuthTokenReply {
+	return &domain.OAuthTokenReply{
+		AccessToken:  pair.AccessToken,
+		TokenType:    pair.TokenType,
+		ExpiresIn:    int64(time.Until(pair.ExpiresAt).Seconds()),
+		RefreshToken: pair.RefreshToken,
+		IDToken:      idToken,
+		Scope:        scope,
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// clientDevice labels sessions held by an OAuth client with the client's
+// name, since its user agent is a server rather than the user's browser, and
+// binds them to the client so its refresh tokens work for no one else.
+func clientDevice(client *domain.OAuthClient, data *domain.OAuthTokenRequest) *domain.Device {
+	return &domain.Device{UserAgent: "OAuth client " + client.Name, IP: data.IP, ClientID: client.ClientID}
+}
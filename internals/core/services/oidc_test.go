@@ -0,0 +1,349 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/utils"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOIDCRepository keeps clients and codes in memory. UseCode hands a code
+// out once, like the UPDATE ... RETURNING in the repository.
+type fakeOIDCRepository struct {
+	mu      sync.Mutex
+	clients map[string]*domain.OAuthClient
+	codes   map[string]*domain.AuthorizationCode
+	expires map[string]time.Time
+	used    map[string]bool
+}
+
+func newFakeOIDCRepository(clients ...*domain.OAuthClient) *fakeOIDCRepository {
+	r := &fakeOIDCRepository{
+		clients: map[string]*domain.OAuthClient{},
+		codes:   map[string]*domain.AuthorizationCode{},
+		expires: map[string]time.Time{},
+		used:    map[string]bool{},
+	}
+	for _, client := range clients {
+		r.clients[client.ClientID] = client
+	}
+	return r
+}
+
+func (r *fakeOIDCRepository) GetClients() ([]domain.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	clients := []domain.OAuthClient{}
+	for _, client := range r.clients {
+		clients = append(clients, *client)
+	}
+	return clients, nil
+}
+
+func (r *fakeOIDCRepository) GetClient(data *domain.OAuthClient) (*domain.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	client, ok := r.clients[data.ClientID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	found := *client
+	return &found, nil
+}
+
+func (r *fakeOIDCRepository) CreateClient(data *domain.OAuthClient) (*domain.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	client := *data
+	r.clients[data.ClientID] = &client
+	return data, nil
+}
+
+func (r *fakeOIDCRepository) DeleteClient(data *domain.OAuthClient) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.clients[data.ClientID]
+	delete(r.clients, data.ClientID)
+	return ok, nil
+}
+
+func (r *fakeOIDCRepository) CreateCode(data *domain.AuthorizationCode, ttlSeconds int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	code := *data
+	r.codes[data.CodeHash] = &code
+	r.expires[data.CodeHash] = time.Now().Add(time.Duration(ttlSeconds) * time.Second)
+	return nil
+}
+
+func (r *fakeOIDCRepository) UseCode(data *domain.AuthorizationCode) (*domain.AuthorizationCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	code, ok := r.codes[data.CodeHash]
+	if !ok || r.used[data.CodeHash] || time.Now().After(r.expires[data.CodeHash]) {
+		return nil, sql.ErrNoRows
+	}
+	r.used[data.CodeHash] = true
+	found := *code
+	return &found, nil
+}
+
+const (
+	testRedirectURI = "https://app.acme.test/callback"
+	testVerifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testSecret      = "app-secret"
+)
+
+// s256 derives the code_challenge for a verifier as in RFC 7636.
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type oidcFixture struct {
+	service *oidcService
+	tokens  *tokenService
+	oidc    *fakeOIDCRepository
+	users   *fakeCompanyRepository
+	user    *domain.Data
+}
+
+func newOIDCFixture() *oidcFixture {
+	user := newUser("acme", "hq", "alice", domain.RoleUser)
+	users := newFakeCompanyRepository(user)
+	tokens, _, _ := newTestTokenService(users)
+
+	oidc := newFakeOIDCRepository(
+		&domain.OAuthClient{ClientID: "spa", Name: "SPA", RedirectURIs: []string{testRedirectURI}, Public: true},
+		&domain.OAuthClient{ClientID: "web", Name: "Web", RedirectURIs: []string{testRedirectURI}, SecretHash: utils.HashToken(testSecret)},
+	)
+
+	return &oidcFixture{
+		service: NewOIDCService(oidc, users, tokens, "https://id.acme.test", time.Minute),
+		tokens:  tokens,
+		oidc:    oidc,
+		users:   users,
+		user:    user,
+	}
+}
+
+func authorizeRequest(clientID string) *domain.AuthorizeRequest {
+	return &domain.AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            clientID,
+		RedirectURI:         testRedirectURI,
+		Scope:               "openid profile",
+		State:               "xyz",
+		Nonce:               "n-0S6_WzA2Mj",
+		CodeChallenge:       s256(testVerifier),
+		CodeChallengeMethod: domain.PKCEMethodS256,
+	}
+}
+
+// authorize logs the fixture user in to the client and returns the code.
+func (f *oidcFixture) authorize(t *testing.T, clientID string) string {
+	t.Helper()
+
+	principal := &domain.Principal{UserID: f.user.ID, Company: f.user.Company, Branch: f.user.Branch, Role: f.user.Role}
+	reply, err := f.service.Authorize(principal, authorizeRequest(clientID))
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	redirect, err := url.Parse(reply.RedirectURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := redirect.Query().Get("state"); state != "xyz" {
+		t.Errorf("state = %q, want it echoed", state)
+	}
+	return redirect.Query().Get("code")
+}
+
+func codeRequest(clientID, code string) *domain.OAuthTokenRequest {
+	return &domain.OAuthTokenRequest{
+		GrantType:    domain.OAuthGrantAuthorizationCode,
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		ClientID:     clientID,
+		CodeVerifier: testVerifier,
+	}
+}
+
+func oauthErrorCode(err error) string {
+	var oauthErr *domain.OAuthError
+	if !errors.As(err, &oauthErr) {
+		return ""
+	}
+	return oauthErr.Code
+}
+
+func TestS256MatchesRFC7636(t *testing.T) {
+	// Appendix B of RFC 7636
+	if got := s256(testVerifier); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("s256 = %s", got)
+	}
+}
+
+func TestCheckAuthorizeRequiresPKCE(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*domain.AuthorizeRequest)
+		want   string
+	}{
+		{name: "valid", modify: func(*domain.AuthorizeRequest) {}},
+		{name: "no challenge", modify: func(r *domain.AuthorizeRequest) { r.CodeChallenge = "" }, want: "invalid_request"},
+		{name: "no method", modify: func(r *domain.AuthorizeRequest) { r.CodeChallengeMethod = "" }, want: "invalid_request"},
+		{name: "plain method", modify: func(r *domain.AuthorizeRequest) { r.CodeChallengeMethod = "plain" }, want: "invalid_request"},
+		{name: "unknown client", modify: func(r *domain.AuthorizeRequest) { r.ClientID = "other" }, want: "invalid_client"},
+		{name: "unregistered redirect", modify: func(r *domain.AuthorizeRequest) { r.RedirectURI = "https://evil.test/callback" }, want: "invalid_request"},
+		{name: "token response type", modify: func(r *domain.AuthorizeRequest) { r.ResponseType = "token" }, want: "unsupported_response_type"},
+		{name: "no openid scope", modify: func(r *domain.AuthorizeRequest) { r.Scope = "profile" }, want: "invalid_scope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOIDCFixture()
+			request := authorizeRequest("spa")
+			tt.modify(request)
+
+			_, err := f.service.CheckAuthorize(request)
+			if got := oauthErrorCode(err); got != tt.want || (tt.want == "" && err != nil) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeCode(t *testing.T) {
+	f := newOIDCFixture()
+	code := f.authorize(t, "spa")
+
+	reply, err := f.service.Token(codeRequest("spa", code))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if reply.AccessToken == "" || reply.RefreshToken == "" || reply.Scope != "openid profile" {
+		t.Errorf("reply = %+v", reply)
+	}
+
+	claims, err := utils.ParseJWT(reply.IDToken)
+	if err != nil {
+		t.Fatalf("id_token: %v", err)
+	}
+	if claims.Subject != f.user.ID.String() || claims.Audience != "spa" || claims.Nonce != "n-0S6_WzA2Mj" || claims.Issuer != "https://id.acme.test" {
+		t.Errorf("id_token claims = %+v", claims)
+	}
+
+	// The code is single-use
+	if _, err := f.service.Token(codeRequest("spa", code)); oauthErrorCode(err) != "invalid_grant" {
+		t.Errorf("second exchange: err = %v, want invalid_grant", err)
+	}
+}
+
+func TestExchangeCodeRefusals(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(f *oidcFixture, r *domain.OAuthTokenRequest)
+		want   string
+	}{
+		{name: "wrong verifier", modify: func(f *oidcFixture, r *domain.OAuthTokenRequest) {
+			r.CodeVerifier = "another-verifier-of-sufficient-length-000000"
+		}, want: "invalid_grant"},
+		{name: "no verifier", modify: func(f *oidcFixture, r *domain.OAuthTokenRequest) { r.CodeVerifier = "" }, want: "invalid_grant"},
+		{name: "challenge as verifier", modify: func(f *oidcFixture, r *domain.OAuthTokenRequest) { r.CodeVerifier = s256(testVerifier) }, want: "invalid_grant"},
+		{name: "other redirect", modify: func(f *oidcFixture, r *domain.OAuthTokenRequest) { r.RedirectURI = "https://app.acme.test/other" }, want: "invalid_grant"},
+		{name: "other client", modify: func(f *oidcFixture, r *domain.OAuthTokenRequest) {
+			r.ClientID, r.ClientSecret = "web", testSecret
+		}, want: "invalid_grant"},
+		{name: "unknown code", modify: func(f *oidcFixture, r *domain.OAuthTokenRequest) { r.Code = "made-up" }, want: "invalid_grant"},
+		{name: "expired code", modify: func(f *oidcFixture, r *domain.OAuthTokenRequest) {
+			f.oidc.expires[utils.HashToken(r.Code)] = time.Now().Add(-time.Second)
+		}, want: "invalid_grant"},
+		{name: "user deleted", modify: func(f *oidcFixture, r *domain.OAuthTokenRequest) { f.users.delete(f.user.ID) }, want: "invalid_grant"},
+		{name: "unknown client", modify: func(f *oidcFixture, r *domain.OAuthTokenRequest) { r.ClientID = "other" }, want: "invalid_client"},
+		{name: "unsupported grant", modify: func(f *oidcFixture, r *domain.OAuthTokenRequest) { r.GrantType = "password" }, want: "unsupported_grant_type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOIDCFixture()
+			request := codeRequest("spa", f.authorize(t, "spa"))
+			tt.modify(f, request)
+
+			reply, err := f.service.Token(request)
+			if got := oauthErrorCode(err); got != tt.want {
+				t.Errorf("reply = %+v, err = %v, want %s", reply, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangeCodeAuthenticatesConfidentialClient(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		want   string
+	}{
+		{name: "right secret", secret: testSecret},
+		{name: "wrong secret", secret: "guess", want: "invalid_client"},
+		{name: "no secret", secret: "", want: "invalid_client"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOIDCFixture()
+			request := codeRequest("web", f.authorize(t, "web"))
+			request.ClientSecret = tt.secret
+
+			_, err := f.service.Token(request)
+			if got := oauthErrorCode(err); got != tt.want || (tt.want == "" && err != nil) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenIsBoundToClient(t *testing.T) {
+	f := newOIDCFixture()
+	reply, err := f.service.Token(codeRequest("spa", f.authorize(t, "spa")))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+
+	refresh := func(clientID, secret string) (*domain.OAuthTokenReply, error) {
+		return f.service.Token(&domain.OAuthTokenRequest{
+			GrantType:    domain.OAuthGrantRefreshToken,
+			RefreshToken: reply.RefreshToken,
+			ClientID:     clientID,
+			ClientSecret: secret,
+		})
+	}
+
+	// Another client, even an authenticated one, cannot use the token
+	if _, err := refresh("web", testSecret); oauthErrorCode(err) != "invalid_grant" {
+		t.Errorf("other client: err = %v, want invalid_grant", err)
+	}
+
+	// Neither can the first-party refresh endpoint
+	if _, err := f.tokens.Refresh(&domain.RefreshInput{RefreshToken: reply.RefreshToken}); !errors.Is(err, domain.ErrInvalidRefreshToken) {
+		t.Errorf("first-party refresh: err = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	// The refusals did not use up the token for the client it belongs to
+	if _, err := refresh("spa", ""); err != nil {
+		t.Errorf("own client: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"fmt"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+type passwordPolicy struct {
+	policyRepository  ports.PolicyRepository
+	companyRepository ports.CompanyRepository
+	passwordHasher    ports.PasswordHasher
+	breachList        ports.BreachList
+}
+
+func NewPasswordPolicy(policyRepository ports.PolicyRepository, companyRepository ports.CompanyRepository, passwordHasher ports.PasswordHasher, breachList ports.BreachList) *passwordPolicy {
+	return &passwordPolicy{
+		policyRepository:  policyRepository,
+		companyRepository: companyRepository,
+		passwordHasher:    passwordHasher,
+		breachList:        breachList,
+	}
+}
+
+// Check tests a new password for user against the policy of the user's
+// company. For existing users, user.Password is the current hash and counts
+// towards the history rule. All broken rules are reported together.
+func (p *passwordPolicy) Check(user *domain.Data, password string) error {
+	policy, err := loadPolicy(p.policyRepository, user.Company)
+	if err != nil {
+		return err
+	}
+
+	violations := []string{}
+
+	length := utf8.RuneCountInString(password)
+	if length < policy.PasswordMinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", policy.PasswordMinLength))
+	}
+	if length > domain.PasswordMaxLength {
+		violations = append(violations, fmt.Sprintf("must be at most %d characters long", domain.PasswordMaxLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r), unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+	if policy.PasswordRequireUpper && !upper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if policy.PasswordRequireLower && !lower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if policy.PasswordRequireDigit && !digit {
+		violations = append(violations, "must contain a digit")
+	}
+	if policy.PasswordRequireSymbol && !symbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	if policy.PasswordCheckBreached && p.breachList.Contains(password) {
+		violations = append(violations, "appears in a list of breached passwords")
+	}
+
+	if policy.PasswordHistory > 0 && user.ID != uuid.Nil {
+		reused, err := p.reused(user, password, policy.PasswordHistory)
+		if err != nil {
+			return err
+		}
+		if reused {
+			violations = append(violations, fmt.Sprintf("must not be one of the last %d passwords", policy.PasswordHistory))
+		}
+	}
+
+	if len(violations) > 0 {
+		return &domain.PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// Record adds the hash in user.Password to the user's password history.
+func (p *passwordPolicy) Record(user *domain.Data) error {
+	return p.policyRepository.AddPasswordHistory(user)
+}
+
+// Expired reports whether the user's password is older than the policy allows.
+func (p *passwordPolicy) Expired(user *domain.Data) (bool, error) {
+	policy, err := loadPolicy(p.policyRepository, user.Company)
+	if err != nil {
+		return false, err
+	}
+
+	if policy.PasswordMaxAgeDays <= 0 || user.Password == domain.FederatedPassword {
+		return false, nil
+	}
+
+	return p.companyRepository.PasswordExpired(user, policy.PasswordMaxAgeDays)
+}
+
+// reused compares the password with the current one and the ones in the
+// history, the current one included for users who predate the history.
+func (p *passwordPolicy) reused(user *domain.Data, password string, depth int) (bool, error) {
+	hashes, err := p.policyRepository.GetPasswordHistory(user, depth)
+	if err != nil {
+		return false, err
+	}
+
+	if user.Password != "" && user.Password != domain.FederatedPassword {
+		hashes = append(hashes, user.Password)
+	}
+
+	for _, hash := range hashes {
+		ok, err := p.passwordHasher.Verify(password, hash)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"reflect"
+	"testing"
+)
+
+// breached is a breach list of the passwords it holds.
+type breached map[string]bool
+
+func (b breached) Contains(password string) bool { return b[password] }
+
+// expiredPasswords reports every stored password as expired.
+type expiredPasswords struct {
+	ports.CompanyRepository
+}
+
+func (expiredPasswords) PasswordExpired(*domain.Data, int) (bool, error) { return true, nil }
+
+func violations(err error) []string {
+	var policyErr *domain.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		return policyErr.Violations
+	}
+	return nil
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	strict := domain.DefaultSecurityPolicy("acme")
+	strict.PasswordMinLength = 10
+	strict.PasswordRequireUpper = true
+	strict.PasswordRequireDigit = true
+	strict.PasswordRequireSymbol = true
+	p := NewPasswordPolicy(newFakePolicyRepository(strict), nil, newTestHasher(t), breached{"Tr0ub4dor&3x": true})
+
+	user := &domain.Data{Company: "acme"}
+	tests := []struct {
+		password string
+		want     []string
+	}{
+		{password: "C0rrect-horse"},
+		{password: "short", want: []string{
+			"must be at least 10 characters long",
+			"must contain an uppercase letter",
+			"must contain a digit",
+			"must contain a symbol",
+		}},
+		{password: "Tr0ub4dor&3x", want: []string{"appears in a list of breached passwords"}},
+	}
+	for _, tt := range tests {
+		if got := violations(p.Check(user, tt.password)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Check(%q) = %q, want %q", tt.password, got, tt.want)
+		}
+	}
+
+	// Companies without a policy get the defaults
+	if got := violations(p.Check(&domain.Data{Company: "globex"}, "short")); len(got) != 1 {
+		t.Errorf("default policy violations = %q, want the length only", got)
+	}
+	if err := p.Check(&domain.Data{Company: "globex"}, "Tr0ub4dor&3x"); err == nil {
+		t.Error("default policy accepted a breached password")
+	}
+}
+
+func TestPasswordPolicyHistory(t *testing.T) {
+	policy := domain.DefaultSecurityPolicy("acme")
+	policy.PasswordHistory = 2
+	policies := newFakePolicyRepository(policy)
+	hasher := newTestHasher(t)
+	p := NewPasswordPolicy(policies, nil, hasher, breached{})
+
+	user := newUser("acme", "hq", "alice", domain.RoleUser)
+	for _, password := range []string{"first-passw0rd", "second-passw0rd", "third-passw0rd"} {
+		hash, err := hasher.Hash(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user.Password = hash
+		if err := p.Record(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The current password is refused even when the history is empty
+	alice := *user
+	for password, reused := range map[string]bool{"third-passw0rd": true, "second-passw0rd": true, "first-passw0rd": false} {
+		if err := p.Check(&alice, password); (violations(err) != nil) != reused {
+			t.Errorf("Check(%q) = %v, want reused = %v", password, err, reused)
+		}
+	}
+	delete(policies.history, user.ID)
+	if err := p.Check(&alice, "third-passw0rd"); violations(err) == nil {
+		t.Error("current password accepted for a user without history")
+	}
+
+	// New users have nothing to reuse
+	if err := p.Check(&domain.Data{Company: "acme"}, "third-passw0rd"); err != nil {
+		t.Errorf("new user: %v", err)
+	}
+}
+
+func TestPasswordExpired(t *testing.T) {
+	aging := domain.DefaultSecurityPolicy("acme")
+	aging.PasswordMaxAgeDays = 90
+	p := NewPasswordPolicy(newFakePolicyRepository(aging), expiredPasswords{}, nil, breached{})
+
+	tests := []struct {
+		name string
+		user *domain.Data
+		want bool
+	}{
+		{name: "old password", user: newUser("acme", "hq", "alice", domain.RoleUser), want: true},
+		{name: "federated", user: &domain.Data{Company: "acme", Password: domain.FederatedPassword}},
+		{name: "no max age", user: newUser("globex", "hq", "bob", domain.RoleUser)},
+	}
+	for _, tt := range tests {
+		if got, err := p.Expired(tt.user); err != nil || got != tt.want {
+			t.Errorf("%s: Expired = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestUpdatePolicyBounds(t *testing.T) {
+	policies := newFakePolicyRepository()
+	s := NewPolicyService(policies)
+
+	invalid := []func(*domain.SecurityPolicy){
+		func(p *domain.SecurityPolicy) { p.PasswordMinLength = 0 },
+		func(p *domain.SecurityPolicy) { p.PasswordMinLength = domain.PasswordMaxLength + 1 },
+		func(p *domain.SecurityPolicy) { p.PasswordHistory = -1 },
+		func(p *domain.SecurityPolicy) { p.PasswordHistory = domain.PasswordHistoryMax + 1 },
+		func(p *domain.SecurityPolicy) { p.PasswordMaxAgeDays = domain.PasswordMaxAgeDaysMax + 1 },
+	}
+	for i, change := range invalid {
+		policy := domain.DefaultSecurityPolicy("acme")
+		change(policy)
+		if _, err := s.UpdatePolicy(policy); !errors.Is(err, domain.ErrInvalidPolicy) {
+			t.Errorf("case %d: UpdatePolicy = %v, want %v", i, err, domain.ErrInvalidPolicy)
+		}
+	}
+	if len(policies.policies) != 0 {
+		t.Fatalf("saved %v", policies.policies)
+	}
+
+	policy := domain.DefaultSecurityPolicy("ACME")
+	policy.PasswordHistory = domain.PasswordHistoryMax
+	if _, err := s.UpdatePolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err := s.GetPolicy(&domain.CompanyRequest{Company: "acme"}); err != nil || saved.PasswordHistory != domain.PasswordHistoryMax {
+		t.Errorf("GetPolicy = %+v, %v", saved, err)
+	}
+}
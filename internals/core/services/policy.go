@@ -0,0 +1,56 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"strings"
+)
+
+type policyService struct {
+	policyRepository ports.PolicyRepository
+}
+
+func NewPolicyService(policyRepository ports.PolicyRepository) *policyService {
+	return &policyService{
+		policyRepository: policyRepository,
+	}
+}
+
+func (s *policyService) GetPolicy(data *domain.CompanyRequest) (*domain.SecurityPolicy, error) {
+	if data == nil || data.Company == "" {
+		return nil, errors.New("Company name is required")
+	}
+
+	return loadPolicy(s.policyRepository, strings.ToLower(data.Company))
+}
+
+func (s *policyService) UpdatePolicy(data *domain.SecurityPolicy) (*domain.SecurityPolicy, error) {
+	if data == nil || data.Company == "" {
+		return nil, errors.New("Company name is required")
+	}
+
+	if data.PasswordMinLength < 1 || data.PasswordMinLength > domain.PasswordMaxLength ||
+		data.PasswordHistory < 0 || data.PasswordHistory > domain.PasswordHistoryMax ||
+		data.PasswordMaxAgeDays < 0 || data.PasswordMaxAgeDays > domain.PasswordMaxAgeDaysMax {
+		return nil, domain.ErrInvalidPolicy
+	}
+
+	data.Company = strings.ToLower(data.Company)
+	return s.policyRepository.SavePolicy(data)
+}
+
+// loadPolicy returns the company's policy, or the defaults when the company
+// has never saved one.
+func loadPolicy(policyRepository ports.PolicyRepository, company string) (*domain.SecurityPolicy, error) {
+	policy, err := policyRepository.GetPolicy(&domain.SecurityPolicy{Company: company})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.DefaultSecurityPolicy(company), nil
+		}
+		return nil, err
+	}
+
+	return policy, nil
+}
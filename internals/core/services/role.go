@@ -0,0 +1,201 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type roleService struct {
+	roleRepository    ports.RoleRepository
+	companyRepository ports.CompanyRepository
+}
+
+func NewRoleService(roleRepository ports.RoleRepository, companyRepository ports.CompanyRepository) *roleService {
+	return &roleService{
+		roleRepository:    roleRepository,
+		companyRepository: companyRepository,
+	}
+}
+
+func (s *roleService) ListRoles(principal *domain.Principal) ([]domain.CustomRole, error) {
+	return s.roleRepository.GetRoles(&domain.CustomRole{Company: principal.Company})
+}
+
+func (s *roleService) CreateRole(principal *domain.Principal, data *domain.RoleInput) (*domain.CustomRole, error) {
+	role, err := s.buildRole(principal, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.roleRepository.CreateRole(role)
+}
+
+// UpdateRole replaces the role's definition. Users holding the role get the
+// new permissions with their next access token.
+func (s *roleService) UpdateRole(principal *domain.Principal, id uuid.UUID, data *domain.RoleInput) (*domain.CustomRole, error) {
+	if _, err := s.getRole(principal, id); err != nil {
+		return nil, err
+	}
+
+	role, err := s.buildRole(principal, data)
+	if err != nil {
+		return nil, err
+	}
+	role.ID = id
+
+	return s.roleRepository.UpdateRole(role)
+}
+
+func (s *roleService) DeleteRole(principal *domain.Principal, id uuid.UUID) error {
+	ok, err := s.roleRepository.DeleteRole(&domain.CustomRole{ID: id, Company: principal.Company})
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return domain.ErrRoleNotFound
+	}
+
+	return nil
+}
+
+// AssignRole gives a user of the caller's company a role. The caller must be
+// able to reach the user's branch and hold every permission the role grants.
+func (s *roleService) AssignRole(principal *domain.Principal, data *domain.RoleAssignment) error {
+	role, err := s.getRole(principal, data.RoleID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkGrant(principal, role.Permissions); err != nil {
+		return err
+	}
+
+	data.Company = principal.Company
+	if err := s.checkUser(principal, data); err != nil {
+		return err
+	}
+
+	return s.roleRepository.AssignRole(data)
+}
+
+func (s *roleService) UnassignRole(principal *domain.Principal, data *domain.RoleAssignment) error {
+	data.Company = principal.Company
+	if err := s.checkUser(principal, data); err != nil {
+		return err
+	}
+
+	return s.roleRepository.UnassignRole(data)
+}
+
+func (s *roleService) UserRoles(principal *domain.Principal, data *domain.RoleAssignment) ([]domain.CustomRole, error) {
+	data.Company = principal.Company
+	if err := s.checkUser(principal, data); err != nil {
+		return nil, err
+	}
+
+	return s.roleRepository.GetUserRoles(data)
+}
+
+// Permissions returns everything a user may do: the permissions of the
+// built-in role plus those of every company role assigned to the user.
+func (s *roleService) Permissions(userID uuid.UUID, role string) ([]string, error) {
+	assigned, err := s.roleRepository.GetUserPermissions(&domain.RoleAssignment{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	perms := domain.RolePermissions(role)
+	for _, perm := range assigned {
+		// Permissions dropped from the catalogue stop working immediately
+		if domain.AssignablePermission(perm) && !domain.HasPermission(perms, perm) {
+			perms = append(perms, perm)
+		}
+	}
+
+	sort.Strings(perms)
+	return perms, nil
+}
+
+func (s *roleService) buildRole(principal *domain.Principal, data *domain.RoleInput) (*domain.CustomRole, error) {
+	name := strings.TrimSpace(data.Name)
+	if name == "" {
+		return nil, errors.New("role name cannot be empty")
+	}
+
+	if domain.ValidRole(strings.ToLower(name)) {
+		return nil, errors.New("role name is reserved")
+	}
+
+	perms := []string{}
+	for _, perm := range data.Permissions {
+		if !domain.AssignablePermission(perm) {
+			return nil, domain.ErrUnknownPermission
+		}
+		if !domain.HasPermission(perms, perm) {
+			perms = append(perms, perm)
+		}
+	}
+	sort.Strings(perms)
+
+	if err := s.checkGrant(principal, perms); err != nil {
+		return nil, err
+	}
+
+	return &domain.CustomRole{
+		Company:     principal.Company,
+		Name:        name,
+		Description: data.Description,
+		Permissions: perms,
+	}, nil
+}
+
+func (s *roleService) getRole(principal *domain.Principal, id uuid.UUID) (*domain.CustomRole, error) {
+	role, err := s.roleRepository.GetRole(&domain.CustomRole{ID: id, Company: principal.Company})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrRoleNotFound
+		}
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// checkGrant stops callers from handing out more than they hold themselves.
+func (s *roleService) checkGrant(principal *domain.Principal, perms []string) error {
+	for _, perm := range perms {
+		if !domain.HasPermission(principal.Permissions, perm) {
+			return domain.ErrPermissionEscalated
+		}
+	}
+	return nil
+}
+
+// checkUser makes sure the assignment targets an existing user the caller
+// can reach.
+func (s *roleService) checkUser(principal *domain.Principal, data *domain.RoleAssignment) error {
+	if !domain.InTenantScope(principal.Permissions, principal.Company, principal.Branch, data.Company, data.Branch) {
+		return domain.ErrOutOfTenantScope
+	}
+
+	_, err := s.companyRepository.GetMe(&domain.Data{
+		Company: data.Company,
+		Branch:  data.Branch,
+		ID:      data.UserID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("user not found")
+		}
+		return err
+	}
+
+	return nil
+}
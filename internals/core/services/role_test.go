@@ -0,0 +1,289 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// fakeRoleRepository keeps company roles and their assignments in memory.
+// Methods the tests do not need fall through to the nil interface and panic
+// if called.
+type fakeRoleRepository struct {
+	ports.RoleRepository
+
+	mu          sync.Mutex
+	roles       map[uuid.UUID]*domain.CustomRole
+	assignments []domain.RoleAssignment
+}
+
+func newFakeRoleRepository() *fakeRoleRepository {
+	return &fakeRoleRepository{roles: map[uuid.UUID]*domain.CustomRole{}}
+}
+
+func (r *fakeRoleRepository) GetRoles(data *domain.CustomRole) ([]domain.CustomRole, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	roles := []domain.CustomRole{}
+	for _, role := range r.roles {
+		if role.Company == data.Company {
+			roles = append(roles, *role)
+		}
+	}
+	return roles, nil
+}
+
+func (r *fakeRoleRepository) GetRole(data *domain.CustomRole) (*domain.CustomRole, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	role, ok := r.roles[data.ID]
+	if !ok || role.Company != data.Company {
+		return nil, sql.ErrNoRows
+	}
+	found := *role
+	return &found, nil
+}
+
+func (r *fakeRoleRepository) CreateRole(data *domain.CustomRole) (*domain.CustomRole, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data.ID = uuid.New()
+	role := *data
+	r.roles[data.ID] = &role
+	return data, nil
+}
+
+func (r *fakeRoleRepository) UpdateRole(data *domain.CustomRole) (*domain.CustomRole, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	role := *data
+	r.roles[data.ID] = &role
+	return data, nil
+}
+
+func (r *fakeRoleRepository) DeleteRole(data *domain.CustomRole) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	role, ok := r.roles[data.ID]
+	if !ok || role.Company != data.Company {
+		return false, nil
+	}
+	delete(r.roles, data.ID)
+	return true, nil
+}
+
+func (r *fakeRoleRepository) AssignRole(data *domain.RoleAssignment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.assignments = append(r.assignments, *data)
+	return nil
+}
+
+func (r *fakeRoleRepository) UnassignRole(data *domain.RoleAssignment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.assignments[:0]
+	for _, a := range r.assignments {
+		if a.UserID != data.UserID || a.RoleID != data.RoleID {
+			kept = append(kept, a)
+		}
+	}
+	r.assignments = kept
+	return nil
+}
+
+func (r *fakeRoleRepository) GetRoleMembers(data *domain.CustomRole) ([]domain.RoleAssignment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	members := []domain.RoleAssignment{}
+	for _, a := range r.assignments {
+		if a.RoleID == data.ID {
+			members = append(members, a)
+		}
+	}
+	return members, nil
+}
+
+func (r *fakeRoleRepository) GetUserPermissions(data *domain.RoleAssignment) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	perms := []string{}
+	for _, a := range r.assignments {
+		if role, ok := r.roles[a.RoleID]; ok && a.UserID == data.UserID {
+			perms = append(perms, role.Permissions...)
+		}
+	}
+	return perms, nil
+}
+
+// roleManager can manage roles and read users, through a company role
+// rather than a built-in one.
+var roleManager = &domain.Principal{
+	UserID:      uuid.New(),
+	Company:     "acme",
+	Branch:      "hq",
+	Role:        domain.RoleUser,
+	Permissions: []string{domain.PermRolesManage, domain.PermUsersRead},
+}
+
+func TestCreateRole(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *domain.Principal
+		input     domain.RoleInput
+		want      error
+	}{
+		{name: "permissions the caller holds", principal: roleManager, input: domain.RoleInput{Name: "auditor", Permissions: []string{domain.PermUsersRead}}},
+		{name: "permission the caller lacks", principal: roleManager, input: domain.RoleInput{Name: "editor", Permissions: []string{domain.PermUsersRead, domain.PermUsersWrite}}, want: domain.ErrPermissionEscalated},
+		{name: "company admin grants branches", principal: companyAdmin, input: domain.RoleInput{Name: "regional", Permissions: []string{domain.PermBranchesManage}}},
+		{name: "tenants:manage by super admin", principal: superAdmin, input: domain.RoleInput{Name: "operator", Permissions: []string{domain.PermTenantsManage}}, want: domain.ErrUnknownPermission},
+		{name: "unknown permission", principal: companyAdmin, input: domain.RoleInput{Name: "other", Permissions: []string{"billing:manage"}}, want: domain.ErrUnknownPermission},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles := newFakeRoleRepository()
+			s := NewRoleService(roles, newFakeCompanyRepository())
+
+			role, err := s.CreateRole(tt.principal, &tt.input)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if tt.want != nil {
+				if len(roles.roles) != 0 {
+					t.Error("refused role was stored")
+				}
+				return
+			}
+			if role.Company != tt.principal.Company {
+				t.Errorf("role created in %q, want the caller's company", role.Company)
+			}
+		})
+	}
+}
+
+func TestCreateRoleRefusesBuiltInNames(t *testing.T) {
+	s := NewRoleService(newFakeRoleRepository(), newFakeCompanyRepository())
+
+	for _, name := range []string{"Admin", "super_admin", " "} {
+		if _, err := s.CreateRole(companyAdmin, &domain.RoleInput{Name: name}); err == nil {
+			t.Errorf("role %q was created", name)
+		}
+	}
+}
+
+func TestUpdateRoleRefusesEscalation(t *testing.T) {
+	roles := newFakeRoleRepository()
+	s := NewRoleService(roles, newFakeCompanyRepository())
+
+	role, err := s.CreateRole(roleManager, &domain.RoleInput{Name: "auditor", Permissions: []string{domain.PermUsersRead}})
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+
+	// Widening a role is granting its new permissions to everyone holding it
+	_, err = s.UpdateRole(roleManager, role.ID, &domain.RoleInput{Name: "auditor", Permissions: []string{domain.PermUsersRead, domain.PermUsersWrite}})
+	if !errors.Is(err, domain.ErrPermissionEscalated) {
+		t.Fatalf("err = %v, want ErrPermissionEscalated", err)
+	}
+	if got := roles.roles[role.ID].Permissions; !reflect.DeepEqual(got, []string{domain.PermUsersRead}) {
+		t.Errorf("permissions = %v, want them unchanged", got)
+	}
+
+	// Roles of other companies cannot be reached at all
+	_, err = s.UpdateRole(globexAdmin, role.ID, &domain.RoleInput{Name: "auditor"})
+	if !errors.Is(err, domain.ErrRoleNotFound) {
+		t.Errorf("other company: err = %v, want ErrRoleNotFound", err)
+	}
+}
+
+func TestCustomRoleGrantsPermissions(t *testing.T) {
+	user := newUser("acme", "hq", "alice", domain.RoleUser)
+	roles := newFakeRoleRepository()
+	s := NewRoleService(roles, newFakeCompanyRepository(user))
+
+	role, err := s.CreateRole(companyAdmin, &domain.RoleInput{Name: "support", Permissions: []string{domain.PermUsersWrite, domain.PermUsersRead}})
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	assignment := &domain.RoleAssignment{UserID: user.ID, RoleID: role.ID, Branch: "hq"}
+
+	// The role manager holds roles:manage but not users:write
+	if err := s.AssignRole(roleManager, assignment); !errors.Is(err, domain.ErrPermissionEscalated) {
+		t.Fatalf("escalating assignment: err = %v, want ErrPermissionEscalated", err)
+	}
+	if len(roles.assignments) != 0 {
+		t.Fatal("refused assignment was stored")
+	}
+
+	if err := s.AssignRole(companyAdmin, assignment); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	perms, err := s.Permissions(user.ID, user.Role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{domain.PermUsersRead, domain.PermUsersWrite}; !reflect.DeepEqual(perms, want) {
+		t.Errorf("permissions = %v, want %v", perms, want)
+	}
+
+	if err := s.UnassignRole(companyAdmin, assignment); err != nil {
+		t.Fatalf("UnassignRole: %v", err)
+	}
+	if perms, _ := s.Permissions(user.ID, user.Role); len(perms) != 0 {
+		t.Errorf("permissions after unassign = %v, want none", perms)
+	}
+}
+
+func TestAssignRoleInTenantScope(t *testing.T) {
+	user := newUser("acme", "east", "bob", domain.RoleUser)
+	roles := newFakeRoleRepository()
+	s := NewRoleService(roles, newFakeCompanyRepository(user))
+
+	role, err := s.CreateRole(companyAdmin, &domain.RoleInput{Name: "auditor", Permissions: []string{domain.PermUsersRead}})
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+
+	// Without branches:manage the role manager only reaches acme/hq
+	err = s.AssignRole(roleManager, &domain.RoleAssignment{UserID: user.ID, RoleID: role.ID, Branch: "east"})
+	if !errors.Is(err, domain.ErrOutOfTenantScope) {
+		t.Errorf("sibling branch: err = %v, want ErrOutOfTenantScope", err)
+	}
+	if err := s.AssignRole(companyAdmin, &domain.RoleAssignment{UserID: user.ID, RoleID: role.ID, Branch: "east"}); err != nil {
+		t.Errorf("company admin: %v", err)
+	}
+}
+
+func TestPermissionsIgnoreUnassignable(t *testing.T) {
+	user := newUser("acme", "hq", "alice", domain.RoleUser)
+	roles := newFakeRoleRepository()
+	s := NewRoleService(roles, newFakeCompanyRepository(user))
+
+	// A role stored before tenants:manage became unassignable
+	role, _ := roles.CreateRole(&domain.CustomRole{Company: "acme", Name: "legacy", Permissions: []string{domain.PermTenantsManage, domain.PermUsersRead}})
+	roles.AssignRole(&domain.RoleAssignment{UserID: user.ID, RoleID: role.ID, Company: "acme", Branch: "hq"})
+
+	perms, err := s.Permissions(user.ID, user.Role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{domain.PermUsersRead}; !reflect.DeepEqual(perms, want) {
+		t.Errorf("permissions = %v, want %v", perms, want)
+	}
+}
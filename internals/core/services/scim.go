@@ -0,0 +1,818 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	scimDefaultCount = 100
+	scimMaxCount     = 500
+)
+
+type scimService struct {
+	companyRepository ports.CompanyRepository
+	roleRepository    ports.RoleRepository
+	tokenService      ports.TokenService
+	passwordHasher    ports.PasswordHasher
+	passwordPolicy    ports.PasswordPolicy
+	baseURL           string
+}
+
+func NewSCIMService(companyRepository ports.CompanyRepository, roleRepository ports.RoleRepository, tokenService ports.TokenService, passwordHasher ports.PasswordHasher, passwordPolicy ports.PasswordPolicy, baseURL string) *scimService {
+	return &scimService{
+		companyRepository: companyRepository,
+		roleRepository:    roleRepository,
+		tokenService:      tokenService,
+		passwordHasher:    passwordHasher,
+		passwordPolicy:    passwordPolicy,
+		baseURL:           strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// ListUsers supports filters made of `attribute eq value` comparisons joined
+// with `and`, on userName, emails.value, id and active.
+func (s *scimService) ListUsers(principal *domain.Principal, data *domain.SCIMListInput) (*domain.SCIMListResponse, error) {
+	query := &domain.UserQuery{Company: principal.Company, Branch: scimBranch(principal)}
+
+	comparisons, err := parseSCIMFilter(data.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for attr, value := range comparisons {
+		switch attr {
+		case "username":
+			query.Username = value
+		case "emails", "emails.value":
+			query.Email = value
+		case "id":
+			id, err := uuid.Parse(value)
+			if err != nil {
+				return emptySCIMList(), nil
+			}
+			query.ID = &id
+		case "active":
+			active, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, scimInvalidFilter("active must be true or false")
+			}
+			query.Active = &active
+		default:
+			return nil, scimInvalidFilter("unsupported filter attribute " + attr)
+		}
+	}
+
+	startIndex, count := scimPage(data)
+	query.Offset = startIndex - 1
+	query.Limit = count
+
+	users, total, err := s.companyRepository.FindUsers(query)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []*domain.SCIMUser{}
+	for i := range users {
+		resources = append(resources, s.scimUser(&users[i]))
+	}
+
+	return &domain.SCIMListResponse{
+		Schemas:      []string{domain.SCIMSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}, nil
+}
+
+func (s *scimService) GetUser(principal *domain.Principal, id string) (*domain.SCIMUser, error) {
+	user, err := s.user(principal, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.scimUser(user), nil
+}
+
+// CreateUser provisions a user. Without a password the user can only sign
+// in through the company's identity provider or after a password reset.
+func (s *scimService) CreateUser(principal *domain.Principal, data *domain.SCIMUser) (*domain.SCIMUser, error) {
+	if data.UserName == "" {
+		return nil, &domain.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidValue", Detail: "userName is required"}
+	}
+
+	branch, err := s.branch(principal, data.Tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkUsername(principal.Company, branch, data.UserName, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	password := domain.FederatedPassword
+	if data.Password != "" {
+		if err := s.passwordPolicy.Check(&domain.Data{Company: principal.Company, Branch: branch}, data.Password); err != nil {
+			var policyErr *domain.PasswordPolicyError
+			if errors.As(err, &policyErr) {
+				return nil, scimInvalidValue(err.Error())
+			}
+			return nil, err
+		}
+
+		password, err = s.passwordHasher.Hash(data.Password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	user := &domain.Data{
+		Company:  principal.Company,
+		Branch:   branch,
+		Username: data.UserName,
+		Password: password,
+		Email:    primaryEmail(data.Emails),
+		Role:     domain.RoleUser,
+	}
+	if data.Name != nil {
+		user.FirstName = data.Name.GivenName
+		user.LastName = data.Name.FamilyName
+	}
+
+	res, err := s.companyRepository.Register(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.Password != "" {
+		if err := s.passwordPolicy.Record(res); err != nil {
+			return nil, err
+		}
+	}
+
+	if data.Active != nil && !*data.Active {
+		if err := s.companyRepository.SetActive(res, false); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetUser(principal, res.ID.String())
+}
+
+// ReplaceUser implements PUT. Attributes left out are cleared.
+func (s *scimService) ReplaceUser(principal *domain.Principal, id string, data *domain.SCIMUser) (*domain.SCIMUser, error) {
+	user, err := s.user(principal, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.UserName == "" {
+		return nil, &domain.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidValue", Detail: "userName is required"}
+	}
+
+	user.Username = data.UserName
+	user.FirstName, user.LastName = "", ""
+	if data.Name != nil {
+		user.FirstName = data.Name.GivenName
+		user.LastName = data.Name.FamilyName
+	}
+	user.Email = primaryEmail(data.Emails)
+
+	active := true
+	if data.Active != nil {
+		active = *data.Active
+	}
+
+	return s.saveUser(principal, user, active)
+}
+
+// PatchUser applies add, replace and remove operations on userName,
+// name.givenName, name.familyName, emails and active.
+func (s *scimService) PatchUser(principal *domain.Principal, id string, data *domain.SCIMPatch) (*domain.SCIMUser, error) {
+	user, err := s.user(principal, id)
+	if err != nil {
+		return nil, err
+	}
+
+	active := user.DeleteAt == nil
+	for _, op := range data.Operations {
+		if err := patchUser(user, &active, op); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.saveUser(principal, user, active)
+}
+
+// DeleteUser removes the user. Use active=false to only deactivate.
+func (s *scimService) DeleteUser(principal *domain.Principal, id string) error {
+	user, err := s.user(principal, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.tokenService.RevokeUserSessions(user.ID); err != nil {
+		return err
+	}
+
+	return s.companyRepository.DeleteData(user)
+}
+
+// ListGroups lists the company roles as SCIM groups. Only displayName eq
+// filters are supported.
+func (s *scimService) ListGroups(principal *domain.Principal, data *domain.SCIMListInput) (*domain.SCIMListResponse, error) {
+	comparisons, err := parseSCIMFilter(data.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName, filtered := comparisons["displayname"]
+	delete(comparisons, "displayname")
+	for attr := range comparisons {
+		return nil, scimInvalidFilter("unsupported filter attribute " + attr)
+	}
+
+	roles, err := s.roleRepository.GetRoles(&domain.CustomRole{Company: principal.Company})
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []domain.CustomRole{}
+	for _, role := range roles {
+		if !filtered || strings.EqualFold(role.Name, displayName) {
+			matches = append(matches, role)
+		}
+	}
+
+	startIndex, count := scimPage(data)
+	resources := []*domain.SCIMGroup{}
+	for i := startIndex - 1; i < len(matches) && len(resources) < count; i++ {
+		group, err := s.scimGroup(principal, &matches[i])
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, group)
+	}
+
+	return &domain.SCIMListResponse{
+		Schemas:      []string{domain.SCIMSchemaListResponse},
+		TotalResults: len(matches),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}, nil
+}
+
+func (s *scimService) GetGroup(principal *domain.Principal, id string) (*domain.SCIMGroup, error) {
+	role, err := s.role(principal, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.scimGroup(principal, role)
+}
+
+// CreateGroup creates a company role without permissions. Permissions are
+// granted to it through the roles API, SCIM only manages membership.
+func (s *scimService) CreateGroup(principal *domain.Principal, data *domain.SCIMGroup) (*domain.SCIMGroup, error) {
+	name := strings.TrimSpace(data.DisplayName)
+	if name == "" || domain.ValidRole(strings.ToLower(name)) {
+		return nil, &domain.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidValue", Detail: "displayName is missing or reserved"}
+	}
+
+	roles, err := s.roleRepository.GetRoles(&domain.CustomRole{Company: principal.Company})
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		if strings.EqualFold(role.Name, name) {
+			return nil, &domain.SCIMError{Status: http.StatusConflict, ScimType: "uniqueness", Detail: "displayName is already taken"}
+		}
+	}
+
+	role, err := s.roleRepository.CreateRole(&domain.CustomRole{
+		Company:     principal.Company,
+		Name:        name,
+		Permissions: []string{},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, member := range data.Members {
+		if err := s.addMember(principal, role, member.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.scimGroup(principal, role)
+}
+
+// PatchGroup renames the group and adds or removes members.
+func (s *scimService) PatchGroup(principal *domain.Principal, id string, data *domain.SCIMPatch) (*domain.SCIMGroup, error) {
+	role, err := s.role(principal, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range data.Operations {
+		path := strings.ToLower(op.Path)
+		switch {
+		case path == "displayname" && strings.EqualFold(op.Op, "replace"):
+			var name string
+			if err := json.Unmarshal(op.Value, &name); err != nil || strings.TrimSpace(name) == "" {
+				return nil, scimInvalidValue("displayName must be a non-empty string")
+			}
+			role.Name = strings.TrimSpace(name)
+			if _, err := s.roleRepository.UpdateRole(role); err != nil {
+				return nil, err
+			}
+		case path == "members" || path == "":
+			members, err := patchMembers(op)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.applyMembers(principal, role, op.Op, members); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(path, "members[") && strings.EqualFold(op.Op, "remove"):
+			// members[value eq "<id>"]
+			comparisons, err := parseSCIMFilter(strings.TrimSuffix(op.Path[len("members["):], "]"))
+			if err != nil {
+				return nil, err
+			}
+			if err := s.applyMembers(principal, role, "remove", []string{comparisons["value"]}); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, &domain.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidPath", Detail: "unsupported path " + op.Path}
+		}
+	}
+
+	return s.scimGroup(principal, role)
+}
+
+func (s *scimService) DeleteGroup(principal *domain.Principal, id string) error {
+	role, err := s.role(principal, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.roleRepository.DeleteRole(role)
+	return err
+}
+
+func (s *scimService) saveUser(principal *domain.Principal, user *domain.Data, active bool) (*domain.SCIMUser, error) {
+	if err := s.checkUsername(user.Company, user.Branch, user.Username, user.ID); err != nil {
+		return nil, err
+	}
+
+	if err := s.companyRepository.UpdateProfile(user); err != nil {
+		return nil, err
+	}
+
+	if active != (user.DeleteAt == nil) {
+		if err := s.companyRepository.SetActive(user, active); err != nil {
+			return nil, err
+		}
+	}
+
+	// Leavers lose access right away, not when their access token expires
+	if !active {
+		if err := s.tokenService.RevokeUserSessions(user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetUser(principal, user.ID.String())
+}
+
+// checkUsername refuses a username another user of the branch already has,
+// deactivated users included since they can be reactivated.
+func (s *scimService) checkUsername(company, branch, username string, id uuid.UUID) error {
+	users, _, err := s.companyRepository.FindUsers(&domain.UserQuery{Company: company, Branch: branch, Username: username, Limit: 2})
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if user.ID != id {
+			return &domain.SCIMError{Status: http.StatusConflict, ScimType: "uniqueness", Detail: "userName is already taken"}
+		}
+	}
+
+	return nil
+}
+
+// user loads a user of the caller's company, limited to the caller's branch
+// for branch-bound API keys.
+func (s *scimService) user(principal *domain.Principal, id string) (*domain.Data, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, scimNotFound()
+	}
+
+	user, err := s.companyRepository.GetByID(&domain.Data{Company: principal.Company, ID: userID})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, scimNotFound()
+		}
+		return nil, err
+	}
+
+	if branch := scimBranch(principal); branch != "" && user.Branch != branch {
+		return nil, scimNotFound()
+	}
+
+	return user, nil
+}
+
+func (s *scimService) role(principal *domain.Principal, id string) (*domain.CustomRole, error) {
+	roleID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, scimNotFound()
+	}
+
+	role, err := s.roleRepository.GetRole(&domain.CustomRole{ID: roleID, Company: principal.Company})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, scimNotFound()
+		}
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (s *scimService) branch(principal *domain.Principal, tenant *domain.SCIMUserTenant) (string, error) {
+	if branch := scimBranch(principal); branch != "" {
+		if tenant != nil && tenant.Branch != "" && tenant.Branch != branch {
+			return "", &domain.SCIMError{Status: http.StatusForbidden, Detail: "limited to branch " + branch}
+		}
+		return branch, nil
+	}
+
+	if tenant == nil || tenant.Branch == "" {
+		return "", scimInvalidValue("the branch is required in the " + domain.SCIMSchemaUserTenant + " extension")
+	}
+
+	return strings.ToLower(tenant.Branch), nil
+}
+
+func (s *scimService) applyMembers(principal *domain.Principal, role *domain.CustomRole, op string, members []string) error {
+	switch strings.ToLower(op) {
+	case "add":
+		for _, member := range members {
+			if err := s.addMember(principal, role, member); err != nil {
+				return err
+			}
+		}
+	case "remove", "replace":
+		current, err := s.roleRepository.GetRoleMembers(role)
+		if err != nil {
+			return err
+		}
+		for _, m := range current {
+			keep := containsString(members, m.UserID.String())
+			if strings.EqualFold(op, "remove") {
+				keep = !keep
+			}
+			if !keep {
+				if err := s.roleRepository.UnassignRole(&m); err != nil {
+					return err
+				}
+			}
+		}
+		if strings.EqualFold(op, "replace") {
+			return s.applyMembers(principal, role, "add", members)
+		}
+	default:
+		return scimInvalidValue("unsupported operation " + op)
+	}
+
+	return nil
+}
+
+func (s *scimService) addMember(principal *domain.Principal, role *domain.CustomRole, id string) error {
+	// Same rule as the roles API, callers cannot hand out more than they hold
+	for _, perm := range role.Permissions {
+		if !domain.HasPermission(principal.Permissions, perm) {
+			return &domain.SCIMError{Status: http.StatusForbidden, Detail: domain.ErrPermissionEscalated.Error()}
+		}
+	}
+
+	user, err := s.user(principal, id)
+	if err != nil {
+		return err
+	}
+
+	return s.roleRepository.AssignRole(&domain.RoleAssignment{
+		UserID:  user.ID,
+		RoleID:  role.ID,
+		Company: user.Company,
+		Branch:  user.Branch,
+	})
+}
+
+func (s *scimService) scimUser(user *domain.Data) *domain.SCIMUser {
+	active := user.DeleteAt == nil
+	res := &domain.SCIMUser{
+		Schemas:  []string{domain.SCIMSchemaUser, domain.SCIMSchemaUserTenant},
+		ID:       user.ID.String(),
+		UserName: user.Username,
+		Name:     &domain.SCIMName{GivenName: user.FirstName, FamilyName: user.LastName},
+		Active:   &active,
+		Tenant:   &domain.SCIMUserTenant{Branch: user.Branch, Role: user.Role},
+		Meta: &domain.SCIMMeta{
+			ResourceType: "User",
+			Created:      user.CreateAt,
+			LastModified: user.UpdateAt,
+			Location:     s.baseURL + "/scim/v2/Users/" + user.ID.String(),
+		},
+	}
+	if user.Email != "" {
+		res.Emails = []domain.SCIMEmail{{Value: user.Email, Type: "work", Primary: true}}
+	}
+
+	return res
+}
+
+func (s *scimService) scimGroup(principal *domain.Principal, role *domain.CustomRole) (*domain.SCIMGroup, error) {
+	members, err := s.roleRepository.GetRoleMembers(role)
+	if err != nil {
+		return nil, err
+	}
+
+	group := &domain.SCIMGroup{
+		Schemas:     []string{domain.SCIMSchemaGroup},
+		ID:          role.ID.String(),
+		DisplayName: role.Name,
+		Members:     []domain.SCIMMember{},
+		Meta: &domain.SCIMMeta{
+			ResourceType: "Group",
+			Created:      role.CreateAt,
+			LastModified: role.UpdateAt,
+			Location:     s.baseURL + "/scim/v2/Groups/" + role.ID.String(),
+		},
+	}
+
+	branch := scimBranch(principal)
+	for _, m := range members {
+		if branch != "" && m.Branch != branch {
+			continue
+		}
+		group.Members = append(group.Members, domain.SCIMMember{Value: m.UserID.String()})
+	}
+
+	return group, nil
+}
+
+// scimBranch returns the branch the caller is limited to, or "" when it may
+// provision users anywhere in its company.
+func scimBranch(principal *domain.Principal) string {
+	if domain.HasPermission(principal.Permissions, domain.PermBranchesManage) {
+		return ""
+	}
+	return principal.Branch
+}
+
+func patchUser(user *domain.Data, active *bool, op domain.SCIMPatchOp) error {
+	kind := strings.ToLower(op.Op)
+	if kind != "add" && kind != "replace" && kind != "remove" {
+		return scimInvalidValue("unsupported operation " + op.Op)
+	}
+
+	// Without a path the value is an object of attributes to set
+	if op.Path == "" {
+		if kind == "remove" {
+			return &domain.SCIMError{Status: http.StatusBadRequest, ScimType: "noTarget", Detail: "remove requires a path"}
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return scimInvalidValue("value must be an object when no path is given")
+		}
+		for path, value := range values {
+			if err := patchUser(user, active, domain.SCIMPatchOp{Op: op.Op, Path: path, Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	path := strings.ToLower(op.Path)
+	switch {
+	case path == "active":
+		if kind == "remove" {
+			return scimInvalidValue("active cannot be removed")
+		}
+		value, err := scimBool(op.Value)
+		if err != nil {
+			return err
+		}
+		*active = value
+	case path == "username":
+		if kind == "remove" {
+			return scimInvalidValue("userName cannot be removed")
+		}
+		return unmarshalString(op.Value, &user.Username)
+	case path == "name.givenname":
+		if kind == "remove" {
+			user.FirstName = ""
+			return nil
+		}
+		return unmarshalString(op.Value, &user.FirstName)
+	case path == "name.familyname":
+		if kind == "remove" {
+			user.LastName = ""
+			return nil
+		}
+		return unmarshalString(op.Value, &user.LastName)
+	case path == "name":
+		var name domain.SCIMName
+		if kind != "remove" {
+			if err := json.Unmarshal(op.Value, &name); err != nil {
+				return scimInvalidValue("name must be an object")
+			}
+		}
+		user.FirstName, user.LastName = name.GivenName, name.FamilyName
+	case path == "emails":
+		if kind == "remove" {
+			user.Email = ""
+			return nil
+		}
+		var emails []domain.SCIMEmail
+		if err := json.Unmarshal(op.Value, &emails); err != nil {
+			return scimInvalidValue("emails must be an array")
+		}
+		user.Email = primaryEmail(emails)
+	case strings.HasPrefix(path, "emails[") && strings.HasSuffix(path, "].value"):
+		// emails[type eq "work"].value, only one address is kept
+		if kind == "remove" {
+			user.Email = ""
+			return nil
+		}
+		return unmarshalString(op.Value, &user.Email)
+	case strings.HasPrefix(path, strings.ToLower(domain.SCIMSchemaUserTenant)):
+		return &domain.SCIMError{Status: http.StatusBadRequest, ScimType: "mutability", Detail: "branch and role cannot be changed through SCIM"}
+	default:
+		return &domain.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidPath", Detail: "unsupported path " + op.Path}
+	}
+
+	return nil
+}
+
+// patchMembers reads the member ids of a members operation.
+func patchMembers(op domain.SCIMPatchOp) ([]string, error) {
+	raw := op.Value
+	if op.Path == "" {
+		var values struct {
+			Members json.RawMessage `json:"members"`
+		}
+		if err := json.Unmarshal(op.Value, &values); err != nil || values.Members == nil {
+			return nil, scimInvalidValue("value must contain members")
+		}
+		raw = values.Members
+	}
+
+	var members []domain.SCIMMember
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return nil, scimInvalidValue("members must be an array")
+	}
+
+	ids := []string{}
+	for _, m := range members {
+		ids = append(ids, m.Value)
+	}
+	return ids, nil
+}
+
+// parseSCIMFilter parses `attr eq "value" and attr eq value ...` into a map
+// keyed by the lowercased attribute name.
+func parseSCIMFilter(filter string) (map[string]string, error) {
+	comparisons := map[string]string{}
+	rest := strings.TrimSpace(filter)
+
+	for rest != "" {
+		fields := strings.SplitN(rest, " ", 3)
+		if len(fields) != 3 || !strings.EqualFold(fields[1], "eq") {
+			return nil, scimInvalidFilter("only eq comparisons joined with and are supported")
+		}
+
+		attr := strings.ToLower(fields[0])
+		value := strings.TrimSpace(fields[2])
+
+		if strings.HasPrefix(value, `"`) {
+			end := 1
+			for end < len(value) && (value[end] != '"' || value[end-1] == '\\') {
+				end++
+			}
+			if end >= len(value) {
+				return nil, scimInvalidFilter("unterminated string")
+			}
+			var unquoted string
+			if err := json.Unmarshal([]byte(value[:end+1]), &unquoted); err != nil {
+				return nil, scimInvalidFilter("invalid string")
+			}
+			comparisons[attr] = unquoted
+			rest = strings.TrimSpace(value[end+1:])
+		} else {
+			token, remaining, _ := strings.Cut(value, " ")
+			comparisons[attr] = token
+			rest = strings.TrimSpace(remaining)
+		}
+
+		if rest == "" {
+			break
+		}
+
+		conjunction, remaining, _ := strings.Cut(rest, " ")
+		if !strings.EqualFold(conjunction, "and") {
+			return nil, scimInvalidFilter("only eq comparisons joined with and are supported")
+		}
+		rest = strings.TrimSpace(remaining)
+	}
+
+	return comparisons, nil
+}
+
+func scimPage(data *domain.SCIMListInput) (int, int) {
+	startIndex := data.StartIndex
+	if startIndex < 1 {
+		startIndex = 1
+	}
+
+	count := data.Count
+	if count <= 0 {
+		count = scimDefaultCount
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+
+	return startIndex, count
+}
+
+func emptySCIMList() *domain.SCIMListResponse {
+	return &domain.SCIMListResponse{
+		Schemas:    []string{domain.SCIMSchemaListResponse},
+		StartIndex: 1,
+		Resources:  []*domain.SCIMUser{},
+	}
+}
+
+func primaryEmail(emails []domain.SCIMEmail) string {
+	for _, email := range emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
+
+// scimBool accepts booleans and, as some providers send them, "True"/"False" strings.
+func scimBool(raw json.RawMessage) (bool, error) {
+	var value bool
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value, nil
+	}
+
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		if value, err := strconv.ParseBool(str); err == nil {
+			return value, nil
+		}
+	}
+
+	return false, scimInvalidValue("active must be a boolean")
+}
+
+func unmarshalString(raw json.RawMessage, target *string) error {
+	if err := json.Unmarshal(raw, target); err != nil {
+		return scimInvalidValue("value must be a string")
+	}
+	return nil
+}
+
+func scimNotFound() error {
+	return &domain.SCIMError{Status: http.StatusNotFound, Detail: "resource not found"}
+}
+
+func scimInvalidFilter(detail string) error {
+	return &domain.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidFilter", Detail: detail}
+}
+
+func scimInvalidValue(detail string) error {
+	return &domain.SCIMError{Status: http.StatusBadRequest, ScimType: "invalidValue", Detail: detail}
+}
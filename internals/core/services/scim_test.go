@@ -0,0 +1,192 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// companyKey is a SCIM client's API key that provisions the whole of acme.
+var companyKey = &domain.Principal{Company: "acme", Branch: "hq", Role: domain.RoleAPIKey, Permissions: []string{domain.PermUsersRead, domain.PermUsersWrite, domain.PermBranchesManage}}
+
+func scimStatus(err error) int {
+	var scimErr *domain.SCIMError
+	if errors.As(err, &scimErr) {
+		return scimErr.Status
+	}
+	return 0
+}
+
+func TestParseSCIMFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   map[string]string
+		bad    bool
+	}{
+		{filter: "", want: map[string]string{}},
+		{filter: `userName eq "alice"`, want: map[string]string{"username": "alice"}},
+		{filter: `userName eq "al ice" and active eq true`, want: map[string]string{"username": "al ice", "active": "true"}},
+		{filter: `emails.value EQ "a\"b@acme.test"`, want: map[string]string{"emails.value": `a"b@acme.test`}},
+		{filter: `userName co "ali"`, bad: true},
+		{filter: `userName eq "alice" or active eq true`, bad: true},
+		{filter: `userName eq "alice`, bad: true},
+		{filter: `userName`, bad: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSCIMFilter(tt.filter)
+		if tt.bad {
+			if scimStatus(err) != http.StatusBadRequest {
+				t.Errorf("parseSCIMFilter(%q) = %v, want invalidFilter", tt.filter, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSCIMFilter(%q) = %v, %v, want %v", tt.filter, got, err, tt.want)
+		}
+	}
+}
+
+func TestSCIMCreateUser(t *testing.T) {
+	users := newFakeCompanyRepository()
+	s := NewSCIMService(users, nil, nil, newTestHasher(t), allowAll{}, "https://id.acme.test/")
+
+	inactive := false
+	created, err := s.CreateUser(companyKey, &domain.SCIMUser{
+		UserName: "alice",
+		Emails:   []domain.SCIMEmail{{Value: "old@acme.test"}, {Value: "alice@acme.test", Primary: true}},
+		Active:   &inactive,
+		Tenant:   &domain.SCIMUserTenant{Branch: "East"},
+	})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if created.Tenant.Branch != "east" || created.Tenant.Role != domain.RoleUser || *created.Active {
+		t.Errorf("created %+v in %+v", created, created.Tenant)
+	}
+	if created.Emails[0].Value != "alice@acme.test" {
+		t.Errorf("email = %s, want the primary one", created.Emails[0].Value)
+	}
+	if created.Meta.Location != "https://id.acme.test/scim/v2/Users/"+created.ID {
+		t.Errorf("location = %s", created.Meta.Location)
+	}
+	for _, user := range users.users {
+		if user.Password != domain.FederatedPassword {
+			t.Error("user without a password can log in with one")
+		}
+	}
+
+	tests := []struct {
+		name string
+		user *domain.SCIMUser
+		want int
+	}{
+		{name: "taken", user: &domain.SCIMUser{UserName: "alice", Tenant: &domain.SCIMUserTenant{Branch: "east"}}, want: http.StatusConflict},
+		{name: "no userName", user: &domain.SCIMUser{Tenant: &domain.SCIMUserTenant{Branch: "east"}}, want: http.StatusBadRequest},
+		{name: "no branch", user: &domain.SCIMUser{UserName: "bob"}, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if _, err := s.CreateUser(companyKey, tt.user); scimStatus(err) != tt.want {
+			t.Errorf("%s: err = %v, want %d", tt.name, err, tt.want)
+		}
+	}
+
+	// Keys bound to a branch provision into it and nowhere else
+	if _, err := s.CreateUser(branchAdmin, &domain.SCIMUser{UserName: "bob", Tenant: &domain.SCIMUserTenant{Branch: "east"}}); scimStatus(err) != http.StatusForbidden {
+		t.Errorf("branch key into another branch: err = %v, want 403", err)
+	}
+	bob, err := s.CreateUser(branchAdmin, &domain.SCIMUser{UserName: "bob"})
+	if err != nil || bob.Tenant.Branch != "hq" {
+		t.Errorf("branch key without a branch: %v, %v", bob, err)
+	}
+}
+
+func TestSCIMPatchUser(t *testing.T) {
+	alice := newUser("acme", "hq", "alice", domain.RoleUser)
+	sessions := &revokingTokenService{}
+	s := NewSCIMService(newFakeCompanyRepository(alice), nil, sessions, nil, allowAll{}, "https://id.acme.test")
+
+	patch := func(ops ...domain.SCIMPatchOp) (*domain.SCIMUser, error) {
+		return s.PatchUser(companyKey, alice.ID.String(), &domain.SCIMPatch{Operations: ops})
+	}
+	raw := func(v string) json.RawMessage { return json.RawMessage(v) }
+
+	user, err := patch(
+		domain.SCIMPatchOp{Op: "replace", Path: "name.givenName", Value: raw(`"Alice"`)},
+		domain.SCIMPatchOp{Op: "Replace", Value: raw(`{"emails": [{"value": "alice@acme.test"}]}`)},
+	)
+	if err != nil {
+		t.Fatalf("PatchUser: %v", err)
+	}
+	if user.Name.GivenName != "Alice" || user.Emails[0].Value != "alice@acme.test" || !*user.Active {
+		t.Errorf("patched to %+v", user)
+	}
+	if len(sessions.revoked) != 0 {
+		t.Error("sessions revoked for an active user")
+	}
+
+	// Providers send booleans as strings too
+	user, err = patch(domain.SCIMPatchOp{Op: "replace", Path: "active", Value: raw(`"False"`)})
+	if err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+	if *user.Active {
+		t.Error("user is still active")
+	}
+	if len(sessions.revoked) != 1 || sessions.revoked[0] != alice.ID {
+		t.Errorf("revoked %v, want the deactivated user's sessions", sessions.revoked)
+	}
+
+	refused := []domain.SCIMPatchOp{
+		{Op: "replace", Path: domain.SCIMSchemaUserTenant + ":role", Value: raw(`"head_admin"`)},
+		{Op: "remove", Path: "userName"},
+		{Op: "move", Path: "userName", Value: raw(`"x"`)},
+		{Op: "replace", Path: "nickName", Value: raw(`"x"`)},
+	}
+	for _, op := range refused {
+		if _, err := patch(op); scimStatus(err) != http.StatusBadRequest {
+			t.Errorf("%s %s: err = %v, want 400", op.Op, op.Path, err)
+		}
+	}
+	if alice.Role != domain.RoleUser {
+		t.Errorf("role changed to %s through SCIM", alice.Role)
+	}
+}
+
+func TestSCIMGroupMembers(t *testing.T) {
+	alice := newUser("acme", "hq", "alice", domain.RoleUser)
+	roles := newFakeRoleRepository()
+	auditors, _ := roles.CreateRole(&domain.CustomRole{Company: "acme", Name: "auditors", Permissions: []string{domain.PermUsersRead}})
+	managers, _ := roles.CreateRole(&domain.CustomRole{Company: "acme", Name: "managers", Permissions: []string{domain.PermRolesManage}})
+	s := NewSCIMService(newFakeCompanyRepository(alice), roles, nil, nil, allowAll{}, "https://id.acme.test")
+
+	add := &domain.SCIMPatch{Operations: []domain.SCIMPatchOp{{Op: "add", Path: "members", Value: json.RawMessage(`[{"value": "` + alice.ID.String() + `"}]`)}}}
+
+	group, err := s.PatchGroup(companyKey, auditors.ID.String(), add)
+	if err != nil {
+		t.Fatalf("PatchGroup: %v", err)
+	}
+	if len(group.Members) != 1 || group.Members[0].Value != alice.ID.String() {
+		t.Errorf("members = %v", group.Members)
+	}
+
+	// The key does not hold roles:manage, so it cannot hand it out either
+	if _, err := s.PatchGroup(companyKey, managers.ID.String(), add); scimStatus(err) != http.StatusForbidden {
+		t.Errorf("escalating membership: err = %v, want 403", err)
+	}
+
+	remove := &domain.SCIMPatch{Operations: []domain.SCIMPatchOp{{Op: "remove", Path: `members[value eq "` + alice.ID.String() + `"]`}}}
+	if group, err = s.PatchGroup(companyKey, auditors.ID.String(), remove); err != nil || len(group.Members) != 0 {
+		t.Errorf("after remove: %v, %v", group, err)
+	}
+
+	if _, err := s.CreateGroup(companyKey, &domain.SCIMGroup{DisplayName: "Head_Admin"}); scimStatus(err) != http.StatusBadRequest {
+		t.Errorf("group named after a built-in role: err = %v, want 400", err)
+	}
+	if _, err := s.CreateGroup(companyKey, &domain.SCIMGroup{DisplayName: "Auditors"}); scimStatus(err) != http.StatusConflict {
+		t.Errorf("duplicate group: err = %v, want 409", err)
+	}
+}
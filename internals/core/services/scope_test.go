@@ -0,0 +1,274 @@
+package services
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSessionsInTenantScope(t *testing.T) {
+	alice := newUser("acme", "hq", "alice", domain.RoleUser)
+	bob := newUser("acme", "east", "bob", domain.RoleUser)
+	carol := newUser("globex", "hq", "carol", domain.RoleUser)
+
+	tests := []struct {
+		name      string
+		principal *domain.Principal
+		target    *domain.Data
+		want      error
+	}{
+		{name: "branch admin in own branch", principal: branchAdmin, target: alice},
+		{name: "branch admin in sibling branch", principal: branchAdmin, target: bob, want: domain.ErrOutOfTenantScope},
+		{name: "branch admin in other company", principal: branchAdmin, target: carol, want: domain.ErrUserNotFound},
+		{name: "company admin in sibling branch", principal: companyAdmin, target: bob},
+		{name: "company admin in other company", principal: companyAdmin, target: carol, want: domain.ErrUserNotFound},
+		{name: "other company admin", principal: globexAdmin, target: alice, want: domain.ErrUserNotFound},
+		{name: "super admin in sibling branch", principal: superAdmin, target: bob},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, tokens, _ := newTestTokenService(newFakeCompanyRepository(alice, bob, carol))
+			session, err := tokens.CreateSession(&domain.Session{UserID: tt.target.ID, Company: tt.target.Company, Branch: tt.target.Branch})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.ListSessions(tt.principal, tt.target.ID); !errors.Is(err, tt.want) {
+				t.Errorf("ListSessions: err = %v, want %v", err, tt.want)
+			}
+
+			err = s.RevokeSession(tt.principal, tt.target.ID, session.ID)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("RevokeSession: err = %v, want %v", err, tt.want)
+			}
+			if revoked := tokens.sessions[session.ID].RevokedAt != nil; revoked != (tt.want == nil) {
+				t.Errorf("session revoked = %v", revoked)
+			}
+		})
+	}
+}
+
+func TestRevokeSessionOfAnotherUser(t *testing.T) {
+	alice := newUser("acme", "hq", "alice", domain.RoleUser)
+	bob := newUser("acme", "hq", "bob", domain.RoleUser)
+	s, tokens, _ := newTestTokenService(newFakeCompanyRepository(alice, bob))
+
+	session, err := tokens.CreateSession(&domain.Session{UserID: bob.ID, Company: "acme", Branch: "hq"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Alice passes the owner check for herself but names Bob's session
+	self := &domain.Principal{UserID: alice.ID, Company: "acme", Branch: "hq", Role: domain.RoleUser}
+	if err := s.RevokeSession(self, alice.ID, session.ID); !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("err = %v, want ErrSessionNotFound", err)
+	}
+	if tokens.sessions[session.ID].RevokedAt != nil {
+		t.Error("another user's session was revoked")
+	}
+}
+
+func TestAPIKeysInTenantScope(t *testing.T) {
+	hqKey := &domain.APIKey{ID: uuid.New(), Company: "acme", Branch: "hq", Name: "hq"}
+	eastKey := &domain.APIKey{ID: uuid.New(), Company: "acme", Branch: "east", Name: "east"}
+	companyKey := &domain.APIKey{ID: uuid.New(), Company: "acme", Name: "company"}
+	globexKey := &domain.APIKey{ID: uuid.New(), Company: "globex", Branch: "hq", Name: "globex"}
+
+	listTests := []struct {
+		principal *domain.Principal
+		want      []string
+	}{
+		{principal: branchAdmin, want: []string{"hq"}},
+		{principal: companyAdmin, want: []string{"company", "east", "hq"}},
+		{principal: superAdmin, want: []string{"company", "east", "hq"}},
+		{principal: globexAdmin, want: []string{"globex"}},
+	}
+	for _, tt := range listTests {
+		s := NewAPIKeyService(newFakeAPIKeyRepository(hqKey, eastKey, companyKey, globexKey))
+		keys, err := s.ListAPIKeys(tt.principal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, key := range keys {
+			names = append(names, key.Name)
+		}
+		sort.Strings(names)
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s of %s sees %v, want %v", tt.principal.Role, tt.principal.Company, names, tt.want)
+		}
+	}
+
+	createTests := []struct {
+		name      string
+		principal *domain.Principal
+		branch    string
+		want      error
+	}{
+		{name: "branch admin for own branch", principal: branchAdmin, branch: "hq"},
+		{name: "branch admin for sibling branch", principal: branchAdmin, branch: "east", want: domain.ErrOutOfTenantScope},
+		{name: "branch admin for whole company", principal: branchAdmin, branch: "", want: domain.ErrOutOfTenantScope},
+		{name: "company admin for sibling branch", principal: companyAdmin, branch: "east"},
+		{name: "company admin for whole company", principal: companyAdmin, branch: ""},
+	}
+	for _, tt := range createTests {
+		t.Run("create/"+tt.name, func(t *testing.T) {
+			s := NewAPIKeyService(newFakeAPIKeyRepository())
+			_, err := s.CreateAPIKey(tt.principal, &domain.APIKeyInput{Name: "ci", Branch: tt.branch})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	revokeTests := []struct {
+		name      string
+		principal *domain.Principal
+		key       *domain.APIKey
+		want      error
+	}{
+		{name: "branch admin on own branch key", principal: branchAdmin, key: hqKey},
+		{name: "branch admin on sibling branch key", principal: branchAdmin, key: eastKey, want: domain.ErrOutOfTenantScope},
+		{name: "branch admin on company key", principal: branchAdmin, key: companyKey, want: domain.ErrOutOfTenantScope},
+		{name: "company admin on sibling branch key", principal: companyAdmin, key: eastKey},
+		{name: "company admin on other company key", principal: companyAdmin, key: globexKey, want: domain.ErrInvalidAPIKey},
+		{name: "other company admin", principal: globexAdmin, key: hqKey, want: domain.ErrInvalidAPIKey},
+	}
+	for _, tt := range revokeTests {
+		t.Run("revoke/"+tt.name, func(t *testing.T) {
+			key := *tt.key
+			repository := newFakeAPIKeyRepository(&key)
+			s := NewAPIKeyService(repository)
+
+			if err := s.RevokeAPIKey(tt.principal, key.ID); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			if revoked := repository.keys[key.ID].RevokedAt != nil; revoked != (tt.want == nil) {
+				t.Errorf("key revoked = %v", revoked)
+			}
+		})
+	}
+}
+
+func TestInvitationsInTenantScope(t *testing.T) {
+	createTests := []struct {
+		name      string
+		principal *domain.Principal
+		company   string
+		branch    string
+		want      error
+	}{
+		{name: "branch admin into own branch", principal: branchAdmin},
+		{name: "branch admin into sibling branch", principal: branchAdmin, branch: "east", want: domain.ErrOutOfTenantScope},
+		{name: "company admin into sibling branch", principal: companyAdmin, branch: "east"},
+		{name: "company admin into other company", principal: companyAdmin, company: "globex", branch: "hq", want: domain.ErrOutOfTenantScope},
+		{name: "super admin into other company", principal: superAdmin, company: "globex", branch: "hq"},
+	}
+
+	for _, tt := range createTests {
+		t.Run("create/"+tt.name, func(t *testing.T) {
+			s := NewInvitationService(newFakeInvitationRepository(), nil, nil, allowAll{}, &fakeTenantStatus{}, &outbox{}, "https://id.acme.test", time.Hour)
+			_, err := s.CreateInvitation(tt.principal, &domain.InvitationInput{Company: tt.company, Branch: tt.branch, Email: "new@acme.test"})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	eastInvitation := &domain.Invitation{ID: uuid.New(), Company: "acme", Branch: "east", Email: "e@acme.test"}
+	globexInvitation := &domain.Invitation{ID: uuid.New(), Company: "globex", Branch: "hq", Email: "g@globex.test"}
+
+	revokeTests := []struct {
+		name       string
+		principal  *domain.Principal
+		invitation *domain.Invitation
+		want       error
+	}{
+		{name: "branch admin in sibling branch", principal: branchAdmin, invitation: eastInvitation, want: domain.ErrInvitationNotFound},
+		{name: "company admin in sibling branch", principal: companyAdmin, invitation: eastInvitation},
+		{name: "company admin in other company", principal: companyAdmin, invitation: globexInvitation, want: domain.ErrInvitationNotFound},
+		{name: "super admin in other company", principal: superAdmin, invitation: globexInvitation},
+	}
+
+	for _, tt := range revokeTests {
+		t.Run("revoke/"+tt.name, func(t *testing.T) {
+			invitation := *tt.invitation
+			repository := newFakeInvitationRepository(&invitation)
+			s := NewInvitationService(repository, nil, nil, allowAll{}, &fakeTenantStatus{}, &outbox{}, "https://id.acme.test", time.Hour)
+
+			if err := s.RevokeInvitation(tt.principal, invitation.ID); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			if revoked := repository.invitations[invitation.ID].RevokedAt != nil; revoked != (tt.want == nil) {
+				t.Errorf("invitation revoked = %v", revoked)
+			}
+		})
+	}
+
+	listTests := []struct {
+		principal *domain.Principal
+		branch    string
+	}{
+		{principal: branchAdmin, branch: "hq"},
+		{principal: companyAdmin, branch: ""},
+	}
+	for _, tt := range listTests {
+		repository := newFakeInvitationRepository()
+		s := NewInvitationService(repository, nil, nil, allowAll{}, &fakeTenantStatus{}, &outbox{}, "https://id.acme.test", time.Hour)
+		if _, err := s.ListInvitations(tt.principal); err != nil {
+			t.Fatal(err)
+		}
+		if got := repository.listed[0]; got.Company != "acme" || got.Branch != tt.branch {
+			t.Errorf("%s lists %s/%q, want acme/%q", tt.principal.Role, got.Company, got.Branch, tt.branch)
+		}
+	}
+}
+
+func TestSCIMUserInTenantScope(t *testing.T) {
+	alice := newUser("acme", "hq", "alice", domain.RoleUser)
+	bob := newUser("acme", "east", "bob", domain.RoleUser)
+	carol := newUser("globex", "hq", "carol", domain.RoleUser)
+	s := NewSCIMService(newFakeCompanyRepository(alice, bob, carol), nil, nil, nil, allowAll{}, "https://id.acme.test")
+
+	// SCIM clients authenticate with API keys, bound to a branch or the whole company
+	branchKey := &domain.Principal{Company: "acme", Branch: "hq", Role: domain.RoleAPIKey, Permissions: []string{domain.PermUsersRead}}
+	companyKey := &domain.Principal{Company: "acme", Branch: "hq", Role: domain.RoleAPIKey, Permissions: []string{domain.PermUsersRead, domain.PermBranchesManage}}
+
+	tests := []struct {
+		name      string
+		principal *domain.Principal
+		target    *domain.Data
+		found     bool
+	}{
+		{name: "branch key in own branch", principal: branchKey, target: alice, found: true},
+		{name: "branch key in sibling branch", principal: branchKey, target: bob},
+		{name: "branch key in other company", principal: branchKey, target: carol},
+		{name: "company key in sibling branch", principal: companyKey, target: bob, found: true},
+		{name: "company key in other company", principal: companyKey, target: carol},
+		{name: "super admin in other company", principal: superAdmin, target: carol},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := s.user(tt.principal, tt.target.ID.String())
+			if tt.found {
+				if err != nil || user.ID != tt.target.ID {
+					t.Errorf("user = %v, %v, want %s", user, err, tt.target.Username)
+				}
+				return
+			}
+
+			var scimErr *domain.SCIMError
+			if !errors.As(err, &scimErr) || scimErr.Status != http.StatusNotFound {
+				t.Errorf("err = %v, want a SCIM 404", err)
+			}
+		})
+	}
+}
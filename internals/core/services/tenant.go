@@ -0,0 +1,130 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"strings"
+	"sync"
+	"time"
+)
+
+type tenantStatusService struct {
+	manageRepository ports.ManageRepository
+	cacheTTL         time.Duration
+
+	mu    sync.Mutex
+	cache map[string]*tenantCacheEntry
+}
+
+// tenantCacheEntry holds the states of one company, keyed by branch with ""
+// for the company itself.
+type tenantCacheEntry struct {
+	statuses map[string]string
+	loadedAt time.Time
+}
+
+// NewTenantStatusService enforces the tenant states. The middleware asks on
+// every request, so states are cached for cacheTTL. SetStatus only clears
+// the cache of the instance that handled it: other instances keep serving
+// the old state for up to cacheTTL, so a suspension is not immediate
+// everywhere when several replicas run.
+func NewTenantStatusService(manageRepository ports.ManageRepository, cacheTTL time.Duration) *tenantStatusService {
+	return &tenantStatusService{
+		manageRepository: manageRepository,
+		cacheTTL:         cacheTTL,
+		cache:            map[string]*tenantCacheEntry{},
+	}
+}
+
+func (s *tenantStatusService) Check(company, branch string, write bool) error {
+	statuses, err := s.statuses(company)
+	if err != nil {
+		return err
+	}
+
+	// Tenants missing from the registry count as active
+	status := domain.TenantActive
+	if own, ok := statuses[""]; ok {
+		status = own
+	}
+	if branch != "" {
+		status = domain.StricterTenantStatus(status, statuses[branch])
+	}
+
+	switch {
+	case status == domain.TenantSuspended:
+		return domain.ErrTenantSuspended
+	case status == domain.TenantReadOnly && write:
+		return domain.ErrTenantReadOnly
+	}
+
+	return nil
+}
+
+func (s *tenantStatusService) SetStatus(data *domain.TenantStatusInput) (*domain.Tenant, error) {
+	if !domain.ValidTenantStatus(data.Status) {
+		return nil, domain.ErrInvalidTenantStatus
+	}
+
+	tenant := &domain.Tenant{
+		Company: strings.ToLower(data.Company),
+		Branch:  strings.ToLower(data.Branch),
+		Status:  data.Status,
+	}
+
+	ok, err := s.manageRepository.SetTenantStatus(tenant)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, domain.ErrTenantNotFound
+	}
+
+	s.forget(tenant.Company)
+
+	res, err := s.manageRepository.GetTenant(tenant)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrTenantNotFound
+		}
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// statuses returns the states of the company and its branches from the
+// cache, loading them when missing or stale.
+func (s *tenantStatusService) statuses(company string) (map[string]string, error) {
+	s.mu.Lock()
+	entry, ok := s.cache[company]
+	s.mu.Unlock()
+
+	if ok && time.Since(entry.loadedAt) < s.cacheTTL {
+		return entry.statuses, nil
+	}
+
+	tenants, err := s.manageRepository.GetCompanyTenants(&domain.Tenant{Company: company})
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := map[string]string{}
+	for _, tenant := range tenants {
+		statuses[tenant.Branch] = tenant.Status
+	}
+
+	s.mu.Lock()
+	s.cache[company] = &tenantCacheEntry{statuses: statuses, loadedAt: time.Now()}
+	s.mu.Unlock()
+
+	return statuses, nil
+}
+
+func (s *tenantStatusService) forget(company string) {
+	s.mu.Lock()
+	delete(s.cache, company)
+	s.mu.Unlock()
+}
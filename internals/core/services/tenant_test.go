@@ -0,0 +1,105 @@
+package services
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"testing"
+	"time"
+)
+
+func TestTenantStatusCheck(t *testing.T) {
+	repo := newFakeManageRepository("acme/", "acme/hq", "acme/east")
+	repo.tenants["acme/east"] = domain.TenantReadOnly
+	s := NewTenantStatusService(repo, time.Hour)
+
+	tests := []struct {
+		company, branch string
+		write           bool
+		want            error
+	}{
+		{company: "acme", branch: "hq", write: true},
+		{company: "acme", branch: "east"},
+		{company: "acme", branch: "east", write: true, want: domain.ErrTenantReadOnly},
+		{company: "acme", write: true},
+		{company: "globex", branch: "hq", write: true}, // missing from the registry
+	}
+	for _, tt := range tests {
+		if err := s.Check(tt.company, tt.branch, tt.write); !errors.Is(err, tt.want) {
+			t.Errorf("Check(%s, %s, %v) = %v, want %v", tt.company, tt.branch, tt.write, err, tt.want)
+		}
+	}
+
+	// A suspended company takes its active branches with it
+	repo.tenants["acme/"] = domain.TenantSuspended
+	s = NewTenantStatusService(repo, time.Hour)
+	if err := s.Check("acme", "hq", false); !errors.Is(err, domain.ErrTenantSuspended) {
+		t.Errorf("branch of a suspended company = %v, want %v", err, domain.ErrTenantSuspended)
+	}
+}
+
+func TestTenantStatusCache(t *testing.T) {
+	repo := newFakeManageRepository("acme/", "acme/hq")
+	s := NewTenantStatusService(repo, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if err := s.Check("acme", "hq", true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if repo.loads != 1 {
+		t.Fatalf("loaded %d times for three checks, want 1", repo.loads)
+	}
+
+	// Changed behind the service's back, as another instance would: the
+	// cached state is served until it expires
+	repo.tenants["acme/hq"] = domain.TenantSuspended
+	if err := s.Check("acme", "hq", true); err != nil {
+		t.Errorf("Check before expiry = %v, want the cached state", err)
+	}
+
+	// Changed through the service: applies at once
+	if _, err := s.SetStatus(&domain.TenantStatusInput{Company: "ACME", Branch: "hq", Status: domain.TenantReadOnly}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Check("acme", "hq", true); !errors.Is(err, domain.ErrTenantReadOnly) {
+		t.Errorf("Check after SetStatus = %v, want %v", err, domain.ErrTenantReadOnly)
+	}
+	if repo.loads != 2 {
+		t.Errorf("loaded %d times, want a reload after SetStatus", repo.loads)
+	}
+}
+
+func TestTenantStatusCacheExpires(t *testing.T) {
+	repo := newFakeManageRepository("acme/", "acme/hq")
+	s := NewTenantStatusService(repo, time.Millisecond)
+
+	if err := s.Check("acme", "hq", false); err != nil {
+		t.Fatal(err)
+	}
+	repo.tenants["acme/hq"] = domain.TenantSuspended
+	time.Sleep(5 * time.Millisecond)
+
+	if err := s.Check("acme", "hq", false); !errors.Is(err, domain.ErrTenantSuspended) {
+		t.Errorf("Check after expiry = %v, want %v", err, domain.ErrTenantSuspended)
+	}
+}
+
+func TestSetTenantStatus(t *testing.T) {
+	repo := newFakeManageRepository("acme/")
+	s := NewTenantStatusService(repo, time.Hour)
+
+	if _, err := s.SetStatus(&domain.TenantStatusInput{Company: "acme", Status: "frozen"}); !errors.Is(err, domain.ErrInvalidTenantStatus) {
+		t.Errorf("unknown status = %v, want %v", err, domain.ErrInvalidTenantStatus)
+	}
+	if _, err := s.SetStatus(&domain.TenantStatusInput{Company: "globex", Status: domain.TenantSuspended}); !errors.Is(err, domain.ErrTenantNotFound) {
+		t.Errorf("unknown tenant = %v, want %v", err, domain.ErrTenantNotFound)
+	}
+
+	tenant, err := s.SetStatus(&domain.TenantStatusInput{Company: "acme", Status: domain.TenantSuspended})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant.Status != domain.TenantSuspended {
+		t.Errorf("status = %s, want %s", tenant.Status, domain.TenantSuspended)
+	}
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"strings"
+	"time"
+)
+
+// LoginThrottleConfig controls how failed logins slow down further attempts.
+type LoginThrottleConfig struct {
+	MaxAttempts   int           // failures per account before it is locked out
+	IPMaxAttempts int           // failures per client address before it is locked out
+	FreeAttempts  int           // failures per account allowed before backoff starts
+	BackoffBase   time.Duration // delay after the first failure past the free ones, doubled for every further failure
+	BackoffMax    time.Duration
+	Lockout       time.Duration
+	Window        time.Duration // failures older than this are forgotten
+}
+
+type loginThrottle struct {
+	loginAttemptRepository ports.LoginAttemptRepository
+	config                 LoginThrottleConfig
+}
+
+type throttleKey struct {
+	key  string
+	free int
+	max  int
+}
+
+func NewLoginThrottle(loginAttemptRepository ports.LoginAttemptRepository, config LoginThrottleConfig) *loginThrottle {
+	return &loginThrottle{
+		loginAttemptRepository: loginAttemptRepository,
+		config:                 config,
+	}
+}
+
+// Check returns a LockoutError while the account or the client address has
+// to wait before trying again.
+func (t *loginThrottle) Check(login *domain.LoginInput) error {
+	for _, key := range t.keys(login) {
+		attempt, err := t.loginAttemptRepository.GetAttempt(&domain.LoginAttempt{Key: key.key})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return err
+		}
+
+		if attempt.LockedFor > 0 {
+			return &domain.LockoutError{RetryAfter: time.Duration(attempt.LockedFor) * time.Second}
+		}
+	}
+
+	return nil
+}
+
+// Fail records a failed attempt and locks the account and address for an
+// exponentially growing delay, or for the full lockout once the threshold is hit.
+func (t *loginThrottle) Fail(login *domain.LoginInput) error {
+	for _, key := range t.keys(login) {
+		attempt, err := t.loginAttemptRepository.RecordFailure(&domain.LoginAttempt{Key: key.key}, int(t.config.Window.Seconds()))
+		if err != nil {
+			return err
+		}
+
+		delay := t.delay(attempt.Failures, key)
+		if delay <= 0 {
+			continue
+		}
+
+		if err := t.loginAttemptRepository.Lock(attempt, int((delay+time.Second-1)/time.Second)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Succeed clears the account counter. The address counter is kept so one
+// valid account cannot be used to reset the limit while guessing others.
+func (t *loginThrottle) Succeed(login *domain.LoginInput) error {
+	return t.loginAttemptRepository.ResetAttempts(&domain.LoginAttempt{Key: accountKey(login.Company, login.Branch, login.Username)})
+}
+
+func (t *loginThrottle) Unlock(data *domain.UnlockInput) error {
+	if data.Username == "" && data.IP == "" {
+		return errors.New("username or ip is required")
+	}
+
+	if data.Username != "" {
+		if data.Company == "" || data.Branch == "" {
+			return errors.New("company and branch are required")
+		}
+		err := t.loginAttemptRepository.ResetAttempts(&domain.LoginAttempt{Key: accountKey(data.Company, data.Branch, data.Username)})
+		if err != nil {
+			return err
+		}
+	}
+
+	if data.IP != "" {
+		err := t.loginAttemptRepository.ResetAttempts(&domain.LoginAttempt{Key: ipKey(data.IP)})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *loginThrottle) keys(login *domain.LoginInput) []throttleKey {
+	keys := []throttleKey{{
+		key:  accountKey(login.Company, login.Branch, login.Username),
+		free: t.config.FreeAttempts,
+		max:  t.config.MaxAttempts,
+	}}
+
+	// Many users can share an address behind NAT, so it gets a larger allowance
+	if login.IP != "" {
+		keys = append(keys, throttleKey{
+			key:  ipKey(login.IP),
+			free: t.config.IPMaxAttempts / 2,
+			max:  t.config.IPMaxAttempts,
+		})
+	}
+
+	return keys
+}
+
+func (t *loginThrottle) delay(failures int, key throttleKey) time.Duration {
+	if key.max > 0 && failures >= key.max {
+		return t.config.Lockout
+	}
+
+	if failures <= key.free || t.config.BackoffBase <= 0 {
+		return 0
+	}
+
+	delay := t.config.BackoffBase
+	for i := key.free + 1; i < failures && delay < t.config.BackoffMax; i++ {
+		delay *= 2
+	}
+
+	if t.config.BackoffMax > 0 && delay > t.config.BackoffMax {
+		delay = t.config.BackoffMax
+	}
+
+	return delay
+}
+
+// accountKey does not depend on whether the account exists, so unknown
+// usernames are throttled exactly like real ones.
+func accountKey(company, branch, username string) string {
+	return "account:" + strings.ToLower(company) + "/" + strings.ToLower(branch) + "/" + strings.ToLower(username)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLoginAttemptRepository keeps the counters in memory. Like the
+// database it forgets failures older than the window.
+type fakeLoginAttemptRepository struct {
+	mu       sync.Mutex
+	attempts map[string]*domain.LoginAttempt
+}
+
+func newFakeLoginAttemptRepository() *fakeLoginAttemptRepository {
+	return &fakeLoginAttemptRepository{attempts: map[string]*domain.LoginAttempt{}}
+}
+
+func (r *fakeLoginAttemptRepository) GetAttempt(data *domain.LoginAttempt) (*domain.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt, ok := r.attempts[data.Key]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	found := *attempt
+	if found.LockedUntil != nil && time.Now().Before(*found.LockedUntil) {
+		found.LockedFor = int(time.Until(*found.LockedUntil).Seconds()) + 1
+	}
+	return &found, nil
+}
+
+func (r *fakeLoginAttemptRepository) RecordFailure(data *domain.LoginAttempt, windowSeconds int) (*domain.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt, ok := r.attempts[data.Key]
+	if !ok || time.Since(attempt.LastFailureAt) > time.Duration(windowSeconds)*time.Second {
+		attempt = &domain.LoginAttempt{Key: data.Key}
+		r.attempts[data.Key] = attempt
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = time.Now()
+	found := *attempt
+	return &found, nil
+}
+
+func (r *fakeLoginAttemptRepository) Lock(data *domain.LoginAttempt, seconds int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	until := time.Now().Add(time.Duration(seconds) * time.Second)
+	r.attempts[data.Key].LockedUntil = &until
+	return nil
+}
+
+func (r *fakeLoginAttemptRepository) ResetAttempts(data *domain.LoginAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.attempts, data.Key)
+	return nil
+}
+
+// expire ends every lock, as if the client waited long enough.
+func (r *fakeLoginAttemptRepository) expire() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, attempt := range r.attempts {
+		attempt.LockedUntil = nil
+	}
+}
+
+var testThrottleConfig = LoginThrottleConfig{
+	MaxAttempts:   5,
+	IPMaxAttempts: 8,
+	FreeAttempts:  2,
+	BackoffBase:   time.Second,
+	BackoffMax:    4 * time.Second,
+	Lockout:       15 * time.Minute,
+	Window:        time.Hour,
+}
+
+func aliceLogin(ip string) *domain.LoginInput {
+	return &domain.LoginInput{Company: "acme", Branch: "hq", Username: "alice", IP: ip}
+}
+
+func lockedFor(t *testing.T, err error) time.Duration {
+	t.Helper()
+
+	var lockout *domain.LockoutError
+	if !errors.As(err, &lockout) {
+		t.Fatalf("err = %v, want a LockoutError", err)
+	}
+	return lockout.RetryAfter
+}
+
+func TestThrottleDelay(t *testing.T) {
+	throttle := NewLoginThrottle(nil, testThrottleConfig)
+	account := throttle.keys(aliceLogin(""))[0]
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 1, want: 0},
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Second},
+		{failures: 4, want: 2 * time.Second},
+		{failures: 5, want: 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := throttle.delay(tt.failures, account); got != tt.want {
+			t.Errorf("delay after %d failures = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+
+	// Without a hard limit the backoff stops growing at BackoffMax
+	unlimited := throttleKey{key: account.key, free: 2}
+	if got := throttle.delay(20, unlimited); got != 4*time.Second {
+		t.Errorf("delay after 20 failures = %s, want BackoffMax", got)
+	}
+}
+
+func TestThrottleBacksOffAndLocksAccount(t *testing.T) {
+	attempts := newFakeLoginAttemptRepository()
+	throttle := NewLoginThrottle(attempts, testThrottleConfig)
+	login := aliceLogin("")
+
+	for i := 1; i <= 2; i++ {
+		if err := throttle.Fail(login); err != nil {
+			t.Fatal(err)
+		}
+		if err := throttle.Check(login); err != nil {
+			t.Fatalf("free failure %d: Check = %v", i, err)
+		}
+	}
+
+	if err := throttle.Fail(login); err != nil {
+		t.Fatal(err)
+	}
+	if wait := lockedFor(t, throttle.Check(login)); wait > 2*time.Second {
+		t.Errorf("first backoff = %s, want about BackoffBase", wait)
+	}
+
+	attempts.expire()
+	for i := 0; i < 2; i++ {
+		if err := throttle.Fail(login); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if wait := lockedFor(t, throttle.Check(login)); wait < 14*time.Minute {
+		t.Errorf("lockout = %s, want the full lockout", wait)
+	}
+
+	// Other accounts are not affected
+	if err := throttle.Check(&domain.LoginInput{Company: "acme", Branch: "hq", Username: "bob"}); err != nil {
+		t.Errorf("other account: Check = %v", err)
+	}
+}
+
+func TestThrottleAccountKeyIgnoresCase(t *testing.T) {
+	attempts := newFakeLoginAttemptRepository()
+	config := testThrottleConfig
+	config.FreeAttempts = 0
+	throttle := NewLoginThrottle(attempts, config)
+
+	if err := throttle.Fail(&domain.LoginInput{Company: "ACME", Branch: "HQ", Username: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	lockedFor(t, throttle.Check(aliceLogin("")))
+}
+
+func TestThrottleLocksAddress(t *testing.T) {
+	attempts := newFakeLoginAttemptRepository()
+	throttle := NewLoginThrottle(attempts, testThrottleConfig)
+
+	// Spraying one password over many accounts trips the address counter
+	for i := 0; i < testThrottleConfig.IPMaxAttempts; i++ {
+		login := &domain.LoginInput{Company: "acme", Branch: "hq", Username: string(rune('a' + i)), IP: "198.51.100.1"}
+		if err := throttle.Fail(login); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if wait := lockedFor(t, throttle.Check(&domain.LoginInput{Company: "acme", Branch: "hq", Username: "zed", IP: "198.51.100.1"})); wait < 14*time.Minute {
+		t.Errorf("address lockout = %s, want the full lockout", wait)
+	}
+	if err := throttle.Check(&domain.LoginInput{Company: "acme", Branch: "hq", Username: "zed", IP: "198.51.100.2"}); err != nil {
+		t.Errorf("other address: Check = %v", err)
+	}
+}
+
+func TestThrottleSucceedKeepsAddressCounter(t *testing.T) {
+	attempts := newFakeLoginAttemptRepository()
+	throttle := NewLoginThrottle(attempts, testThrottleConfig)
+	login := aliceLogin("198.51.100.1")
+
+	for i := 0; i < 2; i++ {
+		if err := throttle.Fail(login); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := throttle.Succeed(login); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := attempts.attempts[accountKey("acme", "hq", "alice")]; ok {
+		t.Error("account counter survived a successful login")
+	}
+	if attempt, ok := attempts.attempts[ipKey("198.51.100.1")]; !ok || attempt.Failures != 2 {
+		t.Errorf("address counter = %+v, want it kept", attempt)
+	}
+}
+
+func TestThrottleUnlock(t *testing.T) {
+	tests := []struct {
+		name  string
+		input *domain.UnlockInput
+		fails bool
+	}{
+		{name: "account", input: &domain.UnlockInput{Company: "acme", Branch: "hq", Username: "alice"}},
+		{name: "address", input: &domain.UnlockInput{IP: "198.51.100.1"}},
+		{name: "nothing", input: &domain.UnlockInput{}, fails: true},
+		{name: "account without tenant", input: &domain.UnlockInput{Username: "alice"}, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := newFakeLoginAttemptRepository()
+			config := testThrottleConfig
+			config.MaxAttempts, config.IPMaxAttempts = 1, 1
+			throttle := NewLoginThrottle(attempts, config)
+			login := aliceLogin("198.51.100.1")
+			if err := throttle.Fail(login); err != nil {
+				t.Fatal(err)
+			}
+
+			err := throttle.Unlock(tt.input)
+			if tt.fails {
+				if err == nil {
+					t.Error("Unlock succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unlock: %v", err)
+			}
+
+			cleared := accountKey("acme", "hq", "alice")
+			if tt.input.IP != "" {
+				cleared = ipKey(tt.input.IP)
+			}
+			if _, ok := attempts.attempts[cleared]; ok {
+				t.Errorf("%s is still counted", cleared)
+			}
+		})
+	}
+}
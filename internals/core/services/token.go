@@ -0,0 +1,322 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"go-multi-tenancy/internals/utils"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type tokenService struct {
+	tokenRepository   ports.TokenRepository
+	companyRepository ports.CompanyRepository
+	roleService       ports.RoleService
+	tenantStatus      ports.TenantStatusService
+	accessTTL         time.Duration
+	refreshTTL        time.Duration
+}
+
+func NewTokenService(tokenRepository ports.TokenRepository, companyRepository ports.CompanyRepository, roleService ports.RoleService, tenantStatus ports.TenantStatusService, accessTTL time.Duration, refreshTTL time.Duration) *tokenService {
+	return &tokenService{
+		tokenRepository:   tokenRepository,
+		companyRepository: companyRepository,
+		roleService:       roleService,
+		tenantStatus:      tenantStatus,
+		accessTTL:         accessTTL,
+		refreshTTL:        refreshTTL,
+	}
+}
+
+// Issue starts a new session for the user and returns its first token pair.
+func (s *tokenService) Issue(user *domain.DataReply, role string, device *domain.Device) (*domain.TokenPair, error) {
+	// Every way of logging in ends here, so suspended tenants are refused once
+	if err := s.tenantStatus.Check(user.Company, user.Branch, false); err != nil {
+		return nil, err
+	}
+
+	session, err := s.tokenRepository.CreateSession(&domain.Session{
+		UserID:    user.ID,
+		Company:   user.Company,
+		Branch:    user.Branch,
+		Username:  user.Username,
+		ClientID:  device.ClientID,
+		UserAgent: device.UserAgent,
+		IP:        device.IP,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issuePair(session, role)
+}
+
+// Impersonate starts a session for target on behalf of actor. The access
+// token carries the actor in its act claim and there is no refresh token, so
+// the impersonation ends when the token expires at the latest.
+func (s *tokenService) Impersonate(target *domain.Data, actor *domain.Actor, ttl time.Duration) (*domain.Session, *domain.TokenPair, error) {
+	if err := s.tenantStatus.Check(target.Company, target.Branch, false); err != nil {
+		return nil, nil, err
+	}
+
+	session, err := s.tokenRepository.CreateSession(&domain.Session{
+		UserID:   target.ID,
+		Company:  target.Company,
+		Branch:   target.Branch,
+		Username: target.Username,
+		ActorID:  &actor.UserID,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	perms, err := s.roleService.Permissions(target.ID, target.Role)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	accessToken, err := utils.GenerateJWT(&utils.Claims{
+		ID:          target.Username,
+		UserID:      target.ID.String(),
+		SessionID:   session.ID.String(),
+		Company:     target.Company,
+		Branch:      target.Branch,
+		Role:        target.Role,
+		Permissions: perms,
+		Actor: &utils.Actor{
+			Subject:   actor.UserID.String(),
+			ID:        actor.Username,
+			SessionID: actor.SessionID.String(),
+			Company:   actor.Company,
+			Branch:    actor.Branch,
+			Role:      actor.Role,
+		},
+	}, ttl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return session, &domain.TokenPair{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. Every refresh token
+// can be used once; presenting a used token revokes the whole session because
+// it means the token was copied.
+func (s *tokenService) Refresh(data *domain.RefreshInput) (*domain.TokenPair, error) {
+	if data.RefreshToken == "" {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	token, err := s.tokenRepository.GetRefreshToken(&domain.RefreshToken{TokenHash: utils.HashToken(data.RefreshToken)})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	session, err := s.tokenRepository.GetSession(&domain.Session{ID: token.SessionID})
+	if err != nil {
+		return nil, err
+	}
+
+	if session.RevokedAt != nil {
+		return nil, domain.ErrSessionRevoked
+	}
+
+	if token.UsedAt != nil {
+		return nil, s.revokeReused(session)
+	}
+
+	// Refresh tokens only work for whoever they were issued to, an OAuth
+	// client or the first-party login
+	if session.ClientID != data.Device.ClientID {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	if err := s.tenantStatus.Check(session.Company, session.Branch, false); err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+
+	ok, err := s.tokenRepository.UseRefreshToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, s.revokeReused(session)
+	}
+
+	// The device may have moved to another network since the login
+	session.UserAgent = data.Device.UserAgent
+	session.IP = data.Device.IP
+	if err := s.tokenRepository.TouchSession(session); err != nil {
+		return nil, err
+	}
+
+	// Reload the user so role changes and deletions apply on the next refresh
+	user, err := s.companyRepository.GetMe(&domain.Data{
+		Company: session.Company,
+		Branch:  session.Branch,
+		ID:      session.UserID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			if err := s.tokenRepository.RevokeSession(session); err != nil {
+				return nil, err
+			}
+			return nil, domain.ErrSessionRevoked
+		}
+		return nil, err
+	}
+
+	return s.issuePair(session, user.Role)
+}
+
+func (s *tokenService) Logout(data *domain.LogoutInput) error {
+	if data.All {
+		return s.RevokeUserSessions(data.UserID)
+	}
+
+	return s.tokenRepository.RevokeSession(&domain.Session{ID: data.SessionID})
+}
+
+func (s *tokenService) RevokeUserSessions(userID uuid.UUID) error {
+	return s.tokenRepository.RevokeUserSessions(&domain.Session{UserID: userID})
+}
+
+// ValidateSession returns an error unless the session exists and has not been revoked.
+func (s *tokenService) ValidateSession(sessionID uuid.UUID) error {
+	session, err := s.tokenRepository.GetSession(&domain.Session{ID: sessionID})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrSessionRevoked
+		}
+		return err
+	}
+
+	if session.RevokedAt != nil {
+		return domain.ErrSessionRevoked
+	}
+
+	return s.tokenRepository.TouchSession(&domain.Session{ID: session.ID})
+}
+
+// ListSessions returns the active sessions of a user. Users may list their
+// own, admins those of users in their tenant scope.
+func (s *tokenService) ListSessions(principal *domain.Principal, userID uuid.UUID) ([]domain.Session, error) {
+	if err := s.checkSessionOwner(principal, userID); err != nil {
+		return nil, err
+	}
+
+	return s.tokenRepository.GetUserSessions(&domain.Session{UserID: userID}, int(s.refreshTTL.Seconds()))
+}
+
+// RevokeSession signs one device out. Its access token stops working on the
+// next request and its refresh token is refused.
+func (s *tokenService) RevokeSession(principal *domain.Principal, userID uuid.UUID, sessionID uuid.UUID) error {
+	if err := s.checkSessionOwner(principal, userID); err != nil {
+		return err
+	}
+
+	session, err := s.tokenRepository.GetSession(&domain.Session{ID: sessionID})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrSessionNotFound
+		}
+		return err
+	}
+
+	if session.UserID != userID {
+		return domain.ErrSessionNotFound
+	}
+
+	return s.tokenRepository.RevokeSession(session)
+}
+
+// checkSessionOwner lets callers through for their own account, and admins
+// for users of their tenant scope.
+func (s *tokenService) checkSessionOwner(principal *domain.Principal, userID uuid.UUID) error {
+	if userID == principal.UserID {
+		return nil
+	}
+
+	user, err := s.companyRepository.GetByID(&domain.Data{Company: principal.Company, ID: userID})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrUserNotFound
+		}
+		return err
+	}
+
+	if !domain.InTenantScope(principal.Permissions, principal.Company, principal.Branch, user.Company, user.Branch) {
+		return domain.ErrOutOfTenantScope
+	}
+
+	return nil
+}
+
+func (s *tokenService) revokeReused(session *domain.Session) error {
+	if err := s.tokenRepository.RevokeSession(session); err != nil {
+		return err
+	}
+
+	return domain.ErrRefreshTokenReused
+}
+
+// issuePair signs a new access token and refresh token for the session. The
+// permissions are resolved now and carried in the token, so role changes
+// reach the user with the next refresh.
+func (s *tokenService) issuePair(session *domain.Session, role string) (*domain.TokenPair, error) {
+	perms, err := s.roleService.Permissions(session.UserID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(s.accessTTL)
+	accessToken, err := utils.GenerateJWT(&utils.Claims{
+		ID:          session.Username,
+		UserID:      session.UserID.String(),
+		SessionID:   session.ID.String(),
+		Company:     session.Company,
+		Branch:      session.Branch,
+		Role:        role,
+		Permissions: perms,
+	}, s.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.tokenRepository.CreateRefreshToken(&domain.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.refreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresAt:    expiresAt,
+	}, nil
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/utils"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type fakeTokenRepository struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*domain.Session
+	tokens   map[string]*domain.RefreshToken
+}
+
+func newFakeTokenRepository() *fakeTokenRepository {
+	return &fakeTokenRepository{
+		sessions: map[uuid.UUID]*domain.Session{},
+		tokens:   map[string]*domain.RefreshToken{},
+	}
+}
+
+func (r *fakeTokenRepository) CreateSession(data *domain.Session) (*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data.ID = uuid.New()
+	data.CreateAt = time.Now()
+	session := *data
+	r.sessions[data.ID] = &session
+	return data, nil
+}
+
+func (r *fakeTokenRepository) GetSession(data *domain.Session) (*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[data.ID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	found := *session
+	return &found, nil
+}
+
+func (r *fakeTokenRepository) GetUserSessions(data *domain.Session, idleSeconds int) ([]domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sessions := []domain.Session{}
+	for _, session := range r.sessions {
+		if session.UserID == data.UserID && session.RevokedAt == nil {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *fakeTokenRepository) TouchSession(data *domain.Session) error {
+	return nil
+}
+
+func (r *fakeTokenRepository) RevokeSession(data *domain.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[data.ID]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+func (r *fakeTokenRepository) RevokeUserSessions(data *domain.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, session := range r.sessions {
+		if session.UserID == data.UserID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeTokenRepository) CreateRefreshToken(data *domain.RefreshToken) (*domain.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data.ID = uuid.New()
+	token := *data
+	r.tokens[data.TokenHash] = &token
+	return data, nil
+}
+
+func (r *fakeTokenRepository) GetRefreshToken(data *domain.RefreshToken) (*domain.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[data.TokenHash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	found := *token
+	return &found, nil
+}
+
+func (r *fakeTokenRepository) UseRefreshToken(data *domain.RefreshToken) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[data.TokenHash]
+	if !ok || token.UsedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.UsedAt = &now
+	return true, nil
+}
+
+func newTestTokenService(users *fakeCompanyRepository) (*tokenService, *fakeTokenRepository, *fakeTenantStatus) {
+	tokens := newFakeTokenRepository()
+	status := &fakeTenantStatus{errs: map[string]error{}}
+	return NewTokenService(tokens, users, fakeRoleService{}, status, time.Minute, time.Hour), tokens, status
+}
+
+func issueFor(t *testing.T, s *tokenService, user *domain.Data) *domain.TokenPair {
+	t.Helper()
+
+	pair, err := s.Issue(&domain.DataReply{ID: user.ID, Company: user.Company, Branch: user.Branch, Username: user.Username}, user.Role, &domain.Device{})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	return pair
+}
+
+func refresh(s *tokenService, token string) (*domain.TokenPair, error) {
+	return s.Refresh(&domain.RefreshInput{RefreshToken: token})
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	user := newUser("acme", "hq", "alice", domain.RoleUser)
+	s, _, _ := newTestTokenService(newFakeCompanyRepository(user))
+
+	first := issueFor(t, s, user)
+	second, err := refresh(s, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh token was not rotated")
+	}
+
+	claims, err := utils.ParseJWT(second.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseJWT: %v", err)
+	}
+	if claims.UserID != user.ID.String() || claims.Company != "acme" || claims.Branch != "hq" {
+		t.Errorf("claims = %+v, want the refreshed user's", claims)
+	}
+
+	if _, err := refresh(s, second.RefreshToken); err != nil {
+		t.Errorf("rotated token refused: %v", err)
+	}
+}
+
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	user := newUser("acme", "hq", "alice", domain.RoleUser)
+	s, tokens, _ := newTestTokenService(newFakeCompanyRepository(user))
+
+	first := issueFor(t, s, user)
+	second, err := refresh(s, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// A copied token shows up again after the legitimate client used it
+	if _, err := refresh(s, first.RefreshToken); !errors.Is(err, domain.ErrRefreshTokenReused) {
+		t.Fatalf("reused token: err = %v, want ErrRefreshTokenReused", err)
+	}
+
+	// The whole session is gone, including the token the real client holds
+	if _, err := refresh(s, second.RefreshToken); !errors.Is(err, domain.ErrSessionRevoked) {
+		t.Errorf("token of revoked session: err = %v, want ErrSessionRevoked", err)
+	}
+
+	claims, err := utils.ParseJWT(second.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseJWT: %v", err)
+	}
+	if err := s.ValidateSession(uuid.MustParse(claims.SessionID)); !errors.Is(err, domain.ErrSessionRevoked) {
+		t.Errorf("ValidateSession = %v, want ErrSessionRevoked", err)
+	}
+
+	for _, session := range tokens.sessions {
+		if session.RevokedAt == nil {
+			t.Errorf("session %s still active", session.ID)
+		}
+	}
+}
+
+func TestRefreshRefusals(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(s *tokenService, tokens *fakeTokenRepository, users *fakeCompanyRepository, status *fakeTenantStatus, user *domain.Data, pair *domain.TokenPair) string
+		want    error
+	}{
+		{
+			name: "empty token",
+			prepare: func(*tokenService, *fakeTokenRepository, *fakeCompanyRepository, *fakeTenantStatus, *domain.Data, *domain.TokenPair) string {
+				return ""
+			},
+			want: domain.ErrInvalidRefreshToken,
+		},
+		{
+			name: "unknown token",
+			prepare: func(*tokenService, *fakeTokenRepository, *fakeCompanyRepository, *fakeTenantStatus, *domain.Data, *domain.TokenPair) string {
+				return "not-a-token"
+			},
+			want: domain.ErrInvalidRefreshToken,
+		},
+		{
+			name: "expired token",
+			prepare: func(_ *tokenService, tokens *fakeTokenRepository, _ *fakeCompanyRepository, _ *fakeTenantStatus, _ *domain.Data, pair *domain.TokenPair) string {
+				tokens.tokens[utils.HashToken(pair.RefreshToken)].ExpiresAt = time.Now().Add(-time.Second)
+				return pair.RefreshToken
+			},
+			want: domain.ErrInvalidRefreshToken,
+		},
+		{
+			name: "logged out",
+			prepare: func(s *tokenService, _ *fakeTokenRepository, _ *fakeCompanyRepository, _ *fakeTenantStatus, user *domain.Data, pair *domain.TokenPair) string {
+				if err := s.Logout(&domain.LogoutInput{UserID: user.ID, All: true}); err != nil {
+					panic(err)
+				}
+				return pair.RefreshToken
+			},
+			want: domain.ErrSessionRevoked,
+		},
+		{
+			name: "user deleted",
+			prepare: func(_ *tokenService, _ *fakeTokenRepository, users *fakeCompanyRepository, _ *fakeTenantStatus, user *domain.Data, pair *domain.TokenPair) string {
+				users.delete(user.ID)
+				return pair.RefreshToken
+			},
+			want: domain.ErrSessionRevoked,
+		},
+		{
+			name: "tenant suspended",
+			prepare: func(_ *tokenService, _ *fakeTokenRepository, _ *fakeCompanyRepository, status *fakeTenantStatus, user *domain.Data, pair *domain.TokenPair) string {
+				status.errs[user.Company] = domain.ErrTenantSuspended
+				return pair.RefreshToken
+			},
+			want: domain.ErrTenantSuspended,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := newUser("acme", "hq", "alice", domain.RoleUser)
+			users := newFakeCompanyRepository(user)
+			s, tokens, status := newTestTokenService(users)
+			pair := issueFor(t, s, user)
+
+			token := tt.prepare(s, tokens, users, status, user, pair)
+			if _, err := refresh(s, token); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevokeOneOfOwnSessions(t *testing.T) {
+	user := newUser("acme", "hq", "alice", domain.RoleUser)
+	s, _, _ := newTestTokenService(newFakeCompanyRepository(user))
+	self := &domain.Principal{UserID: user.ID, Company: "acme", Branch: "hq", Role: domain.RoleUser}
+
+	laptop, err := s.Issue(&domain.DataReply{ID: user.ID, Company: "acme", Branch: "hq", Username: "alice"}, domain.RoleUser, &domain.Device{UserAgent: "Firefox", IP: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	phone, err := s.Issue(&domain.DataReply{ID: user.ID, Company: "acme", Branch: "hq", Username: "alice"}, domain.RoleUser, &domain.Device{UserAgent: "Safari", IP: "192.0.2.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := s.ListSessions(self, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("listed %d sessions, want 2", len(sessions))
+	}
+
+	phoneClaims, err := utils.ParseJWT(phone.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	phoneSession := uuid.MustParse(phoneClaims.SessionID)
+	for _, session := range sessions {
+		if session.ID == phoneSession && (session.UserAgent != "Safari" || session.IP != "192.0.2.2") {
+			t.Errorf("phone session recorded as %s from %s", session.UserAgent, session.IP)
+		}
+	}
+
+	if err := s.RevokeSession(self, user.ID, phoneSession); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+
+	// The phone is signed out on its next request and cannot refresh
+	if err := s.ValidateSession(phoneSession); !errors.Is(err, domain.ErrSessionRevoked) {
+		t.Errorf("ValidateSession(phone) = %v, want ErrSessionRevoked", err)
+	}
+	if _, err := refresh(s, phone.RefreshToken); !errors.Is(err, domain.ErrSessionRevoked) {
+		t.Errorf("phone refresh: err = %v, want ErrSessionRevoked", err)
+	}
+
+	// The laptop is untouched
+	if _, err := refresh(s, laptop.RefreshToken); err != nil {
+		t.Errorf("laptop refresh: %v", err)
+	}
+	if sessions, _ := s.ListSessions(self, user.ID); len(sessions) != 1 {
+		t.Errorf("listed %d sessions after revoking one, want 1", len(sessions))
+	}
+
+	if err := s.RevokeSession(self, user.ID, uuid.New()); !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("unknown session: err = %v, want ErrSessionNotFound", err)
+	}
+}
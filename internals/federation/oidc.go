@@ -0,0 +1,271 @@
+// Package federation is the client side of OpenID Connect, used to sign
+// users in with the identity provider their company registered.
+package federation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-multi-tenancy/internals/core/domain"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// metadataTTL is how long discovery documents and key sets are cached.
+const metadataTTL = time.Hour
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type issuerMetadata struct {
+	discovery *discovery
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+type oidcClient struct {
+	httpClient *http.Client
+	mu         sync.Mutex
+	issuers    map[string]*issuerMetadata
+}
+
+func NewOIDCClient(timeout time.Duration) *oidcClient {
+	return &oidcClient{
+		httpClient: &http.Client{Timeout: timeout},
+		issuers:    map[string]*issuerMetadata{},
+	}
+}
+
+func (o *oidcClient) AuthorizationURL(provider *domain.IdentityProvider, state, nonce, codeChallenge string) (string, error) {
+	meta, err := o.metadata(provider.Issuer, false)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientID)
+	query.Set("redirect_uri", provider.RedirectURI)
+	query.Set("scope", provider.Scopes)
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", domain.PKCEMethodS256)
+
+	separator := "?"
+	if strings.Contains(meta.discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return meta.discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+func (o *oidcClient) Exchange(provider *domain.IdentityProvider, code, codeVerifier string) (map[string]interface{}, error) {
+	meta, err := o.metadata(provider.Issuer, false)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", domain.OAuthGrantAuthorizationCode)
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.RedirectURI)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", provider.ClientID)
+	if provider.ClientSecret != "" {
+		form.Set("client_secret", provider.ClientSecret)
+	}
+
+	res, err := o.httpClient.PostForm(meta.discovery.TokenEndpoint, form)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("federation: token endpoint returned %s", res.Status)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tokens); err != nil {
+		return nil, err
+	}
+
+	if tokens.IDToken == "" {
+		return nil, errors.New("federation: token response has no id_token")
+	}
+
+	return o.verify(provider, tokens.IDToken)
+}
+
+// verify checks the ID token's signature, issuer, audience and lifetime.
+func (o *oidcClient) verify(provider *domain.IdentityProvider, idToken string) (map[string]interface{}, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA, *jwt.SigningMethodEd25519:
+		default:
+			return nil, fmt.Errorf("federation: unexpected signing method %v", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		return o.key(provider.Issuer, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyIssuer(provider.Issuer, true) {
+		return nil, errors.New("federation: ID token issuer does not match")
+	}
+
+	if !claims.VerifyAudience(provider.ClientID, true) {
+		return nil, errors.New("federation: ID token is not meant for this client")
+	}
+
+	return claims, nil
+}
+
+// key finds a signing key, fetching the key set again once when the kid is
+// unknown so rotations at the provider are picked up.
+func (o *oidcClient) key(issuer, kid string) (crypto.PublicKey, error) {
+	for _, refresh := range []bool{false, true} {
+		meta, err := o.metadata(issuer, refresh)
+		if err != nil {
+			return nil, err
+		}
+
+		if key, ok := meta.keys[kid]; ok {
+			return key, nil
+		}
+
+		// Providers with a single key may leave the kid out
+		if kid == "" && len(meta.keys) == 1 {
+			for _, key := range meta.keys {
+				return key, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("federation: unknown signing key %q", kid)
+}
+
+func (o *oidcClient) metadata(issuer string, refresh bool) (*issuerMetadata, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	meta, ok := o.issuers[issuer]
+	if ok && !refresh && time.Since(meta.fetchedAt) < metadataTTL {
+		return meta, nil
+	}
+
+	var doc discovery
+	if err := o.getJSON(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, err
+	}
+
+	if doc.Issuer != issuer {
+		return nil, fmt.Errorf("federation: discovery document is for issuer %q", doc.Issuer)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := o.getJSON(doc.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	meta = &issuerMetadata{discovery: &doc, keys: keys, fetchedAt: time.Now()}
+	o.issuers[issuer] = meta
+	return meta, nil
+}
+
+func (o *oidcClient) getJSON(target string, v interface{}) error {
+	res, err := o.httpClient.Get(target)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("federation: %s returned %s", target, res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("federation: unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("federation: unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("federation: unsupported key type %q", k.Kty)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type AccountHandler struct {
+	accountService ports.AccountService
+}
+
+func NewAccountHandler(accountService ports.AccountService) *AccountHandler {
+	return &AccountHandler{accountService: accountService}
+}
+
+func (h *AccountHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req domain.ForgotPasswordInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	err := h.accountService.RequestPasswordReset(&req)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Same answer whether or not the account exists
+	return c.Status(fiber.StatusAccepted).JSON(&fiber.Map{"data": "If the account exists, a reset link has been sent"})
+}
+
+func (h *AccountHandler) ResetPassword(c *fiber.Ctx) error {
+	var req domain.ResetPasswordInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	err := h.accountService.ResetPassword(&req)
+	if err != nil {
+		var policyErr *domain.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return passwordPolicyFailed(c, policyErr)
+		}
+		return c.Status(accountStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": "Password successfully reset"})
+}
+
+func (h *AccountHandler) RequestEmailVerification(c *fiber.Ctx) error {
+	company := c.Locals("company")
+	branch := c.Locals("branch")
+	id := c.Locals("id")
+
+	if company == nil || branch == nil || id == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	req := &domain.Me{
+		Company: company.(string),
+		Branch:  branch.(string),
+		ID:      id.(uuid.UUID),
+	}
+
+	err := h.accountService.RequestEmailVerification(req)
+	if err != nil {
+		return c.Status(accountStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(&fiber.Map{"data": "Verification email sent"})
+}
+
+func (h *AccountHandler) VerifyEmail(c *fiber.Ctx) error {
+	var req domain.VerifyEmailInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	err := h.accountService.VerifyEmail(&req)
+	if err != nil {
+		return c.Status(accountStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": "Email successfully verified"})
+}
+
+func accountStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrInvalidActionToken):
+		return fiber.StatusUnauthorized
+	case errors.Is(err, domain.ErrEmailMissing):
+		return fiber.StatusUnprocessableEntity
+	case errors.Is(err, domain.ErrTenantSuspended), errors.Is(err, domain.ErrTenantReadOnly):
+		return fiber.StatusForbidden
+	}
+
+	return fiber.StatusInternalServerError
+}
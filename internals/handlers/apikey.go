@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type APIKeyHandler struct {
+	apiKeyService ports.APIKeyService
+}
+
+func NewAPIKeyHandler(apiKeyService ports.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: apiKeyService}
+}
+
+func (h *APIKeyHandler) ListAPIKeys(c *fiber.Ctx) error {
+	res, err := h.apiKeyService.ListAPIKeys(principal(c))
+	if err != nil {
+		return c.Status(apiKeyStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+// CreateAPIKey returns the new key in plain text. It cannot be shown again.
+func (h *APIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	var req domain.APIKeyInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	res, err := h.apiKeyService.CreateAPIKey(principal(c), &req)
+	if err != nil {
+		return c.Status(apiKeyStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(&fiber.Map{"data": res})
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid API key id"})
+	}
+
+	if err := h.apiKeyService.RevokeAPIKey(principal(c), id); err != nil {
+		return c.Status(apiKeyStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": "API key successfully revoked"})
+}
+
+func apiKeyStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrInvalidAPIKey):
+		return fiber.StatusNotFound
+	case errors.Is(err, domain.ErrPermissionEscalated), errors.Is(err, domain.ErrOutOfTenantScope):
+		return fiber.StatusForbidden
+	case errors.Is(err, domain.ErrUnknownPermission):
+		return fiber.StatusBadRequest
+	}
+
+	return fiber.StatusInternalServerError
+}
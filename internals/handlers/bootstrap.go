@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type BootstrapHandler struct {
+	bootstrapService ports.BootstrapService
+}
+
+func NewBootstrapHandler(bootstrapService ports.BootstrapService) *BootstrapHandler {
+	return &BootstrapHandler{bootstrapService: bootstrapService}
+}
+
+func (h *BootstrapHandler) Bootstrap(c *fiber.Ctx) error {
+	var req domain.BootstrapInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	res, err := h.bootstrapService.Bootstrap(&req)
+	if err != nil {
+		var policyErr *domain.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return passwordPolicyFailed(c, policyErr)
+		}
+		return c.Status(bootstrapStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(&fiber.Map{"data": res})
+}
+
+func bootstrapStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrInvalidBootstrapToken):
+		return fiber.StatusUnauthorized
+	case errors.Is(err, domain.ErrAlreadyBootstrapped):
+		return fiber.StatusConflict
+	case errors.Is(err, domain.ErrInvalidTenantName), errors.Is(err, domain.ErrReservedTenantName):
+		return fiber.StatusBadRequest
+	}
+
+	return fiber.StatusInternalServerError
+}
@@ -1,24 +1,27 @@
 package handlers
 
 import (
+	"errors"
 	"go-multi-tenancy/internals/core/domain"
 	"go-multi-tenancy/internals/core/ports"
-	"go-multi-tenancy/internals/utils"
+	"log"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/session"
 	"github.com/google/uuid"
 )
 
-var store = session.New()
-
 type CompanyHandler struct {
 	companyService ports.CompanyService
+	tokenService   ports.TokenService
+	accountService ports.AccountService
 }
 
-func NewCompanyHandler(companyService ports.CompanyService) *CompanyHandler {
+func NewCompanyHandler(companyService ports.CompanyService, tokenService ports.TokenService, accountService ports.AccountService) *CompanyHandler {
 	return &CompanyHandler{
 		companyService: companyService,
+		tokenService:   tokenService,
+		accountService: accountService,
 	}
 }
 
@@ -30,9 +33,23 @@ func (h *CompanyHandler) Register(c *fiber.Ctx) error {
 
 	res, err := h.companyService.Register(&req)
 	if err != nil {
+		var policyErr *domain.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return passwordPolicyFailed(c, policyErr)
+		}
+		if errors.Is(err, domain.ErrRegistrationClosed) || errors.Is(err, domain.ErrTenantSuspended) || errors.Is(err, domain.ErrTenantReadOnly) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	// The account exists either way, a failed email can be requested again later
+	if res.Email != "" {
+		if err := h.accountService.SendEmailVerification(res); err != nil {
+			log.Println("send verification email:", err)
+		}
+	}
+
 	return c.Status(fiber.StatusCreated).JSON(&fiber.Map{"data": res})
 }
 
@@ -42,18 +59,103 @@ func (h *CompanyHandler) Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
 	}
 
-	res, role, err := h.companyService.Login(&req)
+	req.IP = c.IP()
+
+	res, err := h.companyService.Login(&req)
+	if err != nil {
+		var lockout *domain.LockoutError
+		if errors.As(err, &lockout) {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(lockout.RetryAfter.Seconds())))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, domain.ErrInvalidCredentials) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, domain.ErrNetworkNotAllowed) || errors.Is(err, domain.ErrOutsideLoginHours) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, domain.ErrPasswordExpired) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error(), "password_expired": true})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return loginReply(c, h.tokenService, res)
+}
+
+// loginReply answers a successful first login step, with either the session
+// tokens or the MFA token when a second factor is still owed.
+func loginReply(c *fiber.Ctx, tokenService ports.TokenService, res *domain.LoginResult) error {
+	// The second factor is still missing, hand out the MFA token instead of a session
+	if res.MFAToken != "" {
+		return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+			"mfa_required":            true,
+			"mfa_enrollment_required": res.MFAEnrollmentRequired,
+			"mfa_token":               res.MFAToken,
+		})
+	}
+
+	// Start a session and issue the access and refresh tokens
+	token, err := tokenService.Issue(res.Data, res.Role, device(c))
+	if err != nil {
+		if errors.Is(err, domain.ErrTenantSuspended) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res.Data, "token": token})
+}
+
+// device describes the client making the request, for the session list.
+func device(c *fiber.Ctx) *domain.Device {
+	return &domain.Device{UserAgent: c.Get(fiber.HeaderUserAgent), IP: c.IP()}
+}
+
+func (h *CompanyHandler) Refresh(c *fiber.Ctx) error {
+	var req domain.RefreshInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	req.Device = *device(c)
+
+	token, err := h.tokenService.Refresh(&req)
 	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRefreshToken) || errors.Is(err, domain.ErrRefreshTokenReused) || errors.Is(err, domain.ErrSessionRevoked) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, domain.ErrTenantSuspended) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Generate JWT
-	token, err := utils.GenerateJWT(res.Username, res.Company, res.Branch, role)
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"token": token})
+}
+
+func (h *CompanyHandler) Logout(c *fiber.Ctx) error {
+	sessionID := c.Locals("session_id")
+	id := c.Locals("id")
+
+	if sessionID == nil || id == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	var req domain.LogoutInput
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+		}
+	}
+	req.SessionID = sessionID.(uuid.UUID)
+	req.UserID = id.(uuid.UUID)
+
+	err := h.tokenService.Logout(&req)
 	if err != nil {
-		return err
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res, "token": token})
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": "Logged out successfully"})
 }
 
 func (h *CompanyHandler) GetData(c *fiber.Ctx) error {
@@ -92,13 +194,20 @@ func (h *CompanyHandler) UpdateData(c *fiber.Ctx) error {
 	}
 
 	req := &domain.DataUpdate{
-		Company: company.(string),
-		Branch:  branch.(string),
-		ID:      id.(uuid.UUID),
+		Company:   company.(string),
+		Branch:    branch.(string),
+		ID:        id.(uuid.UUID),
+		FirstName: dataValue.FirstName,
+		LastName:  dataValue.LastName,
+		Password:  dataValue.Password,
 	}
 
 	res, err := h.companyService.UpdateData(req)
 	if err != nil {
+		var policyErr *domain.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return passwordPolicyFailed(c, policyErr)
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -166,8 +275,15 @@ func (h *CompanyHandler) Admin(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
 	}
 
-	res, err := h.companyService.Admin(&req)
+	res, err := h.companyService.Admin(principal(c), &req)
 	if err != nil {
+		var policyErr *domain.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return passwordPolicyFailed(c, policyErr)
+		}
+		if errors.Is(err, domain.ErrAdminRole) || errors.Is(err, domain.ErrOutOfTenantScope) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -206,3 +322,30 @@ func (h *CompanyHandler) GetBranchData(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
 }
+
+// Unlock clears the failed login counters of an account within the caller's
+// tenant scope.
+func (h *CompanyHandler) Unlock(c *fiber.Ctx) error {
+	var req domain.UnlockInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	caller := principal(c)
+
+	// Addresses are shared across tenants, so only platform operators may clear them
+	if req.IP != "" && !domain.HasPermission(caller.Permissions, domain.PermTenantsManage) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	if req.Username != "" && !domain.InTenantScope(caller.Permissions, caller.Company, caller.Branch, req.Company, req.Branch) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	err := h.companyService.Unlock(&req)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": "Account successfully unlocked"})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type FederationHandler struct {
+	federationService ports.FederationService
+	tokenService      ports.TokenService
+}
+
+func NewFederationHandler(federationService ports.FederationService, tokenService ports.TokenService) *FederationHandler {
+	return &FederationHandler{
+		federationService: federationService,
+		tokenService:      tokenService,
+	}
+}
+
+func (h *FederationHandler) GetProvider(c *fiber.Ctx) error {
+	res, err := h.federationService.GetProvider(&domain.CompanyRequest{Company: c.Params("company")})
+	if err != nil {
+		return c.Status(federationStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+func (h *FederationHandler) SaveProvider(c *fiber.Ctx) error {
+	var req domain.IdentityProvider
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	req.Company = c.Params("company")
+
+	res, err := h.federationService.SaveProvider(&req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+func (h *FederationHandler) DeleteProvider(c *fiber.Ctx) error {
+	err := h.federationService.DeleteProvider(&domain.CompanyRequest{Company: c.Params("company")})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": "Identity provider successfully deleted"})
+}
+
+// Start redirects the browser to the company's identity provider.
+func (h *FederationHandler) Start(c *fiber.Ctx) error {
+	res, err := h.federationService.Start(&domain.CompanyRequest{Company: c.Params("company")})
+	if err != nil {
+		return c.Status(federationStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Redirect(res.AuthorizationURL, fiber.StatusFound)
+}
+
+// Callback is called by the page the identity provider redirected back to,
+// with the code and state it received. It answers like the password login.
+func (h *FederationHandler) Callback(c *fiber.Ctx) error {
+	var req domain.SSOCallbackInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	req.Company = c.Params("company")
+
+	res, err := h.federationService.Callback(&req)
+	if err != nil {
+		return c.Status(federationStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return loginReply(c, h.tokenService, res)
+}
+
+func federationStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrSSONotConfigured):
+		return fiber.StatusNotFound
+	case errors.Is(err, domain.ErrSSOInvalidState), errors.Is(err, domain.ErrSSOFailed):
+		return fiber.StatusUnauthorized
+	case errors.Is(err, domain.ErrSSOAccountExists):
+		return fiber.StatusConflict
+	case errors.Is(err, domain.ErrTenantSuspended), errors.Is(err, domain.ErrTenantReadOnly):
+		return fiber.StatusForbidden
+	}
+
+	return fiber.StatusInternalServerError
+}
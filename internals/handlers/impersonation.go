@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type ImpersonationHandler struct {
+	impersonationService ports.ImpersonationService
+}
+
+func NewImpersonationHandler(impersonationService ports.ImpersonationService) *ImpersonationHandler {
+	return &ImpersonationHandler{impersonationService: impersonationService}
+}
+
+// Start lets a super admin act as another user with a short-lived token.
+func (h *ImpersonationHandler) Start(c *fiber.Ctx) error {
+	if actor, _ := c.Locals("actor").(*domain.Actor); actor != nil {
+		return c.Status(impersonationStatus(domain.ErrImpersonationNested)).JSON(fiber.Map{"error": domain.ErrImpersonationNested.Error()})
+	}
+
+	userID, _ := c.Locals("id").(uuid.UUID)
+	sessionID, _ := c.Locals("session_id").(uuid.UUID)
+	username, _ := c.Locals("username").(string)
+	company, _ := c.Locals("company").(string)
+	branch, _ := c.Locals("branch").(string)
+	role, _ := c.Locals("role").(string)
+
+	var req domain.ImpersonationInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	req.IP = c.IP()
+
+	res, err := h.impersonationService.Start(&domain.Actor{
+		UserID:    userID,
+		SessionID: sessionID,
+		Username:  username,
+		Company:   company,
+		Branch:    branch,
+		Role:      role,
+	}, &req)
+	if err != nil {
+		return c.Status(impersonationStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(&fiber.Map{"data": res})
+}
+
+// Stop ends the impersonation, called with the impersonation token.
+func (h *ImpersonationHandler) Stop(c *fiber.Ctx) error {
+	p := principal(c)
+	sessionID, _ := c.Locals("session_id").(uuid.UUID)
+
+	err := h.impersonationService.Stop(&domain.ImpersonationStopInput{
+		SessionID: sessionID,
+		UserID:    p.UserID,
+		Company:   p.Company,
+		Branch:    p.Branch,
+		Actor:     p.Actor,
+		IP:        c.IP(),
+	})
+	if err != nil {
+		return c.Status(impersonationStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": "Impersonation ended"})
+}
+
+func (h *ImpersonationHandler) AuditLog(c *fiber.Ctx) error {
+	var req domain.AuditQuery
+	if err := c.QueryParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid query"})
+	}
+
+	res, err := h.impersonationService.AuditLog(&req)
+	if err != nil {
+		return c.Status(impersonationStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+func impersonationStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, domain.ErrImpersonationForbidden), errors.Is(err, domain.ErrImpersonationNested), errors.Is(err, domain.ErrTenantSuspended):
+		return fiber.StatusForbidden
+	case errors.Is(err, domain.ErrImpersonationReason), errors.Is(err, domain.ErrImpersonationTarget), errors.Is(err, domain.ErrNotImpersonating):
+		return fiber.StatusBadRequest
+	}
+
+	return fiber.StatusInternalServerError
+}
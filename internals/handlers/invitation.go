@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type InvitationHandler struct {
+	invitationService ports.InvitationService
+}
+
+func NewInvitationHandler(invitationService ports.InvitationService) *InvitationHandler {
+	return &InvitationHandler{invitationService: invitationService}
+}
+
+func (h *InvitationHandler) ListInvitations(c *fiber.Ctx) error {
+	res, err := h.invitationService.ListInvitations(principal(c))
+	if err != nil {
+		return c.Status(invitationStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+func (h *InvitationHandler) CreateInvitation(c *fiber.Ctx) error {
+	var req domain.InvitationInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	res, err := h.invitationService.CreateInvitation(principal(c), &req)
+	if err != nil {
+		return c.Status(invitationStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(&fiber.Map{"data": res})
+}
+
+func (h *InvitationHandler) RevokeInvitation(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid invitation id"})
+	}
+
+	if err := h.invitationService.RevokeInvitation(principal(c), id); err != nil {
+		return c.Status(invitationStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": "Invitation successfully revoked"})
+}
+
+func (h *InvitationHandler) AcceptInvitation(c *fiber.Ctx) error {
+	var req domain.AcceptInvitationInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	res, err := h.invitationService.AcceptInvitation(&req)
+	if err != nil {
+		var policyErr *domain.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return passwordPolicyFailed(c, policyErr)
+		}
+		return c.Status(invitationStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(&fiber.Map{"data": res})
+}
+
+func invitationStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrInvalidInvitation):
+		return fiber.StatusBadRequest
+	case errors.Is(err, domain.ErrInvitationNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, domain.ErrOutOfTenantScope), errors.Is(err, domain.ErrInvitationRole), errors.Is(err, domain.ErrTenantSuspended), errors.Is(err, domain.ErrTenantReadOnly):
+		return fiber.StatusForbidden
+	case errors.Is(err, domain.ErrUsernameTaken):
+		return fiber.StatusConflict
+	}
+
+	return fiber.StatusInternalServerError
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"go-multi-tenancy/internals/core/domain"
 	"go-multi-tenancy/internals/core/ports"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
 type ManageHandler struct {
@@ -36,7 +38,7 @@ func (m *ManageHandler) GetBranch(c *fiber.Ctx) error {
 
 	res, err := m.manageService.GetBranch(req)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+		return c.Status(manageStatus(err)).JSON(&fiber.Map{
 			"error": err.Error(),
 		})
 	}
@@ -55,7 +57,7 @@ func (m *ManageHandler) CreateCompany(c *fiber.Ctx) error {
 
 	res, err := m.manageService.CreateCompany(&company)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+		return c.Status(manageStatus(err)).JSON(&fiber.Map{
 			"error": err.Error(),
 		})
 	}
@@ -75,7 +77,7 @@ func (m *ManageHandler) CreateBranch(c *fiber.Ctx) error {
 
 	res, err := m.manageService.CreateBranch(&branch)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+		return c.Status(manageStatus(err)).JSON(&fiber.Map{
 			"error": err.Error(),
 		})
 	}
@@ -92,15 +94,16 @@ func (m *ManageHandler) DeleteCompany(c *fiber.Ctx) error {
 		Company: company,
 	}
 
-	err := m.manageService.DeleteCompany(req)
+	res, err := m.manageService.DeleteCompany(req)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+		return c.Status(manageStatus(err)).JSON(&fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
 	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
-		"data": "Company successfully deleted",
+		"data":    "Company successfully deleted",
+		"archive": res,
 	})
 }
 
@@ -113,15 +116,16 @@ func (m *ManageHandler) DeleteBranch(c *fiber.Ctx) error {
 		Branch:  branch,
 	}
 
-	err := m.manageService.DeleteBranch(req)
+	res, err := m.manageService.DeleteBranch(req)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+		return c.Status(manageStatus(err)).JSON(&fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
 	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
-		"data": "Branch successfully deleted",
+		"data":    "Branch successfully deleted",
+		"archive": res,
 	})
 }
 
@@ -137,7 +141,7 @@ func (m *ManageHandler) UpdateCompanyToBranch(c *fiber.Ctx) error {
 
 	res, err := m.manageService.UpdateCompanyToBranch(&req)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+		return c.Status(manageStatus(err)).JSON(&fiber.Map{
 			"error": err.Error(),
 		})
 	}
@@ -160,7 +164,7 @@ func (m *ManageHandler) UpdateBranchToCompany(c *fiber.Ctx) error {
 
 	res, err := m.manageService.UpdateBranchToCompany(&req)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+		return c.Status(manageStatus(err)).JSON(&fiber.Map{
 			"error": err.Error(),
 		})
 	}
@@ -183,7 +187,7 @@ func (m *ManageHandler) UpdateCompanyName(c *fiber.Ctx) error {
 
 	res, err := m.manageService.UpdateCompanyName(&req)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+		return c.Status(manageStatus(err)).JSON(&fiber.Map{
 			"error": err.Error(),
 		})
 	}
@@ -205,7 +209,7 @@ func (m *ManageHandler) UpdateBranchName(c *fiber.Ctx) error {
 
 	res, err := m.manageService.UpdateBranchName(&req)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+		return c.Status(manageStatus(err)).JSON(&fiber.Map{
 			"error": err.Error(),
 		})
 	}
@@ -214,3 +218,78 @@ func (m *ManageHandler) UpdateBranchName(c *fiber.Ctx) error {
 		"data": *res.Branch + " successfully updated",
 	})
 }
+
+func (m *ManageHandler) UpdateCompanyMetadata(c *fiber.Ctx) error {
+	return m.updateTenant(c, "")
+}
+
+func (m *ManageHandler) UpdateBranchMetadata(c *fiber.Ctx) error {
+	return m.updateTenant(c, c.Params("branch"))
+}
+
+func (m *ManageHandler) updateTenant(c *fiber.Ctx, branch string) error {
+	var req domain.TenantUpdate
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	req.Company = c.Params("company")
+	req.Branch = branch
+
+	res, err := m.manageService.UpdateTenant(&req)
+	if err != nil {
+		return c.Status(manageStatus(err)).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"data": res,
+	})
+}
+
+func (m *ManageHandler) GetArchives(c *fiber.Ctx) error {
+	res, err := m.manageService.GetArchives()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"data": res,
+	})
+}
+
+func (m *ManageHandler) RestoreArchive(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"error": "Invalid archive id",
+		})
+	}
+
+	if err := m.manageService.RestoreArchive(id); err != nil {
+		return c.Status(manageStatus(err)).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"data": "Archive successfully restored",
+	})
+}
+
+func manageStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrTenantNotFound), errors.Is(err, domain.ErrArchiveNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, domain.ErrArchiveConflict), errors.Is(err, domain.ErrArchiveParentMissing), errors.Is(err, domain.ErrArchiveLegacy):
+		return fiber.StatusConflict
+	case errors.Is(err, domain.ErrInvalidSettings), errors.Is(err, domain.ErrInvalidTenantName), errors.Is(err, domain.ErrReservedTenantName):
+		return fiber.StatusBadRequest
+	}
+
+	return fiber.StatusInternalServerError
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type MFAHandler struct {
+	mfaService   ports.MFAService
+	tokenService ports.TokenService
+}
+
+func NewMFAHandler(mfaService ports.MFAService, tokenService ports.TokenService) *MFAHandler {
+	return &MFAHandler{
+		mfaService:   mfaService,
+		tokenService: tokenService,
+	}
+}
+
+// Verify finishes a two-step login and issues the session tokens.
+func (h *MFAHandler) Verify(c *fiber.Ctx) error {
+	var req domain.MFAVerifyInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	req.IP = c.IP()
+
+	res, err := h.mfaService.Verify(&req)
+	if err != nil {
+		return mfaError(c, err)
+	}
+
+	token, err := h.tokenService.Issue(res.Data, res.Role, device(c))
+	if err != nil {
+		if errors.Is(err, domain.ErrTenantSuspended) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res.Data, "token": token, "recovery_codes": res.RecoveryCodes})
+}
+
+func (h *MFAHandler) EnrollWithToken(c *fiber.Ctx) error {
+	var req domain.MFATokenInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	res, err := h.mfaService.EnrollWithToken(&req)
+	if err != nil {
+		return mfaError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+func (h *MFAHandler) Enroll(c *fiber.Ctx) error {
+	identity, ok := mfaIdentity(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	res, err := h.mfaService.Enroll(identity)
+	if err != nil {
+		return mfaError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+func (h *MFAHandler) Confirm(c *fiber.Ctx) error {
+	identity, ok := mfaIdentity(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	var req domain.MFACodeInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	req.IP = c.IP()
+
+	res, err := h.mfaService.Confirm(identity, &req)
+	if err != nil {
+		return mfaError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+func (h *MFAHandler) Disable(c *fiber.Ctx) error {
+	identity, ok := mfaIdentity(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	var req domain.MFACodeInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	req.IP = c.IP()
+
+	err := h.mfaService.Disable(identity, &req)
+	if err != nil {
+		return mfaError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": "MFA successfully disabled"})
+}
+
+func (h *MFAHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	identity, ok := mfaIdentity(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	var req domain.MFACodeInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	req.IP = c.IP()
+
+	res, err := h.mfaService.RegenerateRecoveryCodes(identity, &req)
+	if err != nil {
+		return mfaError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+func mfaIdentity(c *fiber.Ctx) (*domain.MFAIdentity, bool) {
+	id, ok := c.Locals("id").(uuid.UUID)
+	if !ok {
+		return nil, false
+	}
+
+	company, _ := c.Locals("company").(string)
+	branch, _ := c.Locals("branch").(string)
+	username, _ := c.Locals("username").(string)
+	role, _ := c.Locals("role").(string)
+
+	return &domain.MFAIdentity{
+		UserID:   id,
+		Company:  company,
+		Branch:   branch,
+		Username: username,
+		Role:     role,
+	}, true
+}
+
+// mfaError answers a failed MFA request. Lockouts from the login throttle
+// tell the client when to try again.
+func mfaError(c *fiber.Ctx, err error) error {
+	var lockout *domain.LockoutError
+	if errors.As(err, &lockout) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(lockout.RetryAfter.Seconds())))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(mfaStatus(err)).JSON(fiber.Map{"error": err.Error()})
+}
+
+func mfaStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrMFAInvalidCode), errors.Is(err, domain.ErrMFAInvalidToken), errors.Is(err, domain.ErrMFAChallengeLocked):
+		return fiber.StatusUnauthorized
+	case errors.Is(err, domain.ErrMFARequiredByPolicy):
+		return fiber.StatusForbidden
+	case errors.Is(err, domain.ErrMFAAlreadyEnabled), errors.Is(err, domain.ErrMFANotEnabled), errors.Is(err, domain.ErrMFANotEnrolled):
+		return fiber.StatusConflict
+	}
+
+	return fiber.StatusInternalServerError
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type NetworkPolicyHandler struct {
+	networkService ports.NetworkPolicyService
+}
+
+func NewNetworkPolicyHandler(networkService ports.NetworkPolicyService) *NetworkPolicyHandler {
+	return &NetworkPolicyHandler{networkService: networkService}
+}
+
+func (h *NetworkPolicyHandler) GetPolicies(c *fiber.Ctx) error {
+	res, err := h.networkService.GetPolicies(&domain.CompanyRequest{Company: c.Params("company")})
+	if err != nil {
+		return c.Status(networkStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+func (h *NetworkPolicyHandler) SaveCompanyPolicy(c *fiber.Ctx) error {
+	return h.savePolicy(c, "")
+}
+
+func (h *NetworkPolicyHandler) SaveBranchPolicy(c *fiber.Ctx) error {
+	return h.savePolicy(c, c.Params("branch"))
+}
+
+func (h *NetworkPolicyHandler) DeleteCompanyPolicy(c *fiber.Ctx) error {
+	return h.deletePolicy(c, "")
+}
+
+func (h *NetworkPolicyHandler) DeleteBranchPolicy(c *fiber.Ctx) error {
+	return h.deletePolicy(c, c.Params("branch"))
+}
+
+func (h *NetworkPolicyHandler) savePolicy(c *fiber.Ctx, branch string) error {
+	var req domain.NetworkPolicy
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	req.Company = c.Params("company")
+	req.Branch = branch
+
+	res, err := h.networkService.SavePolicy(&req)
+	if err != nil {
+		return c.Status(networkStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+func (h *NetworkPolicyHandler) deletePolicy(c *fiber.Ctx, branch string) error {
+	err := h.networkService.DeletePolicy(&domain.NetworkPolicy{Company: c.Params("company"), Branch: branch})
+	if err != nil {
+		return c.Status(networkStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": "Network policy successfully deleted"})
+}
+
+func networkStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrInvalidNetworkPolicy):
+		return fiber.StatusBadRequest
+	case errors.Is(err, domain.ErrNetworkPolicyNotFound):
+		return fiber.StatusNotFound
+	}
+
+	return fiber.StatusInternalServerError
+}
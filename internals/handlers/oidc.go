@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type OIDCHandler struct {
+	oidcService ports.OIDCService
+	loginURL    string
+}
+
+func NewOIDCHandler(oidcService ports.OIDCService, loginURL string) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+		loginURL:    loginURL,
+	}
+}
+
+// Authorize validates the authorization request and sends the browser to the
+// login page with the request attached. Once the user has logged in through
+// the regular API, the login page completes the flow with ApproveAuthorize.
+func (h *OIDCHandler) Authorize(c *fiber.Ctx) error {
+	var req domain.AuthorizeRequest
+	if err := c.QueryParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&domain.OAuthError{Code: "invalid_request"})
+	}
+
+	if _, err := h.oidcService.CheckAuthorize(&req); err != nil {
+		return oauthError(c, err)
+	}
+
+	return c.Redirect(h.loginURL+"?"+string(c.Request().URI().QueryString()), fiber.StatusFound)
+}
+
+// ApproveAuthorize issues the authorization code for the logged in caller
+// and returns the client redirect to follow.
+func (h *OIDCHandler) ApproveAuthorize(c *fiber.Ctx) error {
+	var req domain.AuthorizeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&domain.OAuthError{Code: "invalid_request"})
+	}
+
+	res, err := h.oidcService.Authorize(principal(c), &req)
+	if err != nil {
+		return oauthError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+func (h *OIDCHandler) Token(c *fiber.Ctx) error {
+	var req domain.OAuthTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&domain.OAuthError{Code: "invalid_request"})
+	}
+
+	req.IP = c.IP()
+
+	// client_secret_basic, RFC 6749 section 2.3.1
+	if id, secret, ok := basicAuth(c.Get(fiber.HeaderAuthorization)); ok {
+		req.ClientID = id
+		req.ClientSecret = secret
+	}
+
+	res, err := h.oidcService.Token(&req)
+	if err != nil {
+		return oauthError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(res)
+}
+
+func (h *OIDCHandler) UserInfo(c *fiber.Ctx) error {
+	res, err := h.oidcService.UserInfo(principal(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(res)
+}
+
+func (h *OIDCHandler) ListClients(c *fiber.Ctx) error {
+	res, err := h.oidcService.ListClients()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+// CreateClient returns the client secret in plain text. It cannot be shown again.
+func (h *OIDCHandler) CreateClient(c *fiber.Ctx) error {
+	var req domain.OAuthClientInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	res, err := h.oidcService.CreateClient(&req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(&fiber.Map{"data": res})
+}
+
+func (h *OIDCHandler) DeleteClient(c *fiber.Ctx) error {
+	err := h.oidcService.DeleteClient(&domain.OAuthClient{ClientID: c.Params("client_id")})
+	if err != nil {
+		var oauthErr *domain.OAuthError
+		if errors.As(err, &oauthErr) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": "Client successfully deleted"})
+}
+
+// oauthError writes err in the RFC 6749 error format.
+func oauthError(c *fiber.Ctx, err error) error {
+	var oauthErr *domain.OAuthError
+	if !errors.As(err, &oauthErr) {
+		return c.Status(fiber.StatusInternalServerError).JSON(&domain.OAuthError{Code: "server_error"})
+	}
+
+	status := fiber.StatusBadRequest
+	if oauthErr.Code == "invalid_client" {
+		status = fiber.StatusUnauthorized
+	}
+
+	return c.Status(status).JSON(oauthErr)
+}
+
+func basicAuth(header string) (string, string, bool) {
+	encoded, ok := strings.CutPrefix(header, "Basic ")
+	if !ok {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+
+	id, secret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+
+	// Both parts are form-urlencoded before being joined
+	id, err = url.QueryUnescape(id)
+	if err != nil {
+		return "", "", false
+	}
+	secret, err = url.QueryUnescape(secret)
+	if err != nil {
+		return "", "", false
+	}
+
+	return id, secret, true
+}
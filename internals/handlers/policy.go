@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PolicyHandler struct {
+	policyService ports.PolicyService
+}
+
+func NewPolicyHandler(policyService ports.PolicyService) *PolicyHandler {
+	return &PolicyHandler{policyService: policyService}
+}
+
+func (h *PolicyHandler) GetPolicy(c *fiber.Ctx) error {
+	req := &domain.CompanyRequest{
+		Company: c.Params("company"),
+	}
+
+	res, err := h.policyService.GetPolicy(req)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"data": res,
+	})
+}
+
+// UpdatePolicy changes the fields present in the body and keeps the rest.
+func (h *PolicyHandler) UpdatePolicy(c *fiber.Ctx) error {
+	req, err := h.policyService.GetPolicy(&domain.CompanyRequest{Company: c.Params("company")})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	req.Company = c.Params("company")
+
+	res, err := h.policyService.UpdatePolicy(req)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidPolicy) {
+			return c.Status(fiber.StatusBadRequest).JSON(&fiber.Map{
+				"error": fmt.Sprintf("%v: password_min_length must be 1 to %d, password_history 0 to %d and password_max_age_days 0 to %d",
+					err, domain.PasswordMaxLength, domain.PasswordHistoryMax, domain.PasswordMaxAgeDaysMax),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(&fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"data": res,
+	})
+}
+
+// passwordPolicyFailed answers with every rule the new password broke.
+func passwordPolicyFailed(c *fiber.Ctx, err *domain.PasswordPolicyError) error {
+	return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+		"error":      "Password does not meet the password policy",
+		"violations": err.Violations,
+	})
+}
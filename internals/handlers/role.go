@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type RoleHandler struct {
+	roleService ports.RoleService
+}
+
+func NewRoleHandler(roleService ports.RoleService) *RoleHandler {
+	return &RoleHandler{roleService: roleService}
+}
+
+func (h *RoleHandler) ListPermissions(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": domain.Permissions})
+}
+
+func (h *RoleHandler) ListRoles(c *fiber.Ctx) error {
+	res, err := h.roleService.ListRoles(principal(c))
+	if err != nil {
+		return c.Status(roleStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+func (h *RoleHandler) CreateRole(c *fiber.Ctx) error {
+	var req domain.RoleInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	res, err := h.roleService.CreateRole(principal(c), &req)
+	if err != nil {
+		return c.Status(roleStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(&fiber.Map{"data": res})
+}
+
+func (h *RoleHandler) UpdateRole(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid role id"})
+	}
+
+	var req domain.RoleInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	res, err := h.roleService.UpdateRole(principal(c), id, &req)
+	if err != nil {
+		return c.Status(roleStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+func (h *RoleHandler) DeleteRole(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid role id"})
+	}
+
+	if err := h.roleService.DeleteRole(principal(c), id); err != nil {
+		return c.Status(roleStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": "Role successfully deleted"})
+}
+
+func (h *RoleHandler) AssignRole(c *fiber.Ctx) error {
+	req, err := roleAssignment(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.roleService.AssignRole(principal(c), req); err != nil {
+		return c.Status(roleStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": "Role successfully assigned"})
+}
+
+func (h *RoleHandler) UnassignRole(c *fiber.Ctx) error {
+	req, err := roleAssignment(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := h.roleService.UnassignRole(principal(c), req); err != nil {
+		return c.Status(roleStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": "Role successfully unassigned"})
+}
+
+func (h *RoleHandler) UserRoles(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user id"})
+	}
+
+	req := &domain.RoleAssignment{
+		UserID: id,
+		Branch: c.Query("branch"),
+	}
+
+	res, err := h.roleService.UserRoles(principal(c), req)
+	if err != nil {
+		return c.Status(roleStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+// roleAssignment reads the role from the path and the user and their branch
+// from the body.
+func roleAssignment(c *fiber.Ctx) (*domain.RoleAssignment, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, errors.New("Invalid role id")
+	}
+
+	var req domain.RoleAssignment
+	if err := c.BodyParser(&req); err != nil {
+		return nil, errors.New("Invalid request")
+	}
+	req.RoleID = id
+
+	return &req, nil
+}
+
+// principal describes the caller from the locals set by JWTAuth.
+func principal(c *fiber.Ctx) *domain.Principal {
+	id, _ := c.Locals("id").(uuid.UUID)
+	company, _ := c.Locals("company").(string)
+	branch, _ := c.Locals("branch").(string)
+	role, _ := c.Locals("role").(string)
+	perms, _ := c.Locals("permissions").([]string)
+	actor, _ := c.Locals("actor").(*domain.Actor)
+
+	return &domain.Principal{
+		UserID:      id,
+		Company:     company,
+		Branch:      branch,
+		Role:        role,
+		Permissions: perms,
+		Actor:       actor,
+	}
+}
+
+func roleStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrRoleNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, domain.ErrPermissionEscalated), errors.Is(err, domain.ErrOutOfTenantScope):
+		return fiber.StatusForbidden
+	case errors.Is(err, domain.ErrUnknownPermission):
+		return fiber.StatusBadRequest
+	}
+
+	return fiber.StatusInternalServerError
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const scimContentType = "application/scim+json"
+
+type SCIMHandler struct {
+	scimService ports.SCIMService
+}
+
+func NewSCIMHandler(scimService ports.SCIMService) *SCIMHandler {
+	return &SCIMHandler{scimService: scimService}
+}
+
+// ServiceProviderConfig tells provisioning clients which optional SCIM
+// features are available.
+func (h *SCIMHandler) ServiceProviderConfig(c *fiber.Ctx) error {
+	return scimReply(c, fiber.StatusOK, fiber.Map{
+		"schemas":        []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		"patch":          fiber.Map{"supported": true},
+		"bulk":           fiber.Map{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         fiber.Map{"supported": true, "maxResults": 500},
+		"changePassword": fiber.Map{"supported": false},
+		"sort":           fiber.Map{"supported": false},
+		"etag":           fiber.Map{"supported": false},
+		"authenticationSchemes": []fiber.Map{{
+			"type":        "oauthbearertoken",
+			"name":        "API key",
+			"description": "Send a company API key as Authorization: Bearer or ApiKey",
+		}},
+	})
+}
+
+func (h *SCIMHandler) ListUsers(c *fiber.Ctx) error {
+	var req domain.SCIMListInput
+	if err := c.QueryParser(&req); err != nil {
+		return scimFail(c, &domain.SCIMError{Status: fiber.StatusBadRequest, Detail: "Invalid query"})
+	}
+
+	res, err := h.scimService.ListUsers(principal(c), &req)
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	return scimReply(c, fiber.StatusOK, res)
+}
+
+func (h *SCIMHandler) GetUser(c *fiber.Ctx) error {
+	res, err := h.scimService.GetUser(principal(c), c.Params("id"))
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	return scimReply(c, fiber.StatusOK, res)
+}
+
+func (h *SCIMHandler) CreateUser(c *fiber.Ctx) error {
+	var req domain.SCIMUser
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return scimFail(c, scimInvalidSyntax())
+	}
+
+	res, err := h.scimService.CreateUser(principal(c), &req)
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	c.Set(fiber.HeaderLocation, res.Meta.Location)
+	return scimReply(c, fiber.StatusCreated, res)
+}
+
+func (h *SCIMHandler) ReplaceUser(c *fiber.Ctx) error {
+	var req domain.SCIMUser
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return scimFail(c, scimInvalidSyntax())
+	}
+
+	res, err := h.scimService.ReplaceUser(principal(c), c.Params("id"), &req)
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	return scimReply(c, fiber.StatusOK, res)
+}
+
+func (h *SCIMHandler) PatchUser(c *fiber.Ctx) error {
+	var req domain.SCIMPatch
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return scimFail(c, scimInvalidSyntax())
+	}
+
+	res, err := h.scimService.PatchUser(principal(c), c.Params("id"), &req)
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	return scimReply(c, fiber.StatusOK, res)
+}
+
+func (h *SCIMHandler) DeleteUser(c *fiber.Ctx) error {
+	if err := h.scimService.DeleteUser(principal(c), c.Params("id")); err != nil {
+		return scimFail(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *SCIMHandler) ListGroups(c *fiber.Ctx) error {
+	var req domain.SCIMListInput
+	if err := c.QueryParser(&req); err != nil {
+		return scimFail(c, &domain.SCIMError{Status: fiber.StatusBadRequest, Detail: "Invalid query"})
+	}
+
+	res, err := h.scimService.ListGroups(principal(c), &req)
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	return scimReply(c, fiber.StatusOK, res)
+}
+
+func (h *SCIMHandler) GetGroup(c *fiber.Ctx) error {
+	res, err := h.scimService.GetGroup(principal(c), c.Params("id"))
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	return scimReply(c, fiber.StatusOK, res)
+}
+
+func (h *SCIMHandler) CreateGroup(c *fiber.Ctx) error {
+	var req domain.SCIMGroup
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return scimFail(c, scimInvalidSyntax())
+	}
+
+	res, err := h.scimService.CreateGroup(principal(c), &req)
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	c.Set(fiber.HeaderLocation, res.Meta.Location)
+	return scimReply(c, fiber.StatusCreated, res)
+}
+
+func (h *SCIMHandler) PatchGroup(c *fiber.Ctx) error {
+	var req domain.SCIMPatch
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return scimFail(c, scimInvalidSyntax())
+	}
+
+	res, err := h.scimService.PatchGroup(principal(c), c.Params("id"), &req)
+	if err != nil {
+		return scimFail(c, err)
+	}
+
+	return scimReply(c, fiber.StatusOK, res)
+}
+
+func (h *SCIMHandler) DeleteGroup(c *fiber.Ctx) error {
+	if err := h.scimService.DeleteGroup(principal(c), c.Params("id")); err != nil {
+		return scimFail(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func scimReply(c *fiber.Ctx, status int, body interface{}) error {
+	if err := c.Status(status).JSON(body); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, scimContentType)
+	return nil
+}
+
+// scimFail answers in the SCIM error format, which provisioning clients
+// parse instead of the {"error": ...} body the rest of the API uses.
+func scimFail(c *fiber.Ctx, err error) error {
+	var scimErr *domain.SCIMError
+	if !errors.As(err, &scimErr) {
+		scimErr = &domain.SCIMError{Status: fiber.StatusInternalServerError, Detail: err.Error()}
+	}
+
+	return scimReply(c, scimErr.Status, scimErr)
+}
+
+func scimInvalidSyntax() error {
+	return &domain.SCIMError{Status: fiber.StatusBadRequest, ScimType: "invalidSyntax", Detail: "Invalid request"}
+}
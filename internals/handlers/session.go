@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type SessionHandler struct {
+	tokenService ports.TokenService
+}
+
+func NewSessionHandler(tokenService ports.TokenService) *SessionHandler {
+	return &SessionHandler{tokenService: tokenService}
+}
+
+// ListMySessions lists the devices the caller is logged in on, flagging the
+// one the request came from.
+func (h *SessionHandler) ListMySessions(c *fiber.Ctx) error {
+	p := principal(c)
+	return h.listSessions(c, p, p.UserID)
+}
+
+func (h *SessionHandler) RevokeMySession(c *fiber.Ctx) error {
+	p := principal(c)
+	return h.revokeSession(c, p, p.UserID)
+}
+
+func (h *SessionHandler) ListUserSessions(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user id"})
+	}
+
+	return h.listSessions(c, principal(c), userID)
+}
+
+func (h *SessionHandler) RevokeUserSession(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user id"})
+	}
+
+	return h.revokeSession(c, principal(c), userID)
+}
+
+func (h *SessionHandler) listSessions(c *fiber.Ctx, p *domain.Principal, userID uuid.UUID) error {
+	res, err := h.tokenService.ListSessions(p, userID)
+	if err != nil {
+		return c.Status(sessionStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	current, _ := c.Locals("session_id").(uuid.UUID)
+	for i := range res {
+		res[i].Current = res[i].ID == current
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+func (h *SessionHandler) revokeSession(c *fiber.Ctx, p *domain.Principal, userID uuid.UUID) error {
+	sessionID, err := uuid.Parse(c.Params("session_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session id"})
+	}
+
+	if err := h.tokenService.RevokeSession(p, userID, sessionID); err != nil {
+		return c.Status(sessionStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": "Session successfully revoked"})
+}
+
+func sessionStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrSessionNotFound), errors.Is(err, domain.ErrUserNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, domain.ErrOutOfTenantScope):
+		return fiber.StatusForbidden
+	}
+
+	return fiber.StatusInternalServerError
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type TenantHandler struct {
+	tenantStatus ports.TenantStatusService
+}
+
+func NewTenantHandler(tenantStatus ports.TenantStatusService) *TenantHandler {
+	return &TenantHandler{tenantStatus: tenantStatus}
+}
+
+func (h *TenantHandler) SetCompanyStatus(c *fiber.Ctx) error {
+	return h.setStatus(c, "")
+}
+
+func (h *TenantHandler) SetBranchStatus(c *fiber.Ctx) error {
+	return h.setStatus(c, c.Params("branch"))
+}
+
+func (h *TenantHandler) setStatus(c *fiber.Ctx, branch string) error {
+	var req domain.TenantStatusInput
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	req.Company = c.Params("company")
+	req.Branch = branch
+
+	res, err := h.tenantStatus.SetStatus(&req)
+	if err != nil {
+		return c.Status(tenantStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{"data": res})
+}
+
+func tenantStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrInvalidTenantStatus):
+		return fiber.StatusBadRequest
+	case errors.Is(err, domain.ErrTenantNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, domain.ErrTenantSuspended), errors.Is(err, domain.ErrTenantReadOnly):
+		return fiber.StatusForbidden
+	}
+
+	return fiber.StatusInternalServerError
+}
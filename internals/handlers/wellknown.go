@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type WellKnownHandler struct {
+	issuer string
+}
+
+func NewWellKnownHandler(issuer string) *WellKnownHandler {
+	return &WellKnownHandler{issuer: issuer}
+}
+
+func (h *WellKnownHandler) JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(utils.JWKS())
+}
+
+// OpenIDConfiguration serves the OpenID Connect discovery document.
+func (h *WellKnownHandler) OpenIDConfiguration(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"issuer":                                h.issuer,
+		"authorization_endpoint":                h.issuer + "/oauth/authorize",
+		"token_endpoint":                        h.issuer + "/oauth/token",
+		"userinfo_endpoint":                     h.issuer + "/oauth/userinfo",
+		"jwks_uri":                              h.issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{domain.OAuthGrantAuthorizationCode, domain.OAuthGrantRefreshToken},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": utils.SigningAlgorithms(),
+		"scopes_supported":                      []string{domain.OAuthScopeOpenID, "profile", "email"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{domain.PKCEMethodS256},
+		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "nonce", "company", "branch", "role"},
+	})
+}
@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"fmt"
+	"go-multi-tenancy/internals/core/domain"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// logMailer does not deliver anything. It appends every message to a file,
+// or to the standard logger when no path is set, which is enough for tests
+// and development machines.
+type logMailer struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewLogMailer(path string) *logMailer {
+	return &logMailer{path: path}
+}
+
+func (m *logMailer) Send(mail *domain.Mail) error {
+	entry := fmt.Sprintf("--- %s\nTo: %s\nSubject: %s\n\n%s\n", time.Now().Format(time.RFC3339), mail.To, mail.Subject, mail.Body)
+
+	if m.path == "" {
+		log.Print(entry)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(entry)
+	return err
+}
@@ -1,16 +1,24 @@
 package middleware
 
 import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
 	"go-multi-tenancy/internals/utils"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
 // JWTAuth is a middleware function that handles JWT authentication.
 // It extracts the JWT token from the Authorization header, validates it,
+// checks that its session has not been revoked,
 // and stores user information in the locals of the context.
-func JWTAuth() fiber.Handler {
+// Integrations can send "ApiKey <key>" instead, which fills the same locals
+// from the API key with the role api_key.
+// Either way the request has to pass the company's network policies.
+func JWTAuth(tokens ports.TokenService, apiKeys ports.APIKeyService, network ports.NetworkPolicyService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get the Authorization header
 		authHeader := c.Get("Authorization")
@@ -24,12 +32,18 @@ func JWTAuth() fiber.Handler {
 
 		// Check if the Authorization header has the correct format
 		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		if len(parts) != 2 || (parts[0] != "Bearer" && parts[0] != "ApiKey") {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Invalid Authorization header format",
 			})
 		}
 
+		// Provisioning clients such as SCIM connectors only know how to send
+		// bearer tokens, so API keys are recognised by their prefix there too
+		if parts[0] == "ApiKey" || strings.HasPrefix(parts[1], domain.APIKeyPrefix+"_") {
+			return apiKeyAuth(c, apiKeys, network, parts[1])
+		}
+
 		// Extract the token from the Authorization header
 		tokenString := parts[1]
 
@@ -41,38 +55,205 @@ func JWTAuth() fiber.Handler {
 			})
 		}
 
-		// Store user information in the locals of the context
+		// Reject tokens whose session was logged out or revoked
+		sessionID, err := uuid.Parse(claims.SessionID)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid token",
+			})
+		}
+
+		userID, err := uuid.Parse(claims.UserID)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid token",
+			})
+		}
+
+		if err := tokens.ValidateSession(sessionID); err != nil {
+			if errors.Is(err, domain.ErrSessionRevoked) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Session has been revoked",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		// Impersonation tokens also name the super admin behind them, whose
+		// own session has to be alive for the impersonation to be
+		var actor *domain.Actor
+		if claims.Actor != nil {
+			actor, err = tokenActor(claims.Actor)
+			if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid token",
+				})
+			}
+			if err := tokens.ValidateSession(actor.SessionID); err != nil {
+				if errors.Is(err, domain.ErrSessionRevoked) {
+					return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+						"error": "Session has been revoked",
+					})
+				}
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+		}
+
+		// Network policies are checked on every request, not only at login,
+		// so a token taken off the branch network stops working. Super admins
+		// impersonating a user are judged by their own role.
+		role := claims.Role
+		if actor != nil {
+			role = actor.Role
+		}
+		if err := checkNetwork(c, network, claims.Company, claims.Branch, role); err != nil {
+			return err
+		}
+
+		// Store user information in the locals of the context. The effective
+		// identity is the impersonated user, the real one is in actor.
+		c.Locals("id", userID)
+		c.Locals("session_id", sessionID)
 		c.Locals("username", claims.ID)
 		c.Locals("company", claims.Company)
 		c.Locals("branch", claims.Branch)
 		c.Locals("role", claims.Role)
+		c.Locals("permissions", claims.Permissions)
+		if actor != nil {
+			c.Locals("actor", actor)
+		}
 
 		// Continue to the next handler in the chain
 		return c.Next()
 	}
 }
 
-// AuthorizeRole is a middleware function that checks if the user's role
-// matches the required role. If the user's role does not match the required
-// role, it returns a 403 Forbidden response.
+// apiKeyAuth authenticates a request made with an API key.
+func apiKeyAuth(c *fiber.Ctx, apiKeys ports.APIKeyService, network ports.NetworkPolicyService, key string) error {
+	record, err := apiKeys.Authenticate(key)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidAPIKey) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid API key",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := checkNetwork(c, network, record.Company, record.Branch, domain.RoleAPIKey); err != nil {
+		return err
+	}
+
+	// Store the key's identity in the same locals a user token fills
+	c.Locals("id", record.ID)
+	c.Locals("session_id", uuid.Nil)
+	c.Locals("username", record.Name)
+	c.Locals("company", record.Company)
+	c.Locals("branch", record.Branch)
+	c.Locals("role", domain.RoleAPIKey)
+	c.Locals("permissions", record.Permissions)
+	c.Locals("api_key_id", record.ID)
+
+	// Continue to the next handler in the chain
+	return c.Next()
+}
+
+// checkNetwork answers 403 when the network policies refuse the request,
+// and returns nil to let it through.
+func checkNetwork(c *fiber.Ctx, network ports.NetworkPolicyService, company, branch, role string) error {
+	err := network.Check(&domain.NetworkCheck{
+		Company: company,
+		Branch:  branch,
+		Role:    role,
+		IP:      c.IP(),
+	})
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, domain.ErrNetworkNotAllowed) || errors.Is(err, domain.ErrOutsideLoginHours) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
+
+// tokenActor reads the act claim of an impersonation token.
+func tokenActor(claims *utils.Actor) (*domain.Actor, error) {
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.Actor{
+		UserID:    userID,
+		SessionID: sessionID,
+		Username:  claims.ID,
+		Company:   claims.Company,
+		Branch:    claims.Branch,
+		Role:      claims.Role,
+	}, nil
+}
+
+// BlockImpersonation is a middleware function that rejects impersonation
+// tokens on destructive routes, so support staff can look around a user's
+// account without deleting data or changing credentials in their name.
+// Returns:
+// - fiber.Handler: a function that handles the request and returns an error.
+func BlockImpersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if actor, _ := c.Locals("actor").(*domain.Actor); actor != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not allowed while impersonating"})
+		}
+
+		return c.Next()
+	}
+}
+
+// RequireUser is a middleware function that rejects API keys on routes that
+// act on the calling user's own account, such as logout or MFA enrolment.
+// Returns:
+// - fiber.Handler: a function that handles the request and returns an error.
+func RequireUser() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if role, _ := c.Locals("role").(string); role == domain.RoleAPIKey {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not available to API keys"})
+		}
+
+		return c.Next()
+	}
+}
+
+// RequirePermission is a middleware function that checks if the caller's
+// access token carries the required permission, either through the built-in
+// role or a company role assigned to the user. If it does not, it returns a
+// 403 Forbidden response.
 // Parameters:
-// - requiredRole: the required role for access.
+// - permission: the permission required for access.
 // Returns:
 // - fiber.Handler: a function that handles the request and returns an error.
-func AuthorizeRole(requiredRole string) fiber.Handler {
+func RequirePermission(permission string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get the user's role from the context
-		userRole, ok := c.Locals("role").(string)
-
-		// Check if the user's role is missing or does not match the required role
-		if userRole != "super_admin" {
-			if !ok || userRole != requiredRole {
-				// Return a 403 Forbidden response
-				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
-			}
+		perms, _ := c.Locals("permissions").([]string)
+
+		if !domain.HasPermission(perms, permission) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
 		}
 
-		// Continue to the next handler in the chain
 		return c.Next()
 	}
 }
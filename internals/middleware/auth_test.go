@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const testAPIKey = domain.APIKeyPrefix + "_0a1b2c3d4e5f_s3cr3t"
+
+// fakeAPIKeys knows testAPIKey for acme/hq and refuses anything else, the way
+// the service refuses unknown, revoked and expired keys alike.
+type fakeAPIKeys struct{ ports.APIKeyService }
+
+func (fakeAPIKeys) Authenticate(key string) (*domain.APIKey, error) {
+	if key != testAPIKey {
+		return nil, domain.ErrInvalidAPIKey
+	}
+	return &domain.APIKey{ID: uuid.New(), Company: "acme", Branch: "hq", Name: "ci", Permissions: []string{domain.PermUsersRead}}, nil
+}
+
+// fakeNetwork refuses the companies listed in denied.
+type fakeNetwork struct {
+	ports.NetworkPolicyService
+	denied map[string]bool
+}
+
+func (f fakeNetwork) Check(data *domain.NetworkCheck) error {
+	if f.denied[data.Company] {
+		return domain.ErrNetworkNotAllowed
+	}
+	return nil
+}
+
+func TestJWTAuthAPIKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		denied bool
+		want   int
+	}{
+		{name: "ApiKey scheme", header: "ApiKey " + testAPIKey, want: fiber.StatusOK},
+		{name: "bearer with key prefix", header: "Bearer " + testAPIKey, want: fiber.StatusOK},
+		{name: "revoked or expired", header: "ApiKey " + domain.APIKeyPrefix + "_0a1b2c3d4e5f_revoked", want: fiber.StatusUnauthorized},
+		{name: "ApiKey scheme without key prefix", header: "ApiKey s3cr3t", want: fiber.StatusUnauthorized},
+		{name: "other scheme", header: "Basic " + testAPIKey, want: fiber.StatusUnauthorized},
+		{name: "no key", header: "ApiKey", want: fiber.StatusUnauthorized},
+		{name: "outside the network policy", header: "ApiKey " + testAPIKey, denied: true, want: fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network := fakeNetwork{denied: map[string]bool{"acme": tt.denied}}
+
+			app := fiber.New()
+			app.Get("/", JWTAuth(nil, fakeAPIKeys{}, network), func(c *fiber.Ctx) error {
+				role, _ := c.Locals("role").(string)
+				company, _ := c.Locals("company").(string)
+				branch, _ := c.Locals("branch").(string)
+				return c.SendString(role + " " + company + "/" + branch)
+			})
+
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			req.Header.Set("Authorization", tt.header)
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", res.StatusCode, tt.want)
+			}
+
+			if tt.want == fiber.StatusOK {
+				body, _ := io.ReadAll(res.Body)
+				if got := string(body); got != domain.RoleAPIKey+" acme/hq" {
+					t.Errorf("locals = %q, want the key's tenant with role %s", got, domain.RoleAPIKey)
+				}
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name  string
+		perms []string
+		want  int
+	}{
+		{name: "built-in role with it", perms: domain.RolePermissions(domain.RoleHeadAdmin), want: fiber.StatusOK},
+		{name: "built-in role without it", perms: domain.RolePermissions(domain.RoleAdmin), want: fiber.StatusForbidden},
+		{name: "granted by a company role", perms: append(domain.RolePermissions(domain.RoleUser), domain.PermRolesManage), want: fiber.StatusOK},
+		{name: "API key with it", perms: []string{domain.PermRolesManage}, want: fiber.StatusOK},
+		{name: "no permissions", perms: []string{}, want: fiber.StatusForbidden},
+		{name: "no locals", want: fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				if tt.perms != nil {
+					c.Locals("permissions", tt.perms)
+				}
+				return c.Next()
+			})
+			app.Get("/roles", RequirePermission(domain.PermRolesManage), func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			res, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/roles", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockImpersonation(t *testing.T) {
+	tests := []struct {
+		name  string
+		actor *domain.Actor
+		want  int
+	}{
+		{name: "own token", want: fiber.StatusOK},
+		{name: "impersonation token", actor: &domain.Actor{UserID: uuid.New(), Role: domain.RoleSuperAdmin}, want: fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				if tt.actor != nil {
+					c.Locals("actor", tt.actor)
+				}
+				return c.Next()
+			})
+			app.Delete("/data", BlockImpersonation(), func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			res, err := app.Test(httptest.NewRequest(fiber.MethodDelete, "/data", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.want)
+			}
+		})
+	}
+}
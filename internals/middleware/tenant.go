@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TenantScope is a middleware function that binds the :company and :branch
+// path parameters to the caller's own tenant. Callers with branches:manage
+// can reach their whole company, callers with tenants:manage every company,
+// and everyone else only their own branch. Requests outside the caller's scope get a 403 Forbidden
+// response. It must run after JWTAuth.
+// Returns:
+// - fiber.Handler: a function that handles the request and returns an error.
+func TenantScope() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		perms, _ := c.Locals("permissions").([]string)
+		company, _ := c.Locals("company").(string)
+		branch, _ := c.Locals("branch").(string)
+
+		if !domain.InTenantScope(perms, company, branch, c.Params("company"), c.Params("branch")) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+		}
+
+		return c.Next()
+	}
+}
+
+// TenantStatus is a middleware function that enforces the state of the
+// caller's company and branch. Requests from suspended tenants get a 403
+// Forbidden response, and so do writes from read-only tenants. Platform
+// operators with tenants:manage are let through so they can fix things up.
+// It must run after JWTAuth.
+// Returns:
+// - fiber.Handler: a function that handles the request and returns an error.
+func TenantStatus(statuses ports.TenantStatusService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		perms, _ := c.Locals("permissions").([]string)
+		if domain.HasPermission(perms, domain.PermTenantsManage) {
+			return c.Next()
+		}
+
+		company, _ := c.Locals("company").(string)
+		branch, _ := c.Locals("branch").(string)
+
+		write := true
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			write = false
+		}
+
+		err := statuses.Check(company, branch, write)
+		if err != nil {
+			if errors.Is(err, domain.ErrTenantSuspended) || errors.Is(err, domain.ErrTenantReadOnly) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// scopeApp serves the tenant routes behind TenantScope for a caller with the
+// given role in acme/hq, the way JWTAuth would leave the locals.
+func scopeApp(role string) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("permissions", domain.RolePermissions(role))
+		c.Locals("company", "acme")
+		c.Locals("branch", "hq")
+		return c.Next()
+	})
+
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	app.Get("/data/company/:company", TenantScope(), ok)
+	app.Get("/data/company/:company/branch/:branch", TenantScope(), ok)
+	return app
+}
+
+func TestTenantScope(t *testing.T) {
+	tests := []struct {
+		name string
+		role string
+		path string
+		want int
+	}{
+		{name: "branch admin in own branch", role: domain.RoleAdmin, path: "/data/company/acme/branch/hq", want: fiber.StatusOK},
+		{name: "branch admin in sibling branch", role: domain.RoleAdmin, path: "/data/company/acme/branch/east", want: fiber.StatusForbidden},
+		{name: "branch admin on whole company", role: domain.RoleAdmin, path: "/data/company/acme", want: fiber.StatusForbidden},
+		{name: "company admin in sibling branch", role: domain.RoleHeadAdmin, path: "/data/company/acme/branch/east", want: fiber.StatusOK},
+		{name: "company admin on whole company", role: domain.RoleHeadAdmin, path: "/data/company/acme", want: fiber.StatusOK},
+		{name: "company admin in other company", role: domain.RoleHeadAdmin, path: "/data/company/globex/branch/hq", want: fiber.StatusForbidden},
+		{name: "company admin on other whole company", role: domain.RoleHeadAdmin, path: "/data/company/globex", want: fiber.StatusForbidden},
+		{name: "super admin in other company", role: domain.RoleSuperAdmin, path: "/data/company/globex/branch/hq", want: fiber.StatusOK},
+		{name: "super admin on other whole company", role: domain.RoleSuperAdmin, path: "/data/company/globex", want: fiber.StatusOK},
+		{name: "user in own branch", role: domain.RoleUser, path: "/data/company/acme/branch/hq", want: fiber.StatusOK},
+		{name: "user in sibling branch", role: domain.RoleUser, path: "/data/company/acme/branch/east", want: fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := scopeApp(tt.role).Test(httptest.NewRequest(fiber.MethodGet, tt.path, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.want {
+				t.Errorf("GET %s as %s = %d, want %d", tt.path, tt.role, res.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestTenantScopeWithoutLocals(t *testing.T) {
+	// A route mounted before JWTAuth by mistake must not open every tenant
+	app := fiber.New()
+	app.Get("/data/company/:company", TenantScope(), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	res, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/data/company/acme", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != fiber.StatusForbidden {
+		t.Errorf("status = %d, want 403", res.StatusCode)
+	}
+}
+
+// fakeStatuses holds acme/hq in status, the way the service would report it.
+type fakeStatuses struct {
+	ports.TenantStatusService
+	status string
+}
+
+func (f fakeStatuses) Check(company, branch string, write bool) error {
+	switch {
+	case company != "acme" || branch != "hq":
+		return errors.New("unexpected tenant " + company + "/" + branch)
+	case f.status == domain.TenantSuspended:
+		return domain.ErrTenantSuspended
+	case f.status == domain.TenantReadOnly && write:
+		return domain.ErrTenantReadOnly
+	case f.status == "broken":
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestTenantStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		role   string
+		method string
+		want   int
+	}{
+		{name: "active write", status: domain.TenantActive, role: domain.RoleUser, method: fiber.MethodPost, want: fiber.StatusOK},
+		{name: "read-only read", status: domain.TenantReadOnly, role: domain.RoleUser, method: fiber.MethodGet, want: fiber.StatusOK},
+		{name: "read-only head", status: domain.TenantReadOnly, role: domain.RoleUser, method: fiber.MethodHead, want: fiber.StatusOK},
+		{name: "read-only write", status: domain.TenantReadOnly, role: domain.RoleHeadAdmin, method: fiber.MethodPut, want: fiber.StatusForbidden},
+		{name: "read-only delete", status: domain.TenantReadOnly, role: domain.RoleUser, method: fiber.MethodDelete, want: fiber.StatusForbidden},
+		{name: "suspended read", status: domain.TenantSuspended, role: domain.RoleHeadAdmin, method: fiber.MethodGet, want: fiber.StatusForbidden},
+		{name: "suspended, platform operator", status: domain.TenantSuspended, role: domain.RoleSuperAdmin, method: fiber.MethodPost, want: fiber.StatusOK},
+		{name: "lookup failure", status: "broken", role: domain.RoleUser, method: fiber.MethodGet, want: fiber.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				c.Locals("permissions", domain.RolePermissions(tt.role))
+				c.Locals("company", "acme")
+				c.Locals("branch", "hq")
+				return c.Next()
+			})
+			app.All("/data", TenantStatus(fakeStatuses{status: tt.status}), func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			res, err := app.Test(httptest.NewRequest(tt.method, "/data", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.want {
+				t.Errorf("%s as %s in a %s tenant = %d, want %d", tt.method, tt.role, tt.status, res.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"go-multi-tenancy/internals/core/domain"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type actionTokenRepository struct {
+	db *sqlx.DB
+}
+
+func NewActionTokenRepository(db *sqlx.DB) *actionTokenRepository {
+	return &actionTokenRepository{db: db}
+}
+
+func (r *actionTokenRepository) CreateActionToken(data *domain.ActionToken) (*domain.ActionToken, error) {
+	// Expiry is computed by the database because UseActionToken compares it with the database clock
+	query := "INSERT INTO company.action_tokens (purpose, user_id, expires_at) VALUES ($1, $2, CURRENT_TIMESTAMP + make_interval(secs => $3)) RETURNING id, expires_at, create_at"
+	err := r.db.QueryRow(query, data.Purpose, data.UserID, time.Until(data.ExpiresAt).Seconds()).Scan(&data.ID, &data.ExpiresAt, &data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// CheckActionToken reports whether the token exists, has not expired and was
+// neither used nor burnt, without using it.
+func (r *actionTokenRepository) CheckActionToken(data *domain.ActionToken) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM company.action_tokens
+		WHERE id = $1 AND purpose = $2 AND user_id = $3 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP)`
+	var usable bool
+	if err := r.db.QueryRow(query, data.ID, data.Purpose, data.UserID).Scan(&usable); err != nil {
+		return false, err
+	}
+	return usable, nil
+}
+
+// UseActionToken marks an unexpired token as used. It reports false when the
+// token does not exist, has expired or was already used.
+func (r *actionTokenRepository) UseActionToken(data *domain.ActionToken) (bool, error) {
+	query := `UPDATE company.action_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND purpose = $2 AND user_id = $3 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP`
+	res, err := r.db.Exec(query, data.ID, data.Purpose, data.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// FailActionToken counts a wrong answer given with an unused token and burns
+// the token once maxFailures is reached. It reports whether the token can
+// still be used.
+func (r *actionTokenRepository) FailActionToken(data *domain.ActionToken, maxFailures int) (bool, error) {
+	query := `UPDATE company.action_tokens SET failures = failures + 1,
+			used_at = CASE WHEN failures + 1 >= $4 THEN CURRENT_TIMESTAMP END
+		WHERE id = $1 AND purpose = $2 AND user_id = $3 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING used_at IS NULL`
+	var usable bool
+	err := r.db.QueryRow(query, data.ID, data.Purpose, data.UserID, maxFailures).Scan(&usable)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return usable, nil
+}
@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const apiKeyColumns = "id, company, branch, name, prefix, key_hash, permissions, created_by, expires_at, last_used_at, revoked_at, create_at"
+
+type apiKeyRepository struct {
+	db *sqlx.DB
+}
+
+func NewAPIKeyRepository(db *sqlx.DB) *apiKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) GetAPIKeys(data *domain.APIKey) ([]domain.APIKey, error) {
+	keys := []domain.APIKey{}
+
+	query := "SELECT " + apiKeyColumns + " FROM company.api_keys WHERE company = $1 ORDER BY create_at DESC"
+	rows, err := r.db.Query(query, data.Company)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k domain.APIKey
+		err := rows.Scan(&k.ID, &k.Company, &k.Branch, &k.Name, &k.Prefix, &k.KeyHash, pq.Array(&k.Permissions), &k.CreatedBy, &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt, &k.CreateAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (r *apiKeyRepository) GetAPIKey(data *domain.APIKey) (*domain.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM company.api_keys WHERE id = $1 AND company = $2"
+	err := r.db.QueryRow(query, data.ID, data.Company).Scan(&data.ID, &data.Company, &data.Branch, &data.Name, &data.Prefix, &data.KeyHash, pq.Array(&data.Permissions), &data.CreatedBy, &data.ExpiresAt, &data.LastUsedAt, &data.RevokedAt, &data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetActiveAPIKey finds a key by prefix, skipping revoked and expired keys.
+// Expiry is checked against the database clock it was computed with.
+func (r *apiKeyRepository) GetActiveAPIKey(data *domain.APIKey) (*domain.APIKey, error) {
+	query := "SELECT " + apiKeyColumns + ` FROM company.api_keys
+		WHERE prefix = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)`
+	err := r.db.QueryRow(query, data.Prefix).Scan(&data.ID, &data.Company, &data.Branch, &data.Name, &data.Prefix, &data.KeyHash, pq.Array(&data.Permissions), &data.CreatedBy, &data.ExpiresAt, &data.LastUsedAt, &data.RevokedAt, &data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *apiKeyRepository) CreateAPIKey(data *domain.APIKey, expiresIn int) (*domain.APIKey, error) {
+	query := `INSERT INTO company.api_keys (company, branch, name, prefix, key_hash, permissions, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CASE WHEN $8 > 0 THEN CURRENT_TIMESTAMP + make_interval(secs => $8) END)
+		RETURNING id, expires_at, create_at`
+	err := r.db.QueryRow(query, data.Company, data.Branch, data.Name, data.Prefix, data.KeyHash, pq.Array(data.Permissions), data.CreatedBy, expiresIn).Scan(&data.ID, &data.ExpiresAt, &data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *apiKeyRepository) RevokeAPIKey(data *domain.APIKey) (bool, error) {
+	query := "UPDATE company.api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND company = $2 AND revoked_at IS NULL"
+	res, err := r.db.Exec(query, data.ID, data.Company)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *apiKeyRepository) TouchAPIKey(data *domain.APIKey) error {
+	query := "UPDATE company.api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1"
+	_, err := r.db.Exec(query, data.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,341 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-multi-tenancy/internals/core/domain"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const archiveColumns = "id, company, branch, table_name, archived_table, tenant_id, branch_tables, archived_at, purge_after"
+
+// ArchiveCompany detaches the company's partition and moves it, branches
+// included, into the company_archive schema under names of its own, so the
+// company slug can be reused while the archive waits. The company's rows in
+// the other tables go into the archive record, so a new company under the
+// slug starts without its keys, roles and policies. The archive can be
+// restored until retention seconds have passed.
+func (m *manageRepository) ArchiveCompany(data *domain.Tenant, retention int) (*domain.Archive, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	company, err := tenantOf(tx, data.Company, "")
+	if err != nil {
+		return nil, err
+	}
+
+	archive := newArchive(data.Company, "", company)
+
+	//step 1: remember the branches => company
+	err = tx.QueryRow(`SELECT COALESCE(array_agg(c.relname::text ORDER BY c.relname), '{}')
+		FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = $1::regclass`, partition(archive.TableName)).Scan(pq.Array(&archive.BranchTables))
+	if err != nil {
+		return nil, err
+	}
+
+	//step 2: detach company => company
+	_, err = tx.Exec(fmt.Sprintf(`ALTER TABLE company.accounts DETACH PARTITION %s;`, partition(archive.TableName)))
+	if err != nil {
+		return nil, err
+	}
+
+	//step 3: move company and branches => archived names
+	err = moveToArchive(tx, archive.TableName, archive.ArchivedTable)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, branch := range archive.BranchTables {
+		err = moveToArchive(tx, branch, archive.ArchivedTable+"_"+strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//step 4: record the archive with the registry entries and rows it takes along => company
+	err = saveArchive(tx, archive, retention, "company = $1", data.Company)
+	if err != nil {
+		return nil, err
+	}
+
+	err = archiveSideRows(tx, archive.ID, data.Company, "")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM company.tenants WHERE company = $1", data.Company)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+func (m *manageRepository) ArchiveBranch(data *domain.Tenant, retention int) (*domain.Archive, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	company, err := tenantOf(tx, data.Company, "")
+	if err != nil {
+		return nil, err
+	}
+
+	branch, err := tenantOf(tx, data.Company, data.Branch)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := newArchive(data.Company, data.Branch, branch)
+
+	//step 1: detach branch => company, branch
+	_, err = tx.Exec(fmt.Sprintf(`ALTER TABLE %s DETACH PARTITION %s;`, partition(company.Partition), partition(archive.TableName)))
+	if err != nil {
+		return nil, err
+	}
+
+	//step 2: move branch => archived name
+	err = moveToArchive(tx, archive.TableName, archive.ArchivedTable)
+	if err != nil {
+		return nil, err
+	}
+
+	//step 3: record the archive with the registry entry and rows it takes along => company, branch
+	err = saveArchive(tx, archive, retention, "company = $1 AND branch = $2", data.Company, data.Branch)
+	if err != nil {
+		return nil, err
+	}
+
+	err = archiveSideRows(tx, archive.ID, data.Company, data.Branch)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM company.tenants WHERE company = $1 AND branch = $2", data.Company, data.Branch)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+func (m *manageRepository) GetArchives() ([]domain.Archive, error) {
+	return m.getArchives("SELECT " + archiveColumns + " FROM company.archives ORDER BY archived_at DESC")
+}
+
+// GetExpiredArchives returns the archives whose retention has ended.
+func (m *manageRepository) GetExpiredArchives() ([]domain.Archive, error) {
+	return m.getArchives("SELECT " + archiveColumns + " FROM company.archives WHERE purge_after <= CURRENT_TIMESTAMP ORDER BY purge_after")
+}
+
+// RestoreArchive moves an archived partition back under its old names,
+// attaches it under its tenant id again and brings back its registry entries
+// and the rows it took along. It refuses while another tenant has taken the
+// archived slug.
+func (m *manageRepository) RestoreArchive(data *domain.Archive) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	archive := &domain.Archive{}
+	var tenants []byte
+	var legacy bool
+	query := "SELECT " + archiveColumns + ", tenants, legacy FROM company.archives WHERE id = $1 FOR UPDATE"
+	err = tx.QueryRow(query, data.ID).Scan(&archive.ID, &archive.Company, &archive.Branch, &archive.TableName, &archive.ArchivedTable, &archive.TenantID, pq.Array(&archive.BranchTables), &archive.ArchivedAt, &archive.PurgeAfter, &tenants, &legacy)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrArchiveNotFound
+		}
+		return err
+	}
+	if legacy {
+		return domain.ErrArchiveLegacy
+	}
+	if archive.TenantID == uuid.Nil {
+		return fmt.Errorf("archive %s has no tenant id on record", archive.ID)
+	}
+
+	//step 1: check the slug and the names are still free => company, branch, tables
+	_, err = tenantOf(tx, archive.Company, archive.Branch)
+	if err == nil {
+		return domain.ErrArchiveConflict
+	}
+	if !errors.Is(err, domain.ErrTenantNotFound) {
+		return err
+	}
+
+	parent := "accounts"
+	if archive.Branch != "" {
+		company, err := tenantOf(tx, archive.Company, "")
+		if errors.Is(err, domain.ErrTenantNotFound) {
+			return domain.ErrArchiveParentMissing
+		}
+		if err != nil {
+			return err
+		}
+		parent = company.Partition
+	}
+
+	for _, table := range append([]string{archive.TableName}, archive.BranchTables...) {
+		exists, err := m.tableExists(table)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return domain.ErrArchiveConflict
+		}
+	}
+
+	//step 2: move back => archived names, old names
+	err = moveFromArchive(tx, archive.ArchivedTable, archive.TableName)
+	if err != nil {
+		return err
+	}
+
+	for i, branch := range archive.BranchTables {
+		err = moveFromArchive(tx, archive.ArchivedTable+"_"+strconv.Itoa(i), branch)
+		if err != nil {
+			return err
+		}
+	}
+
+	//step 3: attach => parent, table, tenant id
+	_, err = tx.Exec(fmt.Sprintf(`ALTER TABLE %s ATTACH PARTITION %s FOR VALUES IN (%s);`, partition(parent), partition(archive.TableName), literal(archive.TenantID.String())))
+	if err != nil {
+		return err
+	}
+
+	//step 4: registry, the rows taken along and archive record
+	_, err = tx.Exec(`INSERT INTO company.tenants SELECT * FROM jsonb_populate_recordset(NULL::company.tenants, $1) ON CONFLICT DO NOTHING`, string(tenants))
+	if err != nil {
+		return err
+	}
+
+	err = restoreSideRows(tx, archive.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM company.archives WHERE id = $1", archive.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PurgeArchive drops an archived partition, with its branches, for good.
+func (m *manageRepository) PurgeArchive(data *domain.Archive) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Dropping a company's partitioned table drops its branch partitions too
+	_, err = tx.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s;`, archived(data.ArchivedTable)))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM company.archives WHERE id = $1", data.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *manageRepository) getArchives(query string, args ...interface{}) ([]domain.Archive, error) {
+	archives := []domain.Archive{}
+
+	rows, err := m.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a domain.Archive
+		err := rows.Scan(&a.ID, &a.Company, &a.Branch, &a.TableName, &a.ArchivedTable, &a.TenantID, pq.Array(&a.BranchTables), &a.ArchivedAt, &a.PurgeAfter)
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return archives, nil
+}
+
+// newArchive names the archived table after the archive id, which fits the
+// identifier limit and cannot clash with an earlier archive of the same name.
+func newArchive(company, branch string, tenant *domain.Tenant) *domain.Archive {
+	id := uuid.New()
+	return &domain.Archive{
+		ID:            id,
+		Company:       company,
+		Branch:        branch,
+		TableName:     tenant.Partition,
+		ArchivedTable: "a_" + strings.ReplaceAll(id.String(), "-", ""),
+		TenantID:      tenant.ID,
+		BranchTables:  []string{},
+	}
+}
+
+func moveToArchive(tx *sql.Tx, table, archivedTable string) error {
+	_, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s RENAME TO %s;`, partition(table), pq.QuoteIdentifier(archivedTable)))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`ALTER TABLE %s SET SCHEMA company_archive;`, partition(archivedTable)))
+	return err
+}
+
+func moveFromArchive(tx *sql.Tx, archivedTable, table string) error {
+	_, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s SET SCHEMA company;`, archived(archivedTable)))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`ALTER TABLE %s RENAME TO %s;`, partition(archivedTable), pq.QuoteIdentifier(table)))
+	return err
+}
+
+// saveArchive records the archive together with the registry entries
+// matching where, so a restore brings back names and settings as they were.
+func saveArchive(tx *sql.Tx, archive *domain.Archive, retention int, where string, args ...interface{}) error {
+	n := len(args)
+	query := fmt.Sprintf(`INSERT INTO company.archives (id, company, branch, table_name, archived_table, tenant_id, branch_tables, tenants, purge_after)
+		VALUES ($%d, $%d, $%d, $%d, $%d, $%d, $%d,
+			(SELECT COALESCE(jsonb_agg(to_jsonb(t)), '[]') FROM company.tenants t WHERE %s),
+			CURRENT_TIMESTAMP + make_interval(secs => $%d))
+		RETURNING archived_at, purge_after`, n+1, n+2, n+3, n+4, n+5, n+6, n+7, where, n+8)
+
+	args = append(args, archive.ID, archive.Company, archive.Branch, archive.TableName, archive.ArchivedTable, archive.TenantID, pq.Array(archive.BranchTables), retention)
+	return tx.QueryRow(query, args...).Scan(&archive.ArchivedAt, &archive.PurgeAfter)
+}
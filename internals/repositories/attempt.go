@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type loginAttemptRepository struct {
+	db *sqlx.DB
+}
+
+func NewLoginAttemptRepository(db *sqlx.DB) *loginAttemptRepository {
+	return &loginAttemptRepository{db: db}
+}
+
+func (r *loginAttemptRepository) GetAttempt(data *domain.LoginAttempt) (*domain.LoginAttempt, error) {
+	query := `SELECT key, failures, last_failure_at, locked_until,
+			COALESCE(GREATEST(CEIL(EXTRACT(EPOCH FROM locked_until - CURRENT_TIMESTAMP)), 0), 0)::int
+		FROM company.login_attempts WHERE key = $1`
+	err := r.db.QueryRow(query, data.Key).Scan(&data.Key, &data.Failures, &data.LastFailureAt, &data.LockedUntil, &data.LockedFor)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// RecordFailure counts a failed attempt. Failures older than the window are
+// forgotten, so the counter starts again at one.
+func (r *loginAttemptRepository) RecordFailure(data *domain.LoginAttempt, windowSeconds int) (*domain.LoginAttempt, error) {
+	query := `INSERT INTO company.login_attempts (key, failures, last_failure_at) VALUES ($1, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN company.login_attempts.last_failure_at < CURRENT_TIMESTAMP - make_interval(secs => $2) THEN 1 ELSE company.login_attempts.failures + 1 END,
+			last_failure_at = CURRENT_TIMESTAMP
+		RETURNING failures, last_failure_at, locked_until`
+	err := r.db.QueryRow(query, data.Key, windowSeconds).Scan(&data.Failures, &data.LastFailureAt, &data.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Lock sets locked_until relative to the database clock, the same clock
+// GetAttempt measures the remaining time against.
+func (r *loginAttemptRepository) Lock(data *domain.LoginAttempt, seconds int) error {
+	query := "UPDATE company.login_attempts SET locked_until = CURRENT_TIMESTAMP + make_interval(secs => $2) WHERE key = $1"
+	_, err := r.db.Exec(query, data.Key, seconds)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *loginAttemptRepository) ResetAttempts(data *domain.LoginAttempt) error {
+	query := "DELETE FROM company.login_attempts WHERE key = $1"
+	_, err := r.db.Exec(query, data.Key)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const auditColumns = "id, action, actor_id, actor_username, actor_company, target_id, target_company, target_branch, session_id, reason, ip, create_at"
+
+type auditRepository struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepository(db *sqlx.DB) *auditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) CreateAuditEvent(data *domain.AuditEvent) error {
+	query := `INSERT INTO company.audit_log (action, actor_id, actor_username, actor_company, target_id, target_company, target_branch, session_id, reason, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, create_at`
+	err := r.db.QueryRow(query, data.Action, data.ActorID, data.ActorUsername, data.ActorCompany, data.TargetID, data.TargetCompany, data.TargetBranch, data.SessionID, data.Reason, data.IP).Scan(&data.ID, &data.CreateAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetAuditEvents returns the newest events first. Empty query fields do not filter.
+func (r *auditRepository) GetAuditEvents(data *domain.AuditQuery) ([]domain.AuditEvent, error) {
+	events := []domain.AuditEvent{}
+
+	conditions := []string{"true"}
+	args := []interface{}{}
+	if data.Action != "" {
+		args = append(args, data.Action)
+		conditions = append(conditions, "action = $"+strconv.Itoa(len(args)))
+	}
+	if data.Company != "" {
+		args = append(args, data.Company)
+		conditions = append(conditions, "target_company = $"+strconv.Itoa(len(args)))
+	}
+	if data.ActorID != "" {
+		args = append(args, data.ActorID)
+		conditions = append(conditions, "actor_id::text = $"+strconv.Itoa(len(args)))
+	}
+	args = append(args, data.Limit)
+
+	query := "SELECT " + auditColumns + " FROM company.audit_log WHERE " + strings.Join(conditions, " AND ") + " ORDER BY create_at DESC LIMIT $" + strconv.Itoa(len(args))
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e domain.AuditEvent
+		err := rows.Scan(&e.ID, &e.Action, &e.ActorID, &e.ActorUsername, &e.ActorCompany, &e.TargetID, &e.TargetCompany, &e.TargetBranch, &e.SessionID, &e.Reason, &e.IP, &e.CreateAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -1,7 +1,6 @@
 package repositories
 
 import (
-	"fmt"
 	"go-multi-tenancy/internals/core/domain"
 	"strconv"
 	"strings"
@@ -9,6 +8,18 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
+// dataColumns lists the onesystem columns in the order every scan expects them.
+// onesystem is a view adding the tenant slugs to company.accounts, which is
+// what writes go to.
+const dataColumns = "company, branch, id, first_name, last_name, username, password, create_at, update_at, delete_at, role, COALESCE(email, ''), email_verified_at"
+
+// accountKey matches the company.accounts rows of a branch, given the
+// placeholders holding its company and branch slugs.
+func accountKey(company, branch int) string {
+	c, b := "$"+strconv.Itoa(company), "$"+strconv.Itoa(branch)
+	return "company_id = company.tenant_id(" + c + ", '') AND branch_id = company.tenant_id(" + c + ", " + b + ")"
+}
+
 type companyRepository struct {
 	db *sqlx.DB
 }
@@ -18,8 +29,8 @@ func NewCompanyRepository(db *sqlx.DB) *companyRepository {
 }
 
 func (r *companyRepository) Register(data *domain.Data) (*domain.Data, error) {
-	query := "INSERT INTO company.onesystem (company, branch, first_name, last_name, username, password, role)   VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING company, branch,  id, first_name, last_name, username,  create_at"
-	err := r.db.QueryRow(query, data.Company, data.Branch, data.FirstName, data.LastName, data.Username, data.Password, data.Role).Scan(&data.Company, &data.Branch, &data.ID, &data.FirstName, &data.LastName, &data.Username, &data.CreateAt)
+	query := "INSERT INTO company.accounts (company_id, branch_id, first_name, last_name, username, password, role, email)   VALUES (company.tenant_id($1, ''), company.tenant_id($1, $2), $3, $4, $5, $6, $7, NULLIF($8, '')) RETURNING id, first_name, last_name, username,  create_at"
+	err := r.db.QueryRow(query, data.Company, data.Branch, data.FirstName, data.LastName, data.Username, data.Password, data.Role, data.Email).Scan(&data.ID, &data.FirstName, &data.LastName, &data.Username, &data.CreateAt)
 	if err != nil {
 		return nil, err
 	}
@@ -27,8 +38,17 @@ func (r *companyRepository) Register(data *domain.Data) (*domain.Data, error) {
 }
 
 func (r *companyRepository) Login(data *domain.Data) (*domain.Data, error) {
-	query := "SELECT * FROM company.onesystem WHERE username = $1 AND company = $2 AND branch = $3"
-	err := r.db.QueryRow(query, data.Username, data.Company, data.Branch).Scan(&data.Company, &data.Branch, &data.ID, &data.FirstName, &data.LastName, &data.Username, &data.Password, &data.CreateAt, &data.UpdateAt, &data.DeleteAt, &data.Role)
+	query := "SELECT " + dataColumns + " FROM company.onesystem WHERE username = $1 AND company = $2 AND branch = $3 AND delete_at IS NULL"
+	err := r.db.QueryRow(query, data.Username, data.Company, data.Branch).Scan(&data.Company, &data.Branch, &data.ID, &data.FirstName, &data.LastName, &data.Username, &data.Password, &data.CreateAt, &data.UpdateAt, &data.DeleteAt, &data.Role, &data.Email, &data.EmailVerifiedAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *companyRepository) GetByEmail(data *domain.Data) (*domain.Data, error) {
+	query := "SELECT " + dataColumns + " FROM company.onesystem WHERE lower(email) = lower($1) AND company = $2 AND branch = $3 AND delete_at IS NULL"
+	err := r.db.QueryRow(query, data.Email, data.Company, data.Branch).Scan(&data.Company, &data.Branch, &data.ID, &data.FirstName, &data.LastName, &data.Username, &data.Password, &data.CreateAt, &data.UpdateAt, &data.DeleteAt, &data.Role, &data.Email, &data.EmailVerifiedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -36,8 +56,8 @@ func (r *companyRepository) Login(data *domain.Data) (*domain.Data, error) {
 }
 
 func (r *companyRepository) GetData(data *domain.Data) (*domain.Data, error) {
-	query := " SELECT * FROM company.onesystem WHERE company = $1 AND branch = $2 "
-	err := r.db.QueryRow(query, data.Company, data.Branch).Scan(&data.Company, &data.Branch, &data.ID, &data.FirstName, &data.LastName, &data.Username, &data.Password, &data.CreateAt, &data.UpdateAt, &data.DeleteAt, &data.Role)
+	query := "SELECT " + dataColumns + " FROM company.onesystem WHERE company = $1 AND branch = $2"
+	err := r.db.QueryRow(query, data.Company, data.Branch).Scan(&data.Company, &data.Branch, &data.ID, &data.FirstName, &data.LastName, &data.Username, &data.Password, &data.CreateAt, &data.UpdateAt, &data.DeleteAt, &data.Role, &data.Email, &data.EmailVerifiedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -45,9 +65,9 @@ func (r *companyRepository) GetData(data *domain.Data) (*domain.Data, error) {
 }
 
 func (r *companyRepository) GetCompanyData(data *domain.Data) ([]domain.Data, error) {
-	query := fmt.Sprintf("SELECT * FROM company.onesystem WHERE company = '%s'", data.Company)
+	query := "SELECT " + dataColumns + " FROM company.onesystem WHERE company = $1"
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.Query(query, data.Company)
 	if err != nil {
 		return nil, err
 	}
@@ -56,7 +76,7 @@ func (r *companyRepository) GetCompanyData(data *domain.Data) ([]domain.Data, er
 	company := []domain.Data{}
 	for rows.Next() {
 		var d domain.Data
-		err := rows.Scan(&d.Company, &d.Branch, &d.ID, &d.FirstName, &d.LastName, &d.Username, &d.Password, &d.CreateAt, &d.UpdateAt, &d.DeleteAt, &d.Role)
+		err := rows.Scan(&d.Company, &d.Branch, &d.ID, &d.FirstName, &d.LastName, &d.Username, &d.Password, &d.CreateAt, &d.UpdateAt, &d.DeleteAt, &d.Role, &d.Email, &d.EmailVerifiedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -70,9 +90,9 @@ func (r *companyRepository) GetCompanyData(data *domain.Data) ([]domain.Data, er
 }
 
 func (r *companyRepository) GetBranchData(data *domain.Data) ([]domain.Data, error) {
-	query := fmt.Sprintf("SELECT * FROM company.onesystem WHERE company = '%s' AND branch = '%s'", data.Company, data.Branch)
+	query := "SELECT " + dataColumns + " FROM company.onesystem WHERE company = $1 AND branch = $2"
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.Query(query, data.Company, data.Branch)
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +101,7 @@ func (r *companyRepository) GetBranchData(data *domain.Data) ([]domain.Data, err
 	company := []domain.Data{}
 	for rows.Next() {
 		var d domain.Data
-		err := rows.Scan(&d.Company, &d.Branch, &d.ID, &d.FirstName, &d.LastName, &d.Username, &d.Password, &d.CreateAt, &d.UpdateAt, &d.DeleteAt, &d.Role)
+		err := rows.Scan(&d.Company, &d.Branch, &d.ID, &d.FirstName, &d.LastName, &d.Username, &d.Password, &d.CreateAt, &d.UpdateAt, &d.DeleteAt, &d.Role, &d.Email, &d.EmailVerifiedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -94,6 +114,8 @@ func (r *companyRepository) GetBranchData(data *domain.Data) ([]domain.Data, err
 	return company, nil
 }
 
+// UpdateData changes the fields that are set. A new password also restarts
+// the password age.
 func (r *companyRepository) UpdateData(data *domain.Data) (*domain.Data, error) {
 
 	var fields []string
@@ -111,16 +133,19 @@ func (r *companyRepository) UpdateData(data *domain.Data) (*domain.Data, error)
 		argIndex++
 	}
 	if data.Password != "" {
-		fields = append(fields, "password = $"+strconv.Itoa(argIndex))
+		fields = append(fields, "password = $"+strconv.Itoa(argIndex), "password_changed_at = CURRENT_TIMESTAMP")
 		args = append(args, data.Password)
 		argIndex++
 	}
 
-	query := "UPDATE company.onesystem SET " + strings.Join(fields, ", ") + " WHERE company = $" + strconv.Itoa(argIndex) + " AND branch = $" + strconv.Itoa(argIndex+1) + " AND username = $" + strconv.Itoa(argIndex+2)
+	if len(fields) > 0 {
+		fields = append(fields, "update_at = CURRENT_TIMESTAMP")
+		query := "UPDATE company.accounts SET " + strings.Join(fields, ", ") + " WHERE " + accountKey(argIndex, argIndex+1) + " AND id = $" + strconv.Itoa(argIndex+2)
 
-	_, err := r.db.Exec(query, args...)
-	if err != nil {
-		return nil, err
+		_, err := r.db.Exec(query, append(args, data.Company, data.Branch, data.ID)...)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	updateData, err := r.GetOne(data)
@@ -132,9 +157,54 @@ func (r *companyRepository) UpdateData(data *domain.Data) (*domain.Data, error)
 
 }
 
+func (r *companyRepository) UpdatePassword(data *domain.Data) error {
+	query := "UPDATE company.accounts SET password = $1, update_at = CURRENT_TIMESTAMP WHERE " + accountKey(2, 3) + " AND id = $4"
+	_, err := r.db.Exec(query, data.Password, data.Company, data.Branch, data.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ChangePassword sets a password the user chose, unlike UpdatePassword which
+// only rehashes the current one and leaves the password age alone.
+func (r *companyRepository) ChangePassword(data *domain.Data) error {
+	query := "UPDATE company.accounts SET password = $1, password_changed_at = CURRENT_TIMESTAMP, update_at = CURRENT_TIMESTAMP WHERE " + accountKey(2, 3) + " AND id = $4"
+	_, err := r.db.Exec(query, data.Password, data.Company, data.Branch, data.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PasswordExpired reports whether the password was last changed more than
+// maxAgeDays ago, by the database clock.
+func (r *companyRepository) PasswordExpired(data *domain.Data, maxAgeDays int) (bool, error) {
+	var expired bool
+	query := "SELECT COALESCE(password_changed_at, create_at) < CURRENT_TIMESTAMP - make_interval(days => $4) FROM company.onesystem WHERE company = $1 AND branch = $2 AND id = $3"
+	err := r.db.QueryRow(query, data.Company, data.Branch, data.ID, maxAgeDays).Scan(&expired)
+	if err != nil {
+		return false, err
+	}
+
+	return expired, nil
+}
+
+func (r *companyRepository) VerifyEmail(data *domain.Data) error {
+	query := "UPDATE company.accounts SET email_verified_at = CURRENT_TIMESTAMP WHERE " + accountKey(1, 2) + " AND id = $3 AND lower(email) = lower($4)"
+	_, err := r.db.Exec(query, data.Company, data.Branch, data.ID, data.Email)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (r *companyRepository) GetOne(data *domain.Data) (*domain.Data, error) {
-	query := "SELECT * FROM company.onesystem WHERE company = $1 AND branch = $2 AND id = $3"
-	err := r.db.QueryRow(query, data.Company, data.Branch, data.ID).Scan(&data.Company, &data.Branch, &data.ID, &data.FirstName, &data.LastName, &data.Username, &data.Password, &data.CreateAt, &data.UpdateAt, &data.DeleteAt, &data.Role)
+	query := "SELECT " + dataColumns + " FROM company.onesystem WHERE company = $1 AND branch = $2 AND id = $3"
+	err := r.db.QueryRow(query, data.Company, data.Branch, data.ID).Scan(&data.Company, &data.Branch, &data.ID, &data.FirstName, &data.LastName, &data.Username, &data.Password, &data.CreateAt, &data.UpdateAt, &data.DeleteAt, &data.Role, &data.Email, &data.EmailVerifiedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -142,7 +212,7 @@ func (r *companyRepository) GetOne(data *domain.Data) (*domain.Data, error) {
 }
 
 func (r *companyRepository) DeleteData(data *domain.Data) error {
-	query := "DELETE FROM company.onesystem WHERE company = $1 AND branch = $2 AND id = $3"
+	query := "DELETE FROM company.accounts WHERE " + accountKey(1, 2) + " AND id = $3"
 	_, err := r.db.Exec(query, data.Company, data.Branch, data.ID)
 	if err != nil {
 		return err
@@ -154,7 +224,7 @@ func (r *companyRepository) DeleteData(data *domain.Data) error {
 func (r *companyRepository) GetAllData() ([]domain.Data, error) {
 	data := []domain.Data{}
 
-	query := "SELECT * FROM company.onesystem"
+	query := "SELECT " + dataColumns + " FROM company.onesystem"
 	rows, err := r.db.Query(query)
 	if err != nil {
 		return nil, err
@@ -163,7 +233,7 @@ func (r *companyRepository) GetAllData() ([]domain.Data, error) {
 
 	for rows.Next() {
 		var d domain.Data
-		err := rows.Scan(&d.Company, &d.Branch, &d.ID, &d.FirstName, &d.LastName, &d.Username, &d.Password, &d.CreateAt, &d.UpdateAt, &d.DeleteAt, &d.Role)
+		err := rows.Scan(&d.Company, &d.Branch, &d.ID, &d.FirstName, &d.LastName, &d.Username, &d.Password, &d.CreateAt, &d.UpdateAt, &d.DeleteAt, &d.Role, &d.Email, &d.EmailVerifiedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -177,11 +247,122 @@ func (r *companyRepository) GetAllData() ([]domain.Data, error) {
 }
 
 func (r *companyRepository) GetMe(data *domain.Data) (*domain.Data, error) {
-	query := "SELECT * FROM company.onesystem WHERE company = $1 AND branch = $2 AND id = $3"
-	err := r.db.QueryRow(query, data.Company, data.Branch, data.ID).Scan(&data.Company, &data.Branch, &data.ID, &data.FirstName, &data.LastName, &data.Username, &data.Password, &data.CreateAt, &data.UpdateAt, &data.DeleteAt, &data.Role)
+	query := "SELECT " + dataColumns + " FROM company.onesystem WHERE company = $1 AND branch = $2 AND id = $3 AND delete_at IS NULL"
+	err := r.db.QueryRow(query, data.Company, data.Branch, data.ID).Scan(&data.Company, &data.Branch, &data.ID, &data.FirstName, &data.LastName, &data.Username, &data.Password, &data.CreateAt, &data.UpdateAt, &data.DeleteAt, &data.Role, &data.Email, &data.EmailVerifiedAt)
 	if err != nil {
 		return nil, err
 	}
 
 	return data, nil
 }
+
+// GetByID finds a user of the company in any branch, deactivated users included.
+func (r *companyRepository) GetByID(data *domain.Data) (*domain.Data, error) {
+	query := "SELECT " + dataColumns + " FROM company.onesystem WHERE company = $1 AND id = $2"
+	err := r.db.QueryRow(query, data.Company, data.ID).Scan(&data.Company, &data.Branch, &data.ID, &data.FirstName, &data.LastName, &data.Username, &data.Password, &data.CreateAt, &data.UpdateAt, &data.DeleteAt, &data.Role, &data.Email, &data.EmailVerifiedAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// FindUsers returns one page of the users matching the query and the total
+// number of matches.
+func (r *companyRepository) FindUsers(data *domain.UserQuery) ([]domain.Data, int, error) {
+	users := []domain.Data{}
+
+	conditions := []string{"company = $1"}
+	args := []interface{}{data.Company}
+	argIndex := 2
+
+	if data.Branch != "" {
+		conditions = append(conditions, "branch = $"+strconv.Itoa(argIndex))
+		args = append(args, data.Branch)
+		argIndex++
+	}
+	if data.ID != nil {
+		conditions = append(conditions, "id = $"+strconv.Itoa(argIndex))
+		args = append(args, *data.ID)
+		argIndex++
+	}
+	if data.Username != "" {
+		conditions = append(conditions, "lower(username) = lower($"+strconv.Itoa(argIndex)+")")
+		args = append(args, data.Username)
+		argIndex++
+	}
+	if data.Email != "" {
+		conditions = append(conditions, "lower(email) = lower($"+strconv.Itoa(argIndex)+")")
+		args = append(args, data.Email)
+		argIndex++
+	}
+	if data.Active != nil {
+		if *data.Active {
+			conditions = append(conditions, "delete_at IS NULL")
+		} else {
+			conditions = append(conditions, "delete_at IS NOT NULL")
+		}
+	}
+
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+	err := r.db.QueryRow("SELECT count(*) FROM company.onesystem WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + dataColumns + " FROM company.onesystem WHERE " + where + " ORDER BY create_at, id OFFSET $" + strconv.Itoa(argIndex) + " LIMIT $" + strconv.Itoa(argIndex+1)
+	rows, err := r.db.Query(query, append(args, data.Offset, data.Limit)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d domain.Data
+		err := rows.Scan(&d.Company, &d.Branch, &d.ID, &d.FirstName, &d.LastName, &d.Username, &d.Password, &d.CreateAt, &d.UpdateAt, &d.DeleteAt, &d.Role, &d.Email, &d.EmailVerifiedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// UpdateProfile replaces the username, names and email. A changed email
+// address has to be verified again.
+func (r *companyRepository) UpdateProfile(data *domain.Data) error {
+	query := `UPDATE company.accounts SET username = $4, first_name = $5, last_name = $6, email = NULLIF($7, ''),
+			email_verified_at = CASE WHEN lower(email) = lower($7) THEN email_verified_at END,
+			update_at = CURRENT_TIMESTAMP
+		WHERE ` + accountKey(1, 2) + ` AND id = $3`
+	_, err := r.db.Exec(query, data.Company, data.Branch, data.ID, data.Username, data.FirstName, data.LastName, data.Email)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetActive deactivates a user by setting delete_at, or reactivates one by
+// clearing it.
+func (r *companyRepository) SetActive(data *domain.Data, active bool) error {
+	query := "UPDATE company.accounts SET delete_at = CASE WHEN $4 THEN NULL ELSE COALESCE(delete_at, CURRENT_TIMESTAMP) END, update_at = CURRENT_TIMESTAMP WHERE " + accountKey(1, 2) + " AND id = $3"
+	_, err := r.db.Exec(query, data.Company, data.Branch, data.ID, active)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *companyRepository) HasSuperAdmin() (bool, error) {
+	var exists bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM company.onesystem WHERE role = $1)", domain.RoleSuperAdmin).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
@@ -0,0 +1,12 @@
+package repositories
+
+import "testing"
+
+func TestAccountKey(t *testing.T) {
+	// Rows are keyed by tenant id, so a renamed tenant's users are found
+	// through its current slugs
+	want := "company_id = company.tenant_id($2, '') AND branch_id = company.tenant_id($2, $3)"
+	if got := accountKey(2, 3); got != want {
+		t.Errorf("accountKey(2, 3) = %s, want %s", got, want)
+	}
+}
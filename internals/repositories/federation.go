@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"encoding/json"
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type federationRepository struct {
+	db *sqlx.DB
+}
+
+func NewFederationRepository(db *sqlx.DB) *federationRepository {
+	return &federationRepository{db: db}
+}
+
+func (r *federationRepository) GetProvider(data *domain.IdentityProvider) (*domain.IdentityProvider, error) {
+	var mapping []byte
+
+	query := `SELECT company, issuer, client_id, client_secret, redirect_uri, scopes, branch_claim, default_branch, role_claim, role_mapping, default_role, enabled, update_at
+		FROM company.identity_providers WHERE company = $1`
+	err := r.db.QueryRow(query, data.Company).Scan(&data.Company, &data.Issuer, &data.ClientID, &data.ClientSecret, &data.RedirectURI, &data.Scopes, &data.BranchClaim, &data.DefaultBranch, &data.RoleClaim, &mapping, &data.DefaultRole, &data.Enabled, &data.UpdateAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(mapping, &data.RoleMapping); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *federationRepository) SaveProvider(data *domain.IdentityProvider) (*domain.IdentityProvider, error) {
+	mapping, err := json.Marshal(data.RoleMapping)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO company.identity_providers (company, issuer, client_id, client_secret, redirect_uri, scopes, branch_claim, default_branch, role_claim, role_mapping, default_role, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (company) DO UPDATE SET issuer = EXCLUDED.issuer, client_id = EXCLUDED.client_id, client_secret = EXCLUDED.client_secret,
+			redirect_uri = EXCLUDED.redirect_uri, scopes = EXCLUDED.scopes, branch_claim = EXCLUDED.branch_claim, default_branch = EXCLUDED.default_branch,
+			role_claim = EXCLUDED.role_claim, role_mapping = EXCLUDED.role_mapping, default_role = EXCLUDED.default_role, enabled = EXCLUDED.enabled,
+			update_at = CURRENT_TIMESTAMP
+		RETURNING update_at`
+	err = r.db.QueryRow(query, data.Company, data.Issuer, data.ClientID, data.ClientSecret, data.RedirectURI, data.Scopes, data.BranchClaim, data.DefaultBranch, data.RoleClaim, mapping, data.DefaultRole, data.Enabled).Scan(&data.UpdateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *federationRepository) DeleteProvider(data *domain.IdentityProvider) error {
+	query := "DELETE FROM company.identity_providers WHERE company = $1"
+	_, err := r.db.Exec(query, data.Company)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *federationRepository) CreateState(data *domain.SSOState, ttlSeconds int) error {
+	query := `INSERT INTO company.sso_states (state_hash, company, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + make_interval(secs => $5))`
+	_, err := r.db.Exec(query, data.StateHash, data.Company, data.Nonce, data.CodeVerifier, ttlSeconds)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UseState burns an unexpired state. It returns sql.ErrNoRows for unknown,
+// used and expired states alike.
+func (r *federationRepository) UseState(data *domain.SSOState) (*domain.SSOState, error) {
+	query := `UPDATE company.sso_states SET used_at = CURRENT_TIMESTAMP
+		WHERE state_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING company, nonce, code_verifier`
+	err := r.db.QueryRow(query, data.StateHash).Scan(&data.Company, &data.Nonce, &data.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *federationRepository) GetIdentity(data *domain.FederatedIdentity) (*domain.FederatedIdentity, error) {
+	query := "SELECT company, issuer, subject, user_id, branch, create_at FROM company.federated_identities WHERE company = $1 AND issuer = $2 AND subject = $3"
+	err := r.db.QueryRow(query, data.Company, data.Issuer, data.Subject).Scan(&data.Company, &data.Issuer, &data.Subject, &data.UserID, &data.Branch, &data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *federationRepository) CreateIdentity(data *domain.FederatedIdentity) error {
+	query := "INSERT INTO company.federated_identities (company, issuer, subject, user_id, branch) VALUES ($1, $2, $3, $4, $5)"
+	_, err := r.db.Exec(query, data.Company, data.Issuer, data.Subject, data.UserID, data.Branch)
+	if err != nil {
+		return err
+	}
+	return nil
+}
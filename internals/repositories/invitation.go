@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const invitationColumns = "id, company, branch, email, role, invited_by, expires_at, accepted_at, revoked_at, user_id, create_at"
+
+type invitationRepository struct {
+	db *sqlx.DB
+}
+
+func NewInvitationRepository(db *sqlx.DB) *invitationRepository {
+	return &invitationRepository{db: db}
+}
+
+// CreateInvitation stores an invitation expiring expiresIn seconds from now
+// by the database clock.
+func (r *invitationRepository) CreateInvitation(data *domain.Invitation, expiresIn int) (*domain.Invitation, error) {
+	query := `INSERT INTO company.invitations (company, branch, email, role, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP + make_interval(secs => $6)) RETURNING ` + invitationColumns
+	err := r.db.QueryRow(query, data.Company, data.Branch, data.Email, data.Role, data.InvitedBy, expiresIn).Scan(&data.ID, &data.Company, &data.Branch, &data.Email, &data.Role, &data.InvitedBy, &data.ExpiresAt, &data.AcceptedAt, &data.RevokedAt, &data.UserID, &data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetInvitations lists the company's invitations, limited to one branch
+// when data.Branch is set.
+func (r *invitationRepository) GetInvitations(data *domain.Invitation) ([]domain.Invitation, error) {
+	invitations := []domain.Invitation{}
+
+	query := "SELECT " + invitationColumns + " FROM company.invitations WHERE company = $1 AND ($2 = '' OR branch = $2) ORDER BY create_at DESC"
+	rows, err := r.db.Query(query, data.Company, data.Branch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i domain.Invitation
+		err := rows.Scan(&i.ID, &i.Company, &i.Branch, &i.Email, &i.Role, &i.InvitedBy, &i.ExpiresAt, &i.AcceptedAt, &i.RevokedAt, &i.UserID, &i.CreateAt)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+func (r *invitationRepository) GetInvitation(data *domain.Invitation) (*domain.Invitation, error) {
+	query := "SELECT " + invitationColumns + " FROM company.invitations WHERE id = $1"
+	err := r.db.QueryRow(query, data.ID).Scan(&data.ID, &data.Company, &data.Branch, &data.Email, &data.Role, &data.InvitedBy, &data.ExpiresAt, &data.AcceptedAt, &data.RevokedAt, &data.UserID, &data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetPendingInvitation finds an invitation that can still be accepted.
+func (r *invitationRepository) GetPendingInvitation(data *domain.Invitation) (*domain.Invitation, error) {
+	query := "SELECT " + invitationColumns + ` FROM company.invitations
+		WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP`
+	err := r.db.QueryRow(query, data.ID).Scan(&data.ID, &data.Company, &data.Branch, &data.Email, &data.Role, &data.InvitedBy, &data.ExpiresAt, &data.AcceptedAt, &data.RevokedAt, &data.UserID, &data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// AcceptInvitation marks a pending invitation as used. It reports false
+// when the invitation was accepted, revoked or expired in the meantime.
+func (r *invitationRepository) AcceptInvitation(data *domain.Invitation) (bool, error) {
+	query := `UPDATE company.invitations SET accepted_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP`
+	res, err := r.db.Exec(query, data.ID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// SetInvitationUser links an accepted invitation to the user it created.
+func (r *invitationRepository) SetInvitationUser(data *domain.Invitation) error {
+	_, err := r.db.Exec("UPDATE company.invitations SET user_id = $2 WHERE id = $1", data.ID, data.UserID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *invitationRepository) RevokeInvitation(data *domain.Invitation) (bool, error) {
+	query := "UPDATE company.invitations SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND company = $2 AND accepted_at IS NULL AND revoked_at IS NULL"
+	res, err := r.db.Exec(query, data.ID, data.Company)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
@@ -1,10 +1,13 @@
 package repositories
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"go-multi-tenancy/internals/core/domain"
+	"strings"
 
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -16,137 +19,232 @@ func NewManageRepository(db *sqlx.DB) *manageRepository {
 	return &manageRepository{db: db}
 }
 
-func (m *manageRepository) GetCompany() ([]domain.Manage, error) {
-	query := `SELECT inhrelid::regclass AS company
-		FROM pg_inherits
-		WHERE inhparent = 'company.onesystem'::regclass;`
+const tenantColumns = "id, company, branch, display_name, status, settings, create_at, update_at"
 
-	var companies []domain.Manage
-	err := m.db.Select(&companies, query)
+func (m *manageRepository) GetCompany() ([]domain.Tenant, error) {
+	return m.getTenants("SELECT " + tenantColumns + " FROM company.tenants WHERE branch = '' ORDER BY company")
+}
+
+func (m *manageRepository) GetBranch(data *domain.Tenant) ([]domain.Tenant, error) {
+	return m.getTenants("SELECT "+tenantColumns+" FROM company.tenants WHERE company = $1 AND branch <> '' ORDER BY branch", data.Company)
+}
+
+// GetCompanyTenants returns the company's own entry and those of its branches.
+func (m *manageRepository) GetCompanyTenants(data *domain.Tenant) ([]domain.Tenant, error) {
+	return m.getTenants("SELECT "+tenantColumns+" FROM company.tenants WHERE company = $1", data.Company)
+}
+
+func (m *manageRepository) GetTenant(data *domain.Tenant) (*domain.Tenant, error) {
+	query := "SELECT " + tenantColumns + " FROM company.tenants WHERE company = $1 AND branch = $2"
+	err := m.db.QueryRow(query, data.Company, data.Branch).Scan(&data.ID, &data.Company, &data.Branch, &data.DisplayName, &data.Status, (*[]byte)(&data.Settings), &data.CreateAt, &data.UpdateAt)
 	if err != nil {
 		return nil, err
 	}
+	return data, nil
+}
+
+// UpdateTenant saves a tenant's display name and settings. It reports false
+// when the tenant is not registered.
+func (m *manageRepository) UpdateTenant(data *domain.Tenant) (bool, error) {
+	query := "UPDATE company.tenants SET display_name = $3, settings = $4, update_at = CURRENT_TIMESTAMP WHERE company = $1 AND branch = $2"
+	res, err := m.db.Exec(query, data.Company, data.Branch, data.DisplayName, string(data.Settings))
+	if err != nil {
+		return false, err
+	}
 
-	return companies, nil
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
 }
 
-func (m *manageRepository) GetBranch(data *domain.GetBranch) ([]domain.GetBranch, error) {
+func (m *manageRepository) SetTenantStatus(data *domain.Tenant) (bool, error) {
+	query := "UPDATE company.tenants SET status = $3, update_at = CURRENT_TIMESTAMP WHERE company = $1 AND branch = $2"
+	res, err := m.db.Exec(query, data.Company, data.Branch, data.Status)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
 
-	query := `SELECT  inhparent::regclass AS company,inhrelid::regclass AS branch
-		FROM pg_inherits
-		WHERE inhparent = $1::regclass;`
+func (m *manageRepository) getTenants(query string, args ...interface{}) ([]domain.Tenant, error) {
+	tenants := []domain.Tenant{}
 
-	rows, err := m.db.Query(query, "company."+data.Company)
+	rows, err := m.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	branchMap := make(map[string][]*string)
 	for rows.Next() {
-		var branch, company string
-		if err := rows.Scan(&branch, &company); err != nil {
+		var t domain.Tenant
+		err := rows.Scan(&t.ID, &t.Company, &t.Branch, &t.DisplayName, &t.Status, (*[]byte)(&t.Settings), &t.CreateAt, &t.UpdateAt)
+		if err != nil {
 			return nil, err
 		}
-		branchMap[branch] = append(branchMap[branch], &company)
-	}
-
-	var branches []domain.GetBranch
-	for company, branch := range branchMap {
-		branches = append(branches, domain.GetBranch{
-			Company: company,
-			Branch:  branch,
-		})
+		tenants = append(tenants, t)
 	}
-
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return branches, nil
-
+	return tenants, nil
 }
 
-func (m *manageRepository) CreateCompany(data *domain.Manage) (*domain.Manage, error) {
-	exists, err := m.tableExists(data.Company)
+// CreateCompany creates the company's partition and registers it in one
+// transaction, so the registry never lists a partition that is not there.
+// The partition is named and keyed after the tenant id, the slug only lives
+// in the registry.
+func (m *manageRepository) CreateCompany(data *domain.Tenant) (*domain.Tenant, error) {
+	tx, err := m.db.Begin()
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	if exists {
+	_, err = tenantOf(tx, data.Company, "")
+	if err == nil {
 		return nil, errors.New("the company already exist")
 	}
+	if !errors.Is(err, domain.ErrTenantNotFound) {
+		return nil, err
+	}
 
-	query := fmt.Sprintf(`CREATE TABLE company.%s PARTITION OF company.onesystem
-    FOR VALUES IN ('%s')
-   	PARTITION BY LIST (branch) ;`, data.Company, data.Company)
+	if err := createCompany(tx, data); err != nil {
+		return nil, err
+	}
 
-	_, err = m.db.Exec(query)
-	if err != nil {
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
 	return data, nil
 }
 
-func (m *manageRepository) CreateBranch(data *domain.Manage) (*domain.Manage, error) {
-	exists, err := m.tableExists(data.Company)
+// CreateBranch creates the branch's partition under its company. Branch
+// slugs only have to be unique within their company.
+func (m *manageRepository) CreateBranch(data *domain.Tenant) (*domain.Tenant, error) {
+	tx, err := m.db.Begin()
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	if !exists {
-		return nil, errors.New("the company does not exist")
+	company, err := tenantOf(tx, data.Company, "")
+	if err != nil {
+		if errors.Is(err, domain.ErrTenantNotFound) {
+			return nil, errors.New("the company does not exist")
+		}
+		return nil, err
 	}
 
-	query := fmt.Sprintf(`CREATE TABLE company.%s PARTITION OF company.%s
-    FOR VALUES IN ('%s');`, data.Branch, data.Company, data.Branch)
+	_, err = tenantOf(tx, data.Company, data.Branch)
+	if err == nil {
+		return nil, errors.New("the branch already exist")
+	}
+	if !errors.Is(err, domain.ErrTenantNotFound) {
+		return nil, err
+	}
 
-	_, err = m.db.Exec(query)
-	if err != nil {
+	if err := createBranch(tx, company, data); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
 	return data, nil
 }
 
-func (m *manageRepository) DeleteCompany(data *domain.Manage) error {
+// createCompany creates and registers the partition of a new company.
+func createCompany(tx *sql.Tx, data *domain.Tenant) error {
+	newPartition(data, "c_")
+	query := fmt.Sprintf(`CREATE TABLE %s PARTITION OF company.accounts
+    FOR VALUES IN (%s)
+   	PARTITION BY LIST (branch_id) ;`, partition(data.Partition), literal(data.ID.String()))
 
-	exists, err := m.tableExists(data.Company)
-	if err != nil {
+	if _, err := tx.Exec(query); err != nil {
 		return err
 	}
 
-	if !exists {
-		return errors.New("the company does not exist")
-	}
+	return registerTenant(tx, data)
+}
 
-	query := "DROP TABLE company." + data.Company
-	_, err = m.db.Exec(query)
-	if err != nil {
+// createBranch creates and registers the partition of a new branch under
+// its company's partition.
+func createBranch(tx *sql.Tx, company, data *domain.Tenant) error {
+	newPartition(data, "b_")
+	query := fmt.Sprintf(`CREATE TABLE %s PARTITION OF %s
+    FOR VALUES IN (%s);`, partition(data.Partition), partition(company.Partition), literal(data.ID.String()))
+
+	if _, err := tx.Exec(query); err != nil {
 		return err
 	}
 
-	return nil
+	return registerTenant(tx, data)
 }
 
-func (m *manageRepository) DeleteBranch(data *domain.Manage) error {
-	exists, err := m.tableExists(data.Branch)
+// RegisterFirstSuperAdmin creates a super admin unless one already exists,
+// along with the company and branch when a fresh install has none yet. The
+// advisory lock keeps two instances from bootstrapping at once. It reports
+// false when a super admin was already there.
+func (m *manageRepository) RegisterFirstSuperAdmin(data *domain.Data) (bool, error) {
+	tx, err := m.db.Begin()
 	if err != nil {
-		return err
+		return false, err
 	}
+	defer tx.Rollback()
 
-	if !exists {
-		return errors.New("the company does not exist")
+	_, err = tx.Exec("SELECT pg_advisory_xact_lock(hashtext('company.bootstrap'))")
+	if err != nil {
+		return false, err
 	}
 
-	query := "DROP TABLE company." + data.Branch
-	_, err = m.db.Exec(query)
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM company.onesystem WHERE role = $1)", domain.RoleSuperAdmin).Scan(&exists)
 	if err != nil {
-		return err
+		return false, err
+	}
+	if exists {
+		return false, nil
 	}
 
-	return nil
+	company, err := tenantOf(tx, data.Company, "")
+	if errors.Is(err, domain.ErrTenantNotFound) {
+		company = &domain.Tenant{Company: data.Company}
+		err = createCompany(tx, company)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	branch, err := tenantOf(tx, data.Company, data.Branch)
+	if errors.Is(err, domain.ErrTenantNotFound) {
+		branch = &domain.Tenant{Company: data.Company, Branch: data.Branch}
+		err = createBranch(tx, company, branch)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	query := "INSERT INTO company.accounts (company_id, branch_id, first_name, last_name, username, password, role, email) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')) RETURNING id, first_name, last_name, username, create_at"
+	err = tx.QueryRow(query, company.ID, branch.ID, data.FirstName, data.LastName, data.Username, data.Password, domain.RoleSuperAdmin, data.Email).Scan(&data.ID, &data.FirstName, &data.LastName, &data.Username, &data.CreateAt)
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	data.Role = domain.RoleSuperAdmin
+	return true, nil
 }
 
 func (m *manageRepository) tableExists(tableName string) (bool, error) {
@@ -177,47 +275,79 @@ func (m *manageRepository) UpdateCompanyToBranch(data *domain.CompanyAndBranch)
 		}
 	}()
 
-	//step 1: detach partition => old company, old branch
-	oldBranch := fmt.Sprintf(`ALTER TABLE company.%s DETACH PARTITION company.%s;`, data.OldCompany, data.OldBranch)
-	_, err = tx.Exec(oldBranch)
+	//step 0: resolve the tenants => old company, old branch, new company
+	oldCompany, err := tenantOf(tx, data.OldCompany, "")
 	if err != nil {
 		return err
 	}
 
-	//step 2: create branch => new branch, new company , branch name
-	newBranch := fmt.Sprintf(`CREATE TABLE company.%s PARTITION OF company.%s  FOR VALUES IN ('%s');`, data.NewBranch, data.NewCompany, data.BranchName)
-	_, err = tx.Exec(newBranch)
+	oldBranch, err := tenantOf(tx, data.OldCompany, data.OldBranch)
+	if err != nil {
+		return err
+	}
+
+	newCompany, err := tenantOf(tx, data.NewCompany, "")
+	if err != nil {
+		return err
+	}
+
+	//step 1: detach partition => old company, old branch
+	detachQuery := fmt.Sprintf(`ALTER TABLE %s DETACH PARTITION %s;`, partition(oldCompany.Partition), partition(oldBranch.Partition))
+	_, err = tx.Exec(detachQuery)
 	if err != nil {
 		return err
 	}
 
-	//step 3: insert data =>  new branch,new company,branch name, old branch
-	query := fmt.Sprintf(`INSERT INTO company.%s (company,branch,id,first_name,last_name,username,password, create_at, update_at,delete_at, role) SELECT '%s','%s',id,first_name,last_name,username,password, create_at, update_at,delete_at, role FROM company.%s;`, data.NewBranch, data.NewCompany, data.BranchName, data.OldBranch)
-	_, err = tx.Exec(query)
+	//step 2: create branch => new company , branch name
+	branch := &domain.Tenant{Company: data.NewCompany, Branch: data.BranchName}
+	newPartition(branch, "b_")
+	newBranch := fmt.Sprintf(`CREATE TABLE %s PARTITION OF %s  FOR VALUES IN (%s);`, partition(branch.Partition), partition(newCompany.Partition), literal(branch.ID.String()))
+	_, err = tx.Exec(newBranch)
 	if err != nil {
 		return err
 	}
 
-	//step 4: update company => new company, new branch, old company, old branch
-	updateQuery := fmt.Sprintf(`UPDATE company.onesystem SET company = '%s', branch = '%s' WHERE company = '%s' AND branch = '%s';`, data.NewCompany, data.NewBranch, data.OldCompany, data.OldBranch)
-	_, err = tx.Exec(updateQuery)
+	//step 3: insert data => new branch, new company, old branch
+	err = copyAccounts(tx, oldBranch, newCompany, branch)
 	if err != nil {
 		return err
 	}
 
-	//step 5: delete company => old branch, old company
-	deleteBranch := fmt.Sprintf(`DROP TABLE company.%s;`, data.OldBranch)
+	//step 4: delete company => old branch, old company
+	deleteBranch := fmt.Sprintf(`DROP TABLE %s;`, partition(oldBranch.Partition))
 	_, err = tx.Exec(deleteBranch)
 	if err != nil {
 		return err
 	}
 
-	deleteCompany := fmt.Sprintf(`DROP TABLE company.%s;`, data.OldCompany)
+	deleteCompany := fmt.Sprintf(`DROP TABLE %s;`, partition(oldCompany.Partition))
 	_, err = tx.Exec(deleteCompany)
 	if err != nil {
 		return err
 	}
 
+	//step 5: registry => the old company lives on as a branch of the new one
+	err = moveTenant(tx, data.OldCompany, "", branch)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM company.tenants WHERE company = $1`, data.OldCompany)
+	if err != nil {
+		return err
+	}
+
+	//step 6: slug-keyed rows => the old branch's go along, the rest of the old company's are dropped
+	err = moveBranchRows(tx, data.OldCompany, data.OldBranch, data.NewCompany, data.BranchName)
+	if err != nil {
+		return err
+	}
+
+	err = deleteCompanyRows(tx, data.OldCompany)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -234,44 +364,78 @@ func (m *manageRepository) UpdateBranchToCompany(data *domain.CompanyAndBranch)
 		}
 	}()
 
+	// step 0: resolve the tenants => old company, old branch
+	oldCompany, err := tenantOf(tx, data.OldCompany, "")
+	if err != nil {
+		return err
+	}
+
+	oldBranch, err := tenantOf(tx, data.OldCompany, data.OldBranch)
+	if err != nil {
+		return err
+	}
+
 	// step 1: detach partition => old company,old branch
-	oldBranch := fmt.Sprintf(`ALTER TABLE company.%s DETACH PARTITION company.%s;`, data.OldCompany, data.OldBranch)
-	_, err = tx.Exec(oldBranch)
+	detachQuery := fmt.Sprintf(`ALTER TABLE %s DETACH PARTITION %s;`, partition(oldCompany.Partition), partition(oldBranch.Partition))
+	_, err = tx.Exec(detachQuery)
 	if err != nil {
 		return err
 	}
 
-	//step 2: create company => new company, new branch
-	newCompany := fmt.Sprintf(`CREATE TABLE company.%s PARTITION OF company.onesystem  FOR VALUES IN ('%s') PARTITION BY LIST (branch);`, data.NewCompany, data.NewCompany)
+	//step 2: create company => new company
+	company := &domain.Tenant{Company: data.NewCompany}
+	newPartition(company, "c_")
+	newCompany := fmt.Sprintf(`CREATE TABLE %s PARTITION OF company.accounts  FOR VALUES IN (%s) PARTITION BY LIST (branch_id);`, partition(company.Partition), literal(company.ID.String()))
 	_, err = tx.Exec(newCompany)
 	if err != nil {
 		return err
 	}
 
-	//step 3: create branch => new branch, new company , new branch name
-	initBranch := fmt.Sprintf(`CREATE TABLE company.%s PARTITION OF company.%s FOR VALUES IN ('%s');`, data.NewBranch, data.NewCompany, data.BranchName)
+	//step 3: create branch => new company , new branch name
+	branch := &domain.Tenant{Company: data.NewCompany, Branch: data.BranchName}
+	newPartition(branch, "b_")
+	initBranch := fmt.Sprintf(`CREATE TABLE %s PARTITION OF %s FOR VALUES IN (%s);`, partition(branch.Partition), partition(company.Partition), literal(branch.ID.String()))
 	_, err = tx.Exec(initBranch)
 	if err != nil {
 		return err
 	}
 
-	//step 4: insert data into new partition => new branch , new company, new branch name , old branch
-	insertQuery := fmt.Sprintf("INSERT INTO company.%s (company, branch,id, first_name, last_name, username, password, create_at, update_at, delete_at, role) SELECT '%s', '%s',id, first_name, last_name, username, password, create_at, update_at, delete_at, role FROM company.%s", data.NewBranch, data.NewCompany, data.BranchName, data.OldBranch)
-	_, err = tx.Exec(insertQuery)
+	//step 4: insert data into new partition => new branch , new company, old branch
+	err = copyAccounts(tx, oldBranch, company, branch)
 	if err != nil {
 		return err
 	}
 
-	//step 5: update data => new company , old company , old branch
-	updateQuery := fmt.Sprintf(`UPDATE company.onesystem SET company = '%s' WHERE company = '%s' AND branch = '%s'`, data.NewCompany, data.OldCompany, data.OldBranch)
-	_, err = tx.Exec(updateQuery)
+	//step 5: delete branch => old branch
+	deleteQuery := fmt.Sprintf(`DROP TABLE %s`, partition(oldBranch.Partition))
+	_, err = tx.Exec(deleteQuery)
 	if err != nil {
 		return err
 	}
 
-	//step 6: delete branch => old branch
-	deleteQuery := fmt.Sprintf(`DROP TABLE company.%s`, data.OldBranch)
-	_, err = tx.Exec(deleteQuery)
+	//step 6: registry => the old branch becomes a company with one branch
+	err = moveTenant(tx, data.OldCompany, data.OldBranch, company)
+	if err != nil {
+		return err
+	}
+
+	err = registerTenant(tx, branch)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM company.tenants WHERE company = $1 AND branch = $2`, data.OldCompany, data.OldBranch)
+	if err != nil {
+		return err
+	}
+
+	//step 7: slug-keyed rows => the new company keeps the old one's policies, the branch's rows go along
+	err = copyCompanyPolicies(tx, data.OldCompany, data.NewCompany)
+	if err != nil {
+		return err
+	}
+
+	err = moveBranchRows(tx, data.OldCompany, data.OldBranch, data.NewCompany, data.BranchName)
 	if err != nil {
 		return err
 	}
@@ -279,90 +443,143 @@ func (m *manageRepository) UpdateBranchToCompany(data *domain.CompanyAndBranch)
 	return nil
 }
 
+// UpdateCompanyName changes the company's slug. Partitions are keyed by
+// tenant id, so this only touches the registry and the slug-keyed tables,
+// however many users the company has. Its users have to log in again.
 func (m *manageRepository) UpdateCompanyName(data *domain.RenameCompany) error {
 	tx, err := m.db.Begin()
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-			return
-		}
-		err = tx.Commit()
-	}()
+	defer tx.Rollback()
 
-	//step 1: rename company => old company, new company
-	renameQuery := fmt.Sprintf(`ALTER TABLE company.%s RENAME TO %s ;`, data.OldCompany, data.NewCompany)
-	_, err = tx.Exec(renameQuery)
-	if err != nil {
+	_, err = tenantOf(tx, data.NewCompany, "")
+	if err == nil {
+		return errors.New("the company already exist")
+	}
+	if !errors.Is(err, domain.ErrTenantNotFound) {
 		return err
 	}
 
-	//step 2: detach company => new company
-	detachQuery := fmt.Sprintf(`ALTER TABLE company.onesystem DETACH PARTITION company.%s;`, data.NewCompany)
-	_, err = tx.Exec(detachQuery)
+	res, err := tx.Exec(`UPDATE company.tenants SET company = $2, update_at = CURRENT_TIMESTAMP WHERE company = $1`, data.OldCompany, data.NewCompany)
 	if err != nil {
 		return err
 	}
 
-	//step 3: update company => new company, old company
-	updateQuery := fmt.Sprintf(`UPDATE company.%s SET company = '%s' WHERE company = '%s';`, data.NewCompany, data.NewCompany, data.OldCompany)
-	_, err = tx.Exec(updateQuery)
+	affected, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if affected == 0 {
+		return domain.ErrTenantNotFound
+	}
 
-	//step 4: attach company => new company
-	attachQuery := fmt.Sprintf(`ALTER TABLE company.onesystem ATTACH PARTITION company.%s FOR VALUES IN ('%s');`, data.NewCompany, data.NewCompany)
-	_, err = tx.Exec(attachQuery)
-	if err != nil {
+	if err := renameCompanyRows(tx, data.OldCompany, data.NewCompany); err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
+// UpdateBranchName changes the branch's slug within its company, in the
+// registry and the slug-keyed tables. Its users have to log in again.
 func (m *manageRepository) UpdateBranchName(data *domain.RenameBranch) error {
 	tx, err := m.db.Begin()
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-			return
-		}
-		err = tx.Commit()
-	}()
+	defer tx.Rollback()
 
-	//step 1: rename branch => old branch, new branch
-	renameQuery := fmt.Sprintf(`ALTER TABLE company.%s RENAME TO %s;`, data.OldBranch, data.NewBranch)
-	_, err = tx.Exec(renameQuery)
-	if err != nil {
+	_, err = tenantOf(tx, data.Company, data.NewBranch)
+	if err == nil {
+		return errors.New("the branch already exist")
+	}
+	if !errors.Is(err, domain.ErrTenantNotFound) {
 		return err
 	}
 
-	//step 2: detach branch => new branch, company
-	detachQuery := fmt.Sprintf(`ALTER TABLE company.%s DETACH PARTITION company.%s;`, data.Company, data.NewBranch)
-	_, err = tx.Exec(detachQuery)
+	res, err := tx.Exec(`UPDATE company.tenants SET branch = $3, update_at = CURRENT_TIMESTAMP WHERE company = $1 AND branch = $2`, data.Company, data.OldBranch, data.NewBranch)
 	if err != nil {
 		return err
 	}
 
-	//step 3: update branch => new branch,company, old branch
-	updateQuery := fmt.Sprintf(`UPDATE company.%s SET branch = '%s' WHERE company = '%s' AND branch = '%s';`, data.NewBranch, data.NewBranch, data.Company, data.OldBranch)
-	_, err = tx.Exec(updateQuery)
+	affected, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if affected == 0 {
+		return domain.ErrTenantNotFound
+	}
+
+	if err := moveBranchRows(tx, data.Company, data.OldBranch, data.Company, data.NewBranch); err != nil {
+		return err
+	}
 
-	//step 4: attach branch => new branch, company
-	attachQuery := fmt.Sprintf(`ALTER TABLE company.%s ATTACH PARTITION company.%s FOR VALUES IN ('%s');`, data.Company, data.NewBranch, data.NewBranch)
-	_, err = tx.Exec(attachQuery)
+	return tx.Commit()
+}
+
+// copyAccounts copies the users of a detached branch partition into the
+// partition of the branch they move to.
+func copyAccounts(tx *sql.Tx, from, company, branch *domain.Tenant) error {
+	query := fmt.Sprintf(`INSERT INTO %s (company_id, branch_id, id, first_name, last_name, username, password, create_at, update_at, delete_at, role, email, email_verified_at, password_changed_at)
+		SELECT $1, $2, id, first_name, last_name, username, password, create_at, update_at, delete_at, role, email, email_verified_at, password_changed_at FROM %s`, partition(branch.Partition), partition(from.Partition))
+	_, err := tx.Exec(query, company.ID, branch.ID)
+	return err
+}
+
+// tenantOf resolves a company, or one of its branches, to its tenant id
+// and the name of its partition table.
+func tenantOf(tx *sql.Tx, company, branch string) (*domain.Tenant, error) {
+	data := &domain.Tenant{Company: company, Branch: branch}
+	var table sql.NullString
+	err := tx.QueryRow(`SELECT id, partition_table FROM company.tenants WHERE company = $1 AND branch = $2`, company, branch).Scan(&data.ID, &table)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrTenantNotFound
+		}
+		return nil, err
+	}
+	if !table.Valid {
+		return nil, fmt.Errorf("tenant %s/%s has no partition on record", company, branch)
+	}
+	data.Partition = table.String
+	return data, nil
+}
+
+// newPartition gives a tenant its id, which is also its partition's list
+// value, and the partition name derived from it. Neither changes when the
+// tenant is renamed.
+func newPartition(data *domain.Tenant, prefix string) {
+	data.ID = uuid.New()
+	data.Partition = prefix + strings.ReplaceAll(data.ID.String(), "-", "")
+}
+
+func registerTenant(tx *sql.Tx, data *domain.Tenant) error {
+	if len(data.Settings) == 0 {
+		data.Settings = []byte("{}")
+	}
+
+	query := "INSERT INTO company.tenants (id, company, branch, display_name, settings, partition_table) VALUES ($1, $2, $3, $4, $5, $6) RETURNING " + tenantColumns
+	return tx.QueryRow(query, data.ID, data.Company, data.Branch, data.DisplayName, string(data.Settings), data.Partition).Scan(&data.ID, &data.Company, &data.Branch, &data.DisplayName, &data.Status, (*[]byte)(&data.Settings), &data.CreateAt, &data.UpdateAt)
+}
+
+// moveTenant registers data under its new company, branch and partition,
+// carrying over the metadata of the old entry. The old entry is left to the
+// caller.
+func moveTenant(tx *sql.Tx, oldCompany, oldBranch string, data *domain.Tenant) error {
+	query := `INSERT INTO company.tenants (id, company, branch, display_name, status, settings, create_at, partition_table)
+		SELECT $3, $4, $5, display_name, status, settings, create_at, $6 FROM company.tenants WHERE company = $1 AND branch = $2`
+	res, err := tx.Exec(query, oldCompany, oldBranch, data.ID, data.Company, data.Branch, data.Partition)
 	if err != nil {
 		return err
 	}
 
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrTenantNotFound
+	}
 	return nil
 }
@@ -0,0 +1,26 @@
+package repositories
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+	"strings"
+	"testing"
+)
+
+func TestNewPartition(t *testing.T) {
+	a := &domain.Tenant{Company: "acme"}
+	b := &domain.Tenant{Company: "acme"}
+	newPartition(a, "c_")
+	newPartition(b, "c_")
+
+	if a.Partition == b.Partition {
+		t.Fatalf("two tenants share partition %s", a.Partition)
+	}
+	if a.Partition != "c_"+strings.ReplaceAll(a.ID.String(), "-", "") {
+		t.Errorf("partition %s is not named after id %s", a.Partition, a.ID)
+	}
+
+	// A plain lowercase identifier within Postgres' 63-byte limit
+	if len(a.Partition) > 63 || strings.ContainsAny(a.Partition, `-"`) || a.Partition != strings.ToLower(a.Partition) {
+		t.Errorf("partition %s is not a plain identifier", a.Partition)
+	}
+}
@@ -0,0 +1,129 @@
+package repositories
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type mfaRepository struct {
+	db *sqlx.DB
+}
+
+func NewMFARepository(db *sqlx.DB) *mfaRepository {
+	return &mfaRepository{db: db}
+}
+
+func (r *mfaRepository) GetMFA(data *domain.MFA) (*domain.MFA, error) {
+	query := "SELECT user_id, company, branch, secret, enabled_at, last_used_step, create_at FROM company.mfa WHERE user_id = $1"
+	err := r.db.QueryRow(query, data.UserID).Scan(&data.UserID, &data.Company, &data.Branch, &data.Secret, &data.EnabledAt, &data.LastUsedStep, &data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// SaveMFA stores a pending enrolment, replacing any earlier pending secret.
+func (r *mfaRepository) SaveMFA(data *domain.MFA) (*domain.MFA, error) {
+	query := `INSERT INTO company.mfa (user_id, company, branch, secret) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, enabled_at = NULL, last_used_step = 0, create_at = CURRENT_TIMESTAMP
+		RETURNING create_at`
+	err := r.db.QueryRow(query, data.UserID, data.Company, data.Branch, data.Secret).Scan(&data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *mfaRepository) EnableMFA(data *domain.MFA) error {
+	query := "UPDATE company.mfa SET enabled_at = CURRENT_TIMESTAMP WHERE user_id = $1"
+	_, err := r.db.Exec(query, data.UserID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *mfaRepository) DeleteMFA(data *domain.MFA) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	_, err = tx.Exec("DELETE FROM company.mfa_recovery_codes WHERE user_id = $1", data.UserID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM company.mfa WHERE user_id = $1", data.UserID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UseStep records the time step of an accepted code. It reports false when
+// the step is not newer than the last accepted one, so a code cannot be replayed.
+func (r *mfaRepository) UseStep(data *domain.MFA) (bool, error) {
+	query := "UPDATE company.mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2"
+	res, err := r.db.Exec(query, data.UserID, data.LastUsedStep)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *mfaRepository) ReplaceRecoveryCodes(data *domain.MFA, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	_, err = tx.Exec("DELETE FROM company.mfa_recovery_codes WHERE user_id = $1", data.UserID)
+	if err != nil {
+		return err
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec("INSERT INTO company.mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)", data.UserID, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *mfaRepository) UseRecoveryCode(data *domain.MFA, codeHash string) (bool, error) {
+	query := "UPDATE company.mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL"
+	res, err := r.db.Exec(query, data.UserID, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const networkColumns = "company, branch, allowed_cidrs, window_start, window_end, timezone, update_at"
+
+type networkRepository struct {
+	db *sqlx.DB
+}
+
+func NewNetworkRepository(db *sqlx.DB) *networkRepository {
+	return &networkRepository{db: db}
+}
+
+// GetNetworkPolicies returns the company-wide policy and the branch policies
+// of the company.
+func (r *networkRepository) GetNetworkPolicies(data *domain.NetworkPolicy) ([]domain.NetworkPolicy, error) {
+	policies := []domain.NetworkPolicy{}
+
+	query := "SELECT " + networkColumns + " FROM company.network_policies WHERE company = $1 ORDER BY branch"
+	rows, err := r.db.Query(query, data.Company)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p domain.NetworkPolicy
+		err := rows.Scan(&p.Company, &p.Branch, pq.Array(&p.AllowedCIDRs), &p.WindowStart, &p.WindowEnd, &p.Timezone, &p.UpdateAt)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+func (r *networkRepository) SaveNetworkPolicy(data *domain.NetworkPolicy) (*domain.NetworkPolicy, error) {
+	query := `INSERT INTO company.network_policies (company, branch, allowed_cidrs, window_start, window_end, timezone) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (company, branch) DO UPDATE SET allowed_cidrs = EXCLUDED.allowed_cidrs, window_start = EXCLUDED.window_start,
+			window_end = EXCLUDED.window_end, timezone = EXCLUDED.timezone, update_at = CURRENT_TIMESTAMP
+		RETURNING update_at`
+	err := r.db.QueryRow(query, data.Company, data.Branch, pq.Array(data.AllowedCIDRs), data.WindowStart, data.WindowEnd, data.Timezone).Scan(&data.UpdateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *networkRepository) DeleteNetworkPolicy(data *domain.NetworkPolicy) (bool, error) {
+	res, err := r.db.Exec("DELETE FROM company.network_policies WHERE company = $1 AND branch = $2", data.Company, data.Branch)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
@@ -0,0 +1,98 @@
+package repositories
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type oidcRepository struct {
+	db *sqlx.DB
+}
+
+func NewOIDCRepository(db *sqlx.DB) *oidcRepository {
+	return &oidcRepository{db: db}
+}
+
+func (r *oidcRepository) GetClients() ([]domain.OAuthClient, error) {
+	clients := []domain.OAuthClient{}
+
+	query := "SELECT client_id, COALESCE(secret_hash, ''), name, redirect_uris, create_at FROM company.oauth_clients ORDER BY name"
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var client domain.OAuthClient
+		err := rows.Scan(&client.ClientID, &client.SecretHash, &client.Name, pq.Array(&client.RedirectURIs), &client.CreateAt)
+		if err != nil {
+			return nil, err
+		}
+		client.Public = client.SecretHash == ""
+		clients = append(clients, client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+func (r *oidcRepository) GetClient(data *domain.OAuthClient) (*domain.OAuthClient, error) {
+	query := "SELECT client_id, COALESCE(secret_hash, ''), name, redirect_uris, create_at FROM company.oauth_clients WHERE client_id = $1"
+	err := r.db.QueryRow(query, data.ClientID).Scan(&data.ClientID, &data.SecretHash, &data.Name, pq.Array(&data.RedirectURIs), &data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	data.Public = data.SecretHash == ""
+	return data, nil
+}
+
+func (r *oidcRepository) CreateClient(data *domain.OAuthClient) (*domain.OAuthClient, error) {
+	query := "INSERT INTO company.oauth_clients (client_id, secret_hash, name, redirect_uris) VALUES ($1, NULLIF($2, ''), $3, $4) RETURNING create_at"
+	err := r.db.QueryRow(query, data.ClientID, data.SecretHash, data.Name, pq.Array(data.RedirectURIs)).Scan(&data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *oidcRepository) DeleteClient(data *domain.OAuthClient) (bool, error) {
+	query := "DELETE FROM company.oauth_clients WHERE client_id = $1"
+	res, err := r.db.Exec(query, data.ClientID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *oidcRepository) CreateCode(data *domain.AuthorizationCode, ttlSeconds int) error {
+	query := `INSERT INTO company.oauth_codes (code_hash, client_id, user_id, company, branch, redirect_uri, scope, nonce, code_challenge, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, CURRENT_TIMESTAMP + make_interval(secs => $10))`
+	_, err := r.db.Exec(query, data.CodeHash, data.ClientID, data.UserID, data.Company, data.Branch, data.RedirectURI, data.Scope, data.Nonce, data.CodeChallenge, ttlSeconds)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UseCode burns an unexpired code and returns what it was issued for. It
+// returns sql.ErrNoRows for unknown, used and expired codes alike.
+func (r *oidcRepository) UseCode(data *domain.AuthorizationCode) (*domain.AuthorizationCode, error) {
+	query := `UPDATE company.oauth_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE code_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING client_id, user_id, company, branch, redirect_uri, scope, nonce, code_challenge, create_at`
+	err := r.db.QueryRow(query, data.CodeHash).Scan(&data.ClientID, &data.UserID, &data.Company, &data.Branch, &data.RedirectURI, &data.Scope, &data.Nonce, &data.CodeChallenge, &data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const policyColumns = "company, mfa_required, password_min_length, password_require_upper, password_require_lower, password_require_digit, password_require_symbol, password_check_breached, password_max_age_days, password_history, open_registration"
+
+type policyRepository struct {
+	db *sqlx.DB
+}
+
+func NewPolicyRepository(db *sqlx.DB) *policyRepository {
+	return &policyRepository{db: db}
+}
+
+func (r *policyRepository) GetPolicy(data *domain.SecurityPolicy) (*domain.SecurityPolicy, error) {
+	query := "SELECT " + policyColumns + " FROM company.security_policies WHERE company = $1"
+	err := r.db.QueryRow(query, data.Company).Scan(&data.Company, &data.MFARequired, &data.PasswordMinLength, &data.PasswordRequireUpper, &data.PasswordRequireLower, &data.PasswordRequireDigit, &data.PasswordRequireSymbol, &data.PasswordCheckBreached, &data.PasswordMaxAgeDays, &data.PasswordHistory, &data.OpenRegistration)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *policyRepository) SavePolicy(data *domain.SecurityPolicy) (*domain.SecurityPolicy, error) {
+	query := "INSERT INTO company.security_policies (" + policyColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (company) DO UPDATE SET mfa_required = EXCLUDED.mfa_required,
+			password_min_length = EXCLUDED.password_min_length,
+			password_require_upper = EXCLUDED.password_require_upper,
+			password_require_lower = EXCLUDED.password_require_lower,
+			password_require_digit = EXCLUDED.password_require_digit,
+			password_require_symbol = EXCLUDED.password_require_symbol,
+			password_check_breached = EXCLUDED.password_check_breached,
+			password_max_age_days = EXCLUDED.password_max_age_days,
+			password_history = EXCLUDED.password_history,
+			open_registration = EXCLUDED.open_registration,
+			update_at = CURRENT_TIMESTAMP`
+	_, err := r.db.Exec(query, data.Company, data.MFARequired, data.PasswordMinLength, data.PasswordRequireUpper, data.PasswordRequireLower, data.PasswordRequireDigit, data.PasswordRequireSymbol, data.PasswordCheckBreached, data.PasswordMaxAgeDays, data.PasswordHistory, data.OpenRegistration)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetPasswordHistory returns the user's most recent password hashes.
+func (r *policyRepository) GetPasswordHistory(data *domain.Data, limit int) ([]string, error) {
+	hashes := []string{}
+	err := r.db.Select(&hashes, "SELECT password_hash FROM company.password_history WHERE user_id = $1 ORDER BY create_at DESC, id LIMIT $2", data.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// AddPasswordHistory records the user's new password hash and forgets the
+// ones beyond the longest history a policy can ask for.
+func (r *policyRepository) AddPasswordHistory(data *domain.Data) error {
+	_, err := r.db.Exec("INSERT INTO company.password_history (user_id, password_hash) VALUES ($1, $2)", data.ID, data.Password)
+	if err != nil {
+		return err
+	}
+
+	query := `DELETE FROM company.password_history WHERE user_id = $1 AND id NOT IN (
+		SELECT id FROM company.password_history WHERE user_id = $1 ORDER BY create_at DESC, id LIMIT $2)`
+	_, err = r.db.Exec(query, data.ID, domain.PasswordHistoryMax)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package repositories
+
+import "github.com/lib/pq"
+
+// DDL cannot take bind parameters, so tenant names spliced into it are
+// always quoted with these, even though the services validate them first.
+
+// partition names a table of the company schema.
+func partition(name string) string {
+	return "company." + pq.QuoteIdentifier(name)
+}
+
+// archived names a table of the company_archive schema.
+func archived(name string) string {
+	return "company_archive." + pq.QuoteIdentifier(name)
+}
+
+// literal quotes a partition bound value.
+func literal(value string) string {
+	return pq.QuoteLiteral(value)
+}
@@ -0,0 +1,152 @@
+package repositories
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+	"strings"
+	"testing"
+)
+
+var quoteSeeds = []string{"acme", "c_0f9c", `acme"; DROP TABLE company.accounts; --`, `a""b`, "acme'", `a\b`, `\'`, "", "ÿ", "a\x00b"}
+
+// unquoteIdentifier reads one double-quoted identifier and reports whether
+// it spans all of s.
+func unquoteIdentifier(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", false
+	}
+
+	var b strings.Builder
+	inner := s[1 : len(s)-1]
+	for i := 0; i < len(inner); i++ {
+		if inner[i] == '"' {
+			if i+1 == len(inner) || inner[i+1] != '"' {
+				return "", false
+			}
+			i++
+		}
+		b.WriteByte(inner[i])
+	}
+	return b.String(), true
+}
+
+// unquoteLiteral reads one single-quoted literal, with backslash escapes
+// when it has the E prefix, and reports whether it spans all of s.
+func unquoteLiteral(s string) (string, bool) {
+	escapes := strings.HasPrefix(s, " E'")
+	if escapes {
+		s = s[2:]
+	}
+	if len(s) < 2 || s[0] != '\'' || s[len(s)-1] != '\'' {
+		return "", false
+	}
+
+	var b strings.Builder
+	inner := s[1 : len(s)-1]
+	for i := 0; i < len(inner); i++ {
+		switch {
+		case inner[i] == '\'':
+			if i+1 == len(inner) || inner[i+1] != '\'' {
+				return "", false
+			}
+			i++
+		case inner[i] == '\\' && escapes:
+			if i+1 == len(inner) || inner[i+1] != '\\' {
+				return "", false
+			}
+			i++
+		}
+		b.WriteByte(inner[i])
+	}
+	return b.String(), true
+}
+
+func FuzzPartition(f *testing.F) {
+	for _, seed := range quoteSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, name string) {
+		for _, quote := range []struct {
+			schema string
+			quote  func(string) string
+		}{
+			{schema: "company.", quote: partition},
+			{schema: "company_archive.", quote: archived},
+		} {
+			quoted := quote.quote(name)
+			if !strings.HasPrefix(quoted, quote.schema) {
+				t.Fatalf("%q is not in %s", quoted, quote.schema)
+			}
+
+			got, ok := unquoteIdentifier(strings.TrimPrefix(quoted, quote.schema))
+			if !ok {
+				t.Fatalf("%q is not a single quoted identifier", quoted)
+			}
+
+			// Postgres identifiers end at a NUL byte, so the quoting drops the rest
+			want, _, _ := strings.Cut(name, "\x00")
+			if got != want {
+				t.Fatalf("%q names %q, want %q", quoted, got, want)
+			}
+		}
+	})
+}
+
+func FuzzLiteral(f *testing.F) {
+	for _, seed := range quoteSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		quoted := literal(value)
+
+		got, ok := unquoteLiteral(quoted)
+		if !ok {
+			t.Fatalf("%q is not a single quoted literal", quoted)
+		}
+		if got != value {
+			t.Fatalf("%q reads as %q, want %q", quoted, got, value)
+		}
+	})
+}
+
+func FuzzValidTenantName(f *testing.F) {
+	for _, seed := range append(quoteSeeds, "acme-east", "7eleven", "pg_class", "a_1", strings.Repeat("a", 64)) {
+		f.Add(seed)
+	}
+	tables := readSchema(f)
+	for name := range tables {
+		f.Add(name)
+	}
+
+	f.Fuzz(func(t *testing.T, name string) {
+		if domain.ValidTenantName(name) != nil {
+			return
+		}
+
+		// Postgres truncates longer identifiers, two slugs could share a table
+		if len(name) == 0 || len(name) > 63 {
+			t.Fatalf("accepted %q of %d bytes", name, len(name))
+		}
+
+		// An accepted slug needs no escaping, so it names the same table
+		// however it is spliced into DDL
+		quoted := partition(name)
+		got, ok := unquoteIdentifier(strings.TrimPrefix(quoted, "company."))
+		if !ok || got != name || quoted != `company."`+name+`"` {
+			t.Fatalf("accepted %q, which quotes as %q", name, quoted)
+		}
+		if bound := literal(name); bound != "'"+name+"'" {
+			t.Fatalf("accepted %q, which quotes as %s", name, bound)
+		}
+
+		// Legacy partitions carry slugs, so no slug may look like a system
+		// table, an archived partition or a table of the company schema
+		if strings.HasPrefix(name, "pg_") || strings.HasPrefix(name, "a_") {
+			t.Fatalf("accepted %q with a reserved prefix", name)
+		}
+		if _, ok := tables[name]; ok {
+			t.Fatalf("accepted %q, the name of a company table", name)
+		}
+	})
+}
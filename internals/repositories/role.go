@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"database/sql"
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const roleColumns = "id, company, name, description, permissions, create_at, update_at"
+
+type roleRepository struct {
+	db *sqlx.DB
+}
+
+func NewRoleRepository(db *sqlx.DB) *roleRepository {
+	return &roleRepository{db: db}
+}
+
+func (r *roleRepository) GetRoles(data *domain.CustomRole) ([]domain.CustomRole, error) {
+	query := "SELECT " + roleColumns + " FROM company.roles WHERE company = $1 ORDER BY name"
+	rows, err := r.db.Query(query, data.Company)
+	if err != nil {
+		return nil, err
+	}
+	return scanRoles(rows)
+}
+
+func (r *roleRepository) GetRole(data *domain.CustomRole) (*domain.CustomRole, error) {
+	query := "SELECT " + roleColumns + " FROM company.roles WHERE id = $1 AND company = $2"
+	err := r.db.QueryRow(query, data.ID, data.Company).Scan(&data.ID, &data.Company, &data.Name, &data.Description, pq.Array(&data.Permissions), &data.CreateAt, &data.UpdateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *roleRepository) CreateRole(data *domain.CustomRole) (*domain.CustomRole, error) {
+	query := "INSERT INTO company.roles (company, name, description, permissions) VALUES ($1, $2, $3, $4) RETURNING id, create_at"
+	err := r.db.QueryRow(query, data.Company, data.Name, data.Description, pq.Array(data.Permissions)).Scan(&data.ID, &data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *roleRepository) UpdateRole(data *domain.CustomRole) (*domain.CustomRole, error) {
+	query := `UPDATE company.roles SET name = $3, description = $4, permissions = $5, update_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND company = $2 RETURNING create_at, update_at`
+	err := r.db.QueryRow(query, data.ID, data.Company, data.Name, data.Description, pq.Array(data.Permissions)).Scan(&data.CreateAt, &data.UpdateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// DeleteRole removes the role together with its assignments.
+func (r *roleRepository) DeleteRole(data *domain.CustomRole) (bool, error) {
+	query := "DELETE FROM company.roles WHERE id = $1 AND company = $2"
+	res, err := r.db.Exec(query, data.ID, data.Company)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *roleRepository) AssignRole(data *domain.RoleAssignment) error {
+	query := "INSERT INTO company.user_roles (user_id, role_id, company, branch) VALUES ($1, $2, $3, $4) ON CONFLICT (user_id, role_id) DO NOTHING"
+	_, err := r.db.Exec(query, data.UserID, data.RoleID, data.Company, data.Branch)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *roleRepository) UnassignRole(data *domain.RoleAssignment) error {
+	query := "DELETE FROM company.user_roles WHERE user_id = $1 AND role_id = $2 AND company = $3"
+	_, err := r.db.Exec(query, data.UserID, data.RoleID, data.Company)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *roleRepository) GetUserRoles(data *domain.RoleAssignment) ([]domain.CustomRole, error) {
+	query := `SELECT r.id, r.company, r.name, r.description, r.permissions, r.create_at, r.update_at
+		FROM company.roles r JOIN company.user_roles ur ON ur.role_id = r.id
+		WHERE ur.user_id = $1 ORDER BY r.name`
+	rows, err := r.db.Query(query, data.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return scanRoles(rows)
+}
+
+func (r *roleRepository) GetRoleMembers(data *domain.CustomRole) ([]domain.RoleAssignment, error) {
+	members := []domain.RoleAssignment{}
+
+	query := "SELECT user_id, role_id, company, branch FROM company.user_roles WHERE role_id = $1 AND company = $2 ORDER BY create_at"
+	rows, err := r.db.Query(query, data.ID, data.Company)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m domain.RoleAssignment
+		if err := rows.Scan(&m.UserID, &m.RoleID, &m.Company, &m.Branch); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// GetUserPermissions returns the union of the permissions of every role
+// assigned to the user.
+func (r *roleRepository) GetUserPermissions(data *domain.RoleAssignment) ([]string, error) {
+	perms := []string{}
+
+	query := `SELECT DISTINCT unnest(r.permissions) FROM company.roles r
+		JOIN company.user_roles ur ON ur.role_id = r.id WHERE ur.user_id = $1`
+	rows, err := r.db.Query(query, data.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var perm string
+		if err := rows.Scan(&perm); err != nil {
+			return nil, err
+		}
+		perms = append(perms, perm)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return perms, nil
+}
+
+func scanRoles(rows *sql.Rows) ([]domain.CustomRole, error) {
+	roles := []domain.CustomRole{}
+	defer rows.Close()
+
+	for rows.Next() {
+		var role domain.CustomRole
+		err := rows.Scan(&role.ID, &role.Company, &role.Name, &role.Description, pq.Array(&role.Permissions), &role.CreateAt, &role.UpdateAt)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,198 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// sideTable is a table outside the partitions whose rows belong to a company,
+// or to one of its branches when it has a branch column. These rows are keyed
+// by slug, so they must follow the partition wherever it goes.
+type sideTable struct {
+	name   string
+	branch bool // rows carry the branch slug, '' for company-wide rows
+	keep   bool // archived and restored with the partition, the others are only dropped
+	local  bool // refers to the company's roles or identity provider, dropped when a branch changes company
+}
+
+// sideTables are in restore order, roles before the user_roles referencing
+// them. The audit log follows renames but is never archived or deleted.
+var sideTables = []sideTable{
+	{name: "security_policies", keep: true},
+	{name: "roles", keep: true},
+	{name: "identity_providers", keep: true},
+	{name: "sso_states"},
+	{name: "network_policies", branch: true, keep: true},
+	{name: "user_roles", branch: true, keep: true, local: true},
+	{name: "api_keys", branch: true, keep: true},
+	{name: "mfa", branch: true, keep: true},
+	{name: "federated_identities", branch: true, keep: true, local: true},
+	{name: "invitations", branch: true, keep: true},
+	{name: "sessions", branch: true},
+	{name: "oauth_codes", branch: true},
+}
+
+// archiveSideRows copies the tenant's rows kept by sideTables into the
+// archive record, then deletes all of its rows. Without a branch that is the
+// whole company's, otherwise only the branch's. Sessions and pending logins
+// are dropped, nobody can log in to an archived tenant anyway.
+func archiveSideRows(tx *sql.Tx, archiveID uuid.UUID, company, branch string) error {
+	where, args := "t.company = $1", []interface{}{company}
+	if branch != "" {
+		where, args = "t.company = $1 AND t.branch = $2", append(args, branch)
+	}
+	n := len(args)
+
+	// Copy everything before deleting anything, roles take their user_roles along
+	for _, table := range sideTables {
+		if !table.keep || (branch != "" && !table.branch) {
+			continue
+		}
+
+		query := fmt.Sprintf(`UPDATE company.archives SET side_rows = side_rows || jsonb_build_object($%d::text,
+			(SELECT COALESCE(jsonb_agg(to_jsonb(t)), '[]') FROM company.%s t WHERE %s))
+			WHERE id = $%d`, n+1, table.name, where, n+2)
+		_, err := tx.Exec(query, append(args, table.name, archiveID)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, table := range sideTables {
+		if branch != "" && !table.branch {
+			continue
+		}
+
+		_, err := tx.Exec(fmt.Sprintf(`DELETE FROM company.%s t WHERE %s`, table.name, where), args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreSideRows puts back the rows archiveSideRows kept.
+func restoreSideRows(tx *sql.Tx, archiveID uuid.UUID) error {
+	for _, table := range sideTables {
+		if !table.keep {
+			continue
+		}
+
+		query := fmt.Sprintf(`INSERT INTO company.%s
+			SELECT * FROM jsonb_populate_recordset(NULL::company.%s,
+				(SELECT COALESCE(side_rows -> $2::text, '[]') FROM company.archives WHERE id = $1))
+			ON CONFLICT DO NOTHING`, table.name, table.name)
+		_, err := tx.Exec(query, archiveID, table.name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renameCompanyRows points the company's rows and its audit log entries at
+// the company's new slug, signing everyone in the company out.
+func renameCompanyRows(tx *sql.Tx, oldCompany, newCompany string) error {
+	if err := revokeTenantSessions(tx, oldCompany, ""); err != nil {
+		return err
+	}
+
+	for _, table := range sideTables {
+		_, err := tx.Exec(fmt.Sprintf(`UPDATE company.%s SET company = $2 WHERE company = $1`, table.name), oldCompany, newCompany)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, column := range []string{"actor_company", "target_company"} {
+		_, err := tx.Exec(fmt.Sprintf(`UPDATE company.audit_log SET %s = $2 WHERE %s = $1`, column, column), oldCompany, newCompany)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// moveBranchRows points the branch's rows and its audit log entries at the
+// branch's new company and slug, signing everyone in the branch out. Within
+// the company this is a rename, when the branch changes company the rows
+// marked local are dropped instead.
+func moveBranchRows(tx *sql.Tx, oldCompany, oldBranch, newCompany, newBranch string) error {
+	if err := revokeTenantSessions(tx, oldCompany, oldBranch); err != nil {
+		return err
+	}
+
+	for _, table := range sideTables {
+		if !table.branch {
+			continue
+		}
+
+		var err error
+		if table.local && oldCompany != newCompany {
+			_, err = tx.Exec(fmt.Sprintf(`DELETE FROM company.%s WHERE company = $1 AND branch = $2`, table.name), oldCompany, oldBranch)
+		} else {
+			_, err = tx.Exec(fmt.Sprintf(`UPDATE company.%s SET company = $3, branch = $4 WHERE company = $1 AND branch = $2`, table.name), oldCompany, oldBranch, newCompany, newBranch)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if oldCompany == newCompany {
+		_, err := tx.Exec(`UPDATE company.identity_providers SET default_branch = $3 WHERE company = $1 AND default_branch = $2`, oldCompany, oldBranch, newBranch)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(`UPDATE company.audit_log SET target_company = $3, target_branch = $4 WHERE target_company = $1 AND target_branch = $2`, oldCompany, oldBranch, newCompany, newBranch)
+	return err
+}
+
+// revokeTenantSessions revokes the sessions of the company, or of one of its
+// branches. Access tokens carry the slug until they expire, and would
+// otherwise act in whichever tenant takes the old slug next.
+func revokeTenantSessions(tx *sql.Tx, company, branch string) error {
+	query, args := `UPDATE company.sessions SET revoked_at = CURRENT_TIMESTAMP WHERE company = $1 AND revoked_at IS NULL`, []interface{}{company}
+	if branch != "" {
+		query, args = query+` AND branch = $2`, append(args, branch)
+	}
+
+	_, err := tx.Exec(query, args...)
+	return err
+}
+
+// copyCompanyPolicies gives a company split off another one the same
+// security and company-wide network policies, rather than the defaults.
+func copyCompanyPolicies(tx *sql.Tx, fromCompany, toCompany string) error {
+	for _, table := range []string{"security_policies", "network_policies"} {
+		query := fmt.Sprintf(`INSERT INTO company.%s
+			SELECT (jsonb_populate_record(NULL::company.%s, to_jsonb(p) || jsonb_build_object('company', $2::text))).*
+			FROM company.%s p WHERE p.company = $1 AND COALESCE(to_jsonb(p) ->> 'branch', '') = ''
+			ON CONFLICT DO NOTHING`, table, table, table)
+		_, err := tx.Exec(query, fromCompany, toCompany)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteCompanyRows drops the rows left behind by a company that no longer
+// exists. The audit log keeps its entries.
+func deleteCompanyRows(tx *sql.Tx, company string) error {
+	for _, table := range sideTables {
+		_, err := tx.Exec(fmt.Sprintf(`DELETE FROM company.%s WHERE company = $1`, table.name), company)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// notSideTables carry a company column but are moved by the tenant
+// operations themselves rather than through sideTables.
+var notSideTables = map[string]string{
+	"onesystem": "legacy accounts, moved out to company_legacy by the migration",
+	"tenants":   "the registry, updated by every tenant operation",
+	"archives":  "the archive records, keyed by tenant id",
+}
+
+// transientSideTables are dropped rather than archived with a tenant.
+var transientSideTables = map[string]bool{
+	"sso_states":  true,
+	"sessions":    true,
+	"oauth_codes": true,
+}
+
+var (
+	createTablePattern = regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS company\.(\w+) \((.*?)\n\)[^;\n]*;`)
+	addColumnPattern   = regexp.MustCompile(`ALTER TABLE company\.(\w+) ADD COLUMN IF NOT EXISTS (\w+)`)
+	referencesPattern  = regexp.MustCompile(`REFERENCES company\.(\w+)`)
+)
+
+type schemaTable struct {
+	columns    map[string]bool
+	references []string
+}
+
+// readSchema returns the tables of the company schema with their columns
+// and the tables they reference.
+func readSchema(t testing.TB) map[string]*schemaTable {
+	t.Helper()
+
+	b, err := os.ReadFile("../../schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := string(b)
+
+	tables := map[string]*schemaTable{}
+	for _, m := range createTablePattern.FindAllStringSubmatch(schema, -1) {
+		table := &schemaTable{columns: map[string]bool{}}
+		for _, line := range strings.Split(m[2], "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 {
+				table.columns[strings.Trim(fields[0], `",`)] = true
+			}
+		}
+		for _, ref := range referencesPattern.FindAllStringSubmatch(m[2], -1) {
+			table.references = append(table.references, ref[1])
+		}
+		tables[m[1]] = table
+	}
+	for _, m := range addColumnPattern.FindAllStringSubmatch(schema, -1) {
+		if table, ok := tables[m[1]]; ok {
+			table.columns[m[2]] = true
+		}
+	}
+
+	if len(tables) == 0 {
+		t.Fatal("no tables found in schema.sql")
+	}
+	return tables
+}
+
+func TestSideTablesCoverSchema(t *testing.T) {
+	tables := readSchema(t)
+
+	listed := map[string]int{}
+	for i, table := range sideTables {
+		listed[table.name] = i
+	}
+
+	// Every table keyed by company slug is renamed, moved and archived with it
+	for name, table := range tables {
+		if !table.columns["company"] || notSideTables[name] != "" {
+			continue
+		}
+		if _, ok := listed[name]; !ok {
+			t.Errorf("company.%s has a company column but is not in sideTables, renames and archives would leave its rows behind", name)
+		}
+	}
+
+	for i, side := range sideTables {
+		table, ok := tables[side.name]
+		if !ok {
+			t.Errorf("sideTables lists company.%s, which is not in schema.sql", side.name)
+			continue
+		}
+		if !table.columns["company"] {
+			t.Errorf("company.%s has no company column", side.name)
+		}
+		if side.branch != table.columns["branch"] {
+			t.Errorf("company.%s: branch = %v, but the branch column exists = %v", side.name, side.branch, table.columns["branch"])
+		}
+		if side.keep == transientSideTables[side.name] {
+			t.Errorf("company.%s: keep = %v, decide whether archives keep it and update transientSideTables", side.name, side.keep)
+		}
+
+		for _, ref := range table.references {
+			j, ok := listed[ref]
+			if !ok {
+				continue
+			}
+			// Restored in list order, so referenced rows must come back first
+			if j > i {
+				t.Errorf("company.%s references company.%s, which comes later in sideTables", side.name, ref)
+			}
+			// Company-wide rows stay behind when a branch changes company
+			if side.branch && !sideTables[j].branch && !side.local {
+				t.Errorf("company.%s references the company-wide company.%s but is not local", side.name, ref)
+			}
+		}
+	}
+
+	for name := range notSideTables {
+		if _, ok := listed[name]; ok {
+			t.Errorf("company.%s is both in sideTables and in notSideTables", name)
+		}
+	}
+}
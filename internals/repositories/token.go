@@ -0,0 +1,131 @@
+package repositories
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const sessionColumns = "id, user_id, company, branch, username, actor_id, client_id, user_agent, ip, create_at, last_seen_at, revoked_at"
+
+type tokenRepository struct {
+	db *sqlx.DB
+}
+
+func NewTokenRepository(db *sqlx.DB) *tokenRepository {
+	return &tokenRepository{db: db}
+}
+
+func (r *tokenRepository) CreateSession(data *domain.Session) (*domain.Session, error) {
+	query := `INSERT INTO company.sessions (user_id, company, branch, username, actor_id, client_id, user_agent, ip, last_seen_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CURRENT_TIMESTAMP) RETURNING id, create_at, last_seen_at`
+	err := r.db.QueryRow(query, data.UserID, data.Company, data.Branch, data.Username, data.ActorID, data.ClientID, data.UserAgent, data.IP).Scan(&data.ID, &data.CreateAt, &data.LastSeenAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *tokenRepository) GetSession(data *domain.Session) (*domain.Session, error) {
+	query := "SELECT " + sessionColumns + " FROM company.sessions WHERE id = $1"
+	err := r.db.QueryRow(query, data.ID).Scan(&data.ID, &data.UserID, &data.Company, &data.Branch, &data.Username, &data.ActorID, &data.ClientID, &data.UserAgent, &data.IP, &data.CreateAt, &data.LastSeenAt, &data.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetUserSessions lists the user's sessions that are not revoked and were
+// used within the last idleSeconds, most recently used first.
+func (r *tokenRepository) GetUserSessions(data *domain.Session, idleSeconds int) ([]domain.Session, error) {
+	sessions := []domain.Session{}
+
+	query := "SELECT " + sessionColumns + ` FROM company.sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND COALESCE(last_seen_at, create_at) > CURRENT_TIMESTAMP - make_interval(secs => $2)
+		ORDER BY COALESCE(last_seen_at, create_at) DESC`
+	rows, err := r.db.Query(query, data.UserID, idleSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s domain.Session
+		err := rows.Scan(&s.ID, &s.UserID, &s.Company, &s.Branch, &s.Username, &s.ActorID, &s.ClientID, &s.UserAgent, &s.IP, &s.CreateAt, &s.LastSeenAt, &s.RevokedAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// TouchSession records that the session was used. Empty device fields are
+// left as they were, and last_seen_at is written at most once a minute so
+// busy sessions do not cost a write per request.
+func (r *tokenRepository) TouchSession(data *domain.Session) error {
+	query := `UPDATE company.sessions SET last_seen_at = CURRENT_TIMESTAMP,
+			user_agent = COALESCE(NULLIF($2, ''), user_agent), ip = COALESCE(NULLIF($3, ''), ip)
+		WHERE id = $1 AND ($2 <> '' OR $3 <> '' OR last_seen_at IS NULL OR last_seen_at < CURRENT_TIMESTAMP - interval '1 minute')`
+	_, err := r.db.Exec(query, data.ID, data.UserAgent, data.IP)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *tokenRepository) RevokeSession(data *domain.Session) error {
+	query := "UPDATE company.sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL"
+	_, err := r.db.Exec(query, data.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *tokenRepository) RevokeUserSessions(data *domain.Session) error {
+	query := "UPDATE company.sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL"
+	_, err := r.db.Exec(query, data.UserID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *tokenRepository) CreateRefreshToken(data *domain.RefreshToken) (*domain.RefreshToken, error) {
+	query := "INSERT INTO company.refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3) RETURNING id, create_at"
+	err := r.db.QueryRow(query, data.SessionID, data.TokenHash, data.ExpiresAt).Scan(&data.ID, &data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *tokenRepository) GetRefreshToken(data *domain.RefreshToken) (*domain.RefreshToken, error) {
+	query := "SELECT id, session_id, token_hash, expires_at, used_at, create_at FROM company.refresh_tokens WHERE token_hash = $1"
+	err := r.db.QueryRow(query, data.TokenHash).Scan(&data.ID, &data.SessionID, &data.TokenHash, &data.ExpiresAt, &data.UsedAt, &data.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// UseRefreshToken marks the token as used. It reports false when the token
+// had already been used, so two concurrent refreshes cannot both succeed.
+func (r *tokenRepository) UseRefreshToken(data *domain.RefreshToken) (bool, error) {
+	query := "UPDATE company.refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1 AND used_at IS NULL"
+	res, err := r.db.Exec(query, data.ID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"fmt"
+	"go-multi-tenancy/internals/core/domain"
 	"go-multi-tenancy/internals/core/ports"
 	"go-multi-tenancy/internals/middleware"
 
@@ -11,15 +12,39 @@ import (
 )
 
 type Server struct {
-	company ports.CompanyHandler
-	manage  ports.ManageHandler
+	company      ports.CompanyHandler
+	manage       ports.ManageHandler
+	mfa          ports.MFAHandler
+	account      ports.AccountHandler
+	policy       ports.PolicyHandler
+	role         ports.RoleHandler
+	apiKey       ports.APIKeyHandler
+	oidc         ports.OIDCHandler
+	sso          ports.FederationHandler
+	scim         ports.SCIMHandler
+	imperson     ports.ImpersonationHandler
+	session      ports.SessionHandler
+	networks     ports.NetworkPolicyHandler
+	invite       ports.InvitationHandler
+	bootstrap    ports.BootstrapHandler
+	tenant       ports.TenantHandler
+	wellKnown    ports.WellKnownHandler
+	tokens       ports.TokenService
+	apiKeys      ports.APIKeyService
+	network      ports.NetworkPolicyService
+	tenantStatus ports.TenantStatusService
 }
 
-func NewServer(company ports.CompanyHandler, manage ports.ManageHandler) *Server {
-	return &Server{company: company, manage: manage}
+func NewServer(company ports.CompanyHandler, manage ports.ManageHandler, mfa ports.MFAHandler, account ports.AccountHandler, policy ports.PolicyHandler, role ports.RoleHandler, apiKey ports.APIKeyHandler, oidc ports.OIDCHandler, sso ports.FederationHandler, scim ports.SCIMHandler, imperson ports.ImpersonationHandler, session ports.SessionHandler, networks ports.NetworkPolicyHandler, invite ports.InvitationHandler, bootstrap ports.BootstrapHandler, tenant ports.TenantHandler, wellKnown ports.WellKnownHandler, tokens ports.TokenService, apiKeys ports.APIKeyService, network ports.NetworkPolicyService, tenantStatus ports.TenantStatusService) *Server {
+	return &Server{company: company, manage: manage, mfa: mfa, account: account, policy: policy, role: role, apiKey: apiKey, oidc: oidc, sso: sso, scim: scim, imperson: imperson, session: session, networks: networks, invite: invite, bootstrap: bootstrap, tenant: tenant, wellKnown: wellKnown, tokens: tokens, apiKeys: apiKeys, network: network, tenantStatus: tenantStatus}
 }
 
 func (s *Server) Initialize() {
+	s.App().Listen(fmt.Sprintf(":%v", viper.GetInt("app.port")))
+}
+
+// App builds the fiber app with every route, without listening.
+func (s *Server) App() *fiber.App {
 	app := fiber.New()
 
 	app.Use(cors.New(cors.Config{
@@ -28,24 +53,70 @@ func (s *Server) Initialize() {
 		AllowHeaders: "Content-Type, Authorization",
 	}))
 
+	app.Get("/.well-known/jwks.json", s.wellKnown.JWKS)
+	app.Get("/.well-known/openid-configuration", s.wellKnown.OpenIDConfiguration)
+
+	oauth := app.Group("/oauth")
+	oauth.Get("/authorize", s.oidc.Authorize)
+	oauth.Post("/token", s.oidc.Token)
+	oauth.Post("/authorize", middleware.JWTAuth(s.tokens, s.apiKeys, s.network), middleware.TenantStatus(s.tenantStatus), middleware.RequireUser(), middleware.BlockImpersonation(), s.oidc.ApproveAuthorize) // called by the login page once the user is logged in
+	oauth.Get("/userinfo", middleware.JWTAuth(s.tokens, s.apiKeys, s.network), middleware.TenantStatus(s.tenantStatus), middleware.RequireUser(), s.oidc.UserInfo)
+
 	v1 := app.Group("/api/v1")
 	company := v1.Group("company")
-	company.Post("/register", s.company.Register) // create user
-	company.Post("/admin", s.company.Admin)       // create admin
+	company.Post("/register", s.company.Register)     // create user
+	company.Post("/bootstrap", s.bootstrap.Bootstrap) // create the first super admin with the one-time bootstrap token
 	company.Post("/login", s.company.Login)
-	company.Use(middleware.JWTAuth())
+	company.Post("/login/mfa", s.mfa.Verify)                 // second step of the login
+	company.Post("/login/mfa/enroll", s.mfa.EnrollWithToken) // enrolment forced by company policy
+	company.Post("/token/refresh", s.company.Refresh)
+	company.Post("/password/forgot", s.account.ForgotPassword)
+	company.Post("/password/reset", s.account.ResetPassword)
+	company.Post("/email/verify", s.account.VerifyEmail)
+	company.Post("/invitations/accept", s.invite.AcceptInvitation) // set username and password from the invitation link
+	company.Get("/sso/:company/login", s.sso.Start)                // redirect to the company's identity provider
+	company.Post("/sso/:company/callback", s.sso.Callback)         // finish the login with the code and state
+	company.Use(middleware.JWTAuth(s.tokens, s.apiKeys, s.network))
 	{
-		company.Get("", middleware.AuthorizeRole("super_admin"), s.company.GetAllData)                                   // require admin role
-		company.Get("/data/company/:company", middleware.AuthorizeRole("head_admin"), s.company.GetCompanyData)          // require company admin role
-		company.Get("/data/company/:company/branch/:branch", middleware.AuthorizeRole("admin"), s.company.GetBranchData) // require branch admin role
-		company.Get("/data", middleware.AuthorizeRole("admin"), s.company.GetData)                                       // require admin role
-		company.Get("/data", s.company.GetMe)
-		company.Put("/data", s.company.UpdateData)
-		company.Delete("/data", s.company.DeleteData)
+		company.Post("/logout", middleware.RequireUser(), middleware.BlockImpersonation(), s.company.Logout)
+		company.Post("/impersonation/stop", s.imperson.Stop) // called with the impersonation token
+		company.Use(middleware.TenantStatus(s.tenantStatus)) // signing out stays possible, everything below follows the tenant state
+		company.Get("/sessions", middleware.RequireUser(), s.session.ListMySessions)
+		company.Delete("/sessions/:session_id", middleware.RequireUser(), middleware.BlockImpersonation(), s.session.RevokeMySession)
+		company.Post("/email/verification", middleware.RequireUser(), s.account.RequestEmailVerification)
+		company.Post("/mfa/enroll", middleware.RequireUser(), middleware.BlockImpersonation(), s.mfa.Enroll)
+		company.Post("/mfa/enroll/confirm", middleware.RequireUser(), middleware.BlockImpersonation(), s.mfa.Confirm)
+		company.Post("/mfa/recovery-codes", middleware.RequireUser(), middleware.BlockImpersonation(), s.mfa.RegenerateRecoveryCodes)
+		company.Delete("/mfa", middleware.RequireUser(), middleware.BlockImpersonation(), s.mfa.Disable)
+		company.Post("/admin", middleware.RequireUser(), middleware.RequirePermission(domain.PermUsersWrite), middleware.BlockImpersonation(), s.company.Admin) // create admin or head_admin, by a higher role
+		company.Post("/unlock", middleware.RequirePermission(domain.PermUsersWrite), s.company.Unlock)                                                          // clear failed login counters
+		company.Get("", middleware.RequirePermission(domain.PermTenantsManage), s.company.GetAllData)
+		company.Get("/data/company/:company", middleware.RequirePermission(domain.PermUsersRead), middleware.TenantScope(), s.company.GetCompanyData)               // own company only, unless tenants:manage
+		company.Get("/data/company/:company/branch/:branch", middleware.RequirePermission(domain.PermUsersRead), middleware.TenantScope(), s.company.GetBranchData) // own branch only, unless branches:manage
+		company.Get("/data", middleware.RequirePermission(domain.PermUsersRead), s.company.GetData)
+		company.Get("/data", middleware.RequireUser(), s.company.GetMe)
+		company.Put("/data", middleware.RequireUser(), middleware.BlockImpersonation(), s.company.UpdateData) // can change the password
+		company.Delete("/data", middleware.RequireUser(), middleware.BlockImpersonation(), s.company.DeleteData)
+		company.Get("/permissions", s.role.ListPermissions)
+		company.Get("/roles", middleware.RequirePermission(domain.PermRolesManage), s.role.ListRoles)
+		company.Post("/roles", middleware.RequirePermission(domain.PermRolesManage), s.role.CreateRole)
+		company.Put("/roles/:id", middleware.RequirePermission(domain.PermRolesManage), s.role.UpdateRole)
+		company.Delete("/roles/:id", middleware.RequirePermission(domain.PermRolesManage), middleware.BlockImpersonation(), s.role.DeleteRole)
+		company.Post("/roles/:id/assign", middleware.RequirePermission(domain.PermRolesManage), middleware.BlockImpersonation(), s.role.AssignRole)
+		company.Post("/roles/:id/unassign", middleware.RequirePermission(domain.PermRolesManage), middleware.BlockImpersonation(), s.role.UnassignRole)
+		company.Get("/users/:id/roles", middleware.RequirePermission(domain.PermRolesManage), s.role.UserRoles)
+		company.Get("/users/:id/sessions", middleware.RequirePermission(domain.PermUsersRead), s.session.ListUserSessions)
+		company.Delete("/users/:id/sessions/:session_id", middleware.RequirePermission(domain.PermUsersWrite), middleware.BlockImpersonation(), s.session.RevokeUserSession)
+		company.Get("/invitations", middleware.RequirePermission(domain.PermUsersRead), s.invite.ListInvitations)
+		company.Post("/invitations", middleware.RequireUser(), middleware.RequirePermission(domain.PermUsersWrite), s.invite.CreateInvitation)
+		company.Delete("/invitations/:id", middleware.RequirePermission(domain.PermUsersWrite), s.invite.RevokeInvitation)
+		company.Get("/api-keys", middleware.RequireUser(), middleware.RequirePermission(domain.PermAPIKeysManage), s.apiKey.ListAPIKeys)
+		company.Post("/api-keys", middleware.RequireUser(), middleware.RequirePermission(domain.PermAPIKeysManage), middleware.BlockImpersonation(), s.apiKey.CreateAPIKey)
+		company.Delete("/api-keys/:id", middleware.RequireUser(), middleware.RequirePermission(domain.PermAPIKeysManage), middleware.BlockImpersonation(), s.apiKey.RevokeAPIKey)
 	}
 
 	manage := v1.Group("manage")
-	company.Use(middleware.JWTAuth(), middleware.AuthorizeRole("super_admin"))
+	manage.Use(middleware.JWTAuth(s.tokens, s.apiKeys, s.network), middleware.RequirePermission(domain.PermTenantsManage))
 	{
 		manage.Get("/company", s.manage.GetCompany)
 		manage.Get("/branch/:company", s.manage.GetBranch)
@@ -55,10 +126,48 @@ func (s *Server) Initialize() {
 		manage.Put("/branch/:branch", s.manage.UpdateBranchToCompany)
 		manage.Put("/rename/company/:company", s.manage.UpdateCompanyName)
 		manage.Put("/rename/branch/:branch", s.manage.UpdateBranchName)
-		manage.Delete("/company/:company", s.manage.DeleteCompany)
+		manage.Delete("/company/:company", s.manage.DeleteCompany) // archived, restorable until the retention ends
 		manage.Delete("/company/:company/branch/:branch", s.manage.DeleteBranch)
+		manage.Get("/archives", s.manage.GetArchives)
+		manage.Post("/archives/:id/restore", s.manage.RestoreArchive)
+		manage.Put("/company/:company/metadata", s.manage.UpdateCompanyMetadata) // display name and settings
+		manage.Put("/company/:company/branch/:branch/metadata", s.manage.UpdateBranchMetadata)
+		manage.Put("/company/:company/status", s.tenant.SetCompanyStatus) // active, read_only or suspended
+		manage.Put("/company/:company/branch/:branch/status", s.tenant.SetBranchStatus)
+		manage.Get("/company/:company/policy", s.policy.GetPolicy)
+		manage.Put("/company/:company/policy", s.policy.UpdatePolicy)
+		manage.Get("/company/:company/network", s.networks.GetPolicies) // company-wide and branch policies
+		manage.Put("/company/:company/network", s.networks.SaveCompanyPolicy)
+		manage.Delete("/company/:company/network", s.networks.DeleteCompanyPolicy)
+		manage.Put("/company/:company/branch/:branch/network", s.networks.SaveBranchPolicy)
+		manage.Delete("/company/:company/branch/:branch/network", s.networks.DeleteBranchPolicy)
+		manage.Get("/company/:company/sso", s.sso.GetProvider)
+		manage.Put("/company/:company/sso", s.sso.SaveProvider)
+		manage.Delete("/company/:company/sso", s.sso.DeleteProvider)
+		manage.Get("/oauth/clients", s.oidc.ListClients)
+		manage.Post("/oauth/clients", s.oidc.CreateClient)
+		manage.Delete("/oauth/clients/:client_id", s.oidc.DeleteClient)
+		manage.Post("/impersonate", middleware.RequireUser(), s.imperson.Start) // act as a user, recorded in the audit log
+		manage.Get("/audit", s.imperson.AuditLog)
 	}
 
-	app.Listen(fmt.Sprintf(":%v", viper.GetInt("app.port")))
+	// SCIM 2.0 provisioning for the caller's company, meant for company API keys
+	scim := app.Group("/scim/v2")
+	scim.Use(middleware.JWTAuth(s.tokens, s.apiKeys, s.network), middleware.TenantStatus(s.tenantStatus))
+	{
+		scim.Get("/ServiceProviderConfig", s.scim.ServiceProviderConfig)
+		scim.Get("/Users", middleware.RequirePermission(domain.PermUsersRead), s.scim.ListUsers)
+		scim.Get("/Users/:id", middleware.RequirePermission(domain.PermUsersRead), s.scim.GetUser)
+		scim.Post("/Users", middleware.RequirePermission(domain.PermUsersWrite), s.scim.CreateUser)
+		scim.Put("/Users/:id", middleware.RequirePermission(domain.PermUsersWrite), s.scim.ReplaceUser)
+		scim.Patch("/Users/:id", middleware.RequirePermission(domain.PermUsersWrite), s.scim.PatchUser) // active=false deactivates
+		scim.Delete("/Users/:id", middleware.RequirePermission(domain.PermUsersWrite), middleware.BlockImpersonation(), s.scim.DeleteUser)
+		scim.Get("/Groups", middleware.RequirePermission(domain.PermRolesManage), s.scim.ListGroups)
+		scim.Get("/Groups/:id", middleware.RequirePermission(domain.PermRolesManage), s.scim.GetGroup)
+		scim.Post("/Groups", middleware.RequirePermission(domain.PermRolesManage), s.scim.CreateGroup)
+		scim.Patch("/Groups/:id", middleware.RequirePermission(domain.PermRolesManage), s.scim.PatchGroup)
+		scim.Delete("/Groups/:id", middleware.RequirePermission(domain.PermRolesManage), middleware.BlockImpersonation(), s.scim.DeleteGroup)
+	}
 
+	return app
 }
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"go-multi-tenancy/internals/core/domain"
+	"go-multi-tenancy/internals/core/ports"
+	"go-multi-tenancy/internals/utils"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestMain(m *testing.M) {
+	// Without configured keys InitKeys signs with a temporary Ed25519 key
+	if err := utils.InitKeys(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+// routeHandlers stands in for every handler. Routes the tests do not call
+// fall through to the nil interfaces and panic if reached.
+type routeHandlers struct {
+	ports.CompanyHandler
+	ports.ManageHandler
+	ports.MFAHandler
+	ports.AccountHandler
+	ports.PolicyHandler
+	ports.RoleHandler
+	ports.APIKeyHandler
+	ports.OIDCHandler
+	ports.FederationHandler
+	ports.SCIMHandler
+	ports.ImpersonationHandler
+	ports.SessionHandler
+	ports.NetworkPolicyHandler
+	ports.InvitationHandler
+	ports.BootstrapHandler
+	ports.TenantHandler
+	ports.WellKnownHandler
+}
+
+func ok(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+
+// Start is on both the federation and the impersonation handler.
+func (routeHandlers) Start(c *fiber.Ctx) error        { return ok(c) }
+func (routeHandlers) UpdateData(c *fiber.Ctx) error   { return ok(c) }
+func (routeHandlers) AssignRole(c *fiber.Ctx) error   { return ok(c) }
+func (routeHandlers) UnassignRole(c *fiber.Ctx) error { return ok(c) }
+
+// liveSessions treats every session as valid.
+type liveSessions struct{ ports.TokenService }
+
+func (liveSessions) ValidateSession(sessionID uuid.UUID) error { return nil }
+
+// openNetwork lets every request through.
+type openNetwork struct{ ports.NetworkPolicyService }
+
+func (openNetwork) Check(data *domain.NetworkCheck) error { return nil }
+
+// activeTenants reports every tenant as active.
+type activeTenants struct{ ports.TenantStatusService }
+
+func (activeTenants) Check(company, branch string, write bool) error { return nil }
+
+func newApp() *fiber.App {
+	h := routeHandlers{}
+	return NewServer(h, h, h, h, h, h, h, h, h, h, h, h, h, h, h, h, h, liveSessions{}, nil, openNetwork{}, activeTenants{}).App()
+}
+
+// headAdminToken signs an access token for a head_admin of acme/hq, acting
+// for a super admin when impersonated is set.
+func headAdminToken(t *testing.T, impersonated bool) string {
+	t.Helper()
+
+	claims := &utils.Claims{
+		ID:          "jane",
+		UserID:      uuid.NewString(),
+		SessionID:   uuid.NewString(),
+		Company:     "acme",
+		Branch:      "hq",
+		Role:        domain.RoleHeadAdmin,
+		Permissions: domain.RolePermissions(domain.RoleHeadAdmin),
+	}
+	if impersonated {
+		claims.Actor = &utils.Actor{
+			Subject:   uuid.NewString(),
+			ID:        "root",
+			SessionID: uuid.NewString(),
+			Company:   "acme",
+			Branch:    "hq",
+			Role:      domain.RoleSuperAdmin,
+		}
+	}
+
+	token, err := utils.GenerateJWT(claims, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestImpersonationBlockedOnCredentialRoutes(t *testing.T) {
+	app := newApp()
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{method: fiber.MethodPut, path: "/api/v1/company/data"},
+		{method: fiber.MethodPost, path: "/api/v1/company/roles/" + uuid.NewString() + "/assign"},
+		{method: fiber.MethodPost, path: "/api/v1/company/roles/" + uuid.NewString() + "/unassign"},
+	}
+
+	for _, route := range routes {
+		for _, impersonated := range []bool{false, true} {
+			req := httptest.NewRequest(route.method, route.path, nil)
+			req.Header.Set("Authorization", "Bearer "+headAdminToken(t, impersonated))
+
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := fiber.StatusOK
+			if impersonated {
+				want = fiber.StatusForbidden
+			}
+			if res.StatusCode != want {
+				t.Errorf("%s %s impersonated=%v = %d, want %d", route.method, route.path, impersonated, res.StatusCode, want)
+			}
+		}
+	}
+}
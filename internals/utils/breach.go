@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// BreachList is a set of passwords known from public breaches, kept as SHA-1
+// digests.
+type BreachList struct {
+	digests map[[sha1.Size]byte]struct{}
+}
+
+// LoadBreachList reads a breach list with one entry per line. An entry is
+// either a plain password or the hex SHA-1 of one, optionally followed by
+// ":count" as in the Have I Been Pwned downloads. Empty lines and lines
+// starting with # are skipped. An empty path gives an empty list.
+func LoadBreachList(path string) (*BreachList, error) {
+	list := &BreachList{digests: map[[sha1.Size]byte]struct{}{}}
+	if path == "" {
+		return list, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var digest [sha1.Size]byte
+		hash, _, _ := strings.Cut(line, ":")
+		if decoded, err := hex.DecodeString(hash); err == nil && len(decoded) == sha1.Size {
+			copy(digest[:], decoded)
+		} else {
+			digest = sha1.Sum([]byte(line))
+		}
+		list.digests[digest] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (l *BreachList) Contains(password string) bool {
+	_, ok := l.digests[sha1.Sum([]byte(password))]
+	return ok
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadBreachList(t *testing.T) {
+	sum := sha1.Sum([]byte("letmein"))
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	list := "# top passwords\npassword123\r\n\n" + hex.EncodeToString(sum[:]) + ":4021\n"
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	breaches, err := LoadBreachList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for password, want := range map[string]bool{
+		"password123":     true,
+		"letmein":         true,
+		"# top passwords": false,
+		"":                false,
+		"letmein:4021":    false,
+	} {
+		if got := breaches.Contains(password); got != want {
+			t.Errorf("Contains(%q) = %v, want %v", password, got, want)
+		}
+	}
+}
+
+func TestLoadBreachListWithoutPath(t *testing.T) {
+	breaches, err := LoadBreachList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if breaches.Contains("password123") {
+		t.Error("empty list contains a password")
+	}
+
+	if _, err := LoadBreachList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("missing file loaded")
+	}
+}
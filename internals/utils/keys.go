@@ -0,0 +1,311 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// SigningKey is one key of the signing key set. A key signs new tokens
+// between NotBefore and NotAfter and keeps verifying them for the overlap
+// window after NotAfter, so tokens signed just before a rotation stay valid.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.PrivateKey
+	Public    crypto.PublicKey
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// KeySet holds every configured signing key.
+type KeySet struct {
+	mu      sync.RWMutex
+	keys    []*SigningKey
+	overlap time.Duration
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+type keyConfig struct {
+	Kid            string    `mapstructure:"kid"`
+	Alg            string    `mapstructure:"alg"`
+	PrivateKeyFile string    `mapstructure:"private_key_file"`
+	PrivateKeyEnv  string    `mapstructure:"private_key_env"`
+	NotBefore      time.Time `mapstructure:"not_before"`
+	NotAfter       time.Time `mapstructure:"not_after"`
+}
+
+var keys = &KeySet{}
+
+// InitKeys loads the signing keys configured under jwt.keys. When no key is
+// configured it generates a temporary Ed25519 key so development setups work,
+// but tokens signed with it do not survive a restart.
+func InitKeys() error {
+	loaded, err := loadKeys()
+	if err != nil {
+		return err
+	}
+
+	if len(loaded) == 0 {
+		log.Println("jwt: no signing keys configured, generating a temporary Ed25519 key")
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		loaded = append(loaded, &SigningKey{
+			ID:        fmt.Sprintf("dev-%d", time.Now().Unix()),
+			Algorithm: jwt.SigningMethodEdDSA.Alg(),
+			Private:   private,
+			Public:    public,
+		})
+	}
+
+	keys.replace(loaded, viper.GetDuration("jwt.overlap"))
+	return nil
+}
+
+// WatchKeys reloads the key set every interval so keys added to the
+// configuration or replaced on disk are picked up without a restart.
+func WatchKeys(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			loaded, err := loadKeys()
+			if err != nil {
+				log.Println("jwt: reloading signing keys:", err)
+				continue
+			}
+			if len(loaded) == 0 {
+				continue
+			}
+			keys.replace(loaded, viper.GetDuration("jwt.overlap"))
+		}
+	}()
+}
+
+// JWKS returns the public keys that can currently verify tokens, including
+// keys scheduled for future use so verifiers can cache them ahead of rotation.
+func JWKS() JWKSet {
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+
+	now := time.Now()
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range keys.keys {
+		if !key.NotAfter.IsZero() && now.After(key.NotAfter.Add(keys.overlap)) {
+			continue
+		}
+		jwk, err := key.jwk()
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+// SigningAlgorithms returns the distinct algorithms of the published keys,
+// as advertised in the OpenID discovery document.
+func SigningAlgorithms() []string {
+	algs := []string{}
+	for _, jwk := range JWKS().Keys {
+		found := false
+		for _, alg := range algs {
+			found = found || alg == jwk.Alg
+		}
+		if !found {
+			algs = append(algs, jwk.Alg)
+		}
+	}
+
+	return algs
+}
+
+func (k *KeySet) replace(loaded []*SigningKey, overlap time.Duration) {
+	// Newest keys first so the signer picks the most recent active key
+	sort.SliceStable(loaded, func(i, j int) bool {
+		return loaded[i].NotBefore.After(loaded[j].NotBefore)
+	})
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = loaded
+	k.overlap = overlap
+}
+
+// signer returns the newest key that is inside its signing window.
+func (k *KeySet) signer() (*SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := time.Now()
+	for _, key := range k.keys {
+		if now.Before(key.NotBefore) {
+			continue
+		}
+		if !key.NotAfter.IsZero() && !now.Before(key.NotAfter) {
+			continue
+		}
+		return key, nil
+	}
+
+	return nil, errors.New("jwt: no active signing key")
+}
+
+// verifier returns the key with the given id if it may still verify tokens.
+func (k *KeySet) verifier(kid string) (*SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := time.Now()
+	for _, key := range k.keys {
+		if key.ID != kid {
+			continue
+		}
+		if !key.NotAfter.IsZero() && now.After(key.NotAfter.Add(k.overlap)) {
+			return nil, errors.New("jwt: signing key has been retired")
+		}
+		return key, nil
+	}
+
+	return nil, errors.New("jwt: unknown signing key")
+}
+
+func (key *SigningKey) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(key.Algorithm)
+}
+
+func (key *SigningKey) jwk() (JWK, error) {
+	switch public := key.Public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: key.Algorithm,
+			Kid: key.ID,
+			N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Use: "sig",
+			Alg: key.Algorithm,
+			Kid: key.ID,
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(public),
+		}, nil
+	}
+
+	return JWK{}, fmt.Errorf("jwt: unsupported key type for %s", key.ID)
+}
+
+func loadKeys() ([]*SigningKey, error) {
+	var configs []keyConfig
+	hook := viper.DecodeHook(mapstructure.StringToTimeHookFunc(time.RFC3339))
+	if err := viper.UnmarshalKey("jwt.keys", &configs, hook); err != nil {
+		return nil, err
+	}
+
+	loaded := []*SigningKey{}
+	for _, config := range configs {
+		key, err := loadKey(config)
+		if err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, key)
+	}
+
+	return loaded, nil
+}
+
+func loadKey(config keyConfig) (*SigningKey, error) {
+	if config.Kid == "" {
+		return nil, errors.New("jwt: signing key without kid")
+	}
+
+	// Read the PEM either from a file or from an environment variable
+	var pem []byte
+	switch {
+	case config.PrivateKeyFile != "":
+		data, err := os.ReadFile(config.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		pem = data
+	case config.PrivateKeyEnv != "":
+		pem = []byte(os.Getenv(config.PrivateKeyEnv))
+	}
+	if len(pem) == 0 {
+		return nil, fmt.Errorf("jwt: no private key for %s", config.Kid)
+	}
+
+	key := &SigningKey{
+		ID:        config.Kid,
+		Algorithm: config.Alg,
+		NotBefore: config.NotBefore,
+		NotAfter:  config.NotAfter,
+	}
+
+	switch config.Alg {
+	case jwt.SigningMethodRS256.Alg():
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, err
+		}
+		key.Private = private
+		key.Public = &private.PublicKey
+	case jwt.SigningMethodEdDSA.Alg():
+		private, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, err
+		}
+		edPrivate, ok := private.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("jwt: %s is not an Ed25519 key", config.Kid)
+		}
+		key.Private = edPrivate
+		key.Public = edPrivate.Public()
+	default:
+		return nil, fmt.Errorf("jwt: unsupported algorithm %q for %s", config.Alg, config.Kid)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,266 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/spf13/viper"
+)
+
+// useKeys swaps the package key set for the duration of the test.
+func useKeys(t *testing.T, overlap time.Duration, loaded ...*SigningKey) {
+	t.Helper()
+
+	keys.mu.RLock()
+	previous, previousOverlap := keys.keys, keys.overlap
+	keys.mu.RUnlock()
+	t.Cleanup(func() { keys.replace(previous, previousOverlap) })
+
+	keys.replace(loaded, overlap)
+}
+
+func newEd25519Key(t *testing.T, kid string, notBefore, notAfter time.Time) *SigningKey {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &SigningKey{
+		ID:        kid,
+		Algorithm: jwt.SigningMethodEdDSA.Alg(),
+		Private:   private,
+		Public:    public,
+		NotBefore: notBefore,
+		NotAfter:  notAfter,
+	}
+}
+
+func newRSAKey(t *testing.T, kid string) *SigningKey {
+	t.Helper()
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &SigningKey{
+		ID:        kid,
+		Algorithm: jwt.SigningMethodRS256.Alg(),
+		Private:   private,
+		Public:    &private.PublicKey,
+	}
+}
+
+// signWith signs claims with key regardless of its signing window, like a
+// token issued before the key was rotated out.
+func signWith(t *testing.T, key *SigningKey, claims *Claims) string {
+	t.Helper()
+
+	claims.IssuedAt = time.Now().Unix()
+	claims.ExpiresAt = time.Now().Add(time.Hour).Unix()
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func kidOf(t *testing.T, token string) string {
+	t.Helper()
+
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestSignerPicksNewestActiveKey(t *testing.T) {
+	now := time.Now()
+	retired := newEd25519Key(t, "retired", now.Add(-48*time.Hour), now.Add(-24*time.Hour))
+	current := newEd25519Key(t, "current", now.Add(-24*time.Hour), now.Add(24*time.Hour))
+	older := newEd25519Key(t, "older", now.Add(-72*time.Hour), time.Time{})
+	next := newEd25519Key(t, "next", now.Add(24*time.Hour), time.Time{})
+	useKeys(t, time.Hour, retired, older, next, current)
+
+	token, err := GenerateJWT(&Claims{UserID: "u1"}, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+	if kid := kidOf(t, token); kid != "current" {
+		t.Errorf("signed with %q, want current", kid)
+	}
+
+	claims, err := ParseJWT(token)
+	if err != nil {
+		t.Fatalf("ParseJWT: %v", err)
+	}
+	if claims.UserID != "u1" {
+		t.Errorf("UserID = %q, want u1", claims.UserID)
+	}
+}
+
+func TestSignerWithoutActiveKey(t *testing.T) {
+	now := time.Now()
+	useKeys(t, time.Hour, newEd25519Key(t, "next", now.Add(time.Hour), time.Time{}))
+
+	if _, err := GenerateJWT(&Claims{}, time.Minute); err == nil {
+		t.Fatal("GenerateJWT succeeded without an active key")
+	}
+}
+
+func TestRotatedKeyVerifiesDuringOverlap(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		notAfter time.Time
+		valid    bool
+	}{
+		{name: "still active", notAfter: now.Add(time.Hour), valid: true},
+		{name: "inside overlap", notAfter: now.Add(-30 * time.Minute), valid: true},
+		{name: "after overlap", notAfter: now.Add(-2 * time.Hour), valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := newEd25519Key(t, "old", now.Add(-24*time.Hour), tt.notAfter)
+			useKeys(t, time.Hour, old, newEd25519Key(t, "new", now.Add(-time.Minute), time.Time{}))
+
+			token := signWith(t, old, &Claims{UserID: "u1"})
+			_, err := ParseJWT(token)
+			if tt.valid && err != nil {
+				t.Errorf("ParseJWT: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("token of a retired key was accepted")
+			}
+		})
+	}
+}
+
+func TestParseJWTRefusals(t *testing.T) {
+	key := newEd25519Key(t, "k1", time.Time{}, time.Time{})
+	stranger := newEd25519Key(t, "k1", time.Time{}, time.Time{})
+	useKeys(t, time.Hour, key)
+
+	unknown := newEd25519Key(t, "unknown", time.Time{}, time.Time{})
+
+	// HS256 keyed with the public key is the classic algorithm confusion attack
+	hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{})
+	hmacToken.Header["kid"] = key.ID
+	confused, err := hmacToken.SignedString([]byte(key.Public.(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"unknown kid":         signWith(t, unknown, &Claims{}),
+		"foreign key":         signWith(t, stranger, &Claims{}),
+		"algorithm confusion": confused,
+		"garbage":             "not.a.token",
+	}
+
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseJWT(token); err == nil {
+				t.Error("token was accepted")
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	now := time.Now()
+	ed := newEd25519Key(t, "ed", now.Add(-time.Hour), time.Time{})
+	rs := newRSAKey(t, "rs")
+	next := newEd25519Key(t, "next", now.Add(time.Hour), time.Time{})
+	retired := newEd25519Key(t, "retired", now.Add(-72*time.Hour), now.Add(-48*time.Hour))
+	useKeys(t, time.Hour, ed, rs, next, retired)
+
+	published := map[string]JWK{}
+	for _, jwk := range JWKS().Keys {
+		published[jwk.Kid] = jwk
+	}
+
+	if _, ok := published["retired"]; ok {
+		t.Error("retired key is published")
+	}
+	if _, ok := published["next"]; !ok {
+		t.Error("scheduled key is not published ahead of rotation")
+	}
+
+	got := published["ed"]
+	want := JWK{
+		Kty: "OKP",
+		Use: "sig",
+		Alg: "EdDSA",
+		Kid: "ed",
+		Crv: "Ed25519",
+		X:   base64.RawURLEncoding.EncodeToString(ed.Public.(ed25519.PublicKey)),
+	}
+	if got != want {
+		t.Errorf("Ed25519 JWK = %+v, want %+v", got, want)
+	}
+
+	got = published["rs"]
+	public := rs.Public.(*rsa.PublicKey)
+	n, _ := base64.RawURLEncoding.DecodeString(got.N)
+	e, _ := base64.RawURLEncoding.DecodeString(got.E)
+	if got.Kty != "RSA" || got.Alg != "RS256" || got.Use != "sig" {
+		t.Errorf("RSA JWK = %+v", got)
+	}
+	if new(big.Int).SetBytes(n).Cmp(public.N) != 0 || int(new(big.Int).SetBytes(e).Int64()) != public.E {
+		t.Error("RSA JWK does not round-trip the public key")
+	}
+
+	algs := SigningAlgorithms()
+	if len(algs) != 2 {
+		t.Errorf("SigningAlgorithms = %v, want EdDSA and RS256 once each", algs)
+	}
+}
+
+func TestLoadKeysFromConfig(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_JWT_KEY", string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})))
+
+	viper.Set("jwt.keys", []map[string]interface{}{
+		{"kid": "2026-01", "alg": "EdDSA", "private_key_env": "TEST_JWT_KEY", "not_before": "2026-01-01T00:00:00Z"},
+	})
+	t.Cleanup(func() { viper.Set("jwt.keys", nil) })
+
+	loaded, err := loadKeys()
+	if err != nil {
+		t.Fatalf("loadKeys: %v", err)
+	}
+	if len(loaded) != 1 || loaded[0].ID != "2026-01" || !loaded[0].NotBefore.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("loaded = %+v", loaded)
+	}
+	if !private.Public().(ed25519.PublicKey).Equal(loaded[0].Public) {
+		t.Error("loaded public key does not match the configured private key")
+	}
+
+	viper.Set("jwt.keys", []map[string]interface{}{
+		{"kid": "bad", "alg": "HS256", "private_key_env": "TEST_JWT_KEY"},
+	})
+	if _, err := loadKeys(); err == nil {
+		t.Error("loadKeys accepted an unsupported algorithm")
+	}
+}
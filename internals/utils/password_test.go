@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters keep the tests fast; the format is what matters here.
+var testArgon2 = Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func newTestHasher(t *testing.T, algorithm string) *PasswordHasher {
+	t.Helper()
+
+	h, err := NewPasswordHasher(algorithm, testArgon2, bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func legacyHash(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestNewPasswordHasherRejectsUnknownAlgorithm(t *testing.T) {
+	if _, err := NewPasswordHasher("sha256", testArgon2, bcrypt.MinCost); err == nil {
+		t.Fatal("NewPasswordHasher accepted sha256")
+	}
+}
+
+func TestPasswordHasherRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{PasswordArgon2id, PasswordBcrypt} {
+		t.Run(algorithm, func(t *testing.T) {
+			h := newTestHasher(t, algorithm)
+
+			first, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			second, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if first == second {
+				t.Error("two hashes of the same password are equal, the salt is missing")
+			}
+
+			if ok, err := h.Verify("correct horse", first); !ok || err != nil {
+				t.Errorf("Verify(right password) = %v, %v", ok, err)
+			}
+			if ok, err := h.Verify("wrong horse", first); ok || err != nil {
+				t.Errorf("Verify(wrong password) = %v, %v", ok, err)
+			}
+			if h.NeedsRehash(first) {
+				t.Error("fresh hash needs a rehash")
+			}
+		})
+	}
+}
+
+func TestArgon2HashEncodesParameters(t *testing.T) {
+	encoded, err := newTestHasher(t, PasswordArgon2id).Hash("pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("hash = %q, want the PHC argon2id format", encoded)
+	}
+}
+
+func TestVerifyAcrossAlgorithms(t *testing.T) {
+	argon := newTestHasher(t, PasswordArgon2id)
+	bcryptHasher := newTestHasher(t, PasswordBcrypt)
+
+	argonHash, _ := argon.Hash("pw")
+	bcryptHash, _ := bcryptHasher.Hash("pw")
+
+	// A deployment switching algorithms must still let existing users in
+	tests := map[string]string{
+		"argon2id": argonHash,
+		"bcrypt":   bcryptHash,
+		"legacy":   legacyHash("pw"),
+	}
+	for name, encoded := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, h := range []*PasswordHasher{argon, bcryptHasher} {
+				if ok, err := h.Verify("pw", encoded); !ok || err != nil {
+					t.Errorf("%s hasher: Verify = %v, %v", h.algorithm, ok, err)
+				}
+				if ok, _ := h.Verify("other", encoded); ok {
+					t.Errorf("%s hasher: wrong password accepted", h.algorithm)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyUnknownFormats(t *testing.T) {
+	h := newTestHasher(t, PasswordArgon2id)
+
+	for _, encoded := range []string{"", "pw", "$argon2i$v=19$m=1,t=1,p=1$c2FsdA$a2V5", strings.Repeat("z", 64)} {
+		if ok, _ := h.Verify("pw", encoded); ok {
+			t.Errorf("Verify matched %q", encoded)
+		}
+	}
+
+	// A plaintext password stored by mistake must not work as its own hash
+	if ok, _ := h.Verify(legacyHash("pw"), legacyHash("pw")); ok {
+		t.Error("the stored digest was accepted as the password")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	argon := newTestHasher(t, PasswordArgon2id)
+	bcryptHasher := newTestHasher(t, PasswordBcrypt)
+
+	argonHash, _ := argon.Hash("pw")
+	bcryptHash, _ := bcryptHasher.Hash("pw")
+
+	stronger := testArgon2
+	stronger.Iterations = 2
+	strongerArgon, err := NewPasswordHasher(PasswordArgon2id, stronger, bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	costlierBcrypt, err := NewPasswordHasher(PasswordBcrypt, testArgon2, bcrypt.MinCost+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		hasher  *PasswordHasher
+		encoded string
+		want    bool
+	}{
+		{name: "legacy sha256", hasher: argon, encoded: legacyHash("pw"), want: true},
+		{name: "legacy sha256 under bcrypt", hasher: bcryptHasher, encoded: legacyHash("pw"), want: true},
+		{name: "current argon2id", hasher: argon, encoded: argonHash, want: false},
+		{name: "argon2id with raised iterations", hasher: strongerArgon, encoded: argonHash, want: true},
+		{name: "argon2id after switching to bcrypt", hasher: bcryptHasher, encoded: argonHash, want: true},
+		{name: "current bcrypt", hasher: bcryptHasher, encoded: bcryptHash, want: false},
+		{name: "bcrypt with raised cost", hasher: costlierBcrypt, encoded: bcryptHash, want: true},
+		{name: "bcrypt after switching to argon2id", hasher: argon, encoded: bcryptHash, want: true},
+		{name: "malformed argon2id", hasher: argon, encoded: "$argon2id$broken", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.encoded); got != tt.want {
+				t.Errorf("NeedsRehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
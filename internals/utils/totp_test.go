@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890".
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// The RFC lists 8 digit codes; these are their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+	}
+
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, at)
+		if !ok {
+			t.Errorf("code %s at %d was refused", tt.code, tt.unix)
+			continue
+		}
+		if step != tt.unix/totpPeriod {
+			t.Errorf("code %s at %d matched step %d, want %d", tt.code, tt.unix, step, tt.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPDrift(t *testing.T) {
+	at := time.Unix(1234567890, 0)
+	step := at.Unix() / totpPeriod
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		drift int64
+		valid bool
+	}{
+		{name: "previous period", drift: -1, valid: true},
+		{name: "next period", drift: 1, valid: true},
+		{name: "two periods late", drift: -2, valid: false},
+		{name: "two periods early", drift: 2, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, ok := ValidateTOTP(rfc6238Secret, totpCode(key, step+tt.drift), at)
+			if ok != tt.valid {
+				t.Fatalf("valid = %v, want %v", ok, tt.valid)
+			}
+			if ok && matched != step+tt.drift {
+				t.Errorf("matched step %d, want %d", matched, step+tt.drift)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRefusals(t *testing.T) {
+	at := time.Unix(59, 0)
+
+	tests := map[string]struct {
+		secret string
+		code   string
+	}{
+		"wrong code":     {secret: rfc6238Secret, code: "287083"},
+		"short code":     {secret: rfc6238Secret, code: "28708"},
+		"8 digit code":   {secret: rfc6238Secret, code: "94287082"},
+		"empty code":     {secret: rfc6238Secret, code: ""},
+		"invalid secret": {secret: "not base32!", code: "287082"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(tt.secret, tt.code, at); ok {
+				t.Error("code was accepted")
+			}
+		})
+	}
+
+	// Authenticator apps show secrets in lower case too, and users paste codes with spaces
+	if _, ok := ValidateTOTP(strings.ToLower(rfc6238Secret), " 287082 ", at); !ok {
+		t.Error("lower case secret or padded code was refused")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	first, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first == second {
+		t.Error("two secrets are equal")
+	}
+
+	key, err := totpEncoding.DecodeString(first)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secret %q does not decode to 160 bits: %v", first, err)
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(TOTPProvisioningURI("One System", "alice@acme", rfc6238Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/One System:alice@acme" {
+		t.Errorf("uri = %s", uri)
+	}
+
+	query := uri.Query()
+	want := map[string]string{"secret": rfc6238Secret, "issuer": "One System", "algorithm": "SHA1", "digits": "6", "period": "30"}
+	for key, value := range want {
+		if query.Get(key) != value {
+			t.Errorf("%s = %q, want %q", key, query.Get(key), value)
+		}
+	}
+}
@@ -1,44 +1,62 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 )
 
-var jwtKey = []byte("your_secret_key")
-
 type Claims struct {
-	ID      string `json:"id"`
-	Company string `json:"company"`
-	Branch  string `json:"branch"`
-	Role    string `json:"role"`
+	ID          string   `json:"id"`
+	UserID      string   `json:"uid"`
+	SessionID   string   `json:"sid"`
+	Company     string   `json:"company"`
+	Branch      string   `json:"branch"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"perms,omitempty"`
+	Nonce       string   `json:"nonce,omitempty"` // OpenID Connect ID tokens only
+	Actor       *Actor   `json:"act,omitempty"`   // impersonation tokens only
 	jwt.StandardClaims
 }
 
-// GenerateJWT generates a JWT token with the given user ID, company ID, branch ID, and role.
-// It sets the expiration time to 24 hours from the current time.
+// Actor identifies who is really behind an impersonation token, in the
+// spirit of the act claim of RFC 8693.
+type Actor struct {
+	Subject   string `json:"sub"`
+	ID        string `json:"id"`
+	SessionID string `json:"sid"`
+	Company   string `json:"company"`
+	Branch    string `json:"branch"`
+	Role      string `json:"role"`
+}
+
+// GenerateJWT generates a JWT token from the given claims.
+// It sets the expiration time to ttl from the current time.
 // It returns the generated token as a string and any error encountered.
-func GenerateJWT(id, company, branch, role string) (string, error) {
-	// Set the expiration time to 24 hours from the current time
-	expirationTime := time.Now().Add(24 * time.Hour)
-
-	// Create a Claims object with the given user ID, company ID, branch ID, role, and expiration time
-	claims := &Claims{
-		ID:      id,
-		Company: company,
-		Branch:  branch,
-		Role:    role,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+func GenerateJWT(claims *Claims, ttl time.Duration) (string, error) {
+	// Set the issue and expiration time relative to the current time
+	now := time.Now()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(ttl).Unix()
+
+	// Pick the active signing key from the key set
+	key, err := keys.signer()
+	if err != nil {
+		return "", err
 	}
 
-	// Create a new JWT token with the claims object and the HS256 signing method
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	// Create a new JWT token with the claims object and the key's signing method
+	token := jwt.NewWithClaims(key.method(), claims)
+
+	// Record which key signed the token so verifiers can find it after rotation
+	token.Header["kid"] = key.ID
 
-	// Sign the token with the JWT key and return it as a string
-	return token.SignedString(jwtKey)
+	// Sign the token with the private key and return it as a string
+	return token.SignedString(key.Private)
 }
 
 // ParseJWT parses and validates a JWT token. It returns the claims in the token and any error encountered.
@@ -47,10 +65,7 @@ func ParseJWT(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
 	// Parse the token string into a JWT token, validating its signature and setting the claims
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		// Return the JWT key used to sign the token
-		return jwtKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey)
 
 	// If there was an error parsing or validating the token, return it
 	if err != nil {
@@ -65,3 +80,89 @@ func ParseJWT(tokenString string) (*Claims, error) {
 	// Return the claims in the token
 	return claims, nil
 }
+
+// verificationKey is the jwt.Keyfunc shared by every parser. It returns the
+// public key named by the token's kid header.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	// Look up the key named by the kid header
+	kid, _ := token.Header["kid"].(string)
+	key, err := keys.verifier(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refuse tokens whose algorithm does not match the key, e.g. HS256 signed with a public key
+	if token.Method.Alg() != key.Algorithm {
+		return nil, jwt.ErrSignatureInvalid
+	}
+
+	// Return the public key used to verify the token
+	return key.Public, nil
+}
+
+// GenerateRandomToken returns a URL-safe random string built from n random bytes.
+func GenerateRandomToken(n int) (string, error) {
+	// Read n bytes from the cryptographically secure random source
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	// Encode the bytes so the token can be used in JSON bodies and URLs
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex encoded SHA-256 digest of an opaque token.
+// Tokens are stored hashed so a database leak does not expose usable tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ActionClaims are the claims of short-lived tokens that authorize a single
+// step of a flow, such as completing an MFA login. They are never accepted
+// as access tokens because they carry no session.
+type ActionClaims struct {
+	Purpose string `json:"purpose"`
+	UserID  string `json:"uid"`
+	Company string `json:"company"`
+	Branch  string `json:"branch"`
+	Email   string `json:"email,omitempty"`
+	jwt.StandardClaims
+}
+
+// GenerateActionToken signs claims for the given time to live.
+func GenerateActionToken(claims *ActionClaims, ttl time.Duration) (string, error) {
+	// Set the issue and expiration time relative to the current time
+	now := time.Now()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(ttl).Unix()
+
+	// Pick the active signing key from the key set
+	key, err := keys.signer()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Private)
+}
+
+// ParseActionToken parses an action token and checks that it was issued for purpose.
+func ParseActionToken(tokenString, purpose string) (*ActionClaims, error) {
+	claims := &ActionClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// A token issued for one flow must not be replayed in another
+	if !token.Valid || claims.Purpose != purpose {
+		return nil, jwt.ErrInvalidKey
+	}
+
+	return claims, nil
+}
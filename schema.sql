@@ -0,0 +1,443 @@
+CREATE SCHEMA IF NOT EXISTS company;
+
+-- main table, partitioned by company and then by branch
+CREATE TABLE IF NOT EXISTS company.onesystem (
+	company varchar(255) NOT NULL,
+	branch varchar(255) NOT NULL,
+	id uuid DEFAULT gen_random_uuid(),
+	first_name varchar(255) NOT NULL,
+	last_name varchar(255) NOT NULL,
+	username varchar(255) NOT NULL,
+	password varchar(255) NOT NULL,
+	create_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	update_at TIMESTAMP,
+	delete_at TIMESTAMP,
+	role varchar(255) DEFAULT 'user',
+	PRIMARY KEY (company, branch, id)
+) PARTITION BY LIST (company);
+
+-- one row per login, revoking a session invalidates its access and refresh tokens
+CREATE TABLE IF NOT EXISTS company.sessions (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id uuid NOT NULL,
+	company varchar(255) NOT NULL,
+	branch varchar(255) NOT NULL,
+	username varchar(255) NOT NULL,
+	create_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_idx ON company.sessions (user_id);
+
+-- refresh tokens are stored hashed and rotated on every use
+CREATE TABLE IF NOT EXISTS company.refresh_tokens (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	session_id uuid NOT NULL REFERENCES company.sessions (id) ON DELETE CASCADE,
+	token_hash varchar(64) NOT NULL UNIQUE,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	create_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- per-company security settings
+CREATE TABLE IF NOT EXISTS company.security_policies (
+	company varchar(255) PRIMARY KEY,
+	mfa_required boolean NOT NULL DEFAULT false,
+	update_at TIMESTAMP
+);
+
+-- TOTP secrets, enabled_at is NULL while enrolment is pending
+CREATE TABLE IF NOT EXISTS company.mfa (
+	user_id uuid PRIMARY KEY,
+	company varchar(255) NOT NULL,
+	branch varchar(255) NOT NULL,
+	secret varchar(64) NOT NULL,
+	enabled_at TIMESTAMP,
+	last_used_step bigint NOT NULL DEFAULT 0,
+	create_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS company.mfa_recovery_codes (
+	user_id uuid NOT NULL,
+	code_hash varchar(64) NOT NULL,
+	used_at TIMESTAMP,
+	PRIMARY KEY (user_id, code_hash)
+);
+
+-- onesystem is a view once the accounts migration at the end of this file has run
+DO $$
+BEGIN
+	IF (SELECT relkind FROM pg_class WHERE oid = to_regclass('company.onesystem')) = 'p' THEN
+		ALTER TABLE company.onesystem ADD COLUMN IF NOT EXISTS email varchar(255);
+		ALTER TABLE company.onesystem ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
+	END IF;
+END $$;
+
+-- single-use tokens for password reset and email verification links
+CREATE TABLE IF NOT EXISTS company.action_tokens (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	purpose varchar(64) NOT NULL,
+	user_id uuid NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	create_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- failed login counters per account and per client address
+CREATE TABLE IF NOT EXISTS company.login_attempts (
+	key varchar(1024) PRIMARY KEY,
+	failures integer NOT NULL DEFAULT 0,
+	last_failure_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	locked_until TIMESTAMP
+);
+
+-- roles a company defines on top of the built-in ones, each a bundle of permissions
+CREATE TABLE IF NOT EXISTS company.roles (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	company varchar(255) NOT NULL,
+	name varchar(255) NOT NULL,
+	description text NOT NULL DEFAULT '',
+	permissions text[] NOT NULL DEFAULT '{}',
+	create_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	update_at TIMESTAMP,
+	UNIQUE (company, name)
+);
+
+CREATE TABLE IF NOT EXISTS company.user_roles (
+	user_id uuid NOT NULL,
+	role_id uuid NOT NULL REFERENCES company.roles (id) ON DELETE CASCADE,
+	company varchar(255) NOT NULL,
+	branch varchar(255) NOT NULL,
+	create_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, role_id)
+);
+
+-- keys for machine-to-machine access, stored hashed and looked up by prefix
+CREATE TABLE IF NOT EXISTS company.api_keys (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	company varchar(255) NOT NULL,
+	branch varchar(255) NOT NULL DEFAULT '',
+	name varchar(255) NOT NULL,
+	prefix varchar(32) NOT NULL UNIQUE,
+	key_hash varchar(64) NOT NULL,
+	permissions text[] NOT NULL DEFAULT '{}',
+	created_by uuid NOT NULL,
+	expires_at TIMESTAMP,
+	last_used_at TIMESTAMP,
+	revoked_at TIMESTAMP,
+	create_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_company_idx ON company.api_keys (company);
+
+-- applications signing users in through the OpenID Connect endpoints
+CREATE TABLE IF NOT EXISTS company.oauth_clients (
+	client_id varchar(64) PRIMARY KEY,
+	secret_hash varchar(64),
+	name varchar(255) NOT NULL,
+	redirect_uris text[] NOT NULL DEFAULT '{}',
+	create_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- authorization codes, single use and valid for a minute
+CREATE TABLE IF NOT EXISTS company.oauth_codes (
+	code_hash varchar(64) PRIMARY KEY,
+	client_id varchar(64) NOT NULL REFERENCES company.oauth_clients (client_id) ON DELETE CASCADE,
+	user_id uuid NOT NULL,
+	company varchar(255) NOT NULL,
+	branch varchar(255) NOT NULL,
+	redirect_uri text NOT NULL,
+	scope text NOT NULL DEFAULT '',
+	nonce text NOT NULL DEFAULT '',
+	code_challenge varchar(128) NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	create_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- upstream OpenID Connect issuer per company for federated login
+CREATE TABLE IF NOT EXISTS company.identity_providers (
+	company varchar(255) PRIMARY KEY,
+	issuer text NOT NULL,
+	client_id text NOT NULL,
+	client_secret text NOT NULL DEFAULT '',
+	redirect_uri text NOT NULL,
+	scopes text NOT NULL DEFAULT 'openid profile email',
+	branch_claim varchar(255) NOT NULL DEFAULT '',
+	default_branch varchar(255) NOT NULL DEFAULT '',
+	role_claim varchar(255) NOT NULL DEFAULT '',
+	role_mapping jsonb NOT NULL DEFAULT '{}',
+	default_role varchar(255) NOT NULL DEFAULT 'user',
+	enabled boolean NOT NULL DEFAULT true,
+	update_at TIMESTAMP
+);
+
+-- pending federated logins, consumed by the callback
+CREATE TABLE IF NOT EXISTS company.sso_states (
+	state_hash varchar(64) PRIMARY KEY,
+	company varchar(255) NOT NULL,
+	nonce text NOT NULL,
+	code_verifier text NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS company.federated_identities (
+	company varchar(255) NOT NULL,
+	issuer text NOT NULL,
+	subject text NOT NULL,
+	user_id uuid NOT NULL,
+	branch varchar(255) NOT NULL,
+	create_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (company, issuer, subject)
+);
+
+-- set on sessions started by a super admin impersonating the user
+ALTER TABLE company.sessions ADD COLUMN IF NOT EXISTS actor_id uuid;
+
+-- append-only record of sensitive actions such as impersonation
+CREATE TABLE IF NOT EXISTS company.audit_log (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	action varchar(64) NOT NULL,
+	actor_id uuid NOT NULL,
+	actor_username varchar(255) NOT NULL,
+	actor_company varchar(255) NOT NULL,
+	target_id uuid,
+	target_company varchar(255) NOT NULL DEFAULT '',
+	target_branch varchar(255) NOT NULL DEFAULT '',
+	session_id uuid,
+	reason text NOT NULL DEFAULT '',
+	ip varchar(64) NOT NULL DEFAULT '',
+	create_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_target_idx ON company.audit_log (target_company, create_at);
+
+-- where each session was started from and when it was last used
+ALTER TABLE company.sessions ADD COLUMN IF NOT EXISTS user_agent text NOT NULL DEFAULT '';
+ALTER TABLE company.sessions ADD COLUMN IF NOT EXISTS ip varchar(64) NOT NULL DEFAULT '';
+ALTER TABLE company.sessions ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP;
+
+-- password rules, checked whenever a password is set
+ALTER TABLE company.security_policies ADD COLUMN IF NOT EXISTS password_min_length integer NOT NULL DEFAULT 8;
+ALTER TABLE company.security_policies ADD COLUMN IF NOT EXISTS password_require_upper boolean NOT NULL DEFAULT false;
+ALTER TABLE company.security_policies ADD COLUMN IF NOT EXISTS password_require_lower boolean NOT NULL DEFAULT false;
+ALTER TABLE company.security_policies ADD COLUMN IF NOT EXISTS password_require_digit boolean NOT NULL DEFAULT false;
+ALTER TABLE company.security_policies ADD COLUMN IF NOT EXISTS password_require_symbol boolean NOT NULL DEFAULT false;
+ALTER TABLE company.security_policies ADD COLUMN IF NOT EXISTS password_check_breached boolean NOT NULL DEFAULT true;
+ALTER TABLE company.security_policies ADD COLUMN IF NOT EXISTS password_max_age_days integer NOT NULL DEFAULT 0;
+ALTER TABLE company.security_policies ADD COLUMN IF NOT EXISTS password_history integer NOT NULL DEFAULT 0;
+
+DO $$
+BEGIN
+	IF (SELECT relkind FROM pg_class WHERE oid = to_regclass('company.onesystem')) = 'p' THEN
+		ALTER TABLE company.onesystem ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+	END IF;
+END $$;
+
+-- hashes of the passwords a user has had, newest first, for the history rule
+CREATE TABLE IF NOT EXISTS company.password_history (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id uuid NOT NULL,
+	password_hash varchar(255) NOT NULL,
+	create_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS password_history_user_idx ON company.password_history (user_id, create_at);
+
+-- address allowlists and login hours, branch '' holds the company-wide rules
+CREATE TABLE IF NOT EXISTS company.network_policies (
+	company varchar(255) NOT NULL,
+	branch varchar(255) NOT NULL DEFAULT '',
+	allowed_cidrs text[] NOT NULL DEFAULT '{}',
+	window_start varchar(5) NOT NULL DEFAULT '',
+	window_end varchar(5) NOT NULL DEFAULT '',
+	timezone varchar(64) NOT NULL DEFAULT '',
+	update_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (company, branch)
+);
+
+-- invitations admins send instead of letting anyone register
+CREATE TABLE IF NOT EXISTS company.invitations (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	company varchar(255) NOT NULL,
+	branch varchar(255) NOT NULL,
+	email varchar(255) NOT NULL,
+	role varchar(255) NOT NULL DEFAULT 'user',
+	invited_by uuid NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	accepted_at TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id uuid,
+	create_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS invitations_company_idx ON company.invitations (company);
+
+ALTER TABLE company.security_policies ADD COLUMN IF NOT EXISTS open_registration boolean NOT NULL DEFAULT true;
+
+-- registry of companies and branches, branch '' is the company itself
+CREATE TABLE IF NOT EXISTS company.tenants (
+	id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+	company varchar(255) NOT NULL,
+	branch varchar(255) NOT NULL DEFAULT '',
+	display_name varchar(255) NOT NULL DEFAULT '',
+	status varchar(32) NOT NULL DEFAULT 'active',
+	settings jsonb NOT NULL DEFAULT '{}',
+	create_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	update_at TIMESTAMP,
+	UNIQUE (company, branch)
+);
+
+-- register the partitions that existed before the registry
+INSERT INTO company.tenants (company, branch)
+SELECT substring(pg_get_expr(c.relpartbound, c.oid) FROM $$IN \('(.*)'\)$$), ''
+FROM pg_inherits i
+JOIN pg_class c ON c.oid = i.inhrelid
+WHERE i.inhparent = 'company.onesystem'::regclass
+ON CONFLICT DO NOTHING;
+
+INSERT INTO company.tenants (company, branch)
+SELECT substring(pg_get_expr(p.relpartbound, p.oid) FROM $$IN \('(.*)'\)$$), substring(pg_get_expr(c.relpartbound, c.oid) FROM $$IN \('(.*)'\)$$)
+FROM pg_inherits ci
+JOIN pg_inherits bi ON bi.inhparent = ci.inhrelid
+JOIN pg_class p ON p.oid = ci.inhrelid
+JOIN pg_class c ON c.oid = bi.inhrelid
+WHERE ci.inhparent = 'company.onesystem'::regclass
+ON CONFLICT DO NOTHING;
+
+-- partitions are named after the tenant id (c_<id>, b_<id>), the slugs above
+-- are only their list values; older partitions keep the slug they were created under
+ALTER TABLE company.tenants ADD COLUMN IF NOT EXISTS partition_table varchar(63);
+CREATE UNIQUE INDEX IF NOT EXISTS tenants_partition_table_key ON company.tenants (partition_table);
+
+UPDATE company.tenants t SET partition_table = c.relname
+FROM pg_inherits i
+JOIN pg_class c ON c.oid = i.inhrelid
+WHERE i.inhparent = 'company.onesystem'::regclass
+	AND t.partition_table IS NULL AND t.branch = ''
+	AND t.company = substring(pg_get_expr(c.relpartbound, c.oid) FROM $$IN \('(.*)'\)$$);
+
+UPDATE company.tenants t SET partition_table = c.relname
+FROM pg_inherits ci
+JOIN pg_inherits bi ON bi.inhparent = ci.inhrelid
+JOIN pg_class p ON p.oid = ci.inhrelid
+JOIN pg_class c ON c.oid = bi.inhrelid
+WHERE ci.inhparent = 'company.onesystem'::regclass
+	AND t.partition_table IS NULL AND t.branch <> ''
+	AND t.company = substring(pg_get_expr(p.relpartbound, p.oid) FROM $$IN \('(.*)'\)$$)
+	AND t.branch = substring(pg_get_expr(c.relpartbound, c.oid) FROM $$IN \('(.*)'\)$$);
+
+-- deleted companies and branches are parked here until their retention ends
+CREATE SCHEMA IF NOT EXISTS company_archive;
+
+CREATE TABLE IF NOT EXISTS company.archives (
+	id uuid PRIMARY KEY,
+	company varchar(255) NOT NULL,
+	branch varchar(255) NOT NULL DEFAULT '',
+	table_name varchar(255) NOT NULL,
+	archived_table varchar(255) NOT NULL,
+	bound text NOT NULL,
+	branch_tables text[] NOT NULL DEFAULT '{}',
+	tenants jsonb NOT NULL DEFAULT '[]',
+	archived_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	purge_after TIMESTAMP NOT NULL
+);
+
+-- archives taken before the accounts migration hold the old layout and can only be purged
+ALTER TABLE company.archives ADD COLUMN IF NOT EXISTS legacy boolean NOT NULL DEFAULT false;
+
+-- users are partitioned by the immutable tenant ids, so renaming a company or
+-- branch only touches company.tenants; onesystem becomes a view adding the slugs
+CREATE TABLE IF NOT EXISTS company.accounts (
+	company_id uuid NOT NULL,
+	branch_id uuid NOT NULL,
+	id uuid DEFAULT gen_random_uuid(),
+	first_name varchar(255) NOT NULL,
+	last_name varchar(255) NOT NULL,
+	username varchar(255) NOT NULL,
+	password varchar(255) NOT NULL,
+	create_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	update_at TIMESTAMP,
+	delete_at TIMESTAMP,
+	role varchar(255) DEFAULT 'user',
+	email varchar(255),
+	email_verified_at TIMESTAMP,
+	password_changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (company_id, branch_id, id)
+) PARTITION BY LIST (company_id);
+
+CREATE OR REPLACE FUNCTION company.tenant_id(company_slug text, branch_slug text) RETURNS uuid
+LANGUAGE sql STABLE AS $$
+	SELECT id FROM company.tenants WHERE company = company_slug AND branch = branch_slug
+$$;
+
+-- move the slug-keyed partitions over, once; every partition was registered above
+DO $$
+DECLARE
+	t record;
+	legacy_rows bigint;
+BEGIN
+	IF (SELECT relkind FROM pg_class WHERE oid = to_regclass('company.onesystem')) IS DISTINCT FROM 'p' THEN
+		RETURN;
+	END IF;
+
+	-- park the old tables so their names are free for the generated ones
+	CREATE SCHEMA company_legacy;
+	FOR t IN SELECT relid FROM pg_partition_tree('company.onesystem') WHERE level > 0 LOOP
+		EXECUTE format('ALTER TABLE %s SET SCHEMA company_legacy', t.relid::regclass);
+	END LOOP;
+	ALTER TABLE company.onesystem SET SCHEMA company_legacy;
+
+	FOR t IN SELECT id FROM company.tenants WHERE branch = '' LOOP
+		EXECUTE format('CREATE TABLE company.%I PARTITION OF company.accounts FOR VALUES IN (%L) PARTITION BY LIST (branch_id)',
+			'c_' || replace(t.id::text, '-', ''), t.id);
+		UPDATE company.tenants SET partition_table = 'c_' || replace(t.id::text, '-', '') WHERE id = t.id;
+	END LOOP;
+
+	FOR t IN SELECT b.id, c.partition_table AS parent FROM company.tenants b
+		JOIN company.tenants c ON c.company = b.company AND c.branch = ''
+		WHERE b.branch <> '' LOOP
+		EXECUTE format('CREATE TABLE company.%I PARTITION OF company.%I FOR VALUES IN (%L)',
+			'b_' || replace(t.id::text, '-', ''), t.parent, t.id);
+		UPDATE company.tenants SET partition_table = 'b_' || replace(t.id::text, '-', '') WHERE id = t.id;
+	END LOOP;
+
+	INSERT INTO company.accounts (company_id, branch_id, id, first_name, last_name, username, password, create_at, update_at, delete_at, role, email, email_verified_at, password_changed_at)
+	SELECT c.id, b.id, o.id, o.first_name, o.last_name, o.username, o.password, o.create_at, o.update_at, o.delete_at, o.role, o.email, o.email_verified_at, o.password_changed_at
+	FROM company_legacy.onesystem o
+	JOIN company.tenants c ON c.company = o.company AND c.branch = ''
+	JOIN company.tenants b ON b.company = o.company AND b.branch = o.branch;
+
+	SELECT count(*) INTO legacy_rows FROM company_legacy.onesystem;
+	IF legacy_rows <> (SELECT count(*) FROM company.accounts) THEN
+		RAISE EXCEPTION 'accounts migration: % users have no registered tenant', legacy_rows - (SELECT count(*) FROM company.accounts);
+	END IF;
+
+	DROP SCHEMA company_legacy CASCADE;
+	UPDATE company.archives SET legacy = true;
+END $$;
+
+CREATE OR REPLACE VIEW company.onesystem AS
+SELECT c.company, b.branch, a.id, a.first_name, a.last_name, a.username, a.password, a.create_at, a.update_at, a.delete_at, a.role,
+	a.email, a.email_verified_at, a.password_changed_at, a.company_id, a.branch_id
+FROM company.accounts a
+JOIN company.tenants c ON c.id = a.company_id
+JOIN company.tenants b ON b.id = a.branch_id;
+
+-- wrong MFA codes entered with a login challenge, which is burnt after too many
+ALTER TABLE company.action_tokens ADD COLUMN IF NOT EXISTS failures integer NOT NULL DEFAULT 0;
+
+-- the OAuth client a session was issued to, whose refresh tokens only it can use
+ALTER TABLE company.sessions ADD COLUMN IF NOT EXISTS client_id varchar(64) NOT NULL DEFAULT '';
+
+-- archives are attached again under the tenant id, never under a bound read back
+-- from the catalog, and hold the tenant's rows of the slug-keyed tables meanwhile
+ALTER TABLE company.archives ADD COLUMN IF NOT EXISTS tenant_id uuid;
+ALTER TABLE company.archives ADD COLUMN IF NOT EXISTS side_rows jsonb NOT NULL DEFAULT '{}';
+ALTER TABLE company.archives ALTER COLUMN bound SET DEFAULT '';
+
+UPDATE company.archives a SET tenant_id = (
+	SELECT (t ->> 'id')::uuid FROM jsonb_array_elements(a.tenants) t
+	WHERE t ->> 'company' = a.company AND t ->> 'branch' = a.branch)
+WHERE a.tenant_id IS NULL AND NOT a.legacy;